@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cache forwarded response cache
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// cacheKey responses are cached per question.
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     *dns.Msg
+	expires time.Time
+}
+
+// ResponseCache LRU cache of the forwarded responses, entries expire with the smallest ttl of the answers.
+type ResponseCache struct {
+	size    int
+	mutex   sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// NewResponseCache creates a cache holding up to size responses.
+func NewResponseCache(size int) *ResponseCache {
+	return &ResponseCache{size: size, entries: make(map[cacheKey]*list.Element), lru: list.New()}
+}
+
+// Size maximum number of responses held.
+func (c *ResponseCache) Size() int {
+	if c == nil {
+		return 0
+	}
+
+	return c.size
+}
+
+// Len current number of responses held.
+func (c *ResponseCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.lru.Len()
+}
+
+// Get returns a copy of the cached response to the request, nil if not cached or expired.
+func (c *ResponseCache) Get(req *dns.Msg) *dns.Msg {
+	if c == nil || len(req.Question) == 0 {
+		return nil
+	}
+	key := newCacheKey(&req.Question[0])
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(element)
+
+	rsp := entry.msg.Copy()
+	rsp.Id = req.Id
+	rsp.Question = req.Question
+
+	return rsp
+}
+
+// Set caches the response to the request, responses without answers are not cached.
+func (c *ResponseCache) Set(req *dns.Msg, rsp *dns.Msg) {
+	if c == nil || c.size <= 0 || len(req.Question) == 0 || rsp == nil || len(rsp.Answer) == 0 {
+		return
+	}
+	ttl := rsp.Answer[0].Header().Ttl
+	for _, rr := range rsp.Answer {
+		if rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	if ttl == 0 {
+		return
+	}
+	key := newCacheKey(&req.Question[0])
+	entry := &cacheEntry{key: key, msg: rsp.Copy(), expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func newCacheKey(question *dns.Question) cacheKey {
+	return cacheKey{name: strings.ToLower(question.Name), qtype: question.Qtype, qclass: question.Qclass}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+const errorInCache = "Error in cache"
+
+func newQuery(name string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeA)
+
+	return req
+}
+
+func newAnswer(req *dns.Msg, ttl uint32) *dns.Msg {
+	rsp := new(dns.Msg)
+	rsp.SetReply(req)
+	rsp.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA,
+		Class: dns.ClassINET, Ttl: ttl}, A: net.ParseIP("10.1.1.1")}}
+
+	return rsp
+}
+
+func TestResponseCache(t *testing.T) {
+	t.Run("GetSet", func(t *testing.T) {
+		c := NewResponseCache(2)
+		req := newQuery("www.example.com.")
+		assert.Nil(t, c.Get(req), errorInCache)
+
+		c.Set(req, newAnswer(req, 30))
+		again := newQuery("WWW.example.com.")
+		rsp := c.Get(again)
+		assert.NotNil(t, rsp, errorInCache)
+		assert.Equal(t, again.Id, rsp.Id, errorInCache)
+		assert.Equal(t, "WWW.example.com.", rsp.Question[0].Name, errorInCache)
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		c := NewResponseCache(2)
+		for _, name := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+			req := newQuery(name)
+			c.Set(req, newAnswer(req, 30))
+		}
+		assert.Equal(t, 2, c.Len(), errorInCache)
+		assert.Nil(t, c.Get(newQuery("a.example.com.")), errorInCache)
+		assert.NotNil(t, c.Get(newQuery("c.example.com.")), errorInCache)
+	})
+
+	t.Run("NotCached", func(t *testing.T) {
+		c := NewResponseCache(2)
+		req := newQuery("www.example.com.")
+		c.Set(req, newAnswer(req, 0))
+		empty := new(dns.Msg)
+		empty.SetReply(req)
+		c.Set(req, empty)
+		assert.Equal(t, 0, c.Len(), errorInCache)
+
+		var nilCache *ResponseCache
+		nilCache.Set(req, newAnswer(req, 30))
+		assert.Nil(t, nilCache.Get(req), errorInCache)
+		assert.Equal(t, 0, nilCache.Size(), errorInCache)
+	})
+}
@@ -61,9 +61,54 @@ var rrClassMap = map[string]uint16{"IN": dns.ClassINET, "CS": dns.ClassCSNET, "C
 	"HS": dns.ClassHESIOD, "*": dns.ClassANY}
 
 type BoltDB struct {
-	FileName string
-	TTL      uint32
-	db       *bolt.DB
+	FileName     string
+	TTL          uint32
+	ReverseZones ReverseZones
+	db           *bolt.DB
+}
+
+// boltZoneAccessor zone entries access within a bolt db transaction.
+type boltZoneAccessor struct {
+	tx *bolt.Tx
+}
+
+func (a *boltZoneAccessor) get(zone string, key DNSConfigRRKey) ([]byte, error) {
+	zoneBkt := a.tx.Bucket([]byte(ZoneConfig)).Bucket([]byte(zone))
+	if zoneBkt == nil {
+		return nil, nil
+	}
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("internal error, could not parse dns config json")
+	}
+
+	return zoneBkt.Get(keyBytes), nil
+}
+
+func (a *boltZoneAccessor) put(zone string, key DNSConfigRRKey, value []byte) error {
+	zoneBkt, err := a.tx.Bucket([]byte(ZoneConfig)).CreateBucketIfNotExists([]byte(zone))
+	if err != nil {
+		return fmt.Errorf("zone(%s) retrieval failed", zone)
+	}
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("internal error, could not parse dns config json")
+	}
+
+	return zoneBkt.Put(keyBytes, value)
+}
+
+func (a *boltZoneAccessor) delete(zone string, key DNSConfigRRKey) error {
+	zoneBkt := a.tx.Bucket([]byte(ZoneConfig)).Bucket([]byte(zone))
+	if zoneBkt == nil {
+		return nil
+	}
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("internal error, could not parse dns config json")
+	}
+
+	return zoneBkt.Delete(keyBytes)
 }
 
 func (b *BoltDB) Open() error {
@@ -117,7 +162,8 @@ func (b *BoltDB) Close() error {
 	return nil
 }
 
-func (b *BoltDB) setOrCreateDBEntryGeneration(confValueBytes []byte, rr *ResourceRecord) ([]byte, error) {
+// setOrCreateDBEntryGeneration merges the input record into the stored value(if any) and returns the encoded value.
+func setOrCreateDBEntryGeneration(confValueBytes []byte, rr *ResourceRecord) ([]byte, error) {
 	var err error
 	dnsCfgValue := &DNSConfigRRValue{}
 
@@ -177,21 +223,33 @@ func (b *BoltDB) SetResourceRecord(zone string, rr *ResourceRecord) error {
 			return fmt.Errorf("zone(%s) retrieval failed", zone)
 		}
 		confValueBytes := zoneBkt.Get(confKeyBytes)
-		updatedConfValueBytes, err := b.setOrCreateDBEntryGeneration(confValueBytes, rr)
+		updatedConfValueBytes, err := setOrCreateDBEntryGeneration(confValueBytes, rr)
 		if err != nil {
 			return err
 		}
+		// Copy, as the value is not valid any more once the bucket is modified
+		oldConfValueBytes := append([]byte(nil), confValueBytes...)
 		if err = zoneBkt.Put(confKeyBytes, updatedConfValueBytes); err != nil {
 			return fmt.Errorf("saving dns entry to data store failed")
 		}
 
+		// Maintain the PTR records in the same transaction
+		if err = updateReverseRecords(&boltZoneAccessor{tx: tx}, host, oldConfValueBytes,
+			b.ReverseZones.target(zone, updatedConfValueBytes)); err != nil {
+			return fmt.Errorf("saving reverse dns entry to data store failed")
+		}
+
 		return nil
 	})
 }
 
 func (b *BoltDB) getRRFromZoneBucket(zoneBkt *bolt.Bucket, dnsCfgKeyBytes []byte, question *dns.Question) []dns.RR {
+	return generateRRFromConfig(zoneBkt.Get(dnsCfgKeyBytes), question)
+}
+
+// generateRRFromConfig builds the answer records for the question from an encoded rr config value.
+func generateRRFromConfig(dnsCfgBytes []byte, question *dns.Question) []dns.RR {
 	var records []dns.RR
-	dnsCfgBytes := zoneBkt.Get(dnsCfgKeyBytes)
 	if dnsCfgBytes == nil {
 		return records
 	}
@@ -210,25 +268,21 @@ func (b *BoltDB) getRRFromZoneBucket(zoneBkt *bolt.Bucket, dnsCfgKeyBytes []byte
 		} else if question.Qtype == dns.TypeAAAA {
 			records = append(records, &dns.AAAA{Hdr: dns.RR_Header{Name: question.Name, Rrtype: question.Qtype,
 				Class: dns.ClassINET, Ttl: dnsCfg.TTL}, AAAA: net.ParseIP(pointToIP)})
+		} else if question.Qtype == dns.TypePTR {
+			records = append(records, &dns.PTR{Hdr: dns.RR_Header{Name: question.Name, Rrtype: question.Qtype,
+				Class: dns.ClassINET, Ttl: dnsCfg.TTL}, Ptr: pointToIP})
 		}
 	}
 
 	return records
 }
 
-func (b *BoltDB) GetResourceRecord(question *dns.Question) (*[]dns.RR, error) {
-	q := strings.ToLower(question.Name)
+// getQuestionZones returns all the zones the question name could belong to, including the default zone.
+func getQuestionZones(q string) map[string]bool {
 	var (
 		off int
 		end bool
 	)
-
-	dnsCfgKey := DNSConfigRRKey{Host: q, RRType: question.Qtype}
-	dnsCfgKeyBytes, err := json.Marshal(dnsCfgKey)
-	if err != nil {
-		return nil, fmt.Errorf("parsing dns query failed")
-	}
-
 	zones := make(map[string]bool)
 	// Get a  zone entries from the input question
 	for {
@@ -238,7 +292,21 @@ func (b *BoltDB) GetResourceRecord(question *dns.Question) (*[]dns.RR, error) {
 			break
 		}
 	}
-	zones["."] = true // Add the default zone at end to process
+	zones[DefaultZone] = true // Add the default zone at end to process
+
+	return zones
+}
+
+func (b *BoltDB) GetResourceRecord(question *dns.Question) (*[]dns.RR, error) {
+	q := strings.ToLower(question.Name)
+
+	dnsCfgKey := DNSConfigRRKey{Host: q, RRType: question.Qtype}
+	dnsCfgKeyBytes, err := json.Marshal(dnsCfgKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dns query failed")
+	}
+
+	zones := getQuestionZones(q)
 
 	var records []dns.RR
 
@@ -284,6 +352,7 @@ func (b *BoltDB) DelResourceRecord(zone string, host string, rrtypestr string) e
 
 	err = b.db.Update(func(tx *bolt.Tx) error {
 		var zoneBkt *bolt.Bucket
+		var oldConfValueBytes []byte
 		err := tx.Bucket([]byte(ZoneConfig)).ForEach(func(zone, _ []byte) error {
 			if found {
 				return nil
@@ -293,14 +362,20 @@ func (b *BoltDB) DelResourceRecord(zone string, host string, rrtypestr string) e
 				// Zone not available in the db
 				return fmt.Errorf("failed to read the zone entry")
 			}
-			if zoneBkt.Get(dnsCfgKeyBytes) != nil {
+			if confValueBytes := zoneBkt.Get(dnsCfgKeyBytes); confValueBytes != nil {
 				found = true
+				oldConfValueBytes = append([]byte(nil), confValueBytes...)
 
 				return zoneBkt.Delete(dnsCfgKeyBytes)
 			}
 			return nil
 		})
-		return err
+		if err != nil || !found {
+			return err
+		}
+
+		// Remove the PTR records in the same transaction
+		return updateReverseRecords(&boltZoneAccessor{tx: tx}, dnsCfgKey.Host, oldConfValueBytes, nil)
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete dns entry")
@@ -0,0 +1,412 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package datastore
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// DefaultEtcdPrefix key prefix under which the dns records are stored in etcd.
+	DefaultEtcdPrefix = "/edgegallery/dns-server/rr/"
+	// etcdRequestTimeout timeout for a single etcd request.
+	etcdRequestTimeout = 5 * time.Second
+	// etcdCasRetryCount max retry count on concurrent modification of the same record.
+	etcdCasRetryCount = 3
+	// etcdRewatchInterval wait time before re-establishing a broken watch.
+	etcdRewatchInterval = time.Second
+)
+
+// etcdRRKey etcd record key, the zone is part of the key so that the same host can be stored in different zones.
+type etcdRRKey struct {
+	Zone   string `json:"zone"`
+	Host   string `json:"host"`
+	RRType uint16 `json:"rrType"`
+}
+
+// etcdZoneAccessor zone entries access, reads are served from etcd recording the key revisions and the writes are
+// collected to be committed in one transaction.
+type etcdZoneAccessor struct {
+	store     *EtcdDB
+	ctx       context.Context
+	revisions map[string]int64
+	ops       []clientv3.Op
+}
+
+func (a *etcdZoneAccessor) get(zone string, key DNSConfigRRKey) ([]byte, error) {
+	etcdKey, err := a.store.encodeKey(&etcdRRKey{Zone: zone, Host: key.Host, RRType: key.RRType})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.store.client.Get(a.ctx, etcdKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		a.revisions[etcdKey] = 0
+		return nil, nil
+	}
+	a.revisions[etcdKey] = resp.Kvs[0].ModRevision
+
+	return resp.Kvs[0].Value, nil
+}
+
+func (a *etcdZoneAccessor) put(zone string, key DNSConfigRRKey, value []byte) error {
+	etcdKey, err := a.store.encodeKey(&etcdRRKey{Zone: zone, Host: key.Host, RRType: key.RRType})
+	if err != nil {
+		return err
+	}
+	a.ops = append(a.ops, clientv3.OpPut(etcdKey, string(value)))
+
+	return nil
+}
+
+func (a *etcdZoneAccessor) delete(zone string, key DNSConfigRRKey) error {
+	etcdKey, err := a.store.encodeKey(&etcdRRKey{Zone: zone, Host: key.Host, RRType: key.RRType})
+	if err != nil {
+		return err
+	}
+	a.ops = append(a.ops, clientv3.OpDelete(etcdKey))
+
+	return nil
+}
+
+// commit applies all the collected writes if none of the read keys were modified since read.
+func (a *etcdZoneAccessor) commit() (bool, error) {
+	cmps := make([]clientv3.Cmp, 0, len(a.revisions))
+	for key, revision := range a.revisions {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(key), "=", revision))
+	}
+	resp, err := a.store.client.Txn(a.ctx).If(cmps...).Then(a.ops...).Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Succeeded, nil
+}
+
+// EtcdDB etcd backed data store, records are shared across all the dns-server replicas connected to the same etcd
+// cluster. Queries are answered from a local cache which is kept up to date by watching the record prefix.
+type EtcdDB struct {
+	Endpoints    []string
+	Prefix       string
+	TTL          uint32
+	DialTimeout  time.Duration
+	ReverseZones ReverseZones
+	client       *clientv3.Client
+	cache        *MemoryDB
+	cancel       context.CancelFunc
+	watchDone    chan struct{}
+}
+
+func (e *EtcdDB) Open() error {
+	if len(e.Prefix) == 0 {
+		e.Prefix = DefaultEtcdPrefix
+	}
+	if e.DialTimeout == 0 {
+		e.DialTimeout = etcdRequestTimeout
+	}
+
+	var err error
+	e.client, err = clientv3.New(clientv3.Config{Endpoints: e.Endpoints, DialTimeout: e.DialTimeout})
+	if err != nil {
+		log.Errorf("Failed to connect to etcd(%s).", strings.Join(e.Endpoints, ","))
+		return err
+	}
+
+	e.cache = &MemoryDB{TTL: e.TTL}
+	_ = e.cache.Open()
+	revision, err := e.loadCache()
+	if err != nil {
+		_ = e.client.Close()
+		return err
+	}
+
+	var ctx context.Context
+	ctx, e.cancel = context.WithCancel(context.Background())
+	e.watchDone = make(chan struct{})
+	go e.watch(ctx, revision)
+
+	log.Debugf("Initialize etcd db(%s) success.", e.Prefix)
+
+	return nil
+}
+
+func (e *EtcdDB) Close() error {
+	if e.cancel != nil {
+		e.cancel()
+		<-e.watchDone
+	}
+	if e.client != nil {
+		err := e.client.Close()
+		if err != nil {
+			log.Errorf("Failed to close the etcd db(%s).", e.Prefix)
+
+			return err
+		}
+	}
+	if e.cache != nil {
+		_ = e.cache.Close()
+	}
+	log.Debugf("Closed etcd db(%s) as part of shutdown service.", e.Prefix)
+
+	return nil
+}
+
+func (e *EtcdDB) SetResourceRecord(zone string, rr *ResourceRecord) error {
+	rrType, ok := rrTypeMap[rr.Type]
+	if !ok {
+		return fmt.Errorf("unsupported rrtype(%s) entry", rr.Type)
+	}
+	if rr.TTL == 0 {
+		log.Error("DNS TTL value 0 is not supported.", nil)
+		return fmt.Errorf("unsupported/missing ttl value")
+	}
+
+	dnsCfgKey := DNSConfigRRKey{Host: strings.ToLower(rr.Name), RRType: rrType}
+
+	return e.updateWithRetry(func(staged *stagedZoneAccessor) error {
+		confValueBytes, err := staged.get(zone, dnsCfgKey)
+		if err != nil {
+			return fmt.Errorf("reading dns entry from data store failed")
+		}
+		updatedConfValueBytes, err := setOrCreateDBEntryGeneration(confValueBytes, rr)
+		if err != nil {
+			return err
+		}
+		_ = staged.put(zone, dnsCfgKey, updatedConfValueBytes)
+		if err = updateReverseRecords(staged, dnsCfgKey.Host, confValueBytes,
+			e.ReverseZones.target(zone, updatedConfValueBytes)); err != nil {
+			return fmt.Errorf("saving reverse dns entry to data store failed")
+		}
+
+		return nil
+	}, "saving dns entry to data store failed")
+}
+
+func (e *EtcdDB) GetResourceRecord(question *dns.Question) (*[]dns.RR, error) {
+	return e.cache.GetResourceRecord(question)
+}
+
+func (e *EtcdDB) DelResourceRecord(zone string, host string, rrtypestr string) error {
+	rrType, ok := rrTypeMap[rrtypestr]
+	if !ok {
+		return fmt.Errorf("unsupported rrtype(%s) entry", rrtypestr)
+	}
+
+	dnsCfgKey := DNSConfigRRKey{Host: strings.ToLower(host), RRType: rrType}
+	key, err := e.findKey(dnsCfgKey.Host, rrType)
+	if err != nil {
+		return fmt.Errorf("failed to delete dns entry")
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("not found for the zone %v", zone)
+	}
+	rrKey, err := e.decodeKey([]byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to delete dns entry")
+	}
+
+	return e.updateWithRetry(func(staged *stagedZoneAccessor) error {
+		confValueBytes, err := staged.get(rrKey.Zone, dnsCfgKey)
+		if err != nil || confValueBytes == nil {
+			return fmt.Errorf("failed to delete dns entry")
+		}
+		_ = staged.delete(rrKey.Zone, dnsCfgKey)
+
+		return updateReverseRecords(staged, dnsCfgKey.Host, confValueBytes, nil)
+	}, "failed to delete dns entry")
+}
+
+// updateWithRetry stages the changes done by the update function and commits them in a single etcd transaction,
+// guarded by the revisions of all the keys read. Retried if another replica modified any of them meanwhile.
+func (e *EtcdDB) updateWithRetry(update func(staged *stagedZoneAccessor) error, errMsg string) error {
+	for i := 0; i < etcdCasRetryCount; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+		acc := &etcdZoneAccessor{store: e, ctx: ctx, revisions: make(map[string]int64)}
+		staged := newStagedZoneAccessor(acc)
+		if err := update(staged); err != nil {
+			cancel()
+			return err
+		}
+		if err := staged.apply(); err != nil {
+			cancel()
+			return errors.New(errMsg)
+		}
+		succeeded, err := acc.commit()
+		cancel()
+		if err != nil {
+			return errors.New(errMsg)
+		}
+		if succeeded {
+			return nil
+		}
+		log.Debugf("Concurrent modification of dns entries, retrying.")
+	}
+
+	return errors.New(errMsg)
+}
+
+func (e *EtcdDB) IsResourceRecordExists(zone string, rr *ResourceRecord) bool {
+	rrType, ok := rrTypeMap[rr.Type]
+	if !ok {
+		log.Error("Unsupported rrtype entry", nil)
+		return false
+	}
+	if rr.TTL == 0 {
+		log.Error("DNS TTL value 0 is not supported.", nil)
+		return false
+	}
+
+	key, err := e.findKey(strings.ToLower(rr.Name), rrType)
+	if err != nil || len(key) == 0 {
+		log.Infof("Record not found for the zone %s", zone)
+		return false
+	}
+
+	return true
+}
+
+// findKey looks up the etcd key of the host and type in any of the zones, empty if not found.
+func (e *EtcdDB) findKey(host string, rrType uint16) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	resp, err := e.client.Get(ctx, e.Prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		log.Errorf("Failed to read the dns entries from etcd.")
+		return "", err
+	}
+	for _, kv := range resp.Kvs {
+		rrKey, err := e.decodeKey(kv.Key)
+		if err != nil {
+			continue
+		}
+		if rrKey.Host == host && rrKey.RRType == rrType {
+			return string(kv.Key), nil
+		}
+	}
+
+	return "", nil
+}
+
+// loadCache fills the local cache with all the records and returns the revision the snapshot was taken at.
+func (e *EtcdDB) loadCache() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	resp, err := e.client.Get(ctx, e.Prefix, clientv3.WithPrefix())
+	if err != nil {
+		log.Errorf("Failed to load the dns entries from etcd.")
+		return 0, err
+	}
+
+	zones := map[string]map[DNSConfigRRKey][]byte{DefaultZone: {}}
+	for _, kv := range resp.Kvs {
+		rrKey, err := e.decodeKey(kv.Key)
+		if err != nil {
+			log.Warnf("Skipping invalid dns entry key in etcd.")
+			continue
+		}
+		if _, ok := zones[rrKey.Zone]; !ok {
+			zones[rrKey.Zone] = make(map[DNSConfigRRKey][]byte)
+		}
+		zones[rrKey.Zone][DNSConfigRRKey{Host: rrKey.Host, RRType: rrKey.RRType}] = kv.Value
+	}
+	e.cache.mutex.Lock()
+	e.cache.zones = zones
+	e.cache.mutex.Unlock()
+
+	return resp.Header.Revision, nil
+}
+
+// watch keeps the local cache in sync with etcd, reloads the complete cache if the watch is lost or compacted.
+func (e *EtcdDB) watch(ctx context.Context, revision int64) {
+	defer close(e.watchDone)
+	for {
+		watchChan := e.client.Watch(clientv3.WithRequireLeader(ctx), e.Prefix, clientv3.WithPrefix(),
+			clientv3.WithRev(revision+1))
+		for resp := range watchChan {
+			if resp.Err() != nil {
+				log.Warnf("Dns entry watch interrupted(%s).", resp.Err().Error())
+				break
+			}
+			for _, event := range resp.Events {
+				e.applyEvent(event)
+			}
+			revision = resp.Header.Revision
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(etcdRewatchInterval):
+		}
+		// Events might have been missed, start over from a fresh snapshot
+		newRevision, err := e.loadCache()
+		if err != nil {
+			continue
+		}
+		revision = newRevision
+	}
+}
+
+// applyEvent updates the local cache from a single watch event.
+func (e *EtcdDB) applyEvent(event *clientv3.Event) {
+	rrKey, err := e.decodeKey(event.Kv.Key)
+	if err != nil {
+		log.Warnf("Skipping invalid dns entry key in etcd.")
+		return
+	}
+	dnsCfgKey := DNSConfigRRKey{Host: rrKey.Host, RRType: rrKey.RRType}
+	switch event.Type {
+	case mvccpb.PUT:
+		e.cache.putEntry(rrKey.Zone, dnsCfgKey, event.Kv.Value)
+	case mvccpb.DELETE:
+		e.cache.deleteEntry(rrKey.Zone, dnsCfgKey)
+	}
+}
+
+func (e *EtcdDB) encodeKey(rrKey *etcdRRKey) (string, error) {
+	keyBytes, err := json.Marshal(rrKey)
+	if err != nil {
+		return "", err
+	}
+
+	return e.Prefix + string(keyBytes), nil
+}
+
+func (e *EtcdDB) decodeKey(key []byte) (*etcdRRKey, error) {
+	keyStr := string(key)
+	if !strings.HasPrefix(keyStr, e.Prefix) {
+		return nil, fmt.Errorf("key not under the prefix")
+	}
+	rrKey := &etcdRRKey{}
+	if err := json.Unmarshal([]byte(keyStr[len(e.Prefix):]), rrKey); err != nil {
+		return nil, err
+	}
+
+	return rrKey, nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package datastore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestEtcdKeyEncoding(t *testing.T) {
+	store := &EtcdDB{Prefix: DefaultEtcdPrefix}
+
+	key, err := store.encodeKey(&etcdRRKey{Zone: "example.com.", Host: exampleAbcDomain, RRType: dns.TypeA})
+	assert.Equal(t, nil, err, "Error in encoding the key")
+
+	rrKey, err := store.decodeKey([]byte(key))
+	assert.Equal(t, nil, err, "Error in decoding the key")
+	assert.Equal(t, etcdRRKey{Zone: "example.com.", Host: exampleAbcDomain, RRType: dns.TypeA}, *rrKey)
+
+	_, err = store.decodeKey([]byte("/other/prefix"))
+	assert.NotEqual(t, nil, err, "Error expected for foreign key")
+}
+
+func TestEtcdCacheWatchEvents(t *testing.T) {
+	store := &EtcdDB{Prefix: DefaultEtcdPrefix, cache: &MemoryDB{TTL: 30}}
+	_ = store.cache.Open()
+
+	key, _ := store.encodeKey(&etcdRRKey{Zone: DefaultZone, Host: exampleDomain, RRType: dns.TypeA})
+	value, err := setOrCreateDBEntryGeneration(nil, &ResourceRecord{Name: exampleDomain, Type: "A", Class: "IN",
+		TTL: 30, RData: []string{dnsConfigTestIP1}})
+	assert.Equal(t, nil, err, "Error in generating the value")
+	question := &dns.Question{Name: exampleDomain, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	store.applyEvent(&clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key), Value: value}})
+	rrResponse, err := store.GetResourceRecord(question)
+	assert.Equal(t, nil, err, "Error in reading the record")
+	assert.Equal(t, fmt.Sprintf(exampleRspFormatter, dnsConfigTestIP1), (*rrResponse)[0].String(), "Error")
+
+	store.applyEvent(&clientv3.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(key)}})
+	_, err = store.GetResourceRecord(question)
+	assert.EqualError(t, err, "could not process/retrieve the query", "Record not invalidated")
+
+	store.applyEvent(&clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("invalid"), Value: value}})
+	_, err = store.GetResourceRecord(question)
+	assert.NotEqual(t, nil, err, "Invalid key must be ignored")
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package datastore
+package datastore
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// MemoryDB in-memory data store, records are lost on restart. Used for tests and ephemeral deployments, and as the
+// local cache of the etcd data store.
+type MemoryDB struct {
+	TTL          uint32
+	ReverseZones ReverseZones
+	mutex        sync.RWMutex
+	zones        map[string]map[DNSConfigRRKey][]byte
+}
+
+// memoryZoneAccessor zone entries access, the caller holds the write lock.
+type memoryZoneAccessor struct {
+	zones map[string]map[DNSConfigRRKey][]byte
+}
+
+func (a *memoryZoneAccessor) get(zone string, key DNSConfigRRKey) ([]byte, error) {
+	return a.zones[zone][key], nil
+}
+
+func (a *memoryZoneAccessor) put(zone string, key DNSConfigRRKey, value []byte) error {
+	zoneEntries, ok := a.zones[zone]
+	if !ok {
+		zoneEntries = make(map[DNSConfigRRKey][]byte)
+		a.zones[zone] = zoneEntries
+	}
+	zoneEntries[key] = value
+
+	return nil
+}
+
+func (a *memoryZoneAccessor) delete(zone string, key DNSConfigRRKey) error {
+	if zoneEntries, ok := a.zones[zone]; ok {
+		delete(zoneEntries, key)
+	}
+
+	return nil
+}
+
+func (m *MemoryDB) Open() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.zones = map[string]map[DNSConfigRRKey][]byte{DefaultZone: {}}
+	log.Debugf("Initialize in-memory db success.")
+
+	return nil
+}
+
+func (m *MemoryDB) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.zones = nil
+	log.Debugf("Closed in-memory db as part of shutdown service.")
+
+	return nil
+}
+
+func (m *MemoryDB) SetResourceRecord(zone string, rr *ResourceRecord) error {
+	rrType, ok := rrTypeMap[rr.Type]
+	if !ok {
+		return fmt.Errorf("unsupported rrtype(%s) entry", rr.Type)
+	}
+	if rr.TTL == 0 {
+		log.Error("DNS TTL value 0 is not supported.", nil)
+		return fmt.Errorf("unsupported/missing ttl value")
+	}
+
+	dnsCfgKey := DNSConfigRRKey{Host: strings.ToLower(rr.Name), RRType: rrType}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.zones == nil {
+		return fmt.Errorf("data store is not opened")
+	}
+	acc := &memoryZoneAccessor{zones: m.zones}
+	confValueBytes, _ := acc.get(zone, dnsCfgKey)
+	updatedConfValueBytes, err := setOrCreateDBEntryGeneration(confValueBytes, rr)
+	if err != nil {
+		return err
+	}
+	// Stage all the changes so that a failure leaves the store untouched
+	staged := newStagedZoneAccessor(acc)
+	_ = staged.put(zone, dnsCfgKey, updatedConfValueBytes)
+	if err = updateReverseRecords(staged, dnsCfgKey.Host, confValueBytes,
+		m.ReverseZones.target(zone, updatedConfValueBytes)); err != nil {
+		return fmt.Errorf("saving reverse dns entry to data store failed")
+	}
+
+	return staged.apply()
+}
+
+func (m *MemoryDB) GetResourceRecord(question *dns.Question) (*[]dns.RR, error) {
+	dnsCfgKey := DNSConfigRRKey{Host: strings.ToLower(question.Name), RRType: question.Qtype}
+
+	var records []dns.RR
+
+	m.mutex.RLock()
+	for zone := range getQuestionZones(dnsCfgKey.Host) {
+		zoneEntries, ok := m.zones[zone]
+		if !ok {
+			// Zone not available in the db
+			continue
+		}
+		records = generateRRFromConfig(zoneEntries[dnsCfgKey], question)
+		if len(records) != 0 {
+			break
+		}
+	}
+	m.mutex.RUnlock()
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("could not process/retrieve the query")
+	}
+
+	return &records, nil
+}
+
+func (m *MemoryDB) DelResourceRecord(zone string, host string, rrtypestr string) error {
+	rrType, ok := rrTypeMap[rrtypestr]
+	if !ok {
+		return fmt.Errorf("unsupported rrtype(%s) entry", rrtypestr)
+	}
+	dnsCfgKey := DNSConfigRRKey{Host: strings.ToLower(host), RRType: rrType}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for entryZone, zoneEntries := range m.zones {
+		confValueBytes, found := zoneEntries[dnsCfgKey]
+		if !found {
+			continue
+		}
+		staged := newStagedZoneAccessor(&memoryZoneAccessor{zones: m.zones})
+		_ = staged.delete(entryZone, dnsCfgKey)
+		if err := updateReverseRecords(staged, dnsCfgKey.Host, confValueBytes, nil); err != nil {
+			return fmt.Errorf("failed to delete dns entry")
+		}
+
+		return staged.apply()
+	}
+
+	return fmt.Errorf("not found for the zone %v", zone)
+}
+
+func (m *MemoryDB) IsResourceRecordExists(zone string, rr *ResourceRecord) bool {
+	rrType, ok := rrTypeMap[rr.Type]
+	if !ok {
+		log.Error("Unsupported rrtype entry", nil)
+		return false
+	}
+	if rr.TTL == 0 {
+		log.Error("DNS TTL value 0 is not supported.", nil)
+		return false
+	}
+	dnsCfgKey := DNSConfigRRKey{Host: strings.ToLower(rr.Name), RRType: rrType}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, zoneEntries := range m.zones {
+		if _, found := zoneEntries[dnsCfgKey]; found {
+			return true
+		}
+	}
+	log.Infof("Record not found for the zone %s", zone)
+
+	return false
+}
+
+// putEntry stores an already encoded rr config value, used to mirror entries from an external store.
+func (m *MemoryDB) putEntry(zone string, key DNSConfigRRKey, value []byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.zones == nil {
+		return
+	}
+	zoneEntries, ok := m.zones[zone]
+	if !ok {
+		zoneEntries = make(map[DNSConfigRRKey][]byte)
+		m.zones[zone] = zoneEntries
+	}
+	zoneEntries[key] = value
+}
+
+// deleteEntry removes a single entry from the zone, used to mirror entries from an external store.
+func (m *MemoryDB) deleteEntry(zone string, key DNSConfigRRKey) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if zoneEntries, ok := m.zones[zone]; ok {
+		delete(zoneEntries, key)
+	}
+}
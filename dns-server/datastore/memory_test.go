@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package datastore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDataStoreOperations(t *testing.T) {
+	store := &MemoryDB{TTL: 30}
+	err := store.Open()
+	assert.Equal(t, nil, err, "Error in opening the db")
+
+	rrecord := ResourceRecord{Name: exampleDomain, Type: "A", Class: "IN", TTL: 30, RData: []string{dnsConfigTestIP1}}
+	err = store.SetResourceRecord(".", &rrecord)
+	assert.Equal(t, nil, err, "Error in setting the record")
+	assert.True(t, store.IsResourceRecordExists(".", &rrecord), "Record not found")
+
+	question := dns.Question{Name: exampleDomain, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rrResponse, err := store.GetResourceRecord(&question)
+	assert.Equal(t, nil, err, "Error in reading the record")
+	assert.Equal(t, fmt.Sprintf(exampleRspFormatter, dnsConfigTestIP1), (*rrResponse)[0].String(), "Error")
+
+	err = store.DelResourceRecord("", exampleDomain, "A")
+	assert.Equal(t, nil, err, errorDeleteMessage)
+	assert.False(t, store.IsResourceRecordExists(".", &rrecord), "Record not deleted")
+
+	t.Run("QueryNonExistingRecord", func(t *testing.T) {
+		_, err = store.GetResourceRecord(&dns.Question{Name: example1Domain, Qtype: dns.TypeA,
+			Qclass: dns.ClassINET})
+		assert.EqualError(t, err, "could not process/retrieve the query", "Error in reading the db")
+	})
+
+	t.Run("QueryNonSupportedRRType", func(t *testing.T) {
+		err = store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "AA", Class: "IN", TTL: 30,
+			RData: []string{dnsConfigTestIP1}})
+		assert.EqualError(t, err, "unsupported rrtype(AA) entry", errorSettingMessage)
+	})
+
+	t.Run("QueryRRClassAny", func(t *testing.T) {
+		err = store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "A", Class: "*", TTL: 30,
+			RData: []string{dnsConfigTestIP1}})
+		assert.EqualError(t, err, "unsupported rrclass(*) entry", errorSettingMessage)
+	})
+
+	t.Run("UpdateARecord", func(t *testing.T) {
+		_ = store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "A",
+			Class: "IN", TTL: 30, RData: []string{dnsConfigTestIP1}})
+		err = store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "A",
+			Class: "IN", TTL: 30, RData: []string{dnsConfigTestIP2}})
+		assert.Equal(t, nil, err, "Error in setting the db")
+		rrResponse, _ = store.GetResourceRecord(&dns.Question{Name: exampleDomain,
+			Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		assert.Equal(t, fmt.Sprintf(exampleRspFormatter, dnsConfigTestIP2), (*rrResponse)[0].String(), "Error")
+
+		err = store.DelResourceRecord("", exampleDomain, "A")
+		assert.Equal(t, nil, err, errorDeleteMessage)
+	})
+
+	t.Run("DeleteNonExistingRecord", func(t *testing.T) {
+		err = store.DelResourceRecord("cloud", exampleDomain, "A")
+		assert.EqualError(t, err, "not found for the zone cloud", errorSettingMessage)
+	})
+
+	t.Run("NonDefaultZone", func(t *testing.T) {
+		_ = store.SetResourceRecord("example.com.", &ResourceRecord{Name: exampleAbcDomain, Type: "A",
+			Class: "IN", TTL: 30, RData: []string{dnsConfigTestIP3, dnsConfigTestIP4}})
+
+		rrResponse, _ = store.GetResourceRecord(&dns.Question{Name: exampleAbcDomain,
+			Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		assert.Equal(t, 2, len(*rrResponse), "Not found all records")
+		assert.Equal(t, fmt.Sprintf(abcExampleRspFormatter, dnsConfigTestIP3), (*rrResponse)[0].String(), "Error")
+
+		err = store.DelResourceRecord("", exampleAbcDomain, "A")
+		assert.Equal(t, nil, err, errorDeleteMessage)
+	})
+
+	err = store.Close()
+	assert.Equal(t, nil, err, "Error in closing the db")
+
+	t.Run("SetAfterClose", func(t *testing.T) {
+		err = store.SetResourceRecord(".", &rrecord)
+		assert.EqualError(t, err, "data store is not opened", errorSettingMessage)
+	})
+}
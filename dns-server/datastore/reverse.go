@@ -0,0 +1,272 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package datastore
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// ReverseZoneIPv4 reverse zone of the ipv4 addresses.
+	ReverseZoneIPv4 = "in-addr.arpa."
+	// ReverseZoneIPv6 reverse zone of the ipv6 addresses.
+	ReverseZoneIPv6 = "ip6.arpa."
+	// AllZones wildcard to enable the reverse records for all the zones.
+	AllZones = "*"
+)
+
+// ReverseZones forward zones for which the reverse(PTR) records are maintained, AllZones for all of them.
+type ReverseZones []string
+
+// zoneAccessor access to the zone entries within a single data store transaction.
+type zoneAccessor interface {
+	// get the encoded rr config value, nil if not exists
+	get(zone string, key DNSConfigRRKey) ([]byte, error)
+	// put the encoded rr config value
+	put(zone string, key DNSConfigRRKey, value []byte) error
+	// delete the entry, no error if not exists
+	delete(zone string, key DNSConfigRRKey) error
+}
+
+// stagedKey key of a staged change.
+type stagedKey struct {
+	zone string
+	key  DNSConfigRRKey
+}
+
+// stagedZoneAccessor buffers the changes over a base accessor so that they can be applied together.
+type stagedZoneAccessor struct {
+	base    zoneAccessor
+	changes map[stagedKey][]byte // nil value for delete
+	order   []stagedKey
+}
+
+func newStagedZoneAccessor(base zoneAccessor) *stagedZoneAccessor {
+	return &stagedZoneAccessor{base: base, changes: make(map[stagedKey][]byte)}
+}
+
+func (a *stagedZoneAccessor) get(zone string, key DNSConfigRRKey) ([]byte, error) {
+	if value, ok := a.changes[stagedKey{zone: zone, key: key}]; ok {
+		return value, nil
+	}
+
+	return a.base.get(zone, key)
+}
+
+func (a *stagedZoneAccessor) put(zone string, key DNSConfigRRKey, value []byte) error {
+	a.stage(stagedKey{zone: zone, key: key}, value)
+
+	return nil
+}
+
+func (a *stagedZoneAccessor) delete(zone string, key DNSConfigRRKey) error {
+	a.stage(stagedKey{zone: zone, key: key}, nil)
+
+	return nil
+}
+
+func (a *stagedZoneAccessor) stage(k stagedKey, value []byte) {
+	if _, ok := a.changes[k]; !ok {
+		a.order = append(a.order, k)
+	}
+	a.changes[k] = value
+}
+
+// apply writes all the staged changes to the base accessor.
+func (a *stagedZoneAccessor) apply() error {
+	for _, k := range a.order {
+		var err error
+		if value := a.changes[k]; value == nil {
+			err = a.base.delete(k.zone, k.key)
+		} else {
+			err = a.base.put(k.zone, k.key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isEnabled checks whether the reverse records are maintained for the zone.
+func (r ReverseZones) isEnabled(zone string) bool {
+	for _, reverseZone := range r {
+		if reverseZone == AllZones || strings.EqualFold(reverseZone, zone) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// target returns the value to be reflected in the reverse zone, nil if the zone has no reverse records.
+func (r ReverseZones) target(zone string, value []byte) []byte {
+	if !r.isEnabled(zone) {
+		return nil
+	}
+
+	return value
+}
+
+// updateReverseRecords moves the PTR records of the host from the addresses in the old value to the ones in the new
+// value. A nil new value removes all the PTR records of the host.
+func updateReverseRecords(acc zoneAccessor, host string, oldValue, newValue []byte) error {
+	oldCfg, err := decodeRRValue(oldValue)
+	if err != nil {
+		return err
+	}
+	newCfg, err := decodeRRValue(newValue)
+	if err != nil {
+		return err
+	}
+
+	newIPs := make(map[string]bool)
+	if newCfg != nil {
+		for _, ip := range newCfg.PointTo {
+			newIPs[ip] = true
+		}
+	}
+	if oldCfg != nil {
+		for _, ip := range oldCfg.PointTo {
+			if newIPs[ip] {
+				continue
+			}
+			if err = removeReverseRecord(acc, ip, host); err != nil {
+				return err
+			}
+		}
+	}
+	if newCfg != nil {
+		for _, ip := range newCfg.PointTo {
+			if err = addReverseRecord(acc, ip, host, newCfg.TTL); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func addReverseRecord(acc zoneAccessor, ip string, host string, ttl uint32) error {
+	zone, key, err := reverseKey(ip)
+	if err != nil {
+		return err
+	}
+	ptrBytes, err := acc.get(zone, key)
+	if err != nil {
+		return err
+	}
+	ptrCfg, err := decodeRRValue(ptrBytes)
+	if err != nil {
+		return err
+	}
+	if ptrCfg == nil {
+		ptrCfg = &DNSConfigRRValue{RRClass: dns.ClassINET}
+	}
+	found := false
+	for _, name := range ptrCfg.PointTo {
+		if name == host {
+			found = true
+			break
+		}
+	}
+	if found && ptrCfg.TTL == ttl {
+		return nil
+	}
+	if !found {
+		ptrCfg.PointTo = append(ptrCfg.PointTo, host)
+	}
+	ptrCfg.TTL = ttl
+
+	return putRRValue(acc, zone, key, ptrCfg)
+}
+
+func removeReverseRecord(acc zoneAccessor, ip string, host string) error {
+	zone, key, err := reverseKey(ip)
+	if err != nil {
+		return err
+	}
+	ptrBytes, err := acc.get(zone, key)
+	if err != nil {
+		return err
+	}
+	ptrCfg, err := decodeRRValue(ptrBytes)
+	if err != nil || ptrCfg == nil {
+		return err
+	}
+	names := make([]string, 0, len(ptrCfg.PointTo))
+	for _, name := range ptrCfg.PointTo {
+		if name != host {
+			names = append(names, name)
+		}
+	}
+	if len(names) == len(ptrCfg.PointTo) {
+		return nil
+	}
+	if len(names) == 0 {
+		return acc.delete(zone, key)
+	}
+	ptrCfg.PointTo = names
+
+	return putRRValue(acc, zone, key, ptrCfg)
+}
+
+// reverseKey returns the reverse zone and the PTR record key of the ip address.
+func reverseKey(ip string) (string, DNSConfigRRKey, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return "", DNSConfigRRKey{}, fmt.Errorf("invalid ip address(%s) in dns entry", ip)
+	}
+	reverseName, err := dns.ReverseAddr(parsedIP.String())
+	if err != nil {
+		return "", DNSConfigRRKey{}, fmt.Errorf("reverse name generation failed for %s", ip)
+	}
+	zone := ReverseZoneIPv6
+	if parsedIP.To4() != nil {
+		zone = ReverseZoneIPv4
+	}
+
+	return zone, DNSConfigRRKey{Host: reverseName, RRType: dns.TypePTR}, nil
+}
+
+func decodeRRValue(value []byte) (*DNSConfigRRValue, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+	dnsCfg := &DNSConfigRRValue{}
+	if err := json.Unmarshal(value, dnsCfg); err != nil {
+		return nil, fmt.Errorf("parsing failed on data retrieval")
+	}
+
+	return dnsCfg, nil
+}
+
+func putRRValue(acc zoneAccessor, zone string, key DNSConfigRRKey, dnsCfg *DNSConfigRRValue) error {
+	value, err := json.Marshal(dnsCfg)
+	if err != nil {
+		return fmt.Errorf("data store could not marshal dns config json")
+	}
+
+	return acc.put(zone, key, value)
+}
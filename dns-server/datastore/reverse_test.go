@@ -0,0 +1,117 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package datastore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ptrTestIPv4     = "192.0.2.10"
+	ptrTestIPv4New  = "192.0.2.11"
+	ptrTestIPv6     = "2001:db8::1"
+	ptrTestIPv4Name = "10.2.0.192.in-addr.arpa."
+	ptrTestIPv6Name = "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."
+	errorPtrMessage = "Error in reverse record"
+)
+
+func queryPTR(store DataStore, name string) []string {
+	rrs, err := store.GetResourceRecord(&dns.Question{Name: name, Qtype: dns.TypePTR, Qclass: dns.ClassINET})
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, rr := range *rrs {
+		names = append(names, rr.(*dns.PTR).Ptr)
+	}
+
+	return names
+}
+
+func testReverseRecords(t *testing.T, store DataStore) {
+	err := store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "A", Class: "IN", TTL: 30,
+		RData: []string{ptrTestIPv4}})
+	assert.Equal(t, nil, err, errorSettingMessage)
+	assert.Equal(t, []string{exampleDomain}, queryPTR(store, ptrTestIPv4Name), errorPtrMessage)
+
+	// Second host on the same ip
+	err = store.SetResourceRecord(".", &ResourceRecord{Name: example1Domain, Type: "A", Class: "IN", TTL: 30,
+		RData: []string{ptrTestIPv4}})
+	assert.Equal(t, nil, err, errorSettingMessage)
+	assert.ElementsMatch(t, []string{exampleDomain, example1Domain}, queryPTR(store, ptrTestIPv4Name),
+		errorPtrMessage)
+
+	// Ip change moves the reverse record
+	err = store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "A", Class: "IN", TTL: 30,
+		RData: []string{ptrTestIPv4New}})
+	assert.Equal(t, nil, err, errorSettingMessage)
+	assert.Equal(t, []string{example1Domain}, queryPTR(store, ptrTestIPv4Name), errorPtrMessage)
+	assert.Equal(t, []string{exampleDomain}, queryPTR(store, "11.2.0.192.in-addr.arpa."), errorPtrMessage)
+
+	err = store.SetResourceRecord(".", &ResourceRecord{Name: exampleDomain, Type: "AAAA", Class: "IN", TTL: 30,
+		RData: []string{ptrTestIPv6}})
+	assert.Equal(t, nil, err, errorSettingMessage)
+	assert.Equal(t, []string{exampleDomain}, queryPTR(store, ptrTestIPv6Name), errorPtrMessage)
+
+	// Zone without reverse records
+	err = store.SetResourceRecord("example.com.", &ResourceRecord{Name: exampleAbcDomain, Type: "A", Class: "IN",
+		TTL: 30, RData: []string{ptrTestIPv4}})
+	assert.Equal(t, nil, err, errorSettingMessage)
+	assert.Equal(t, []string{example1Domain}, queryPTR(store, ptrTestIPv4Name), errorPtrMessage)
+
+	// Delete removes the reverse records
+	assert.Equal(t, nil, store.DelResourceRecord(".", exampleDomain, "A"), errorDeleteMessage)
+	assert.Nil(t, queryPTR(store, "11.2.0.192.in-addr.arpa."), errorPtrMessage)
+	assert.Equal(t, nil, store.DelResourceRecord(".", exampleDomain, "AAAA"), errorDeleteMessage)
+	assert.Nil(t, queryPTR(store, ptrTestIPv6Name), errorPtrMessage)
+	assert.Equal(t, nil, store.DelResourceRecord(".", example1Domain, "A"), errorDeleteMessage)
+	assert.Nil(t, queryPTR(store, ptrTestIPv4Name), errorPtrMessage)
+	assert.Equal(t, nil, store.DelResourceRecord(".", exampleAbcDomain, "A"), errorDeleteMessage)
+}
+
+func TestBoltReverseRecords(t *testing.T) {
+	defer func() {
+		_ = os.RemoveAll(DBPath)
+	}()
+
+	store := &BoltDB{FileName: "testptrdb", TTL: 30, ReverseZones: ReverseZones{DefaultZone}}
+	assert.Equal(t, nil, store.Open(), "Error in opening the db")
+	defer store.Close()
+
+	testReverseRecords(t, store)
+}
+
+func TestMemoryReverseRecords(t *testing.T) {
+	store := &MemoryDB{TTL: 30, ReverseZones: ReverseZones{DefaultZone}}
+	assert.Equal(t, nil, store.Open(), "Error in opening the db")
+	defer store.Close()
+
+	testReverseRecords(t, store)
+}
+
+func TestReverseZonesConfig(t *testing.T) {
+	assert.False(t, ReverseZones(nil).isEnabled(DefaultZone))
+	assert.True(t, ReverseZones{AllZones}.isEnabled("example.com."))
+	assert.True(t, ReverseZones{"Example.com."}.isEnabled("example.com."))
+	assert.False(t, ReverseZones{"example.com."}.isEnabled(DefaultZone))
+
+	_, _, err := reverseKey("invalid")
+	assert.EqualError(t, err, "invalid ip address(invalid) in dns entry")
+}
@@ -18,9 +18,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -28,19 +31,25 @@ import (
 
 	"dns-server/datastore"
 	"dns-server/mgmt"
+	"dns-server/querylog"
 	"dns-server/util"
 )
 
 // Config DNS server configuration.
 type Config struct {
-	dbName            string // Database name, default zone
-	port              uint   // Port to listen to, default 53
-	mgmtPort          uint   // Http port to listen to, default 80
-	ipAdd             net.IP // IP address to listen to, default 0.0.0.0
-	ipMgmtAdd         net.IP // IP address to listen to, default 0.0.0.0
-	forwarder         net.IP // Forwarder dns address , default 8.8.8.8
-	connectionTimeout uint   // Connection time out value, both read, and write, default 2s
-	loadBalance       bool   // load balancing using random shuffle
+	dbName            string                 // Database name, default zone
+	port              uint                   // Port to listen to, default 53
+	mgmtPort          uint                   // Http port to listen to, default 80
+	ipAdd             net.IP                 // IP address to listen to, default 0.0.0.0
+	ipMgmtAdd         net.IP                 // IP address to listen to, default 0.0.0.0
+	forwarder         net.IP                 // Forwarder dns address , default 8.8.8.8
+	connectionTimeout uint                   // Connection time out value, both read, and write, default 2s
+	loadBalance       bool                   // load balancing using random shuffle
+	dataStore         string                 // data store type, default boltdb
+	etcdEndpoints     []string               // etcd endpoints for etcd data store
+	queryLog          *querylog.Config       // dnstap and json query log configuration
+	ptrZones          datastore.ReverseZones // zones for which the PTR records are maintained
+	configFile        string                 // runtime config file, reloaded on SIGHUP
 }
 
 type Server struct {
@@ -49,10 +58,82 @@ type Server struct {
 	mgmtCtl   mgmt.ManagementCtrl
 	tcpServer *dns.Server
 	udpServer *dns.Server
+	queryLog  *querylog.QueryLogger
+	runtime   atomic.Value // *runtimeState
+	base      *RuntimeConfig
+	reloadMu  sync.Mutex
+	inflight  sync.WaitGroup
+}
+
+// queryLogWriter response writer which keeps a reference of the response for the query log.
+type queryLogWriter struct {
+	dns.ResponseWriter
+	response *dns.Msg
+}
+
+func (q *queryLogWriter) WriteMsg(msg *dns.Msg) error {
+	q.response = msg
+	return q.ResponseWriter.WriteMsg(msg)
 }
 
 func NewServer(config *Config, dataStore datastore.DataStore, mgmtCtl mgmt.ManagementCtrl) *Server {
-	return &Server{config: config, dataStore: dataStore, mgmtCtl: mgmtCtl}
+	s := &Server{config: config, dataStore: dataStore, mgmtCtl: mgmtCtl}
+	// Command line values and the startup log level are the base of the runtime config, settings removed from
+	// the config file fall back to them on reload
+	loadBalance := config.loadBalance
+	s.base = &RuntimeConfig{LoadBalance: &loadBalance, LogLevel: log.GetLevel().String()}
+	if config.forwarder != nil {
+		s.base.Forwarders = []string{config.forwarder.String()}
+	}
+	state, err := newRuntimeState(s.base, nil, nil)
+	if err != nil {
+		log.Errorf("Invalid forwarder configuration(%s).", err.Error())
+		state = &runtimeState{loadBalance: loadBalance, logLevel: log.GetLevel()}
+	}
+	s.runtime.Store(state)
+
+	return s
+}
+
+// Reload validates and applies the runtime config, the current settings are kept on failure. Queries in progress
+// complete with the settings they started with.
+func (s *Server) Reload(runtimeConfig *RuntimeConfig) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	state, err := newRuntimeState(s.base, runtimeConfig, s.runtimeState())
+	if err != nil {
+		return err
+	}
+	log.SetLevel(state.logLevel)
+	s.runtime.Store(state)
+	log.Infof("Runtime config applied(forwarders: %v, load balance: %t, acl: %d/%d, log level: %s, cache size: %d).",
+		state.forwarders, state.loadBalance, len(state.allowNets), len(state.denyNets), state.logLevel.String(),
+		state.cache.Size())
+
+	return nil
+}
+
+// ReloadConfigFile reloads the runtime config from the config file, if configured.
+func (s *Server) ReloadConfigFile() error {
+	if len(s.config.configFile) == 0 {
+		return nil
+	}
+	runtimeConfig, err := loadRuntimeConfig(s.config.configFile)
+	if err != nil {
+		return err
+	}
+
+	return s.Reload(runtimeConfig)
+}
+
+func (s *Server) runtimeState() *runtimeState {
+	state, _ := s.runtime.Load().(*runtimeState)
+	if state == nil {
+		state = &runtimeState{loadBalance: s.config.loadBalance, logLevel: log.GetLevel()}
+	}
+
+	return state
 }
 
 func (s *Server) Run() error { // Set dns query handler
@@ -68,13 +149,27 @@ func (s *Server) Run() error { // Set dns query handler
 		WriteTimeout: time.Duration(s.config.connectionTimeout) * time.Second,
 	}
 
-	err := s.dataStore.Open()
+	err := s.ReloadConfigFile()
+	if err != nil {
+		log.Errorf("Failed to load the runtime config(%s).", err.Error())
+
+		return err
+	}
+
+	err = s.dataStore.Open()
 	if err != nil {
 		log.Infof("Failed to open data store.")
 
 		return err
 	}
 
+	s.queryLog, err = querylog.NewQueryLogger(s.config.queryLog)
+	if err != nil {
+		log.Errorf("Failed to initialize the query log(%s).", err.Error())
+
+		return err
+	}
+
 	go s.mgmtCtl.StartController(&s.dataStore, s.config.ipMgmtAdd, s.config.mgmtPort)
 	go s.start(s.udpServer)
 
@@ -82,93 +177,153 @@ func (s *Server) Run() error { // Set dns query handler
 }
 
 func (s *Server) start(dns *dns.Server) {
+	dns.NotifyStartedFunc = func() {
+		log.Infof("Dns %s server now running on %s.", dns.Net, dns.Addr)
+	}
 	err := dns.ListenAndServe()
 	if err != nil {
 		log.Fatalf("Failed to listen dns %s server on %s. (%s)", dns.Net, dns.Addr, err.Error())
 	}
-	log.Infof("Dns %s server now running on %s.", dns.Net, dns.Addr)
 }
 
+// Stop shuts down the listeners, waits for the in-flight queries to drain and then closes the data store.
 func (s *Server) Stop() {
-	err := s.dataStore.Close()
-	if err != nil {
-		log.Error("Failed to close the data store.", nil)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), util.ShutdownTimeout*time.Second)
+	defer cancel()
 
 	if s.udpServer != nil {
-		err = s.udpServer.Shutdown()
-		if err != nil {
-			log.Error("Failed to stop the dns udp server.", nil)
+		if err := s.udpServer.ShutdownContext(ctx); err != nil {
+			log.Errorf("Failed to stop the dns udp server(%s).", err.Error())
 		}
 	}
 
-	err = s.mgmtCtl.StopController()
+	drained := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Warn("Timed out waiting for the in-flight queries.")
+	}
+
+	// Query log and data store are closed even if the controller fails to stop, so that BoltDB is left consistent
+	err := s.mgmtCtl.StopController()
 	if err != nil {
-		log.Fatal("Failed to stop the management controller", err)
+		log.Errorf("Failed to stop the management controller(%s).", err.Error())
+	}
+
+	if s.queryLog != nil {
+		s.queryLog.Close()
+	}
+
+	err = s.dataStore.Close()
+	if err != nil {
+		log.Error("Failed to close the data store.", nil)
 	}
 
 	log.Info("Edge-Gallery DNS-Server stopped now.")
 }
 
 // forward request to external server.
-func (s *Server) forward(req *dns.Msg) (*dns.Msg, error) {
-	c := new(dns.Client)
-	forwarder := s.config.forwarder.String()
-	if forwarder == util.DefaultIP {
+func (s *Server) forward(state *runtimeState, req *dns.Msg) (*dns.Msg, error) {
+	if len(state.forwarders) == 0 {
 		return nil, fmt.Errorf("could not resolve the request %q and no forwarder is configured",
 			req.Question[0].Name)
 	}
+	if rsp := state.cache.Get(req); rsp != nil {
+		return rsp, nil
+	}
 
-	// Retry 3 times on failure. exchange will not retry on failure.
+	c := new(dns.Client)
+	// Retry 3 times on failure, each forwarder in turn. exchange will not retry on failure.
 	for i := 0; i < util.ForwardRetryCount; i++ {
-		ret, _, err := c.Exchange(req, forwarder+":53")
-		if err != nil {
-			continue
-		}
-		if ret.Rcode == dns.RcodeSuccess {
-			return ret, nil
+		for _, forwarder := range state.forwarders {
+			ret, _, err := c.Exchange(req, forwarder)
+			if err != nil {
+				continue
+			}
+			if ret.Rcode == dns.RcodeSuccess {
+				state.cache.Set(req, ret)
+				return ret, nil
+			}
 		}
 	}
 
 	return nil, fmt.Errorf("forward of request %q was not accepted", req.Question[0].Name)
 }
 
-// Handle DNS Query matching.
+// Handle DNS Query matching, the query is logged to the query log if enabled.
 func (s *Server) handleDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.inflight.Add(1)
+	defer s.inflight.Done()
+
+	if s.queryLog == nil {
+		s.processQuery(w, req)
+		return
+	}
+
+	queryTime := time.Now()
+	logWriter := &queryLogWriter{ResponseWriter: w}
+	answeredLocally := s.processQuery(logWriter, req)
+	s.queryLog.Log(&querylog.Record{
+		Query:           req,
+		Response:        logWriter.response,
+		ClientAddr:      w.RemoteAddr(),
+		QueryTime:       queryTime,
+		ResponseTime:    time.Now(),
+		AnsweredLocally: answeredLocally,
+	})
+}
+
+// Process the query, returns true if answered from the local data store.
+func (s *Server) processQuery(w dns.ResponseWriter, req *dns.Msg) bool {
 	if !s.validateQuestion(req) {
 		s.writeErrorResponse(w, req, dns.RcodeFormatError)
 
-		return
+		return false
 	}
 
-	if req.Opcode == dns.OpcodeQuery {
-		// log.Debugf("Query lookup (%s)", req.Question[0].String())
-		// Match data from db
-		rrs, err := s.dataStore.GetResourceRecord(&req.Question[0])
-		if err != nil {
-			respMsg, err := s.forward(req)
-			if err != nil {
-				s.writeErrorResponse(w, req, dns.RcodeServerFailure)
-				// log.Debugf("Failed to find entry: %v", err)
-				return
-			}
-			err = w.WriteMsg(respMsg)
-			if err != nil {
-				log.Errorf("Failed to send a response for query")
-			}
+	if req.Opcode != dns.OpcodeQuery {
+		s.writeErrorResponse(w, req, dns.RcodeRefused)
+
+		return false
+	}
+
+	state := s.runtimeState()
+	if !state.isAllowed(w.RemoteAddr()) {
+		s.writeErrorResponse(w, req, dns.RcodeRefused)
+
+		return false
+	}
 
-			return
+	// log.Debugf("Query lookup (%s)", req.Question[0].String())
+	// Match data from db
+	rrs, err := s.dataStore.GetResourceRecord(&req.Question[0])
+	if err != nil {
+		respMsg, err := s.forward(state, req)
+		if err != nil {
+			s.writeErrorResponse(w, req, dns.RcodeServerFailure)
+			// log.Debugf("Failed to find entry: %v", err)
+			return false
 		}
-		// Shuffle the response if load balancing is enabled
-		if s.config.loadBalance && len(*rrs) > 1 {
-			rand.Shuffle(len(*rrs), func(i, j int) {
-				(*rrs)[i], (*rrs)[j] = (*rrs)[j], (*rrs)[i]
-			})
+		err = w.WriteMsg(respMsg)
+		if err != nil {
+			log.Errorf("Failed to send a response for query")
 		}
-		s.writeSuccessResponse(rrs, w, req)
-	} else {
-		s.writeErrorResponse(w, req, dns.RcodeRefused)
+
+		return false
+	}
+	// Shuffle the response if load balancing is enabled
+	if state.loadBalance && len(*rrs) > 1 {
+		rand.Shuffle(len(*rrs), func(i, j int) {
+			(*rrs)[i], (*rrs)[j] = (*rrs)[j], (*rrs)[i]
+		})
 	}
+	s.writeSuccessResponse(rrs, w, req)
+
+	return true
 }
 
 // Validate the input question.
@@ -17,6 +17,7 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
@@ -30,6 +31,7 @@ import (
 
 	"dns-server/datastore"
 	"dns-server/mgmt"
+	"dns-server/querylog"
 	"dns-server/util"
 )
 
@@ -68,8 +70,18 @@ func TestForward(t *testing.T) {
 	var ipMgmtAddString = util.DefaultIP
 	var forwarder = defaultTestForwarder
 	var loadBalance = false
+	var dataStore = util.DefaultDataStore
+	var etcdEndpoints = util.DefaultEtcdEndpoint
+	var dnstapTarget = ""
+	var queryLogFile = ""
+	var sampleRate = util.DefaultQueryLogSampleRate
+	var keepErrors = true
+	var ptrZones = ""
+	var configFile = ""
 	parameters := &InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-		&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+		&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+		&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+		&ptrZones, &configFile}
 	config := validateInputAndGenerateConfig(parameters)
 
 	store := &datastore.BoltDB{FileName: config.dbName, TTL: util.DefaultTTL}
@@ -94,7 +106,7 @@ func TestForward(t *testing.T) {
 		})
 		defer patch1.Reset()
 
-		rsp, err := dnsServer.forward(dnsMsg)
+		rsp, err := dnsServer.forward(dnsServer.runtimeState(), dnsMsg)
 		assert.Equal(t, nil, err, errorForwarding)
 		assert.Contains(t, rsp.Answer[0].String(), testDomainServer, errorForwarding)
 	})
@@ -116,15 +128,16 @@ func TestForward(t *testing.T) {
 		})
 		defer patch1.Reset()
 
-		_, err := dnsServer.forward(dnsMsg)
+		_, err := dnsServer.forward(dnsServer.runtimeState(), dnsMsg)
 		assert.NotEqual(t, nil, err, errorForwarding)
 		assert.EqualError(t, err, "forward of request \"www.edgegallery0000111.org.\" was not "+
 			"accepted", errorForwarding)
 	})
 
 	t.Run("WrongForwardAddress", func(t *testing.T) {
-		config.forwarder = net.ParseIP("0.0.0.0")
-		defer func() { config.forwarder = net.ParseIP(defaultTestForwarder) }()
+		err := dnsServer.Reload(&RuntimeConfig{Forwarders: []string{util.DefaultIP}})
+		assert.NoError(t, err)
+		defer func() { _ = dnsServer.Reload(nil) }()
 
 		dnsMsg := new(dns.Msg)
 		dnsMsg.Id = dns.Id()
@@ -132,7 +145,7 @@ func TestForward(t *testing.T) {
 		dnsMsg.Question = make([]dns.Question, 1)
 		dnsMsg.Question[0] = dns.Question{Name: testDomainServer, Qtype: dns.TypeA, Qclass: dns.ClassINET}
 
-		_, err := dnsServer.forward(dnsMsg)
+		_, err = dnsServer.forward(dnsServer.runtimeState(), dnsMsg)
 		assert.NotEqual(t, nil, err, errorForwarding)
 		assert.EqualError(t, err, "could not resolve the request \"www.edgegallery.org.\" and no forwarder is "+
 			"configured", errorForwarding)
@@ -151,7 +164,7 @@ func (m *mockDnsRespWriter) LocalAddr() net.Addr {
 }
 
 func (m *mockDnsRespWriter) RemoteAddr() net.Addr {
-	panic(panicImplement)
+	return &net.UDPAddr{IP: net.ParseIP(defaultTestForwarder), Port: util.DefaultDNSPort}
 }
 
 func (m *mockDnsRespWriter) WriteMsg(msg *dns.Msg) error {
@@ -197,8 +210,18 @@ func TestHandleDNS(t *testing.T) {
 	var ipMgmtAddString = util.DefaultIP
 	var forwarder = defaultTestForwarder
 	var loadBalance = false
+	var dataStore = util.DefaultDataStore
+	var etcdEndpoints = util.DefaultEtcdEndpoint
+	var dnstapTarget = ""
+	var queryLogFile = ""
+	var sampleRate = util.DefaultQueryLogSampleRate
+	var keepErrors = true
+	var ptrZones = ""
+	var configFile = ""
 	parameters := &InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-		&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+		&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+		&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+		&ptrZones, &configFile}
 	config := validateInputAndGenerateConfig(parameters)
 
 	store := &datastore.BoltDB{FileName: config.dbName, TTL: util.DefaultTTL}
@@ -280,4 +303,25 @@ func TestHandleDNS(t *testing.T) {
 		assert.Contains(t, mockDnsWriter.rspMsg.Answer[0].String(), testDomainServer, errorInResponse)
 	})
 
+	t.Run("QueryLogEnabled", func(t *testing.T) {
+		queryLogFile := "test_query.log"
+		defer os.Remove(queryLogFile)
+		dnsServer.queryLog, err = querylog.NewQueryLogger(&querylog.Config{JSONLogFile: queryLogFile,
+			SampleRate: 1})
+		assert.Equal(t, nil, err, "Error in creating the query log")
+
+		req := &dns.Msg{Question: []dns.Question{{Name: exampleDomain,
+			Qtype:  dns.TypeA,
+			Qclass: dns.ClassINET}}}
+		mockDnsWriter := &mockDnsRespWriter{}
+		dnsServer.handleDNS(mockDnsWriter, req)
+		assert.Equal(t, dns.RcodeSuccess, mockDnsWriter.rspMsg.Rcode, errorInResponse)
+		dnsServer.queryLog.Close()
+		dnsServer.queryLog = nil
+
+		logBytes, err := ioutil.ReadFile(queryLogFile)
+		assert.Equal(t, nil, err, "Error in reading the query log")
+		assert.Contains(t, string(logBytes), "\"qname\":\""+exampleDomain+"\"", "Query not logged")
+		assert.Contains(t, string(logBytes), "\"answeredLocally\":true", "Query not logged")
+	})
 }
@@ -6,10 +6,13 @@ replace k8s.io/client-go v2.0.0-alpha.0.0.20180817174322-745ca8300397+incompatib
 
 require (
 	github.com/agiledragon/gomonkey v2.0.1+incompatible
+	github.com/dnstap/golang-dnstap v0.4.0
 	github.com/labstack/echo/v4 v4.1.16
-	github.com/miekg/dns v1.1.29
+	github.com/miekg/dns v1.1.31
 	github.com/sirupsen/logrus v1.6.0
-	github.com/stretchr/testify v1.6.1
+	github.com/stretchr/testify v1.7.0
 	go.etcd.io/bbolt v1.3.4
-	golang.org/x/sys v0.0.0-20200515095857-1151b9dac4a9 // indirect
+	go.etcd.io/etcd/api/v3 v3.5.0
+	go.etcd.io/etcd/client/v3 v3.5.0
+	google.golang.org/protobuf v1.26.0
 )
@@ -26,23 +26,33 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/miekg/dns"
 	log "github.com/sirupsen/logrus"
 
 	"dns-server/datastore"
 	"dns-server/mgmt"
+	"dns-server/querylog"
 	"dns-server/util"
 )
 
 // Input placeholder.
 type InputParameters struct {
-	dbName          *string // DB name placeholder
-	port            *uint   // dns port number
-	mgmtPort        *uint   // management interface port number
-	connTimeOut     *uint   // connection time out value
-	ipAddString     *string // dns listening ip
-	ipMgmtAddString *string // management interface listening ip
-	forwarder       *string // forwarder ip address
-	loadBalance     *bool   // need load balancing?
+	dbName          *string  // DB name placeholder
+	port            *uint    // dns port number
+	mgmtPort        *uint    // management interface port number
+	connTimeOut     *uint    // connection time out value
+	ipAddString     *string  // dns listening ip
+	ipMgmtAddString *string  // management interface listening ip
+	forwarder       *string  // forwarder ip address
+	loadBalance     *bool    // need load balancing?
+	dataStore       *string  // data store type
+	etcdEndpoints   *string  // etcd endpoints, comma separated
+	dnstap          *string  // dnstap output target
+	queryLog        *string  // json query log file
+	sampleRate      *float64 // query log sample rate
+	keepErrors      *bool    // log failed queries irrespective of sampling
+	ptrZones        *string  // zones for which the reverse records are maintained
+	configFile      *string  // runtime config file
 }
 
 const invalidMulticastErr = "error: multicast or broadcast ip address "
@@ -65,6 +75,21 @@ func registerInputParameters(inParam *InputParameters) {
 		"Management Ipv4/Ipv6 address to listens to")
 	inParam.forwarder = flag.String("forwarder", util.DefaultIP, "Forwarder")
 	inParam.loadBalance = flag.Bool("loadBalance", false, "Load balance using random shuffle")
+	inParam.dataStore = flag.String("datastore", util.DefaultDataStore,
+		"Data store type(boltdb, memory or etcd)")
+	inParam.etcdEndpoints = flag.String("etcdEndpoints", util.DefaultEtcdEndpoint,
+		"Comma separated etcd endpoints(host:port), used with etcd data store")
+	inParam.dnstap = flag.String("dnstap", "",
+		"Dnstap output, unix:<socket path> for frame stream socket or a file path, empty to disable")
+	inParam.queryLog = flag.String("queryLog", "", "Json query log file path, empty to disable")
+	inParam.sampleRate = flag.Float64("queryLogSampleRate", util.DefaultQueryLogSampleRate,
+		"Fraction of the queries to be logged(0~1)")
+	inParam.keepErrors = flag.Bool("queryLogKeepErrors", true,
+		"Log all the failed queries irrespective of the sample rate")
+	inParam.ptrZones = flag.String("ptrZones", "",
+		"Comma separated zones for which the PTR records are maintained from the A/AAAA records, * for all zones")
+	inParam.configFile = flag.String("config", "",
+		"Runtime config file(forwarders, acl, log level, cache size), reloaded on SIGHUP")
 
 	flag.Parse()
 }
@@ -140,6 +165,25 @@ func validateInputAndGenerateConfig(inParam *InputParameters) *Config {
 		log.Fatalf(multicastBroadcastIpErr, *inParam.forwarder, err.Error())
 	}
 
+	// Validate data store
+	etcdEndpoints := validateDataStore(*inParam.dataStore, *inParam.etcdEndpoints)
+
+	// Validate reverse zones
+	ptrZones := validatePTRZones(*inParam.ptrZones)
+
+	// Validate query log sampling
+	if *inParam.sampleRate <= 0 || *inParam.sampleRate > 1 {
+		err := fmt.Errorf("error: query log sample rate not in valid range(0~1)")
+		log.Fatalf("Failed to parse query log sample rate(%s).", err.Error())
+	}
+
+	// Validate runtime config file
+	if len(*inParam.configFile) != 0 {
+		if _, err := loadRuntimeConfig(*inParam.configFile); err != nil {
+			log.Fatalf("Failed to load runtime config(%s). %s", *inParam.configFile, err.Error())
+		}
+	}
+
 	return &Config{dbName: *inParam.dbName,
 		port:              *inParam.port,
 		mgmtPort:          *inParam.mgmtPort,
@@ -148,18 +192,100 @@ func validateInputAndGenerateConfig(inParam *InputParameters) *Config {
 		connectionTimeout: *inParam.connTimeOut,
 		forwarder:         forwarderAdd,
 		loadBalance:       *inParam.loadBalance,
+		dataStore:         *inParam.dataStore,
+		etcdEndpoints:     etcdEndpoints,
+		ptrZones:          ptrZones,
+		configFile:        *inParam.configFile,
+		queryLog: &querylog.Config{DnstapTarget: *inParam.dnstap,
+			JSONLogFile: *inParam.queryLog,
+			SampleRate:  *inParam.sampleRate,
+			KeepErrors:  *inParam.keepErrors,
+		},
 	}
 }
 
-func waitForSignal() {
+// Validate the data store type and the etcd endpoints in case of etcd data store.
+func validateDataStore(dataStore string, endpoints string) []string {
+	switch dataStore {
+	case util.DataStoreBoltDB, util.DataStoreMemory:
+		return nil
+	case util.DataStoreEtcd:
+	default:
+		err := fmt.Errorf("error: data store should be one of boltdb, memory or etcd")
+		log.Fatalf("Failed to parse data store(%s). %s", dataStore, err.Error())
+	}
+
+	var etcdEndpoints []string
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if len(endpoint) == 0 {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"),
+			"https://")); err != nil {
+			err = fmt.Errorf("error: etcd endpoint should be in host:port format")
+			log.Fatalf("Failed to parse etcd endpoint(%s). %s", endpoint, err.Error())
+		}
+		etcdEndpoints = append(etcdEndpoints, endpoint)
+	}
+	if len(etcdEndpoints) == 0 {
+		err := fmt.Errorf("error: etcd endpoints missing")
+		log.Fatalf("Failed to parse etcd endpoints(%s). %s", endpoints, err.Error())
+	}
+
+	return etcdEndpoints
+}
+
+// Validate the zones for which the PTR records are maintained.
+func validatePTRZones(zones string) datastore.ReverseZones {
+	var ptrZones datastore.ReverseZones
+	for _, zone := range strings.Split(zones, ",") {
+		zone = strings.TrimSpace(zone)
+		if len(zone) == 0 {
+			continue
+		}
+		if len(zone) >= util.MaxDNSFQDNLength {
+			err := fmt.Errorf("error: zone name too long")
+			log.Fatalf("Failed to parse ptr zones(%s). %s", zones, err.Error())
+		}
+		if zone != datastore.AllZones {
+			zone = dns.Fqdn(zone)
+		}
+		ptrZones = append(ptrZones, zone)
+	}
+
+	return ptrZones
+}
+
+// Create the data store as per the configured type.
+func newDataStore(config *Config) datastore.DataStore {
+	switch config.dataStore {
+	case util.DataStoreMemory:
+		return &datastore.MemoryDB{TTL: util.DefaultTTL, ReverseZones: config.ptrZones}
+	case util.DataStoreEtcd:
+		return &datastore.EtcdDB{Endpoints: config.etcdEndpoints, Prefix: datastore.DefaultEtcdPrefix,
+			TTL: util.DefaultTTL, ReverseZones: config.ptrZones}
+	default:
+		return &datastore.BoltDB{FileName: config.dbName, TTL: util.DefaultTTL, ReverseZones: config.ptrZones}
+	}
+}
+
+// Wait for the signals, the runtime config is reloaded on SIGHUP and returns on SIGINT/SIGTERM so that the server is
+// stopped gracefully.
+func waitForSignal(dnsServer *Server) {
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	for {
-		select {
-		case s := <-sig:
-			log.Infof("Signal(%d) received, stopping dns server\n", s)
-			os.Exit(0)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	for s := range sig {
+		if s == syscall.SIGHUP {
+			log.Info("Signal(SIGHUP) received, reloading runtime config.")
+			if err := dnsServer.ReloadConfigFile(); err != nil {
+				log.Errorf("Failed to reload runtime config, keeping the current one(%s).", err.Error())
+			}
+			continue
 		}
+		log.Infof("Signal(%d) received, stopping dns server\n", s)
+		return
 	}
 }
 
@@ -172,7 +298,7 @@ func main() {
 
 	config := validateInputAndGenerateConfig(inputParam)
 
-	store := &datastore.BoltDB{FileName: config.dbName, TTL: util.DefaultTTL}
+	store := newDataStore(config)
 	mgmtCtl := &mgmt.Controller{}
 	dnsServer := NewServer(config, store, mgmtCtl)
 
@@ -182,5 +308,5 @@ func main() {
 	}
 
 	log.Info("DNS server started successfully.")
-	waitForSignal()
+	waitForSignal(dnsServer)
 }
@@ -18,6 +18,7 @@ package main
 import (
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -38,6 +39,14 @@ var ipAddString = util.DefaultIP
 var ipMgmtAddString = util.DefaultIP
 var forwarder = util.DefaultIP
 var loadBalance = false
+var dataStore = util.DefaultDataStore
+var etcdEndpoints = util.DefaultEtcdEndpoint
+var dnstapTarget = ""
+var queryLogFile = ""
+var sampleRate = util.DefaultQueryLogSampleRate
+var keepErrors = true
+var ptrZones = ""
+var configFile = ""
 var ePanic = "Panic expected"
 var eError = "Error expected"
 var panicProblem = "a problem"
@@ -71,7 +80,7 @@ func TestMainDnsServer(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -93,7 +102,9 @@ func TestMainDnsServer(t *testing.T) {
 		}()
 		var invalidPortNo uint = 0
 		parameters := InputParameters{&dbName, &port, &invalidPortNo, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -104,6 +115,14 @@ func TestMainDnsServer(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -122,7 +141,9 @@ func TestMainDnsServer(t *testing.T) {
 		}()
 		var invalidPortNo uint = 65536
 		parameters := InputParameters{&dbName, &port, &invalidPortNo, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -133,6 +154,14 @@ func TestMainDnsServer(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -169,7 +198,7 @@ func TestMainDnsServer1(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -191,7 +220,9 @@ func TestMainDnsServer1(t *testing.T) {
 		}()
 		var invalidIpAdd = "127.0.0.256"
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &invalidIpAdd, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &invalidIpAdd, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -202,6 +233,14 @@ func TestMainDnsServer1(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -220,7 +259,9 @@ func TestMainDnsServer1(t *testing.T) {
 			}
 		}()
 		parameters := InputParameters{&dbName, &port, &port, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -231,6 +272,14 @@ func TestMainDnsServer1(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -267,7 +316,7 @@ func TestMainDnsServer2(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -290,7 +339,9 @@ func TestMainDnsServer2(t *testing.T) {
 
 		var invalidDbName = "test.db"
 		parameters := InputParameters{&invalidDbName, &port, &mgmtPort, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -301,6 +352,14 @@ func TestMainDnsServer2(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -320,7 +379,9 @@ func TestMainDnsServer2(t *testing.T) {
 		}()
 		var invalidIpAdd = "127.0.0.256"
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&ipAddString, &invalidIpAdd, &forwarder, &loadBalance}
+			&ipAddString, &invalidIpAdd, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -331,6 +392,14 @@ func TestMainDnsServer2(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -367,7 +436,7 @@ func TestMainDnsServer3(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -389,7 +458,9 @@ func TestMainDnsServer3(t *testing.T) {
 		}()
 		var invalidIpAdd = "128.15.47.299"
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance}
+			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -400,6 +471,14 @@ func TestMainDnsServer3(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -418,7 +497,9 @@ func TestMainDnsServer3(t *testing.T) {
 		}()
 		var invalidIpAdd = "1::2lkh"
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance}
+			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -429,6 +510,14 @@ func TestMainDnsServer3(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -465,7 +554,7 @@ func TestMainDnsServer4(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -487,7 +576,9 @@ func TestMainDnsServer4(t *testing.T) {
 		}()
 		var invalidIpAdd = ""
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance}
+			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -498,6 +589,14 @@ func TestMainDnsServer4(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -516,7 +615,9 @@ func TestMainDnsServer4(t *testing.T) {
 		}()
 		var invalidIpAdd = "a"
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance}
+			&invalidIpAdd, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -527,6 +628,14 @@ func TestMainDnsServer4(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -563,7 +672,7 @@ func TestMainDnsServer5(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -581,7 +690,9 @@ func TestMainDnsServer5(t *testing.T) {
 			}
 		}()
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -592,6 +703,14 @@ func TestMainDnsServer5(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -615,7 +734,9 @@ func TestMainDnsServer5(t *testing.T) {
 			"qwertyuiopqwertyuiopqwertyuiopqwertyuiopqwertyuiopqwertyuiopqwertyuiop"
 
 		parameters := InputParameters{&invalidDbName, &port, &mgmtPort, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -626,6 +747,14 @@ func TestMainDnsServer5(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -662,7 +791,7 @@ func TestMainDnsServer6(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -684,7 +813,9 @@ func TestMainDnsServer6(t *testing.T) {
 		}()
 		var invalidPortNo uint = 0
 		parameters := InputParameters{&dbName, &invalidPortNo, &mgmtPort, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -695,6 +826,14 @@ func TestMainDnsServer6(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -714,7 +853,9 @@ func TestMainDnsServer6(t *testing.T) {
 		}()
 		var invalidPortNo uint = 65536
 		parameters := InputParameters{&dbName, &invalidPortNo, &mgmtPort, &connTimeOut,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -725,6 +866,14 @@ func TestMainDnsServer6(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -762,7 +911,7 @@ func TestMainDnsServer7(t *testing.T) {
 	})
 	defer patch3.Reset()
 
-	patch4 := gomonkey.ApplyFunc(waitForSignal, func() { // Empty Impl
+	patch4 := gomonkey.ApplyFunc(waitForSignal, func(*Server) { // Empty Impl
 	})
 	defer patch4.Reset()
 
@@ -784,7 +933,9 @@ func TestMainDnsServer7(t *testing.T) {
 		}()
 		var invalidConnT uint = 0
 		parameters := InputParameters{&dbName, &port, &mgmtPort, &invalidConnT,
-			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance}
+			&ipAddString, &ipMgmtAddString, &forwarder, &loadBalance,
+			&dataStore, &etcdEndpoints, &dnstapTarget, &queryLogFile, &sampleRate, &keepErrors,
+			&ptrZones, &configFile}
 
 		patch5 := gomonkey.ApplyFunc(registerInputParameters, func(inParam *InputParameters) {
 			inParam.dbName = parameters.dbName
@@ -795,6 +946,14 @@ func TestMainDnsServer7(t *testing.T) {
 			inParam.ipMgmtAddString = parameters.ipMgmtAddString
 			inParam.forwarder = parameters.forwarder
 			inParam.loadBalance = parameters.loadBalance
+			inParam.dataStore = parameters.dataStore
+			inParam.etcdEndpoints = parameters.etcdEndpoints
+			inParam.dnstap = parameters.dnstap
+			inParam.queryLog = parameters.queryLog
+			inParam.sampleRate = parameters.sampleRate
+			inParam.keepErrors = parameters.keepErrors
+			inParam.ptrZones = parameters.ptrZones
+			inParam.configFile = parameters.configFile
 			return
 		})
 		defer patch5.Reset()
@@ -802,3 +961,76 @@ func TestMainDnsServer7(t *testing.T) {
 		main()
 	})
 }
+
+func TestDataStoreSelection(t *testing.T) {
+	patch1 := gomonkey.ApplyFunc(os.Exit, func(code int) { // Empty Impl
+		panic(panicProblem)
+	})
+	defer patch1.Reset()
+
+	t.Run("InvalidDataStoreType", func(t *testing.T) {
+		defer func() {
+			r := recover()
+			if r != panicProblem {
+				t.Errorf("%s %v", ePanic, r)
+			}
+		}()
+		validateDataStore("redis", util.DefaultEtcdEndpoint)
+	})
+
+	t.Run("InvalidEtcdEndpoint", func(t *testing.T) {
+		defer func() {
+			r := recover()
+			if r != panicProblem {
+				t.Errorf("%s %v", ePanic, r)
+			}
+		}()
+		validateDataStore(util.DataStoreEtcd, "127.0.0.1")
+	})
+
+	t.Run("EmptyEtcdEndpoints", func(t *testing.T) {
+		defer func() {
+			r := recover()
+			if r != panicProblem {
+				t.Errorf("%s %v", ePanic, r)
+			}
+		}()
+		validateDataStore(util.DataStoreEtcd, " , ")
+	})
+
+	t.Run("EtcdDataStore", func(t *testing.T) {
+		endpoints := validateDataStore(util.DataStoreEtcd, "http://10.0.0.1:2379, 10.0.0.2:2379")
+		assert.Equal(t, []string{"http://10.0.0.1:2379", "10.0.0.2:2379"}, endpoints)
+
+		store := newDataStore(&Config{dataStore: util.DataStoreEtcd, etcdEndpoints: endpoints})
+		etcdStore, ok := store.(*datastore.EtcdDB)
+		assert.True(t, ok, "Etcd data store expected")
+		assert.Equal(t, endpoints, etcdStore.Endpoints)
+	})
+
+	t.Run("MemoryAndBoltDataStore", func(t *testing.T) {
+		assert.Nil(t, validateDataStore(util.DataStoreMemory, ""))
+		_, ok := newDataStore(&Config{dataStore: util.DataStoreMemory}).(*datastore.MemoryDB)
+		assert.True(t, ok, "Memory data store expected")
+		_, ok = newDataStore(&Config{dataStore: util.DataStoreBoltDB, dbName: dbName}).(*datastore.BoltDB)
+		assert.True(t, ok, "Bolt data store expected")
+	})
+}
+
+func TestPTRZonesValidation(t *testing.T) {
+	patch1 := gomonkey.ApplyFunc(os.Exit, func(code int) { // Empty Impl
+		panic(panicProblem)
+	})
+	defer patch1.Reset()
+
+	assert.Nil(t, validatePTRZones(""))
+	assert.Equal(t, datastore.ReverseZones{".", "example.com.", "*"}, validatePTRZones(". , example.com,*"))
+
+	defer func() {
+		r := recover()
+		if r != panicProblem {
+			t.Errorf("%s %v", ePanic, r)
+		}
+	}()
+	validatePTRZones(strings.Repeat("a", util.MaxDNSFQDNLength))
+}
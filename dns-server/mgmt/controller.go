@@ -18,9 +18,11 @@
 package mgmt
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -55,16 +57,24 @@ func (e *Controller) StartController(store *datastore.DataStore, ipAddr net.IP,
 	e.dataStore = *store
 
 	// Start server
-	e.echo.Logger.Fatal(e.echo.Start(fmt.Sprintf("%s:%d", ipAddr.String(), port)))
+	err := e.echo.Start(fmt.Sprintf("%s:%d", ipAddr.String(), port))
+	if err != nil && err != http.ErrServerClosed {
+		e.echo.Logger.Fatal(err)
+	}
 }
 
+// StopController stops accepting new requests and waits for the ones in progress to complete.
 func (e *Controller) StopController() error {
-	e.dataStore = nil
 	if e.echo == nil {
+		e.dataStore = nil
 		return nil
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), util.ShutdownTimeout*time.Second)
+	defer cancel()
+	err := e.echo.Shutdown(ctx)
+	e.dataStore = nil
 
-	return e.echo.Close()
+	return err
 }
 
 func (e *Controller) handleAddResourceRecords(c echo.Context) error {
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package querylog dns query logging(dnstap and json)
+package querylog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// unixSocketPrefix dnstap target prefix for the unix socket output.
+	unixSocketPrefix = "unix:"
+	// dnstapIdentity identity reported in the dnstap frames.
+	dnstapIdentity = "edgegallery-dns-server"
+)
+
+// dnstapOutput frame stream output of the dnstap messages.
+type dnstapOutput struct {
+	output dnstap.Output
+	file   *os.File
+}
+
+func newDnstapOutput(target string) (*dnstapOutput, error) {
+	d := &dnstapOutput{}
+	if strings.HasPrefix(target, unixSocketPrefix) {
+		socketPath := strings.TrimPrefix(strings.TrimPrefix(target, unixSocketPrefix), "//")
+		if len(socketPath) == 0 {
+			return nil, fmt.Errorf("dnstap socket path missing")
+		}
+		output, err := dnstap.NewFrameStreamSockOutput(&net.UnixAddr{Name: socketPath, Net: "unix"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the dnstap socket output")
+		}
+		d.output = output
+	} else {
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the dnstap file")
+		}
+		output, err := dnstap.NewFrameStreamOutput(file)
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to create the dnstap file output")
+		}
+		d.output = output
+		d.file = file
+	}
+	go d.output.RunOutputLoop()
+
+	return d, nil
+}
+
+// write encodes the record as a CLIENT_RESPONSE dnstap message, frames are dropped if the output is congested so
+// that the query processing is never blocked on logging.
+func (d *dnstapOutput) write(record *Record) {
+	frame, err := proto.Marshal(newDnstapMessage(record))
+	if err != nil {
+		log.Errorf("Failed to encode the dnstap message.")
+		return
+	}
+	select {
+	case d.output.GetOutputChannel() <- frame:
+	default:
+		log.Debugf("Dnstap output congested, dropping the message.")
+	}
+}
+
+func (d *dnstapOutput) close() {
+	d.output.Close()
+	if d.file != nil {
+		if err := d.file.Close(); err != nil {
+			log.Errorf("Failed to close the dnstap file.")
+		}
+	}
+}
+
+func newDnstapMessage(record *Record) *dnstap.Dnstap {
+	msgType := dnstap.Message_CLIENT_RESPONSE
+	msg := &dnstap.Message{Type: &msgType}
+
+	ip, port := splitAddr(record.ClientAddr)
+	if ip != nil {
+		family := dnstap.SocketFamily_INET6
+		if ip4 := ip.To4(); ip4 != nil {
+			family = dnstap.SocketFamily_INET
+			ip = ip4
+		}
+		protocol := dnstap.SocketProtocol_UDP
+		if _, ok := record.ClientAddr.(*net.TCPAddr); ok {
+			protocol = dnstap.SocketProtocol_TCP
+		}
+		msg.SocketFamily = &family
+		msg.SocketProtocol = &protocol
+		msg.QueryAddress = ip
+		msg.QueryPort = &port
+	}
+
+	querySec, queryNsec := uint64(record.QueryTime.Unix()), uint32(record.QueryTime.Nanosecond())
+	msg.QueryTimeSec, msg.QueryTimeNsec = &querySec, &queryNsec
+	if record.Query != nil {
+		if packed, err := record.Query.Pack(); err == nil {
+			msg.QueryMessage = packed
+		}
+	}
+	responseSec, responseNsec := uint64(record.ResponseTime.Unix()), uint32(record.ResponseTime.Nanosecond())
+	msg.ResponseTimeSec, msg.ResponseTimeNsec = &responseSec, &responseNsec
+	if record.Response != nil {
+		if packed, err := record.Response.Pack(); err == nil {
+			msg.ResponseMessage = packed
+		}
+	}
+
+	tapType := dnstap.Dnstap_MESSAGE
+	return &dnstap.Dnstap{Type: &tapType, Identity: []byte(dnstapIdentity), Message: msg}
+}
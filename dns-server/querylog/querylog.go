@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package querylog dns query logging(dnstap and json)
+package querylog
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config query log configuration.
+type Config struct {
+	DnstapTarget string  // dnstap output, "unix:<socket path>" or a file path, empty to disable
+	JSONLogFile  string  // json query log file path, empty to disable
+	SampleRate   float64 // fraction of the queries to be logged(0~1]
+	KeepErrors   bool    // log all the failed queries irrespective of the sampling
+}
+
+// Record the details of a processed dns query.
+type Record struct {
+	Query           *dns.Msg
+	Response        *dns.Msg
+	ClientAddr      net.Addr
+	QueryTime       time.Time
+	ResponseTime    time.Time
+	AnsweredLocally bool
+}
+
+// QueryLogger emits the processed dns queries to the configured dnstap and json outputs.
+type QueryLogger struct {
+	config     Config
+	dnstap     *dnstapOutput
+	jsonLogger *log.Logger
+	jsonFile   *os.File
+	// mutex serializes Close with the in-flight Log calls, so no frame is sent on a closed output
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewQueryLogger creates the query logger as per the configuration, nil if no output is configured.
+func NewQueryLogger(config *Config) (*QueryLogger, error) {
+	if config == nil || (len(config.DnstapTarget) == 0 && len(config.JSONLogFile) == 0) {
+		return nil, nil
+	}
+	if config.SampleRate <= 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("query log sample rate not in valid range(0~1]")
+	}
+
+	q := &QueryLogger{config: *config}
+	if len(config.DnstapTarget) != 0 {
+		output, err := newDnstapOutput(config.DnstapTarget)
+		if err != nil {
+			return nil, err
+		}
+		q.dnstap = output
+	}
+	if len(config.JSONLogFile) != 0 {
+		file, err := os.OpenFile(config.JSONLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			q.Close()
+			return nil, fmt.Errorf("failed to open the query log file")
+		}
+		q.jsonFile = file
+		q.jsonLogger = log.New()
+		q.jsonLogger.SetOutput(file)
+		q.jsonLogger.SetFormatter(&log.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	}
+
+	return q, nil
+}
+
+// Log emits the query record if selected by the sampling.
+func (q *QueryLogger) Log(record *Record) {
+	if !q.isSampled(record) {
+		return
+	}
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.closed {
+		return
+	}
+	if q.dnstap != nil {
+		q.dnstap.write(record)
+	}
+	if q.jsonLogger != nil {
+		q.jsonLogger.WithFields(jsonFields(record)).WithTime(record.QueryTime).Info("dns query")
+	}
+}
+
+// Close flushes and closes all the outputs, the records logged after close are discarded.
+func (q *QueryLogger) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	if q.dnstap != nil {
+		q.dnstap.close()
+		q.dnstap = nil
+	}
+	if q.jsonFile != nil {
+		if err := q.jsonFile.Close(); err != nil {
+			log.Errorf("Failed to close the query log file.")
+		}
+		q.jsonFile = nil
+		q.jsonLogger = nil
+	}
+}
+
+func (q *QueryLogger) isSampled(record *Record) bool {
+	if q.config.KeepErrors && (record.Response == nil || record.Response.Rcode != dns.RcodeSuccess) {
+		return true
+	}
+	if q.config.SampleRate >= 1 {
+		return true
+	}
+
+	return rand.Float64() < q.config.SampleRate
+}
+
+func jsonFields(record *Record) log.Fields {
+	fields := log.Fields{
+		"clientIp":        "",
+		"qname":           "",
+		"qtype":           "",
+		"rcode":           dns.RcodeToString[dns.RcodeServerFailure],
+		"answeredLocally": record.AnsweredLocally,
+		"latencyUs":       record.ResponseTime.Sub(record.QueryTime).Microseconds(),
+	}
+	if ip, _ := splitAddr(record.ClientAddr); ip != nil {
+		fields["clientIp"] = ip.String()
+	}
+	if record.Query != nil && len(record.Query.Question) != 0 {
+		fields["qname"] = record.Query.Question[0].Name
+		fields["qtype"] = dns.Type(record.Query.Question[0].Qtype).String()
+	}
+	if record.Response != nil {
+		fields["rcode"] = dns.RcodeToString[record.Response.Rcode]
+	}
+
+	return fields
+}
+
+// splitAddr returns the ip and port of an udp/tcp address.
+func splitAddr(addr net.Addr) (net.IP, uint32) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, uint32(a.Port)
+	case *net.TCPAddr:
+		return a.IP, uint32(a.Port)
+	default:
+		return nil, 0
+	}
+}
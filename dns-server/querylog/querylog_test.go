@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+const exampleDomain = "www.example.com."
+
+func newTestRecord(rcode int, local bool) *Record {
+	query := &dns.Msg{Question: []dns.Question{{Name: exampleDomain, Qtype: dns.TypeA, Qclass: dns.ClassINET}}}
+	response := new(dns.Msg)
+	response.SetRcode(query, rcode)
+	queryTime := time.Now()
+
+	return &Record{Query: query, Response: response,
+		ClientAddr:   &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5353},
+		QueryTime:    queryTime,
+		ResponseTime: queryTime.Add(1500 * time.Microsecond), AnsweredLocally: local}
+}
+
+func TestJSONQueryLog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "querylog")
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "query.log")
+
+	logger, err := NewQueryLogger(&Config{JSONLogFile: logFile, SampleRate: 1})
+	assert.Equal(t, nil, err, "Error in creating the query logger")
+	logger.Log(newTestRecord(dns.RcodeSuccess, true))
+	logger.Close()
+
+	file, err := os.Open(logFile)
+	assert.Equal(t, nil, err, "Query log file not created")
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	assert.True(t, scanner.Scan(), "Query log entry missing")
+	entry := map[string]interface{}{}
+	assert.Equal(t, nil, json.Unmarshal(scanner.Bytes(), &entry), "Query log entry is not json")
+	assert.Equal(t, "192.0.2.10", entry["clientIp"])
+	assert.Equal(t, exampleDomain, entry["qname"])
+	assert.Equal(t, "A", entry["qtype"])
+	assert.Equal(t, "NOERROR", entry["rcode"])
+	assert.Equal(t, true, entry["answeredLocally"])
+	assert.Equal(t, float64(1500), entry["latencyUs"])
+}
+
+func TestDnstapFileOutput(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "querylog")
+	defer os.RemoveAll(dir)
+	tapFile := filepath.Join(dir, "query.dnstap")
+
+	logger, err := NewQueryLogger(&Config{DnstapTarget: tapFile, SampleRate: 1})
+	assert.Equal(t, nil, err, "Error in creating the query logger")
+	logger.Log(newTestRecord(dns.RcodeNameError, false))
+	logger.Close()
+
+	input, err := dnstap.NewFrameStreamInputFromFilename(tapFile)
+	assert.Equal(t, nil, err, "Error in reading the dnstap file")
+	frames := make(chan []byte, 1)
+	go input.ReadInto(frames)
+	input.Wait()
+
+	tap := &dnstap.Dnstap{}
+	assert.Equal(t, nil, proto.Unmarshal(<-frames, tap), "Error in decoding the dnstap frame")
+	assert.Equal(t, dnstap.Message_CLIENT_RESPONSE, tap.Message.GetType())
+	assert.Equal(t, dnstap.SocketFamily_INET, tap.Message.GetSocketFamily())
+	assert.Equal(t, net.ParseIP("192.0.2.10").To4(), net.IP(tap.Message.GetQueryAddress()))
+	response := new(dns.Msg)
+	assert.Equal(t, nil, response.Unpack(tap.Message.GetResponseMessage()), "Error in unpacking the response")
+	assert.Equal(t, dns.RcodeNameError, response.Rcode)
+}
+
+func TestQueryLogConcurrentClose(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "querylog")
+	defer os.RemoveAll(dir)
+
+	logger, err := NewQueryLogger(&Config{DnstapTarget: filepath.Join(dir, "query.dnstap"),
+		JSONLogFile: filepath.Join(dir, "query.log"), SampleRate: 1})
+	assert.Equal(t, nil, err, "Error in creating the query logger")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				logger.Log(newTestRecord(dns.RcodeSuccess, true))
+			}
+		}()
+	}
+	logger.Close()
+	wg.Wait()
+	logger.Close()
+}
+
+func TestQueryLogSampling(t *testing.T) {
+	logger := &QueryLogger{config: Config{SampleRate: 0.0001, KeepErrors: true}}
+	assert.True(t, logger.isSampled(newTestRecord(dns.RcodeServerFailure, false)), "Errors must be kept")
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if logger.isSampled(newTestRecord(dns.RcodeSuccess, true)) {
+			sampled++
+		}
+	}
+	assert.Less(t, sampled, 100, "Sample rate not applied")
+
+	logger.config.KeepErrors = false
+	logger.config.SampleRate = 1
+	assert.True(t, logger.isSampled(newTestRecord(dns.RcodeSuccess, true)), "All queries must be logged")
+}
+
+func TestQueryLoggerConfig(t *testing.T) {
+	logger, err := NewQueryLogger(&Config{SampleRate: 1})
+	assert.Nil(t, logger, "Logger not expected without outputs")
+	assert.Equal(t, nil, err)
+
+	_, err = NewQueryLogger(&Config{JSONLogFile: "query.log", SampleRate: 1.5})
+	assert.EqualError(t, err, "query log sample rate not in valid range(0~1]")
+
+	_, err = NewQueryLogger(&Config{DnstapTarget: "unix:", SampleRate: 1})
+	assert.EqualError(t, err, "dnstap socket path missing")
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package main
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"dns-server/cache"
+	"dns-server/util"
+)
+
+// ACLConfig client networks allowed to query the dns server, deny takes precedence over allow. All the clients are
+// allowed if the allow list is empty.
+type ACLConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// RuntimeConfig settings which can be changed at runtime through the config file and a SIGHUP. Settings missing in
+// the file keep the values from the command line.
+//
+// Example:
+//
+//	{
+//		"forwarders": ["8.8.8.8", "8.8.4.4:53"],
+//		"loadBalance": true,
+//		"acl": {"allow": ["10.0.0.0/8"], "deny": ["10.10.0.0/16"]},
+//		"logLevel": "info",
+//		"cacheSize": 1024
+//	}
+type RuntimeConfig struct {
+	Forwarders  []string   `json:"forwarders,omitempty"`
+	LoadBalance *bool      `json:"loadBalance,omitempty"`
+	ACL         *ACLConfig `json:"acl,omitempty"`
+	LogLevel    string     `json:"logLevel,omitempty"`
+	CacheSize   *int       `json:"cacheSize,omitempty"`
+}
+
+// runtimeState validated runtime settings, replaced as a whole on reload.
+type runtimeState struct {
+	forwarders  []string
+	loadBalance bool
+	allowNets   []*net.IPNet
+	denyNets    []*net.IPNet
+	logLevel    log.Level
+	cache       *cache.ResponseCache
+}
+
+// loadRuntimeConfig reads the runtime config file.
+func loadRuntimeConfig(configFile string) (*RuntimeConfig, error) {
+	configBytes, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the config file")
+	}
+	if len(configBytes) > util.MaxConfigFileSize {
+		return nil, fmt.Errorf("config file too large")
+	}
+	runtimeConfig := &RuntimeConfig{}
+	if err = json.Unmarshal(configBytes, runtimeConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse the config file")
+	}
+
+	return runtimeConfig, nil
+}
+
+// newRuntimeState validates the runtime config over the base one. The response cache is reused from the previous
+// state if neither its size nor the forwarders changed, forwarded responses are not cached without a size.
+func newRuntimeState(base *RuntimeConfig, override *RuntimeConfig, prev *runtimeState) (*runtimeState, error) {
+	merged := *base
+	if override != nil {
+		if override.Forwarders != nil {
+			merged.Forwarders = override.Forwarders
+		}
+		if override.LoadBalance != nil {
+			merged.LoadBalance = override.LoadBalance
+		}
+		if override.ACL != nil {
+			merged.ACL = override.ACL
+		}
+		if len(override.LogLevel) != 0 {
+			merged.LogLevel = override.LogLevel
+		}
+		if override.CacheSize != nil {
+			merged.CacheSize = override.CacheSize
+		}
+	}
+
+	state := &runtimeState{logLevel: log.InfoLevel}
+	for _, forwarder := range merged.Forwarders {
+		address, err := parseForwarder(forwarder)
+		if err != nil {
+			return nil, err
+		}
+		if len(address) != 0 {
+			state.forwarders = append(state.forwarders, address)
+		}
+	}
+	if merged.LoadBalance != nil {
+		state.loadBalance = *merged.LoadBalance
+	}
+	if merged.ACL != nil {
+		var err error
+		if state.allowNets, err = parseNetworks(merged.ACL.Allow); err != nil {
+			return nil, err
+		}
+		if state.denyNets, err = parseNetworks(merged.ACL.Deny); err != nil {
+			return nil, err
+		}
+	}
+	if len(merged.LogLevel) != 0 {
+		level, err := log.ParseLevel(merged.LogLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level(%s)", merged.LogLevel)
+		}
+		state.logLevel = level
+	}
+	if merged.CacheSize != nil {
+		if *merged.CacheSize < 0 || *merged.CacheSize > util.MaxCacheSize {
+			return nil, fmt.Errorf("cache size not in valid range(0~%d)", util.MaxCacheSize)
+		}
+		if *merged.CacheSize > 0 {
+			if prev != nil && prev.cache != nil && prev.cache.Size() == *merged.CacheSize &&
+				reflect.DeepEqual(prev.forwarders, state.forwarders) {
+				state.cache = prev.cache
+			} else {
+				state.cache = cache.NewResponseCache(*merged.CacheSize)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// isAllowed checks the client address against the acl.
+func (r *runtimeState) isAllowed(addr net.Addr) bool {
+	if len(r.allowNets) == 0 && len(r.denyNets) == 0 {
+		return true
+	}
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range r.denyNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	if len(r.allowNets) == 0 {
+		return true
+	}
+	for _, ipNet := range r.allowNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseForwarder validates the forwarder ip with optional port, returns empty for the unspecified address.
+func parseForwarder(forwarder string) (string, error) {
+	host, port := forwarder, strconv.Itoa(util.DefaultDNSPort)
+	if h, p, err := net.SplitHostPort(forwarder); err == nil {
+		host, port = h, p
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("invalid forwarder(%s), not in ipv4/ipv6 format", forwarder)
+	}
+	if ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return "", fmt.Errorf("invalid forwarder(%s), multicast or broadcast ip address", forwarder)
+	}
+	if portNum, err := strconv.Atoi(port); err != nil || portNum <= 0 || portNum > util.MaxPortNumber {
+		return "", fmt.Errorf("invalid forwarder(%s), port number not in valid range", forwarder)
+	}
+	if ip.IsUnspecified() {
+		return "", nil
+	}
+
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+func parseNetworks(networks []string) ([]*net.IPNet, error) {
+	var ipNets []*net.IPNet
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid acl network(%s)", network)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+
+	return ipNets, nil
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"dns-server/datastore"
+	"dns-server/mgmt"
+	"dns-server/util"
+)
+
+const errorInReload = "Error in reload"
+
+func newRuntimeTestServer(t *testing.T, configFile string) *Server {
+	config := &Config{forwarder: net.ParseIP("8.8.8.8"), configFile: configFile}
+	store := &datastore.MemoryDB{TTL: util.DefaultTTL}
+	assert.NoError(t, store.Open())
+
+	return NewServer(config, store, &mgmt.Controller{})
+}
+
+func writeRuntimeConfig(t *testing.T, dir string, content string) string {
+	configFile := filepath.Join(dir, "dns-config.json")
+	assert.NoError(t, ioutil.WriteFile(configFile, []byte(content), 0600))
+
+	return configFile
+}
+
+func TestRuntimeReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-runtime")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer log.SetLevel(log.GetLevel())
+
+	t.Run("FlagDefaults", func(t *testing.T) {
+		dnsServer := newRuntimeTestServer(t, "")
+		state := dnsServer.runtimeState()
+		assert.Equal(t, []string{"8.8.8.8:53"}, state.forwarders, errorInReload)
+		assert.False(t, state.loadBalance, errorInReload)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+	})
+
+	t.Run("ConfigFile", func(t *testing.T) {
+		log.SetLevel(log.InfoLevel)
+		configFile := writeRuntimeConfig(t, dir, `{"forwarders": ["1.1.1.1", "[2001:db8::1]:5353"],
+			"loadBalance": true, "logLevel": "debug"}`)
+		dnsServer := newRuntimeTestServer(t, configFile)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+
+		state := dnsServer.runtimeState()
+		assert.Equal(t, []string{"1.1.1.1:53", "[2001:db8::1]:5353"}, state.forwarders, errorInReload)
+		assert.True(t, state.loadBalance, errorInReload)
+		assert.Equal(t, log.DebugLevel, log.GetLevel(), errorInReload)
+
+		// Settings removed from the file fall back to the startup values
+		writeRuntimeConfig(t, dir, `{"loadBalance": true}`)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+		assert.Equal(t, []string{"8.8.8.8:53"}, dnsServer.runtimeState().forwarders, errorInReload)
+		assert.Equal(t, log.InfoLevel, log.GetLevel(), errorInReload)
+	})
+
+	t.Run("InvalidConfigKeepsCurrent", func(t *testing.T) {
+		configFile := writeRuntimeConfig(t, dir, `{"forwarders": ["1.1.1.1"]}`)
+		dnsServer := newRuntimeTestServer(t, configFile)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+
+		for _, content := range []string{`{"forwarders": ["224.0.0.1"]}`, `{"acl": {"allow": ["10.0.0/8"]}}`,
+			`{"logLevel": "verbose"}`, `{"forwarders": `} {
+			writeRuntimeConfig(t, dir, content)
+			assert.Error(t, dnsServer.ReloadConfigFile(), content)
+			assert.Equal(t, []string{"1.1.1.1:53"}, dnsServer.runtimeState().forwarders, content)
+		}
+	})
+
+	t.Run("CacheSize", func(t *testing.T) {
+		configFile := writeRuntimeConfig(t, dir, `{"cacheSize": 2}`)
+		dnsServer := newRuntimeTestServer(t, configFile)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+		state := dnsServer.runtimeState()
+		assert.Equal(t, 2, state.cache.Size(), errorInReload)
+
+		req := &dns.Msg{}
+		req.SetQuestion(exampleDomain, dns.TypeA)
+		rsp := &dns.Msg{}
+		rsp.SetReply(req)
+		rsp.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: exampleDomain, Rrtype: dns.TypeA,
+			Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.1.1.1")}}
+		state.cache.Set(req, rsp)
+
+		// The cached responses are kept while the size is unchanged
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+		assert.Same(t, state.cache, dnsServer.runtimeState().cache, errorInReload)
+		cached, err := dnsServer.forward(dnsServer.runtimeState(), req)
+		assert.NoError(t, err, errorInReload)
+		assert.Equal(t, rsp.Answer[0].String(), cached.Answer[0].String(), errorInReload)
+
+		writeRuntimeConfig(t, dir, `{"cacheSize": 10}`)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+		assert.Equal(t, 10, dnsServer.runtimeState().cache.Size(), errorInReload)
+		assert.Equal(t, 0, dnsServer.runtimeState().cache.Len(), errorInReload)
+
+		// Without a size the forwarded responses are not cached
+		writeRuntimeConfig(t, dir, `{}`)
+		assert.NoError(t, dnsServer.ReloadConfigFile(), errorInReload)
+		assert.Nil(t, dnsServer.runtimeState().cache, errorInReload)
+
+		writeRuntimeConfig(t, dir, `{"cacheSize": -1}`)
+		assert.Error(t, dnsServer.ReloadConfigFile(), errorInReload)
+	})
+
+	t.Run("ACL", func(t *testing.T) {
+		dnsServer := newRuntimeTestServer(t, "")
+		req := &dns.Msg{Question: []dns.Question{{Name: exampleDomain, Qtype: dns.TypeA, Qclass: dns.ClassINET}}}
+
+		err := dnsServer.Reload(&RuntimeConfig{ACL: &ACLConfig{Deny: []string{defaultTestForwarder}}})
+		assert.NoError(t, err, errorInReload)
+		mockDnsWriter := &mockDnsRespWriter{}
+		dnsServer.handleDNS(mockDnsWriter, req)
+		assert.Equal(t, dns.RcodeRefused, mockDnsWriter.rspMsg.Rcode, errorInResponse)
+
+		err = dnsServer.Reload(&RuntimeConfig{ACL: &ACLConfig{Allow: []string{"0.0.0.0/0"},
+			Deny: []string{"2001:db8::/32"}}})
+		assert.NoError(t, err, errorInReload)
+		assert.True(t, dnsServer.runtimeState().isAllowed(&net.UDPAddr{IP: net.ParseIP("10.1.1.1")}))
+		assert.False(t, dnsServer.runtimeState().isAllowed(&net.TCPAddr{IP: net.ParseIP("2001:db8::5")}))
+		assert.False(t, dnsServer.runtimeState().isAllowed(&net.TCPAddr{IP: net.ParseIP("2001:db9::5")}))
+	})
+}
+
+type failingStopController struct {
+	mgmt.Controller
+}
+
+func (f *failingStopController) StopController() error {
+	return errors.New("shutdown timeout")
+}
+
+type closeTrackingStore struct {
+	*datastore.MemoryDB
+	closed bool
+}
+
+func (c *closeTrackingStore) Close() error {
+	c.closed = true
+	return c.MemoryDB.Close()
+}
+
+func TestStopClosesStoreOnControllerError(t *testing.T) {
+	store := &closeTrackingStore{MemoryDB: &datastore.MemoryDB{TTL: util.DefaultTTL}}
+	assert.NoError(t, store.Open())
+	dnsServer := NewServer(&Config{}, store, &failingStopController{})
+
+	dnsServer.Stop()
+	assert.True(t, store.closed, "Data store not closed when the controller fails to stop")
+}
+
+func TestWaitForSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-signal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Keep the signals from terminating the test process before waitForSignal subscribes
+	guard := make(chan os.Signal, 10)
+	signal.Notify(guard, syscall.SIGHUP, syscall.SIGTERM)
+	defer signal.Stop(guard)
+
+	configFile := writeRuntimeConfig(t, dir, `{"forwarders": ["1.1.1.1"]}`)
+	dnsServer := newRuntimeTestServer(t, configFile)
+
+	done := make(chan struct{})
+	go func() {
+		waitForSignal(dnsServer)
+		close(done)
+	}()
+
+	reloaded := false
+	for i := 0; i < 50 && !reloaded; i++ {
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+		time.Sleep(20 * time.Millisecond)
+		reloaded = len(dnsServer.runtimeState().forwarders) == 1 &&
+			dnsServer.runtimeState().forwarders[0] == "1.1.1.1:53"
+	}
+	assert.True(t, reloaded, "Runtime config not reloaded on SIGHUP")
+
+	stopped := false
+	for i := 0; i < 50 && !stopped; i++ {
+		assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+		select {
+		case <-done:
+			stopped = true
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	assert.True(t, stopped, "Signal wait not returned on SIGTERM")
+}
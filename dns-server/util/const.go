@@ -44,6 +44,24 @@ const (
 	DefaultIP = "0.0.0.0"
 	// MaxPacketSize  Maximum packet size.
 	MaxPacketSize = "4K"
+	// DataStoreBoltDB  Bolt db data store type.
+	DataStoreBoltDB = "boltdb"
+	// DataStoreMemory  In-memory data store type.
+	DataStoreMemory = "memory"
+	// DataStoreEtcd  Etcd data store type.
+	DataStoreEtcd = "etcd"
+	// DefaultDataStore  Default data store type.
+	DefaultDataStore = DataStoreBoltDB
+	// DefaultEtcdEndpoint  Default etcd endpoint.
+	DefaultEtcdEndpoint = "127.0.0.1:2379"
+	// DefaultQueryLogSampleRate  Default query log sample rate, all queries.
+	DefaultQueryLogSampleRate = 1.0
+	// MaxConfigFileSize  Maximum runtime config file size.
+	MaxConfigFileSize = 64 * 1024
+	// MaxCacheSize  Maximum number of cached responses.
+	MaxCacheSize = 100000
+	// ShutdownTimeout  Time in seconds to drain the in-flight queries on shutdown.
+	ShutdownTimeout = 5
 )
 
 const MaxDNSFQDNLength = 253
@@ -14,10 +14,12 @@
 
 local BasePlugin = require "kong.plugins.base_plugin"
 local jwt_decoder = require "kong.plugins.jwt.jwt_parser"
+local resty_sha256 = require "resty.sha256"
 
 
 local kong = kong
 local type = type
+local ipairs = ipairs
 local re_gmatch = ngx.re.gmatch
 
 local AddAppIdHeaderHandler = {}
@@ -51,7 +53,61 @@ local function retrieve_token()
 end
 
 
-local function add_app_id_check_ip()
+local function is_service_granted(claims, service_name)
+  local services = claims["services"]
+  if type(services) ~= "table" then
+    return false
+  end
+  for _, name in ipairs(services) do
+    if name == service_name then
+      return true
+    end
+  end
+  return false
+end
+
+
+-- the revocations are published by mepauth to the plugin configuration
+local function is_token_revoked(claims, conf)
+  local jti = claims["jti"]
+  if jti and conf.revoked_tokens and conf.revoked_tokens[jti] then
+    return true
+  end
+  local generation = conf.revoked_apps and conf.revoked_apps[claims["sub"]]
+  if generation and (tonumber(claims["gen"]) or 0) < generation then
+    return true
+  end
+  return false
+end
+
+
+-- SHA-256 thumbprint of the client certificate the app presented as per RFC 8705 section 3.1
+local function client_cert_thumbprint()
+  local cert_pem = ngx.var.ssl_client_raw_cert
+  if not cert_pem or cert_pem == "" then
+    return nil
+  end
+  local cert_der = ngx.decode_base64((cert_pem:gsub("%-%-%-%-%-[^%-]+%-%-%-%-%-", ""):gsub("%s", "")))
+  if not cert_der then
+    return nil
+  end
+  local sha256 = resty_sha256:new()
+  sha256:update(cert_der)
+  return (ngx.encode_base64(sha256:final(), true):gsub("%+", "-"):gsub("/", "_"))
+end
+
+
+-- the token bound to a client certificate is accepted only along with the same certificate
+local function is_cert_bound_mismatch(claims)
+  local cnf = claims["cnf"]
+  if type(cnf) ~= "table" or not cnf["x5t#S256"] then
+    return false
+  end
+  return client_cert_thumbprint() ~= cnf["x5t#S256"]
+end
+
+
+local function add_app_id_check_ip(conf)
   local token, err = retrieve_token()
   if err then
     kong.log.err(err)
@@ -70,6 +126,16 @@ local function add_app_id_check_ip()
 
   local app_id = claims["sub"]
 
+  -- check the token is not revoked
+  if is_token_revoked(claims, conf) then
+    return false
+  end
+
+  -- check the client certificate the token is bound to
+  if is_cert_bound_mismatch(claims) then
+    return false
+  end
+
   -- check client ip same
   local remote_addr = ngx.var.remote_addr
 
@@ -79,20 +145,34 @@ local function add_app_id_check_ip()
     return false
   end
 
+  -- check the service is in the scope of the token
+  if conf.service_name and not is_service_granted(claims, conf.service_name) then
+    return true, nil, true
+  end
+
   local set_header = kong.service.request.set_header
   local clear_header = kong.service.request.clear_header
   clear_header("X-AppinstanceID")
   set_header("X-AppinstanceID", app_id)
+  -- the verified scopes of the token, mep server denies the operations not granted
+  clear_header("X-Token-Scope")
+  local scope = claims["scope"]
+  if type(scope) == "string" and scope ~= "" then
+    set_header("X-Token-Scope", scope)
+  end
   return true
 end
 
 
 function AddAppIdHeaderHandler:access(conf)
-  local ok, err = add_app_id_check_ip()
+  local ok, err, forbidden = add_app_id_check_ip(conf)
   if err then
     kong.log.err(err)
     return kong.response.exit(500, { message = "Unexpected error."})
   end
+  if forbidden then
+    return kong.response.exit(403, { message = "Forbidden" })
+  end
   if not ok then
     return kong.response.exit(401, { message = "Unauthorized" })
   end
@@ -23,6 +23,14 @@ local schema = {
         -- The 'config' record is the custom part of the plugin schema
         type = "record",
         fields = {
+          -- The service whose name the token must grant, no check when not set
+          { service_name = { type = "string", required = false }, },
+          -- The tokens revoked by their clients, keyed by jti along with their expiry
+          { revoked_tokens = { type = "map", keys = { type = "string" }, values = { type = "integer" },
+                               required = true, default = {} }, },
+          -- The tokens of the app instances issued before the generation are revoked
+          { revoked_apps = { type = "map", keys = { type = "string" }, values = { type = "integer" },
+                             required = true, default = {} }, },
         },
       },
     },
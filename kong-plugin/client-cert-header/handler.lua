@@ -0,0 +1,37 @@
+-- Copyright 2021 Huawei Technologies Co., Ltd.
+--
+-- Licensed under the Apache License, Version 2.0 (the "License");
+-- you may not use this file except in compliance with the License.
+-- You may obtain a copy of the License at
+--
+--     http://www.apache.org/licenses/LICENSE-2.0
+--
+-- Unless required by applicable law or agreed to in writing, software
+-- distributed under the License is distributed on an "AS IS" BASIS,
+-- WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+-- See the License for the specific language governing permissions and
+-- limitations under the License.
+
+local kong = kong
+
+local ClientCertHeaderHandler = {}
+
+
+ClientCertHeaderHandler.VERSION  = "1.0.0"
+ClientCertHeaderHandler.PRIORITY = 1000
+
+
+local CLIENT_CERT_HEADER = "X-Client-Cert"
+
+
+-- forwards the client certificate the app presented to the upstream, which trusts the header only on the
+-- connections kong makes with its own client certificate
+function ClientCertHeaderHandler:access(conf)
+  kong.service.request.clear_header(CLIENT_CERT_HEADER)
+  local escaped_cert = ngx.var.ssl_client_escaped_cert
+  if escaped_cert and escaped_cert ~= "" then
+    kong.service.request.set_header(CLIENT_CERT_HEADER, escaped_cert)
+  end
+end
+
+return ClientCertHeaderHandler
@@ -17,6 +17,10 @@
 // Package adapter contains database interface and implements database adapter
 package adapter
 
+import (
+	"github.com/astaxie/beego/orm"
+)
+
 // Database API's
 type Database interface {
 	// InitDatabase initializes database
@@ -33,4 +37,59 @@ type Database interface {
 
 	// DeleteData deletes data from database
 	DeleteData(data interface{}, cols ...string) (err error)
+
+	// QueryTable reads all the records of a table from database
+	QueryTable(tableName string, container interface{}) (num int64, err error)
+
+	// UpdateDataIf updates the columns of the record only if the stored record still holds the expected values keyed
+	// by column, returns false if the record was modified or removed meanwhile
+	UpdateDataIf(data interface{}, expected map[string]interface{}, cols ...string) (bool, error)
+
+	// QueryData reads the records of a table holding the filter values keyed by column, a column suffixed with __lt
+	// holds lower values. The records are ordered by the column, descending when it is prefixed with -, and at most
+	// limit of them are read
+	QueryData(tableName string, container interface{}, filter map[string]interface{}, orderBy string,
+		limit int) (num int64, err error)
+}
+
+// Create the tables of the registered models and add their new columns, shared by the sql databases. The changes
+// of the existing data follow as versioned migrations. The database and its user are created beforehand as in
+// init.sql.sample
+func syncSchema() error {
+	return orm.RunSyncdb(Default, false, true)
+}
+
+// Filtered query of the sql databases, the filter columns are beego orm expressions
+func queryData(ormer orm.Ormer, tableName string, container interface{}, filter map[string]interface{},
+	orderBy string, limit int) (int64, error) {
+	querySeter := ormer.QueryTable(tableName)
+	for col, value := range filter {
+		querySeter = querySeter.Filter(col, value)
+	}
+	return querySeter.OrderBy(orderBy).Limit(limit).All(container)
+}
+
+// Conditional update of the sql databases, the primary key and the expected values filter the updated row
+func updateDataIf(ormer orm.Ormer, data interface{}, expected map[string]interface{}, cols []string) (bool, error) {
+	record, _, err := modelOf(data)
+	if err != nil {
+		return false, err
+	}
+	pkCol, pk, err := primaryKeyColumnOf(record)
+	if err != nil {
+		return false, err
+	}
+	values, err := columnsOf(record, cols)
+	if err != nil {
+		return false, err
+	}
+	querySeter := ormer.QueryTable(data).Filter(pkCol, pk)
+	for col, value := range expected {
+		querySeter = querySeter.Filter(col, value)
+	}
+	num, err := querySeter.Update(values)
+	if err != nil {
+		return false, err
+	}
+	return num != 0, nil
 }
@@ -37,6 +37,20 @@ func getDbAdapter() (Database, error) {
 			return nil, errors.New("failed to register database")
 		}
 		return db, nil
+	case "sqlite":
+		db := &SqliteDb{}
+		err := db.InitDatabase()
+		if err != nil {
+			return nil, errors.New("failed to register database")
+		}
+		return db, nil
+	case "memory":
+		db := &MemoryDb{}
+		err := db.InitDatabase()
+		if err != nil {
+			return nil, errors.New("failed to register database")
+		}
+		return db, nil
 	default:
 		return nil, errors.New("no database is found")
 	}
@@ -47,6 +47,9 @@ func TestInitDatabase(t *testing.T) {
 			patches.ApplyMethod(reflect.TypeOf(db), "InitOrmer", func(*PgDb) error {
 				return nil
 			})
+			patches.ApplyMethod(reflect.TypeOf(db), "MigrateSchema", func(*PgDb) error {
+				return nil
+			})
 			err := db.InitDatabase()
 			So(err, ShouldBeNil)
 		})
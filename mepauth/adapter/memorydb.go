@@ -0,0 +1,359 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dbAdapter contains database interface and implements database adapter
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/astaxie/beego/orm"
+)
+
+const lowerThanOperator = "__lt"
+
+// MemoryDb in-memory database, the records are lost on restart, for unit tests and local development. The records
+// are the orm models, their tables and columns are named as beego orm names them
+type MemoryDb struct {
+	mutex  sync.RWMutex
+	tables map[string]map[string]reflect.Value
+}
+
+// InitDatabase initializes database of type memory
+func (db *MemoryDb) InitDatabase() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.tables = make(map[string]map[string]reflect.Value)
+	return nil
+}
+
+// InsertData inserts data into memory database
+func (db *MemoryDb) InsertData(data interface{}) (err error) {
+	record, tableName, err := modelOf(data)
+	if err != nil {
+		return err
+	}
+	pk, err := primaryKeyOf(record)
+	if err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	table := db.table(tableName)
+	if _, ok := table[pk]; ok {
+		return fmt.Errorf("duplicate key %s in table %s", pk, tableName)
+	}
+	table[pk] = copyOf(record)
+	return nil
+}
+
+// InsertOrUpdateData inserts or updates data into memory database, the conflict column is the primary key of all
+// the records
+func (db *MemoryDb) InsertOrUpdateData(data interface{}, cols ...string) (err error) {
+	record, tableName, err := modelOf(data)
+	if err != nil {
+		return err
+	}
+	pk, err := primaryKeyOf(record)
+	if err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.table(tableName)[pk] = copyOf(record)
+	return nil
+}
+
+// ReadData reads data from memory database by the columns, by the primary key when no column is given
+func (db *MemoryDb) ReadData(data interface{}, cols ...string) (err error) {
+	record, tableName, err := modelOf(data)
+	if err != nil {
+		return err
+	}
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	for _, stored := range db.tables[tableName] {
+		if isMatching(stored, record, cols) {
+			record.Set(stored)
+			return nil
+		}
+	}
+	return orm.ErrNoRows
+}
+
+// DeleteData deletes data from memory database by the columns, by the primary key when no column is given
+func (db *MemoryDb) DeleteData(data interface{}, cols ...string) (err error) {
+	record, tableName, err := modelOf(data)
+	if err != nil {
+		return err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	table := db.tables[tableName]
+	for pk, stored := range table {
+		if isMatching(stored, record, cols) {
+			delete(table, pk)
+		}
+	}
+	return nil
+}
+
+// QueryTable reads all the records of a table from memory database into a slice of the model or of its pointer
+func (db *MemoryDb) QueryTable(tableName string, container interface{}) (num int64, err error) {
+	return db.QueryData(tableName, container, nil, "", 0)
+}
+
+// QueryData reads the records of a table holding the filter values from memory database into a slice of the model or
+// of its pointer, all of them when the limit is not positive
+func (db *MemoryDb) QueryData(tableName string, container interface{}, filter map[string]interface{}, orderBy string,
+	limit int) (num int64, err error) {
+	slice := reflect.ValueOf(container)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return 0, errors.New("container must be a pointer to slice")
+	}
+	slice = slice.Elem()
+	isPtr := slice.Type().Elem().Kind() == reflect.Ptr
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	records := make([]reflect.Value, 0, len(db.tables[tableName]))
+	for _, stored := range db.tables[tableName] {
+		if isHolding(stored, filter) {
+			records = append(records, stored)
+		}
+	}
+	orderCol := strings.TrimPrefix(orderBy, "-")
+	isDescending := orderCol != orderBy
+	sort.SliceStable(records, func(i, j int) bool {
+		if isDescending {
+			return isLess(fieldOf(records[j], orderCol), fieldOf(records[i], orderCol))
+		}
+		return isLess(fieldOf(records[i], orderCol), fieldOf(records[j], orderCol))
+	})
+	for _, stored := range records {
+		if limit > 0 && num == int64(limit) {
+			break
+		}
+		record := copyOf(stored)
+		if isPtr {
+			record = record.Addr()
+		}
+		slice.Set(reflect.Append(slice, record))
+		num++
+	}
+	return num, nil
+}
+
+// UpdateDataIf updates the columns of the record in memory database only if it still holds the expected values
+func (db *MemoryDb) UpdateDataIf(data interface{}, expected map[string]interface{}, cols ...string) (bool, error) {
+	record, tableName, err := modelOf(data)
+	if err != nil {
+		return false, err
+	}
+	pk, err := primaryKeyOf(record)
+	if err != nil {
+		return false, err
+	}
+	values, err := columnsOf(record, cols)
+	if err != nil {
+		return false, err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	stored, ok := db.tables[tableName][pk]
+	if !ok {
+		return false, nil
+	}
+	updated := copyOf(stored)
+	for col, value := range expected {
+		field := fieldOf(updated, col)
+		if !field.IsValid() || !reflect.DeepEqual(field.Interface(), value) {
+			return false, nil
+		}
+	}
+	for col, value := range values {
+		fieldOf(updated, col).Set(reflect.ValueOf(value))
+	}
+	db.tables[tableName][pk] = updated
+	return true, nil
+}
+
+func (db *MemoryDb) table(tableName string) map[string]reflect.Value {
+	if db.tables == nil {
+		db.tables = make(map[string]map[string]reflect.Value)
+	}
+	table, ok := db.tables[tableName]
+	if !ok {
+		table = make(map[string]reflect.Value)
+		db.tables[tableName] = table
+	}
+	return table
+}
+
+// Get the record struct of the model pointer and its table name
+func modelOf(data interface{}) (reflect.Value, string, error) {
+	val := reflect.ValueOf(data)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, "", errors.New("data must be a pointer to struct")
+	}
+	if fun := val.MethodByName("TableName"); fun.IsValid() {
+		if names := fun.Call(nil); len(names) > 0 && names[0].Kind() == reflect.String {
+			return val.Elem(), names[0].String(), nil
+		}
+	}
+	return val.Elem(), snakeString(val.Elem().Type().Name()), nil
+}
+
+func primaryKeyOf(record reflect.Value) (string, error) {
+	recordType := record.Type()
+	for i := 0; i < recordType.NumField(); i++ {
+		if hasOrmOption(recordType.Field(i), "pk") {
+			return fmt.Sprint(record.Field(i).Interface()), nil
+		}
+	}
+	if id := record.FieldByName("Id"); id.IsValid() {
+		return fmt.Sprint(id.Interface()), nil
+	}
+	return "", fmt.Errorf("%s has no primary key", recordType.Name())
+}
+
+// Column name and value of the primary key as beego orm filters on them
+func primaryKeyColumnOf(record reflect.Value) (string, interface{}, error) {
+	recordType := record.Type()
+	for i := 0; i < recordType.NumField(); i++ {
+		if hasOrmOption(recordType.Field(i), "pk") {
+			return snakeString(recordType.Field(i).Name), record.Field(i).Interface(), nil
+		}
+	}
+	if id := record.FieldByName("Id"); id.IsValid() {
+		return "id", id.Interface(), nil
+	}
+	return "", nil, fmt.Errorf("%s has no primary key", recordType.Name())
+}
+
+// Values of the columns of the record keyed by column
+func columnsOf(record reflect.Value, cols []string) (orm.Params, error) {
+	values := orm.Params{}
+	for _, col := range cols {
+		field := fieldOf(record, col)
+		if !field.IsValid() {
+			return nil, fmt.Errorf("%s has no column %s", record.Type().Name(), col)
+		}
+		values[strings.ToLower(col)] = field.Interface()
+	}
+	return values, nil
+}
+
+func fieldOf(record reflect.Value, col string) reflect.Value {
+	recordType := record.Type()
+	for i := 0; i < recordType.NumField(); i++ {
+		if snakeString(recordType.Field(i).Name) == strings.ToLower(col) {
+			return record.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+func hasOrmOption(field reflect.StructField, option string) bool {
+	for _, tagOption := range strings.Split(field.Tag.Get("orm"), ";") {
+		if strings.TrimSpace(tagOption) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the stored record has the values of the record in the columns, in the primary key when no column is given
+func isMatching(stored reflect.Value, record reflect.Value, cols []string) bool {
+	if len(cols) == 0 {
+		storedPk, _ := primaryKeyOf(stored)
+		recordPk, err := primaryKeyOf(record)
+		return err == nil && storedPk == recordPk
+	}
+	recordType := record.Type()
+	for _, col := range cols {
+		matched := false
+		for i := 0; i < recordType.NumField(); i++ {
+			if snakeString(recordType.Field(i).Name) == strings.ToLower(col) {
+				matched = reflect.DeepEqual(stored.Field(i).Interface(), record.Field(i).Interface())
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Check the stored record holds the filter values keyed by column, a column suffixed with __lt holds lower values
+func isHolding(stored reflect.Value, filter map[string]interface{}) bool {
+	for col, value := range filter {
+		if strings.HasSuffix(col, lowerThanOperator) {
+			if !isLess(fieldOf(stored, strings.TrimSuffix(col, lowerThanOperator)), reflect.ValueOf(value)) {
+				return false
+			}
+			continue
+		}
+		field := fieldOf(stored, col)
+		if !field.IsValid() || !reflect.DeepEqual(field.Interface(), value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Order of the integer and string values, the values of the other kinds are not ordered
+func isLess(a reflect.Value, b reflect.Value) bool {
+	switch {
+	case isInt(a) && isInt(b):
+		return a.Int() < b.Int()
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return a.String() < b.String()
+	}
+	return false
+}
+
+func isInt(value reflect.Value) bool {
+	return value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64
+}
+
+func copyOf(record reflect.Value) reflect.Value {
+	stored := reflect.New(record.Type()).Elem()
+	stored.Set(record)
+	return stored
+}
+
+// Column and table name of the field and model names as beego orm names them, XxYy to xx_yy
+func snakeString(s string) string {
+	data := make([]byte, 0, len(s)*2)
+	j := false
+	for i := 0; i < len(s); i++ {
+		d := s[i]
+		if i > 0 && d >= 'A' && d <= 'Z' && j {
+			data = append(data, '_')
+		}
+		if d != '_' {
+			j = true
+		}
+		data = append(data, d)
+	}
+	return strings.ToLower(string(data))
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adapter
+
+import (
+	"testing"
+
+	"github.com/astaxie/beego/orm"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/models"
+)
+
+const (
+	testAppInsId = "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+	testAk       = "QVUJMSUMgS0VZLS0tLS0"
+)
+
+func TestMemoryDb(t *testing.T) {
+	Convey("memory db", t, func() {
+		db := &MemoryDb{}
+		So(db.InitDatabase(), ShouldBeNil)
+		So(db.InsertData(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: testAk, AppName: "app"}), ShouldBeNil)
+
+		Convey("reads by primary key and by column", func() {
+			record := &models.AuthInfoRecord{AppInsId: testAppInsId}
+			So(db.ReadData(record, "app_ins_id"), ShouldBeNil)
+			So(record.Ak, ShouldEqual, testAk)
+
+			record = &models.AuthInfoRecord{Ak: testAk}
+			So(db.ReadData(record, "ak"), ShouldBeNil)
+			So(record.AppInsId, ShouldEqual, testAppInsId)
+
+			So(db.ReadData(&models.AuthInfoRecord{Ak: "unknown"}, "ak"), ShouldEqual, orm.ErrNoRows)
+		})
+
+		Convey("keeps a copy of the record", func() {
+			record := &models.AuthInfoRecord{AppInsId: testAppInsId}
+			So(db.ReadData(record), ShouldBeNil)
+			record.AppName = "changed"
+			stored := &models.AuthInfoRecord{AppInsId: testAppInsId}
+			So(db.ReadData(stored), ShouldBeNil)
+			So(stored.AppName, ShouldEqual, "app")
+		})
+
+		Convey("inserts or updates by primary key", func() {
+			So(db.InsertData(&models.AuthInfoRecord{AppInsId: testAppInsId}), ShouldNotBeNil)
+			So(db.InsertOrUpdateData(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: "updated"},
+				"app_ins_id"), ShouldBeNil)
+			record := &models.AuthInfoRecord{AppInsId: testAppInsId}
+			So(db.ReadData(record, "app_ins_id"), ShouldBeNil)
+			So(record.Ak, ShouldEqual, "updated")
+		})
+
+		Convey("updates only the unchanged record", func() {
+			updated, err := db.UpdateDataIf(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: "rotated"},
+				map[string]interface{}{"ak": testAk}, "ak")
+			So(err, ShouldBeNil)
+			So(updated, ShouldBeTrue)
+			updated, _ = db.UpdateDataIf(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: "stale"},
+				map[string]interface{}{"ak": testAk}, "ak")
+			So(updated, ShouldBeFalse)
+			updated, _ = db.UpdateDataIf(&models.AuthInfoRecord{AppInsId: "unknown"}, nil, "ak")
+			So(updated, ShouldBeFalse)
+			record := &models.AuthInfoRecord{AppInsId: testAppInsId}
+			So(db.ReadData(record), ShouldBeNil)
+			So(record.Ak, ShouldEqual, "rotated")
+			So(record.AppName, ShouldEqual, "app")
+		})
+
+		Convey("deletes by column", func() {
+			So(db.DeleteData(&models.AuthInfoRecord{AppInsId: testAppInsId}, "app_ins_id"), ShouldBeNil)
+			So(db.ReadData(&models.AuthInfoRecord{AppInsId: testAppInsId}), ShouldEqual, orm.ErrNoRows)
+		})
+
+		Convey("queries the table", func() {
+			So(db.InsertData(&models.AkBlockListRecord{Ak: "ak1"}), ShouldBeNil)
+			So(db.InsertData(&models.AkBlockListRecord{Ak: "ak2"}), ShouldBeNil)
+			var records []*models.AkBlockListRecord
+			num, err := db.QueryTable("ak_block_list_record", &records)
+			So(err, ShouldBeNil)
+			So(num, ShouldEqual, 2)
+			So(len(records), ShouldEqual, 2)
+
+			var authInfoRecords []models.AuthInfoRecord
+			num, err = db.QueryTable("auth_info_record", &authInfoRecords)
+			So(err, ShouldBeNil)
+			So(num, ShouldEqual, 1)
+		})
+
+		Convey("queries the records of the filter in order", func() {
+			for i, event := range []string{"e1", "e2", "e3", "e4"} {
+				So(db.InsertData(&models.AuditEventRecord{Id: event, CreatedAt: int64(i), Event: event,
+					Outcome: "success"}), ShouldBeNil)
+			}
+			var records []models.AuditEventRecord
+			num, err := db.QueryData("audit_event_record", &records, map[string]interface{}{"outcome": "success"},
+				"-created_at", 2)
+			So(err, ShouldBeNil)
+			So(num, ShouldEqual, 2)
+			So(records[0].Event, ShouldEqual, "e4")
+			So(records[1].Event, ShouldEqual, "e3")
+
+			records = nil
+			num, err = db.QueryData("audit_event_record", &records, map[string]interface{}{"created_at__lt": int64(2)},
+				"created_at", 0)
+			So(err, ShouldBeNil)
+			So(num, ShouldEqual, 2)
+			So(records[0].Event, ShouldEqual, "e1")
+			So(records[1].Event, ShouldEqual, "e2")
+		})
+
+		Convey("refuses the data other than a model pointer", func() {
+			So(db.InsertData(models.AuthInfoRecord{}), ShouldNotBeNil)
+			So(db.ReadData(nil), ShouldNotBeNil)
+			_, err := db.QueryTable("auth_info_record", []models.AuthInfoRecord{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
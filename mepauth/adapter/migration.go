@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package adapter contains database interface and implements database adapter
+package adapter
+
+import (
+	"strconv"
+
+	"github.com/astaxie/beego/orm"
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/util"
+)
+
+const schemaVersionId = 1
+
+func init() {
+	orm.RegisterModel(new(SchemaVersionRecord))
+}
+
+// SchemaVersionRecord version of the last migration applied to the database
+type SchemaVersionRecord struct {
+	Id      int   `orm:"pk"`
+	Version int64 `orm:"default(0)"`
+}
+
+// schemaMigration changes the existing data of the sql databases, the syncSchema creates the tables and adds the
+// columns of the models beforehand. The statements run in both postgres and sqlite
+type schemaMigration struct {
+	version     int64
+	description string
+	statements  []string
+}
+
+// The migrations in the order of their versions, a released migration is never changed but followed by a new one
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "revoke the tokens of the revoked app instances by generation",
+		statements: []string{
+			"UPDATE app_token_revocation_record SET generation = 1 WHERE generation = 0",
+		},
+	},
+}
+
+// Apply the migrations newer than the version of the database, each along with its version in a transaction. An
+// instance starting along applies the same migration only once, the version is raised only from the version read
+func migrateSchema(ormer orm.Ormer) error {
+	current, err := readSchemaVersion(ormer)
+	if err != nil {
+		log.Error("Failed to read database schema version.")
+		return err
+	}
+	for _, migration := range schemaMigrations {
+		if migration.version <= current {
+			continue
+		}
+		applied, err := applySchemaMigration(ormer, current, migration)
+		if err != nil {
+			log.Error("Failed to migrate database schema to version " +
+				strconv.FormatInt(migration.version, util.BaseVal) + ".")
+			return err
+		}
+		if !applied {
+			// Migrated by another instance meanwhile
+			if current, err = readSchemaVersion(ormer); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("Database schema is migrated to version " + strconv.FormatInt(migration.version, util.BaseVal) +
+			", " + migration.description + ".")
+		current = migration.version
+	}
+	return nil
+}
+
+func readSchemaVersion(ormer orm.Ormer) (int64, error) {
+	record := &SchemaVersionRecord{Id: schemaVersionId}
+	err := ormer.Read(record)
+	if err == nil {
+		return record.Version, nil
+	}
+	if err != orm.ErrNoRows {
+		return 0, err
+	}
+	_, err = ormer.Insert(record)
+	if err != nil && err.Error() != util.PgOkMsg {
+		// Inserted by another instance meanwhile
+		if readErr := ormer.Read(record); readErr != nil {
+			return 0, err
+		}
+	}
+	return record.Version, nil
+}
+
+func applySchemaMigration(ormer orm.Ormer, from int64, migration schemaMigration) (bool, error) {
+	if err := ormer.Begin(); err != nil {
+		return false, err
+	}
+	result, err := ormer.Raw("UPDATE schema_version_record SET version = ? WHERE id = ? AND version = ?",
+		migration.version, schemaVersionId, from).Exec()
+	if err != nil {
+		_ = ormer.Rollback()
+		return false, err
+	}
+	if num, err := result.RowsAffected(); err != nil || num == 0 {
+		_ = ormer.Rollback()
+		return false, err
+	}
+	for _, statement := range migration.statements {
+		if _, err = ormer.Raw(statement).Exec(); err != nil {
+			_ = ormer.Rollback()
+			return false, err
+		}
+	}
+	if err = ormer.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
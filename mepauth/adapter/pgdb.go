@@ -78,6 +78,28 @@ func (db *PgDb) DeleteData(data interface{}, cols ...string) (err error) {
 	return err
 }
 
+// QueryTable reads all the records of a table from postgres database
+func (db *PgDb) QueryTable(tableName string, container interface{}) (num int64, err error) {
+	num, err = db.ormer.QueryTable(tableName).All(container)
+	return num, err
+}
+
+// QueryData reads the records of a table holding the filter values from postgres database
+func (db *PgDb) QueryData(tableName string, container interface{}, filter map[string]interface{}, orderBy string,
+	limit int) (num int64, err error) {
+	return queryData(db.ormer, tableName, container, filter, orderBy, limit)
+}
+
+// UpdateDataIf updates the columns of the record in postgres database only if it still holds the expected values
+func (db *PgDb) UpdateDataIf(data interface{}, expected map[string]interface{}, cols ...string) (bool, error) {
+	return updateDataIf(db.ormer, data, expected, cols)
+}
+
+// MigrateSchema applies the migrations of the postgres database newer than its schema version
+func (db *PgDb) MigrateSchema() error {
+	return migrateSchema(db.ormer)
+}
+
 // InitDatabase initializes database of type postgres
 func (db *PgDb) InitDatabase() error {
 
@@ -118,7 +140,7 @@ func (db *PgDb) InitDatabase() error {
 		return registerDataBaseErr
 	}
 
-	errRunSyncdb := orm.RunSyncdb(Default, false, true)
+	errRunSyncdb := syncSchema()
 	if errRunSyncdb != nil {
 		log.Error("Failed to sync database.")
 		return errRunSyncdb
@@ -130,5 +152,11 @@ func (db *PgDb) InitDatabase() error {
 		return err
 	}
 
+	err = db.MigrateSchema()
+	if err != nil {
+		log.Error("Failed to migrate database.")
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dbAdapter contains database interface and implements database adapter
+package adapter
+
+import (
+	"fmt"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+)
+
+const sqliteDriver string = "sqlite3"
+const defaultSqlitePath string = "mepauth.db"
+
+// SqliteDb sqlite database, for a single mepauth instance such as in local development
+type SqliteDb struct {
+	ormer orm.Ormer
+}
+
+// InitOrmer constructor of ORM
+func (db *SqliteDb) InitOrmer() (err1 error) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error("panic handled:", err)
+			err1 = fmt.Errorf("recover panic as %s", err)
+		}
+	}()
+	o := orm.NewOrm()
+	err1 = o.Using(Default)
+	if err1 != nil {
+		return err1
+	}
+	db.ormer = o
+
+	return nil
+}
+
+// InsertData inserts data into sqlite database
+func (db *SqliteDb) InsertData(data interface{}) (err error) {
+	_, err = db.ormer.Insert(data)
+	return err
+}
+
+// InsertOrUpdateData inserts or updates data into sqlite database, the conflict column is the primary key of all
+// the records and beego orm has no upsert for sqlite, so the record is updated by its primary key or else inserted
+func (db *SqliteDb) InsertOrUpdateData(data interface{}, cols ...string) (err error) {
+	num, err := db.ormer.Update(data)
+	if err != nil || num != 0 {
+		return err
+	}
+	_, err = db.ormer.Insert(data)
+	return err
+}
+
+// ReadData reads data from sqlite database
+func (db *SqliteDb) ReadData(data interface{}, cols ...string) (err error) {
+	err = db.ormer.Read(data, cols...)
+	return err
+}
+
+// DeleteData deletes data from sqlite database
+func (db *SqliteDb) DeleteData(data interface{}, cols ...string) (err error) {
+	_, err = db.ormer.Delete(data, cols...)
+	return err
+}
+
+// QueryTable reads all the records of a table from sqlite database
+func (db *SqliteDb) QueryTable(tableName string, container interface{}) (num int64, err error) {
+	num, err = db.ormer.QueryTable(tableName).All(container)
+	return num, err
+}
+
+// QueryData reads the records of a table holding the filter values from sqlite database
+func (db *SqliteDb) QueryData(tableName string, container interface{}, filter map[string]interface{}, orderBy string,
+	limit int) (num int64, err error) {
+	return queryData(db.ormer, tableName, container, filter, orderBy, limit)
+}
+
+// UpdateDataIf updates the columns of the record in sqlite database only if it still holds the expected values
+func (db *SqliteDb) UpdateDataIf(data interface{}, expected map[string]interface{}, cols ...string) (bool, error) {
+	return updateDataIf(db.ormer, data, expected, cols)
+}
+
+// MigrateSchema applies the migrations of the sqlite database newer than its schema version
+func (db *SqliteDb) MigrateSchema() error {
+	return migrateSchema(db.ormer)
+}
+
+// InitDatabase initializes database of type sqlite in the file configured by sqlite_db_path
+func (db *SqliteDb) InitDatabase() error {
+	registerDriverErr := orm.RegisterDriver(sqliteDriver, orm.DRSqlite)
+	if registerDriverErr != nil {
+		log.Error("Failed to register driver")
+		return registerDriverErr
+	}
+
+	dataSource := beego.AppConfig.DefaultString("sqlite_db_path", defaultSqlitePath)
+	registerDataBaseErr := orm.RegisterDataBase(Default, sqliteDriver, dataSource)
+	if registerDataBaseErr != nil {
+		log.Error("Failed to register database")
+		return registerDataBaseErr
+	}
+
+	errRunSyncdb := syncSchema()
+	if errRunSyncdb != nil {
+		log.Error("Failed to sync database.")
+		return errRunSyncdb
+	}
+
+	err := db.InitOrmer()
+	if err != nil {
+		log.Error("Failed to init ormer")
+		return err
+	}
+
+	err = db.MigrateSchema()
+	if err != nil {
+		log.Error("Failed to migrate database.")
+		return err
+	}
+
+	return nil
+}
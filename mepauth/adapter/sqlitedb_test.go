@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adapter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/models"
+)
+
+func TestSqliteDb(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "mepauthdb")
+	defer os.RemoveAll(dir)
+	_ = beego.AppConfig.Set("sqlite_db_path", filepath.Join(dir, "mepauth.db"))
+	db := &SqliteDb{}
+	err := db.InitDatabase()
+
+	Convey("sqlite db", t, func() {
+		So(err, ShouldBeNil)
+		So(db.InsertOrUpdateData(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: testAk},
+			"app_ins_id"), ShouldBeNil)
+
+		Convey("inserts or updates by primary key", func() {
+			So(db.InsertOrUpdateData(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: testAk, AppName: "app"},
+				"app_ins_id"), ShouldBeNil)
+			record := &models.AuthInfoRecord{Ak: testAk}
+			So(db.ReadData(record, "ak"), ShouldBeNil)
+			So(record.AppName, ShouldEqual, "app")
+		})
+
+		Convey("queries and deletes", func() {
+			So(db.InsertData(&models.AkBlockListRecord{Ak: "ak1"}), ShouldBeNil)
+			var records []*models.AkBlockListRecord
+			num, err := db.QueryTable("ak_block_list_record", &records)
+			So(err, ShouldBeNil)
+			So(num, ShouldEqual, 1)
+
+			So(db.DeleteData(&models.AkBlockListRecord{Ak: "ak1"}, "ak"), ShouldBeNil)
+			So(db.ReadData(&models.AkBlockListRecord{Ak: "ak1"}, "ak"), ShouldEqual, orm.ErrNoRows)
+		})
+
+		Convey("updates only the unchanged record", func() {
+			So(db.InsertOrUpdateData(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: testAk, AppName: "app"},
+				"app_ins_id"), ShouldBeNil)
+			updated, err := db.UpdateDataIf(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: "rotated"},
+				map[string]interface{}{"ak": testAk}, "ak")
+			So(err, ShouldBeNil)
+			So(updated, ShouldBeTrue)
+			updated, err = db.UpdateDataIf(&models.AuthInfoRecord{AppInsId: testAppInsId, Ak: "stale"},
+				map[string]interface{}{"ak": testAk}, "ak")
+			So(err, ShouldBeNil)
+			So(updated, ShouldBeFalse)
+			record := &models.AuthInfoRecord{AppInsId: testAppInsId}
+			So(db.ReadData(record), ShouldBeNil)
+			So(record.Ak, ShouldEqual, "rotated")
+			So(record.AppName, ShouldEqual, "app")
+		})
+
+		Convey("migrates the schema once", func() {
+			latest := schemaMigrations[len(schemaMigrations)-1].version
+			version, err := readSchemaVersion(db.ormer)
+			So(err, ShouldBeNil)
+			So(version, ShouldEqual, latest)
+
+			// A database of an earlier release
+			So(db.InsertOrUpdateData(&models.AppTokenRevocationRecord{AppInsId: testAppInsId}, "app_ins_id"),
+				ShouldBeNil)
+			_, err = db.ormer.Raw("UPDATE schema_version_record SET version = 0").Exec()
+			So(err, ShouldBeNil)
+			So(migrateSchema(db.ormer), ShouldBeNil)
+			record := &models.AppTokenRevocationRecord{AppInsId: testAppInsId}
+			So(db.ReadData(record), ShouldBeNil)
+			So(record.Generation, ShouldEqual, 1)
+			version, _ = readSchemaVersion(db.ormer)
+			So(version, ShouldEqual, latest)
+
+			// Applied already by another instance
+			applied, err := applySchemaMigration(db.ormer, 0, schemaMigrations[0])
+			So(err, ShouldBeNil)
+			So(applied, ShouldBeFalse)
+		})
+	})
+}
@@ -38,6 +38,11 @@ import (
 
 const servicesPath string = "/services"
 const configFormat string = `{ "name": "%s", "config": %s }`
+const jwtKeyClaimName string = "kid"
+
+// The api gateway certificate id of the client certificate it connects to mepauth with, a constant so that a restart
+// replaces the same certificate
+const apiGwClientCertId string = "5cb8e0a4-7f3e-4c51-9d7b-2a6c1e3f0b84"
 
 // API gateway initializer
 type apiGwInitializer struct {
@@ -107,19 +112,89 @@ func (i *apiGwInitializer) SetApiGwConsumer(apiGwUrl string) error {
 		log.Error(msg)
 		return errors.New(msg)
 	}
-	// add jwt plugin to mepauth consumer
-	apiGwJwtUrl := consumerUrl + "/" + util.MepAppJwtName + "/jwt"
-	jwtPublicKey, err := util.GetPublicKey()
+	// add jwt credential of every valid signing key to mepauth consumer
+	jwtKeys, err := util.GetJwtKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range jwtKeys {
+		err = i.PublishJwtKey(key.Kid, key.PublicKey)
+		if err != nil {
+			log.Error("Failed while adding consumer token.")
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishJwtKey adds the jwt credential of a signing key to mepauth consumer, the key id selects the credential
+func (i *apiGwInitializer) PublishJwtKey(kid string, publicKey string) error {
+	apiGwUrl, err := util.GetAPIGwURL()
+	if err != nil {
+		log.Error("Failed to get API gateway URL")
+		return err
+	}
+	apiGwJwtByte, err := json.Marshal(&models.JwtCredential{
+		Key:          kid,
+		Algorithm:    "RS512",
+		RsaPublicKey: publicKey,
+	})
+	if err != nil {
+		log.Error("Failed to marshal jwt credential")
+		return err
+	}
+	return i.SendPostRequest(apiGwUrl+"/consumers/"+util.MepAppJwtName+"/jwt", apiGwJwtByte)
+}
+
+// WithdrawJwtKey removes the jwt credential of a retired signing key from mepauth consumer
+func (i *apiGwInitializer) WithdrawJwtKey(kid string) error {
+	apiGwUrl, err := util.GetAPIGwURL()
+	if err != nil {
+		log.Error("Failed to get API gateway URL")
+		return err
+	}
+	return i.SendDeleteRequest(apiGwUrl + "/consumers/" + util.MepAppJwtName + "/jwt/" + kid)
+}
+
+// PublishTokenRevocations sets the revoked tokens to every appid-header plugin, which rejects them
+func (i *apiGwInitializer) PublishTokenRevocations(revocations *models.TokenRevocations) error {
+	apiGwUrl, err := util.GetAPIGwURL()
 	if err != nil {
+		log.Error("Failed to get API gateway URL")
 		return err
 	}
-	apiGwJwtByte := []byte(fmt.Sprintf(`{ "algorithm": "RS512", "key": "%s", "rsa_public_key": "%s" }`,
-		mepAuthKey, string(jwtPublicKey)))
-	err = i.SendPostRequest(apiGwJwtUrl, apiGwJwtByte)
+	revocationsByte, err := json.Marshal(&struct {
+		Config *models.TokenRevocations `json:"config"`
+	}{Config: revocations})
 	if err != nil {
-		log.Error("Failed while adding consumer token.")
+		log.Error("Failed to marshal token revocations")
 		return err
 	}
+	// The plugins are listed page by page, the next page is relative to the api gateway
+	pageUrl := apiGwUrl + util.PluginPath
+	for pageUrl != "" {
+		body, err := i.SendGetRequest(pageUrl)
+		if err != nil {
+			return err
+		}
+		plugins := &models.PluginList{}
+		if err = json.Unmarshal(body, plugins); err != nil {
+			log.Error("Failed to parse the plugins of api gateway")
+			return err
+		}
+		for _, plugin := range plugins.Data {
+			if plugin.Name != util.AppidPlugin {
+				continue
+			}
+			if err = i.SendPatchRequest(apiGwUrl+util.PluginPath+"/"+plugin.Id, revocationsByte); err != nil {
+				return err
+			}
+		}
+		pageUrl = ""
+		if plugins.Next != "" {
+			pageUrl = apiGwUrl + plugins.Next
+		}
+	}
 	return nil
 }
 
@@ -146,12 +221,18 @@ func (i *apiGwInitializer) SetupApiGwMepServer(apiGwUrl string) error {
 	}
 	// enable mep server jwt plugin
 	mepServerPluginUrl := apiGwUrl + servicesPath + "/" + util.MepserverName + util.PluginPath
-	jwtConfig := fmt.Sprintf(`{ "name": "%s", "config": { "claims_to_verify": ["exp"] } }`, util.JwtPlugin)
+	jwtConfig := fmt.Sprintf(`{ "name": "%s", "config": { "claims_to_verify": ["exp"], "key_claim_name": "%s" } }`,
+		util.JwtPlugin, jwtKeyClaimName)
 	err = i.SendPostRequest(mepServerPluginUrl, []byte(jwtConfig))
 	if err != nil {
 		log.Error("Enable mep server jwt plugin failed")
 		return err
 	}
+	err = i.updateJwtPluginKeyClaim(apiGwUrl, mepServerPluginUrl)
+	if err != nil {
+		log.Error("Update mep server jwt plugin failed")
+		return err
+	}
 	// enable mep server appid-header plugin
 	err = i.SendPostRequest(mepServerPluginUrl, []byte(fmt.Sprintf(`{ "name": "%s" }`, util.AppidPlugin)))
 	if err != nil {
@@ -183,6 +264,31 @@ func (i *apiGwInitializer) SetupApiGwMepServer(apiGwUrl string) error {
 	return nil
 }
 
+// The jwt plugin enabled by an earlier version is kept on conflict, it selects the credential by the kid claim too
+func (i *apiGwInitializer) updateJwtPluginKeyClaim(apiGwUrl string, pluginUrl string) error {
+	body, err := i.SendGetRequest(pluginUrl)
+	if err != nil {
+		return err
+	}
+	plugins := &models.PluginList{}
+	if err = json.Unmarshal(body, plugins); err != nil {
+		log.Error("Failed to parse the plugins of api gateway service")
+		return err
+	}
+	for _, plugin := range plugins.Data {
+		if plugin.Name != util.JwtPlugin || plugin.Config["key_claim_name"] == jwtKeyClaimName {
+			continue
+		}
+		err = i.SendPatchRequest(apiGwUrl+util.PluginPath+"/"+plugin.Id,
+			[]byte(fmt.Sprintf(`{ "config": { "key_claim_name": "%s" } }`, jwtKeyClaimName)))
+		if err != nil {
+			return err
+		}
+		log.Info("Jwt plugin " + plugin.Id + " selects the credential by the kid claim")
+	}
+	return nil
+}
+
 func (i *apiGwInitializer) SetupApiGwMepAuth(apiGwURL string, trustedNetworks *[]byte) error {
 	// add mep auth service and route to apiGw
 	var httpsPort string
@@ -226,6 +332,15 @@ func (i *apiGwInitializer) SetupApiGwMepAuth(apiGwURL string, trustedNetworks *[
 		return err
 	}
 
+	// The apps presenting their client certificate to the api gateway authenticate with it through mepauth
+	if util.GetAppConfig("client_cacert") != "" && util.GetAppConfig("apigw_client_cert") != "" {
+		err = i.setupApiGwClientCert(apiGwURL, mepAuthPluginURL)
+		if err != nil {
+			log.Error("Forwarding of client certificates to mep auth failed.")
+			return err
+		}
+	}
+
 	if (trustedNetworks != nil) && (len(*trustedNetworks) > 0) {
 		trustedNetworksList := strings.Split(string(*trustedNetworks), ";")
 		allIpValid, err := util.ValidateIpAndCidr(trustedNetworksList)
@@ -244,6 +359,40 @@ func (i *apiGwInitializer) SetupApiGwMepAuth(apiGwURL string, trustedNetworks *[
 	return nil
 }
 
+// The api gateway terminates the TLS of the apps, it connects to mepauth with its own client certificate and forwards
+// the certificate the app presented in a header mepauth trusts on those connections only
+func (i *apiGwInitializer) setupApiGwClientCert(apiGwURL string, mepAuthPluginURL string) error {
+	certPem, err := ioutil.ReadFile(util.GetAppConfig("apigw_client_cert"))
+	if err != nil {
+		log.Error("Unable to read api gateway client certificate file")
+		return err
+	}
+	keyPem, err := ioutil.ReadFile(util.GetAppConfig("apigw_client_key"))
+	if err != nil {
+		log.Error("Unable to read api gateway client key file")
+		return err
+	}
+	certByte, err := json.Marshal(models.ApiGwCertificate{Cert: string(certPem), Key: string(keyPem)})
+	util.ClearByteArray(keyPem)
+	if err != nil {
+		log.Error("Failed to marshal api gateway client certificate")
+		return err
+	}
+	err = i.SendPutRequest(apiGwURL+"/certificates/"+apiGwClientCertId, certByte)
+	util.ClearByteArray(certByte)
+	if err != nil {
+		log.Error("Addition of api gateway client certificate failed.")
+		return err
+	}
+	err = i.SendPatchRequest(apiGwURL+servicesPath+"/"+util.MepauthName,
+		[]byte(fmt.Sprintf(`{ "client_certificate": { "id": "%s" } }`, apiGwClientCertId)))
+	if err != nil {
+		log.Error("Setting of mep auth client certificate failed.")
+		return err
+	}
+	return i.SendPostRequest(mepAuthPluginURL, []byte(fmt.Sprintf(`{ "name": "%s" }`, util.ClientCertPlugin)))
+}
+
 func (i *apiGwInitializer) getTrustedIpList(trustedNetworksList []string) string {
 	var ipcidrList string
 	ipList := `{ "whitelist": [`
@@ -350,6 +499,81 @@ func (i *apiGwInitializer) SendPutRequest(consumerURL string, jsonStr []byte) er
 	return nil
 }
 
+// Send get request, returns the response body
+func (i *apiGwInitializer) SendGetRequest(resourceURL string) ([]byte, error) {
+	req := httplib.Get(resourceURL)
+	if strings.EqualFold(os.Getenv("SSL_ENABLED"), "true") {
+		req.SetTLSClientConfig(i.tlsConfig)
+	}
+	resp, err := req.Response()
+	if err != nil {
+		log.Error("Request sending is having error")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Error("Request's response not received")
+		return nil, err
+	}
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		log.Error("Request sending returned failure response with status code " + strconv.Itoa(resp.StatusCode))
+		return nil, errors.New("request sending returned failure response, status is " + strconv.Itoa(resp.StatusCode))
+	}
+	return body, nil
+}
+
+// Send patch request
+func (i *apiGwInitializer) SendPatchRequest(resourceURL string, jsonStr []byte) error {
+	req := httplib.NewBeegoRequest(resourceURL, http.MethodPatch)
+	req.Header(util.ContentType, util.JsonUtf8)
+	if strings.EqualFold(os.Getenv("SSL_ENABLED"), "true") {
+		req.SetTLSClientConfig(i.tlsConfig)
+	}
+	req.Body(jsonStr)
+	resp, err := req.Response()
+	if err != nil {
+		log.Error("Request sending is having error")
+		return err
+	}
+	defer resp.Body.Close()
+	_, err2 := ioutil.ReadAll(resp.Body)
+	if err2 != nil {
+		log.Error("Request's response not received")
+	}
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		log.Error("Request sending returned failure response with status code " + strconv.Itoa(resp.StatusCode))
+		return errors.New("request sending returned failure response, status is " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+// Send delete request, a resource already removed is not a failure
+func (i *apiGwInitializer) SendDeleteRequest(resourceURL string) error {
+	req := httplib.Delete(resourceURL)
+	if strings.EqualFold(os.Getenv("SSL_ENABLED"), "true") {
+		req.SetTLSClientConfig(i.tlsConfig)
+	}
+	resp, err := req.Response()
+	if err != nil {
+		log.Error("Request sending is having error")
+		return err
+	}
+	defer resp.Body.Close()
+	_, err2 := ioutil.ReadAll(resp.Body)
+	if err2 != nil {
+		log.Error("Request's response not received")
+	}
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode <= 299) && resp.StatusCode != http.StatusNotFound {
+		log.Error("Request sending returned failure response with status code " + strconv.Itoa(resp.StatusCode))
+		return errors.New("request sending returned failure response, status is " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
 func (i *apiGwInitializer) getHttpLogPluginData() (data []byte, err error) {
 	c := &models.ConfigInfo{
 		HTTPEndpoint: httpProtocol + "://mep-mm5:80/mep/service_govern/v1/kong_log",
@@ -21,7 +21,11 @@ import (
 	. "github.com/agiledragon/gomonkey"
 	"github.com/astaxie/beego"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"mepauth/models"
 	"mepauth/util"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -152,8 +156,11 @@ func TestSetApiGwConsumer(t *testing.T) {
 			patches := ApplyMethod(reflect.TypeOf(initializer), "SendPostRequest", func(*apiGwInitializer, string, []byte) error {
 				return nil
 			})
-			patches.ApplyFunc(util.GetPublicKey, func() ([]byte, error) {
-				return []byte("public_key"), nil
+			patches.ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+				return []util.JwtKeyInfo{{Kid: "kid", PublicKey: "public_key"}}, nil
+			})
+			patches.ApplyFunc(util.GetAPIGwURL, func() (string, error) {
+				return "https://127.0.0.1:8444", nil
 			})
 			defer patches.Reset()
 			i := &apiGwInitializer{}
@@ -165,8 +172,11 @@ func TestSetApiGwConsumer(t *testing.T) {
 			patches := ApplyMethod(reflect.TypeOf(initializer), "SendPostRequest", func(*apiGwInitializer, string, []byte) error {
 				return errors.New("send post request error")
 			})
-			patches.ApplyFunc(util.GetPublicKey, func() ([]byte, error) {
-				return []byte("public_key"), nil
+			patches.ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+				return []util.JwtKeyInfo{{Kid: "kid", PublicKey: "public_key"}}, nil
+			})
+			patches.ApplyFunc(util.GetAPIGwURL, func() (string, error) {
+				return "https://127.0.0.1:8444", nil
 			})
 			defer patches.Reset()
 			i := &apiGwInitializer{}
@@ -178,8 +188,11 @@ func TestSetApiGwConsumer(t *testing.T) {
 			patches := ApplyMethod(reflect.TypeOf(initializer), "SendPostRequest", func(*apiGwInitializer, string, []byte) error {
 				return nil
 			})
-			patches.ApplyFunc(util.GetPublicKey, func() ([]byte, error) {
-				return []byte("public_key"), nil
+			patches.ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+				return []util.JwtKeyInfo{{Kid: "kid", PublicKey: "public_key"}}, nil
+			})
+			patches.ApplyFunc(util.GetAPIGwURL, func() (string, error) {
+				return "https://127.0.0.1:8444", nil
 			})
 			beego.AppConfig.Set("mepauth_key", "")
 			defer patches.Reset()
@@ -188,6 +201,27 @@ func TestSetApiGwConsumer(t *testing.T) {
 			err := i.SetApiGwConsumer("https://127.0.0.1:8444")
 			So(err, ShouldNotBeNil)
 		})
+		Convey("for success - credential of every signing key", func() {
+			var initializer *apiGwInitializer
+			var bodies []string
+			patches := ApplyMethod(reflect.TypeOf(initializer), "SendPostRequest", func(_ *apiGwInitializer, _ string, body []byte) error {
+				bodies = append(bodies, string(body))
+				return nil
+			})
+			patches.ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+				return []util.JwtKeyInfo{{Kid: "current", PublicKey: "public_key"}, {Kid: "retired", PublicKey: "public_key"}}, nil
+			})
+			patches.ApplyFunc(util.GetAPIGwURL, func() (string, error) {
+				return "https://127.0.0.1:8444", nil
+			})
+			defer patches.Reset()
+			i := &apiGwInitializer{}
+			err := i.SetApiGwConsumer("https://127.0.0.1:8444")
+			So(err, ShouldBeNil)
+			So(len(bodies), ShouldEqual, 3)
+			So(bodies[1], ShouldContainSubstring, `"key":"current"`)
+			So(bodies[2], ShouldContainSubstring, `"key":"retired"`)
+		})
 	})
 }
 
@@ -205,10 +239,36 @@ func TestSetupApiGwMepServer(t *testing.T) {
 			patches.ApplyMethod(reflect.TypeOf(initializer), "AddServiceRoute", func(*apiGwInitializer, string, []string, string, bool) error {
 				return nil
 			})
+			patches.ApplyMethod(reflect.TypeOf(initializer), "SendGetRequest", func(*apiGwInitializer, string) ([]byte, error) {
+				return []byte(`{"data":[]}`), nil
+			})
+			defer patches.Reset()
+			i := &apiGwInitializer{}
+			err := i.SetupApiGwMepServer("https://127.0.0.1:8444")
+			So(err, ShouldBeNil)
+		})
+		Convey("for success - existing jwt plugin selects the credential by kid", func() {
+			var initializer *apiGwInitializer
+			var patched []string
+			patches := ApplyMethod(reflect.TypeOf(initializer), "SendPostRequest", func(*apiGwInitializer, string, []byte) error {
+				return nil
+			})
+			patches.ApplyMethod(reflect.TypeOf(initializer), "AddServiceRoute", func(*apiGwInitializer, string, []string, string, bool) error {
+				return nil
+			})
+			patches.ApplyMethod(reflect.TypeOf(initializer), "SendGetRequest", func(*apiGwInitializer, string) ([]byte, error) {
+				return []byte(`{"data":[{"id":"p1","name":"jwt","config":{"key_claim_name":"iss"}},` +
+					`{"id":"p2","name":"appid-header","config":{}}]}`), nil
+			})
+			patches.ApplyMethod(reflect.TypeOf(initializer), "SendPatchRequest", func(_ *apiGwInitializer, url string, body []byte) error {
+				patched = append(patched, url+" "+string(body))
+				return nil
+			})
 			defer patches.Reset()
 			i := &apiGwInitializer{}
 			err := i.SetupApiGwMepServer("https://127.0.0.1:8444")
 			So(err, ShouldBeNil)
+			So(patched, ShouldResemble, []string{`https://127.0.0.1:8444/plugins/p1 { "config": { "key_claim_name": "kid" } }`})
 		})
 		Convey("for fail - send post request error", func() {
 			var initializer *apiGwInitializer
@@ -227,6 +287,38 @@ func TestSetupApiGwMepServer(t *testing.T) {
 	})
 }
 
+func TestPublishTokenRevocations(t *testing.T) {
+	var patched []string
+	Convey("publish token revocations", t, func() {
+		var initializer *apiGwInitializer
+		patches := ApplyFunc(util.GetAPIGwURL, func() (string, error) {
+			return "https://127.0.0.1:8444", nil
+		})
+		patches.ApplyMethod(reflect.TypeOf(initializer), "SendGetRequest", func(_ *apiGwInitializer, url string) ([]byte, error) {
+			if url == "https://127.0.0.1:8444/plugins" {
+				return []byte(`{"data":[{"id":"p1","name":"appid-header"},{"id":"p2","name":"jwt"}],` +
+					`"next":"/plugins?offset=p2"}`), nil
+			}
+			return []byte(`{"data":[{"id":"p3","name":"appid-header"}],"next":null}`), nil
+		})
+		patches.ApplyMethod(reflect.TypeOf(initializer), "SendPatchRequest", func(_ *apiGwInitializer, url string, body []byte) error {
+			patched = append(patched, url+" "+string(body))
+			return nil
+		})
+		defer patches.Reset()
+
+		i := &apiGwInitializer{}
+		err := i.PublishTokenRevocations(&models.TokenRevocations{
+			RevokedTokens: map[string]int64{"jti": 1},
+			RevokedApps:   map[string]int64{},
+		})
+		So(err, ShouldBeNil)
+		config := ` {"config":{"revoked_tokens":{"jti":1},"revoked_apps":{}}}`
+		So(patched, ShouldResemble, []string{"https://127.0.0.1:8444/plugins/p1" + config,
+			"https://127.0.0.1:8444/plugins/p3" + config})
+	})
+}
+
 func TestSetupApiGwMepAuth(t *testing.T) {
 	err := beego.LoadAppConfig("ini", "../conf/app.conf")
 	if err != nil {
@@ -264,6 +356,45 @@ func TestSetupApiGwMepAuth(t *testing.T) {
 	})
 }
 
+func TestSetupApiGwClientCert(t *testing.T) {
+	var sent []string
+	Convey("setup apiGw client cert", t, func() {
+		dir, _ := ioutil.TempDir("", "apigw")
+		defer os.RemoveAll(dir)
+		_ = ioutil.WriteFile(filepath.Join(dir, "client.crt"), []byte("cert"), 0600)
+		_ = ioutil.WriteFile(filepath.Join(dir, "client.key"), []byte("key"), 0600)
+		beego.AppConfig.Set("apigw_client_cert", filepath.Join(dir, "client.crt"))
+		beego.AppConfig.Set("apigw_client_key", filepath.Join(dir, "client.key"))
+		defer beego.AppConfig.Set("apigw_client_cert", "")
+		defer beego.AppConfig.Set("apigw_client_key", "")
+
+		var initializer *apiGwInitializer
+		patches := ApplyMethod(reflect.TypeOf(initializer), "SendPutRequest", func(_ *apiGwInitializer, url string, body []byte) error {
+			sent = append(sent, url+" "+string(body))
+			return nil
+		})
+		patches.ApplyMethod(reflect.TypeOf(initializer), "SendPatchRequest", func(_ *apiGwInitializer, url string, body []byte) error {
+			sent = append(sent, url+" "+string(body))
+			return nil
+		})
+		patches.ApplyMethod(reflect.TypeOf(initializer), "SendPostRequest", func(_ *apiGwInitializer, url string, body []byte) error {
+			sent = append(sent, url+" "+string(body))
+			return nil
+		})
+		defer patches.Reset()
+
+		i := &apiGwInitializer{}
+		err := i.setupApiGwClientCert("https://127.0.0.1:8444", "https://127.0.0.1:8444/services/mepauth/plugins")
+		So(err, ShouldBeNil)
+		So(sent, ShouldResemble, []string{
+			"https://127.0.0.1:8444/certificates/" + apiGwClientCertId + ` {"cert":"cert","key":"key"}`,
+			"https://127.0.0.1:8444/services/mepauth " +
+				`{ "client_certificate": { "id": "` + apiGwClientCertId + `" } }`,
+			`https://127.0.0.1:8444/services/mepauth/plugins { "name": "client-cert-header" }`,
+		})
+	})
+}
+
 func TestGetTrustedIpList(t *testing.T) {
 	Convey("Get TrustedIp List", t, func() {
 		list := []string{"abc.com"}
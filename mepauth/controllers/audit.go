@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"log/syslog"
+	"os"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	"github.com/natefinch/lumberjack"
+	log "github.com/sirupsen/logrus"
+	logrusSyslog "github.com/sirupsen/logrus/hooks/syslog"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+// Security audit events
+const (
+	auditTokenIssued         = "TokenIssued"
+	auditSignatureFailure    = "SignatureFailure"
+	auditClientAuthFailure   = "ClientAuthFailure"
+	auditAkBlockListed       = "AkBlockListed"
+	auditAkUnblocked         = "AkUnblocked"
+	auditClientIpRateLimited = "ClientIpRateLimited"
+	auditAkRateLimited       = "AkRateLimited"
+	auditConfCreated         = "ConfCreated"
+	auditConfUpdated         = "ConfUpdated"
+	auditConfDeleted         = "ConfDeleted"
+	auditAkRotated           = "AkRotated"
+)
+
+// Outcomes of the security audit events
+const (
+	auditSuccess = "success"
+	auditFailure = "failure"
+	auditDenied  = "denied"
+)
+
+const (
+	defaultAuditLogFile       = "/usr/mep/log/mepauth_audit.log"
+	defaultAuditRetentionDays = 90
+	auditSyslogTag            = "mepauth"
+	auditEventPurgeInterval   = time.Hour
+	auditEventPurgeBatch      = 1000
+)
+
+const (
+	auditEventTable = "audit_event_record"
+	eventColumn     = "event"
+	outcomeColumn   = "outcome"
+	clientIpColumn  = "client_ip"
+	createdAtColumn = "created_at"
+)
+
+// The audit events go to the mepauth log till the audit log is initialized, they are persisted to be queried from
+// then on
+var (
+	auditLogger      = log.StandardLogger()
+	isAuditPersisted = false
+)
+
+// InitAuditLog initializes the security audit log in the rotating file configured by audit_log_file, the events are
+// also sent to syslog when audit_syslog is enabled
+func InitAuditLog() {
+	isAuditPersisted = true
+
+	fileName := beego.AppConfig.DefaultString("audit_log_file", defaultAuditLogFile)
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		log.Warn("Failed to audit to file, auditing to the mepauth log")
+		return
+	}
+	if err = file.Close(); err != nil {
+		log.Error("failed to close the audit log file")
+		return
+	}
+	logger := log.New()
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.SetLevel(log.InfoLevel)
+	logger.SetOutput(&lumberjack.Logger{
+		Filename:   fileName,
+		MaxSize:    util.MaxSize, // megabytes
+		MaxBackups: util.MaxBackups,
+		MaxAge:     util.MaxAge, // days
+		Compress:   true,        // compress
+	})
+	if beego.AppConfig.DefaultBool("audit_syslog", false) {
+		// The local syslog is used when no network is configured
+		hook, err := logrusSyslog.NewSyslogHook(util.GetAppConfig("audit_syslog_network"),
+			util.GetAppConfig("audit_syslog_address"), syslog.LOG_INFO|syslog.LOG_AUTH, auditSyslogTag)
+		if err != nil {
+			log.Error("Failed to connect to the audit syslog, auditing to file only")
+		} else {
+			logger.AddHook(hook)
+		}
+	}
+	auditLogger = logger
+	log.Info("Security audit events are logged to " + fileName)
+}
+
+// Record a security audit event, the entries are tagged to be told apart from the other logs. The event is also
+// persisted in the database shared by the mepauth instances
+func auditSecurityEvent(event string, outcome string, clientIp string, appInsId string, ak string) {
+	now := time.Now()
+	if isAuditPersisted {
+		persistAuditEvent(&models.AuditEventRecord{
+			CreatedAt: now.UnixNano(),
+			Event:     event,
+			Outcome:   outcome,
+			AppInsId:  appInsId,
+			Ak:        ak,
+			ClientIp:  clientIp,
+		})
+	}
+	entry := auditLogger.WithFields(log.Fields{
+		"audit":        true,
+		eventColumn:    event,
+		outcomeColumn:  outcome,
+		appInstanceID:  appInsId,
+		akColumn:       ak,
+		clientIpColumn: clientIp,
+	})
+	if outcome == auditSuccess {
+		entry.Info("Security audit event " + event)
+	} else {
+		entry.Warn("Security audit event " + event)
+	}
+}
+
+// The event stays in the audit log when it fails to be persisted
+func persistAuditEvent(record *models.AuditEventRecord) {
+	id, err := generateTokenId()
+	if err == nil {
+		record.Id = id
+		err = adapter.Db.InsertData(record)
+	}
+	if err != nil && err.Error() != util.PgOkMsg {
+		log.Error("Failed to persist security audit event " + record.Event + ".")
+	}
+}
+
+// Audit events matching the non empty fields of the filter, the newest first and at most limit of them
+func queryAuditEvents(filter *models.AuditEvent, limit int) ([]models.AuditEvent, error) {
+	conditions := make(map[string]interface{})
+	for col, value := range map[string]string{
+		eventColumn:    filter.Event,
+		outcomeColumn:  filter.Outcome,
+		appInstanceID:  filter.AppInsId,
+		akColumn:       filter.Ak,
+		clientIpColumn: filter.ClientIp,
+	} {
+		if value != "" {
+			conditions[col] = value
+		}
+	}
+	var records []*models.AuditEventRecord
+	_, err := adapter.Db.QueryData(auditEventTable, &records, conditions, "-"+createdAtColumn, limit)
+	if err != nil && err != orm.ErrNoRows {
+		log.Error("Failed to read security audit events from database.")
+		return nil, err
+	}
+	events := make([]models.AuditEvent, 0, len(records))
+	for _, record := range records {
+		events = append(events, models.AuditEvent{
+			Time:     time.Unix(0, record.CreatedAt).UTC().Format(time.RFC3339),
+			Event:    record.Event,
+			Outcome:  record.Outcome,
+			AppInsId: record.AppInsId,
+			Ak:       record.Ak,
+			ClientIp: record.ClientIp,
+		})
+	}
+	return events, nil
+}
+
+// StartAuditEventPurge removes the persisted audit events older than audit_retention_days, the audit log files are
+// rotated on their own
+func StartAuditEventPurge() {
+	go func() {
+		ticker := time.NewTicker(auditEventPurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			retention := beego.AppConfig.DefaultInt("audit_retention_days", defaultAuditRetentionDays)
+			purgeAuditEvents(time.Now().AddDate(0, 0, -retention))
+		}
+	}()
+}
+
+func purgeAuditEvents(before time.Time) {
+	for {
+		var records []*models.AuditEventRecord
+		num, err := adapter.Db.QueryData(auditEventTable, &records,
+			map[string]interface{}{createdAtColumn + "__lt": before.UnixNano()}, createdAtColumn, auditEventPurgeBatch)
+		if err != nil && err != orm.ErrNoRows {
+			log.Error("Failed to read expired security audit events, purge will be retried.")
+			return
+		}
+		for _, record := range records {
+			if err = adapter.Db.DeleteData(&models.AuditEventRecord{Id: record.Id}); err != nil {
+				log.Error("Failed to purge expired security audit events, purge will be retried.")
+				return
+			}
+		}
+		if num < auditEventPurgeBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/adapter"
+	"mepauth/models"
+)
+
+func getAuditController(query map[string][]string) *AuditController {
+	c := &AuditController{}
+	tokenController := getController()
+	tokenController.Ctx.Request.Form = query
+	c.Init(tokenController.Ctx, "", "", nil)
+	return c
+}
+
+// Persist the audit events in a memory database, restored along with the database by the returned function
+func withPersistedAudit() func() {
+	previousDb := adapter.Db
+	previousPersisted := isAuditPersisted
+	db := &adapter.MemoryDb{}
+	_ = db.InitDatabase()
+	adapter.Db = db
+	isAuditPersisted = true
+	return func() {
+		adapter.Db = previousDb
+		isAuditPersisted = previousPersisted
+	}
+}
+
+func TestAuditSecurityEvent(t *testing.T) {
+	Convey("audit security event", t, func() {
+		restore := withPersistedAudit()
+		defer restore()
+		auditSecurityEvent(auditTokenIssued, auditSuccess, "127.0.0.1", oauth2AppInsId, oauth2Ak)
+		auditSecurityEvent(auditSignatureFailure, auditFailure, "127.0.0.2", "", oauth2Ak)
+		auditSecurityEvent(auditAkBlockListed, auditDenied, "127.0.0.2", "", oauth2Ak)
+
+		Convey("queries the persisted events", func() {
+			c := getAuditController(map[string][]string{})
+			c.Get()
+			events, ok := c.Data["json"].([]models.AuditEvent)
+			So(ok, ShouldBeTrue)
+			So(len(events), ShouldEqual, 3)
+			So(events[0].Event, ShouldEqual, auditAkBlockListed)
+			So(events[2].AppInsId, ShouldEqual, oauth2AppInsId)
+			So(events[2].Time, ShouldNotBeEmpty)
+		})
+		Convey("queries the events of the filter", func() {
+			c := getAuditController(map[string][]string{"client_ip": {"127.0.0.2"}, "outcome": {auditFailure}})
+			c.Get()
+			events, ok := c.Data["json"].([]models.AuditEvent)
+			So(ok, ShouldBeTrue)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Event, ShouldEqual, auditSignatureFailure)
+		})
+		Convey("queries at most limit events", func() {
+			c := getAuditController(map[string][]string{"limit": {"2"}})
+			c.Get()
+			events, ok := c.Data["json"].([]models.AuditEvent)
+			So(ok, ShouldBeTrue)
+			So(len(events), ShouldEqual, 2)
+		})
+		Convey("for invalid limit", func() {
+			c := getAuditController(map[string][]string{"limit": {"0"}})
+			c.Get()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusBadRequest)
+		})
+		Convey("audits the unblocked AK", func() {
+			akBlockList = newMemoryBlockListStore()
+			blockAk(blockListAk)
+			getBlockListController(blockListAk).Delete()
+			events, err := queryAuditEvents(&models.AuditEvent{Event: auditAkUnblocked}, 1)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Ak, ShouldEqual, blockListAk)
+		})
+		Convey("audits the failed configuration change", func() {
+			getRotateController("invalid-app-ins-id").Delete()
+			events, err := queryAuditEvents(&models.AuditEvent{Event: auditConfDeleted}, 1)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Outcome, ShouldEqual, auditFailure)
+		})
+		Convey("audits the configuration of an invalid ak", func() {
+			c := getRotateController(oauth2AppInsId)
+			c.Ctx.Input.RequestBody = []byte(`{"authInfo":{"credentials":{"accessKeyId":"invalid",` +
+				`"secretKey":"invalid"}}}`)
+			c.Put()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusBadRequest)
+			events, err := queryAuditEvents(&models.AuditEvent{Event: auditConfCreated}, 1)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Outcome, ShouldEqual, auditFailure)
+		})
+	})
+}
+
+func TestPurgeAuditEvents(t *testing.T) {
+	Convey("purge audit events", t, func() {
+		restore := withPersistedAudit()
+		defer restore()
+		auditSecurityEvent(auditTokenIssued, auditSuccess, "127.0.0.1", oauth2AppInsId, oauth2Ak)
+		before := time.Now()
+		auditSecurityEvent(auditConfDeleted, auditSuccess, "127.0.0.1", oauth2AppInsId, "")
+
+		purgeAuditEvents(before)
+		events, err := queryAuditEvents(&models.AuditEvent{}, defaultAuditQueryLimit)
+		So(err, ShouldBeNil)
+		So(len(events), ShouldEqual, 1)
+		So(events[0].Event, ShouldEqual, auditConfDeleted)
+	})
+}
+
+func TestInitAuditLog(t *testing.T) {
+	previousLogger := auditLogger
+	previousDb := adapter.Db
+	defer func() {
+		auditLogger = previousLogger
+		adapter.Db = previousDb
+		isAuditPersisted = false
+	}()
+
+	Convey("init audit log", t, func() {
+		dir, err := ioutil.TempDir("", "mepauth-audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		fileName := filepath.Join(dir, "audit.log")
+		So(beego.AppConfig.Set("audit_log_file", fileName), ShouldBeNil)
+		defer func() {
+			_ = beego.AppConfig.Set("audit_log_file", "")
+		}()
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		adapter.Db = db
+
+		InitAuditLog()
+		So(auditLogger, ShouldNotEqual, log.StandardLogger())
+		auditSecurityEvent(auditConfDeleted, auditSuccess, "127.0.0.1", oauth2AppInsId, "")
+
+		content, err := ioutil.ReadFile(fileName)
+		So(err, ShouldBeNil)
+		entry := map[string]interface{}{}
+		So(json.Unmarshal([]byte(strings.TrimSpace(string(content))), &entry), ShouldBeNil)
+		So(entry["event"], ShouldEqual, auditConfDeleted)
+		So(entry["outcome"], ShouldEqual, auditSuccess)
+		So(entry["app_ins_id"], ShouldEqual, oauth2AppInsId)
+		So(entry["audit"], ShouldEqual, true)
+		events, err := queryAuditEvents(&models.AuditEvent{}, defaultAuditQueryLimit)
+		So(err, ShouldBeNil)
+		So(len(events), ShouldEqual, 1)
+	})
+}
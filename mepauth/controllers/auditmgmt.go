@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const defaultAuditQueryLimit = 100
+
+// AuditController security audit log query controller
+type AuditController struct {
+	BaseController
+}
+
+// @Title Get security audit events
+// @Description security audit events of the mepauth instances within the retention, the newest first
+// @Param   event       query  string  false  "Audit event"
+// @Param   outcome     query  string  false  "Outcome of the event, success, failure or denied"
+// @Param   app_ins_id  query  string  false  "APP instance ID"
+// @Param   ak          query  string  false  "AK"
+// @Param   client_ip   query  string  false  "Client IP"
+// @Param   limit       query  int     false  "Maximum number of events, 100 by default"
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 500 internal server error
+// @router /appMng/v1/audit [get]
+func (c *AuditController) Get() {
+	log.Info("Get security audit events request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return
+	}
+	c.logReceivedMsg(clientIp)
+
+	limit, err := c.GetInt("limit", defaultAuditQueryLimit)
+	if err != nil || limit < 1 {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, "Limit is invalid")
+		return
+	}
+	filter := &models.AuditEvent{
+		Event:    c.GetString(eventColumn),
+		Outcome:  c.GetString(outcomeColumn),
+		AppInsId: c.GetString(appInstanceID),
+		Ak:       c.GetString(akColumn),
+		ClientIp: c.GetString(clientIpColumn),
+	}
+	events, err := queryAuditEvents(filter, limit)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusInternalServerError, "Failed to read audit events")
+		return
+	}
+	c.Data["json"] = events
+	c.handleLoggingForSuccess(clientIp, "")
+}
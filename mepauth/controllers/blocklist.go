@@ -18,116 +18,328 @@
 package controllers
 
 import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
 	log "github.com/sirupsen/logrus"
+
+	"mepauth/adapter"
 	"mepauth/models"
 	"mepauth/util"
-	"strconv"
-	"time"
 )
 
-var authInfoList map[string]*models.AkSessionInfo
+const (
+	akColumn               = "ak"
+	failureCountColumn     = "failure_count"
+	validateUntilColumn    = "validate_until"
+	blockedUntilColumn     = "blocked_until"
+	akBlockListTable       = "ak_block_list_record"
+	akBlockListStoreConfig = "ak_blocklist_store"
+	dbStoreType            = "db"
+	// Attempts of counting a failure on the record updated concurrently by the other requests
+	akBlockListAttempts = 5
+	// Interval of purging the expired records
+	akBlockListPurgeInterval = time.Minute
+)
 
-// InitAuthInfoList initializes auth info list
-func InitAuthInfoList() {
-	authInfoList = make(map[string]*models.AkSessionInfo)
+// akBlockListStore keeps the block listing records of the AKs, the records are updated only if they are unchanged
+// since read so that the instances sharing them count every failure
+type akBlockListStore interface {
+	// get returns nil when the AK has no record
+	get(ak string) (*models.AkBlockListRecord, error)
+	// saveIf saves the record only if the stored one still equals the expected, nil expected when there is none.
+	// Returns false if the record was changed meanwhile
+	saveIf(record *models.AkBlockListRecord, expected *models.AkBlockListRecord) (bool, error)
+	// removeIf removes the record only if it is unchanged
+	removeIf(record *models.AkBlockListRecord) error
+	list() ([]*models.AkBlockListRecord, error)
 }
 
-// Verify that Ak is in block list or not
-func isAkInBlockList(ak string) bool {
-	akInfo, ok := authInfoList[ak]
-	if ok && akInfo.State == "UnderBlockList" {
-		return true
+// memoryBlockListStore keeps the records in the process, they are lost on restart
+type memoryBlockListStore struct {
+	mutex   sync.RWMutex
+	records map[string]models.AkBlockListRecord
+}
+
+func newMemoryBlockListStore() *memoryBlockListStore {
+	return &memoryBlockListStore{records: make(map[string]models.AkBlockListRecord)}
+}
+
+func (s *memoryBlockListStore) get(ak string) (*models.AkBlockListRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, ok := s.records[ak]
+	if !ok {
+		return nil, nil
 	}
-	return false
+	return &record, nil
 }
 
-// Verify that Ak is in validation list or not
-func isAkInValidationList(ak string) bool {
-	akInfo, ok := authInfoList[ak]
-	if ok && akInfo.State == "ValidationInProgress" {
-		return true
+func (s *memoryBlockListStore) saveIf(record *models.AkBlockListRecord,
+	expected *models.AkBlockListRecord) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.records[record.Ak]
+	if ok != (expected != nil) || (ok && stored != *expected) {
+		return false, nil
+	}
+	s.records[record.Ak] = *record
+	return true, nil
+}
+
+func (s *memoryBlockListStore) removeIf(record *models.AkBlockListRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if stored, ok := s.records[record.Ak]; ok && stored == *record {
+		delete(s.records, record.Ak)
+	}
+	return nil
+}
+
+func (s *memoryBlockListStore) list() ([]*models.AkBlockListRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	records := make([]*models.AkBlockListRecord, 0, len(s.records))
+	for _, record := range s.records {
+		stored := record
+		records = append(records, &stored)
+	}
+	return records, nil
+}
+
+// dbBlockListStore keeps the records in the database, shared by all the mepauth instances
+type dbBlockListStore struct{}
+
+func (s *dbBlockListStore) get(ak string) (*models.AkBlockListRecord, error) {
+	record := &models.AkBlockListRecord{Ak: ak}
+	err := adapter.Db.ReadData(record, akColumn)
+	if err == orm.ErrNoRows {
+		return nil, nil
 	}
-	return false
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *dbBlockListStore) saveIf(record *models.AkBlockListRecord,
+	expected *models.AkBlockListRecord) (bool, error) {
+	if expected != nil {
+		return adapter.Db.UpdateDataIf(record, map[string]interface{}{
+			failureCountColumn:  expected.FailureCount,
+			validateUntilColumn: expected.ValidateUntil,
+			blockedUntilColumn:  expected.BlockedUntil,
+		}, failureCountColumn, validateUntilColumn, blockedUntilColumn)
+	}
+	err := adapter.Db.InsertData(record)
+	if err == nil || err.Error() == util.PgOkMsg {
+		return true, nil
+	}
+	// Inserted by another instance meanwhile
+	if stored, readErr := s.get(record.Ak); readErr == nil && stored != nil {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *dbBlockListStore) removeIf(record *models.AkBlockListRecord) error {
+	return adapter.Db.DeleteData(record, akColumn, failureCountColumn, validateUntilColumn, blockedUntilColumn)
 }
 
-// Start Ak validation
-func startValidatingAk(ak string) {
-	akInfo := new(models.AkSessionInfo)
-	akInfo.Ak = ak
-	akInfo.State = "ValidationInProgress"
-	akInfo.ValidateCounter++
-	akInfo.ClearTimer = time.NewTimer(time.Duration(util.ValidateListClearTimer) * time.Second)
+func (s *dbBlockListStore) list() ([]*models.AkBlockListRecord, error) {
+	var records []*models.AkBlockListRecord
+	_, err := adapter.Db.QueryTable(akBlockListTable, &records)
+	if err != nil && err != orm.ErrNoRows {
+		return nil, err
+	}
+	return records, nil
+}
+
+var akBlockList akBlockListStore = newMemoryBlockListStore()
+
+// InitAuthInfoList initializes auth info list in the store configured by ak_blocklist_store
+func InitAuthInfoList() {
+	if util.GetAppConfig(akBlockListStoreConfig) == dbStoreType {
+		akBlockList = &dbBlockListStore{}
+		log.Info("Ak block list is kept in database")
+		return
+	}
+	akBlockList = newMemoryBlockListStore()
+}
+
+// StartAkBlockListPurge removes the records expired since the last failure of their AKs
+func StartAkBlockListPurge() {
 	go func() {
-		_, ok := <-akInfo.ClearTimer.C
-		if !ok {
-			log.Error("Timer C channel closed")
+		ticker := time.NewTicker(akBlockListPurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purgeAkBlockList()
 		}
-		delete(authInfoList, ak)
 	}()
-	authInfoList[ak] = akInfo
 }
 
-// Stop Ak validation
-func stopValidatingAk(ak string) {
-	defer func() {
-		if err1 := recover(); err1 != nil {
-			log.Error("panic handled:", err1)
+func purgeAkBlockList() {
+	records, err := akBlockList.list()
+	if err != nil {
+		log.Error("Failed to list block listing of Aks, purge will be retried.")
+		return
+	}
+	now := time.Now().Unix()
+	for _, record := range records {
+		if isRecordBlocked(record, now) || isRecordValidating(record, now) {
+			continue
 		}
-	}()
-
-	akInfo, ok := authInfoList[ak]
-	if ok {
-		akInfo.State = "None"
-		akInfo.ValidateCounter = 0
-		ok := akInfo.ClearTimer.Stop()
-		if ok {
-			log.Info("Validating Timer stopped")
+		if err = akBlockList.removeIf(record); err != nil {
+			log.Error("Failed to purge block listing of Ak " + record.Ak + ".")
 		}
 	}
 }
 
-// Start AK block listing
-func startBlockListingAk(ak string) {
-	akInfo, ok := authInfoList[ak]
-	if ok {
-		akInfo.State = "UnderBlockList"
-		akInfo.ClearTimer = time.NewTimer(time.Duration(util.BlockListClearTimer) * time.Second)
-		go func() {
-			_, ok := <-akInfo.ClearTimer.C
-			if !ok {
-				log.Error("Timer C channel closed")
-			}
-			// Timer expired, so ak is safe now
-			delete(authInfoList, ak)
-			log.Info("BlockList timer expired. Ak " + ak + " is moving out of blockList")
-		}()
-	}
-}
-
-// Process Ak for block listing
-func processAkForBlockListing(ak string) {
-	if isAkInValidationList(ak) {
-		akInfo, ok := authInfoList[ak]
-		if ok {
-			akInfo.ValidateCounter++
-			// If received invalid Ak for 3 times move to blockList
-			if akInfo.ValidateCounter >= util.ValidationCounter {
-				log.Info("Received invalid signature " + strconv.FormatInt(akInfo.ValidateCounter, util.BaseVal) +
-					" times, Ak " + ak + " is now under blockList")
-				stopValidatingAk(ak)
-				startBlockListingAk(ak)
-				return
-			}
+// Number of failed authentications to block list an AK
+func akValidationCounter() int64 {
+	return beego.AppConfig.DefaultInt64("ak_validation_counter", util.ValidationCounter)
+}
+
+// Seconds the failed authentications are counted in
+func akValidationWindow() int64 {
+	return beego.AppConfig.DefaultInt64("ak_validation_window", util.ValidateListClearTimer)
+}
+
+// Seconds an AK stays block listed
+func akBlockDuration() int64 {
+	return beego.AppConfig.DefaultInt64("ak_block_duration", util.BlockListClearTimer)
+}
+
+func isRecordBlocked(record *models.AkBlockListRecord, now int64) bool {
+	return record.BlockedUntil > now
+}
+
+func isRecordValidating(record *models.AkBlockListRecord, now int64) bool {
+	return !isRecordBlocked(record, now) && record.ValidateUntil > now
+}
+
+// Read the record of the AK, an expired record is as good as none
+func getAkRecord(ak string, now int64) (*models.AkBlockListRecord, error) {
+	record, err := akBlockList.get(ak)
+	if err != nil {
+		log.Error("Failed to read block listing of Ak " + ak + ".")
+		return nil, err
+	}
+	if record == nil || (!isRecordBlocked(record, now) && !isRecordValidating(record, now)) {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// Verify that Ak is in block list or not, the caller refuses the Ak when its block listing can not be read
+func isAkInBlockList(ak string) (bool, error) {
+	now := time.Now().Unix()
+	record, err := getAkRecord(ak, now)
+	if err != nil {
+		return false, err
+	}
+	return record != nil && isRecordBlocked(record, now), nil
+}
+
+// Verify that Ak is in validation list or not
+func isAkInValidationList(ak string) bool {
+	now := time.Now().Unix()
+	record, err := getAkRecord(ak, now)
+	return err == nil && record != nil && isRecordValidating(record, now)
+}
+
+// Process Ak for block listing, the client ip is audited when the Ak gets block listed. The failure is counted on
+// the record as read, it is counted again on the record updated meanwhile by another request
+func processAkForBlockListing(ak string, clientIp string) {
+	for attempt := 0; attempt < akBlockListAttempts; attempt++ {
+		stored, err := akBlockList.get(ak)
+		if err != nil {
+			log.Error("Failed to read block listing of Ak " + ak + ".")
+			return
+		}
+		now := time.Now().Unix()
+		if stored != nil && isRecordBlocked(stored, now) {
+			return
+		}
+		record := &models.AkBlockListRecord{
+			Ak:            ak,
+			ValidateUntil: now + akValidationWindow(),
+		}
+		if stored != nil && isRecordValidating(stored, now) {
+			*record = *stored
+		}
+		record.FailureCount++
+		// If received invalid Ak for the configured times move to blockList
+		if record.FailureCount >= akValidationCounter() {
+			record.BlockedUntil = now + akBlockDuration()
 		}
-	} else {
-		startValidatingAk(ak)
+		saved, err := akBlockList.saveIf(record, stored)
+		if err != nil {
+			log.Error("Failed to save block listing of Ak " + ak + ".")
+			return
+		}
+		if !saved {
+			continue
+		}
+		if isRecordBlocked(record, now) {
+			log.Info("Received invalid signature " + strconv.FormatInt(record.FailureCount, util.BaseVal) +
+				" times, Ak " + ak + " is now under blockList")
+			auditSecurityEvent(auditAkBlockListed, auditDenied, clientIp, "", ak)
+		}
+		return
 	}
+	log.Warn("Block listing of Ak " + ak + " is updated concurrently, failure is not counted.")
 }
 
-// Clear Ak from block listing
+// Clear Ak from block listing, unless it got block listed meanwhile
 func clearAkFromBlockListing(ak string) {
-	if isAkInValidationList(ak) {
-		stopValidatingAk(ak)
-		delete(authInfoList, ak)
+	record, err := akBlockList.get(ak)
+	if err != nil {
+		log.Error("Failed to read block listing of Ak " + ak + ".")
+		return
+	}
+	if record != nil && !isRecordBlocked(record, time.Now().Unix()) {
+		if err = akBlockList.removeIf(record); err != nil {
+			log.Error("Failed to remove block listing of Ak " + ak + ".")
+		}
+	}
+}
+
+// List the block listed AKs
+func listBlockListedAks() ([]*models.AkBlockListRecord, error) {
+	records, err := akBlockList.list()
+	if err != nil {
+		log.Error("Failed to list block listing of Aks.")
+		return nil, err
+	}
+	now := time.Now().Unix()
+	blocked := make([]*models.AkBlockListRecord, 0, len(records))
+	for _, record := range records {
+		if isRecordBlocked(record, now) {
+			blocked = append(blocked, record)
+		}
+	}
+	return blocked, nil
+}
+
+// Unblock the AK, returns false when the AK is not block listed
+func unblockAk(ak string) (bool, error) {
+	now := time.Now().Unix()
+	record, err := akBlockList.get(ak)
+	if err != nil {
+		log.Error("Failed to read block listing of Ak " + ak + ".")
+		return false, err
+	}
+	if record == nil || !isRecordBlocked(record, now) {
+		return false, nil
+	}
+	if err = akBlockList.removeIf(record); err != nil {
+		log.Error("Failed to remove block listing of Ak " + ak + ".")
+		return false, err
 	}
+	log.Info("Ak " + ak + " is moving out of blockList")
+	return true, nil
 }
@@ -17,38 +17,81 @@
 package controllers
 
 import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/agiledragon/gomonkey"
 	"github.com/smartystreets/goconvey/convey"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
 )
 
+const blockListAk = "QVUJMSUMgS0VZLS0tLS0"
+
+func blockAk(ak string) {
+	for i := int64(0); i < akValidationCounter(); i++ {
+		processAkForBlockListing(ak, "127.0.0.1")
+	}
+}
+
+func isBlockListed(ak string) bool {
+	blocked, err := isAkInBlockList(ak)
+	return err == nil && blocked
+}
+
 func TestInitAuthInfoList(t *testing.T) {
 	convey.Convey("Init AuthInfo List", t, func() {
-		convey.Convey("for success", func() {
+		convey.Convey("for memory store", func() {
+			patches := gomonkey.ApplyFunc(util.GetAppConfig, func(string) string {
+				return ""
+			})
+			defer patches.Reset()
+			InitAuthInfoList()
+			_, ok := akBlockList.(*memoryBlockListStore)
+			convey.So(ok, convey.ShouldBeTrue)
+		})
+		convey.Convey("for db store", func() {
+			patches := gomonkey.ApplyFunc(util.GetAppConfig, func(string) string {
+				return dbStoreType
+			})
+			defer patches.Reset()
 			InitAuthInfoList()
+			_, ok := akBlockList.(*dbBlockListStore)
+			convey.So(ok, convey.ShouldBeTrue)
 		})
 	})
 }
 
 func TestIsAkInBlockList(t *testing.T) {
 	convey.Convey("isAkInBlockList", t, func() {
+		akBlockList = newMemoryBlockListStore()
 		convey.Convey("for success", func() {
-			InitAuthInfoList()
-			startValidatingAk("ak")
-			startBlockListingAk("ak")
-			res := isAkInBlockList("ak")
+			blockAk("ak")
+			res, _ := isAkInBlockList("ak")
 			convey.So(res, convey.ShouldBeTrue)
 		})
 
 		convey.Convey("for fail state", func() {
-			InitAuthInfoList()
-			startValidatingAk("ak")
-			res := isAkInBlockList("ak")
+			processAkForBlockListing("ak", "127.0.0.1")
+			res, _ := isAkInBlockList("ak")
 			convey.So(res, convey.ShouldBeFalse)
 		})
 
 		convey.Convey("for fail", func() {
-			res := isAkInBlockList("ak2")
+			res, _ := isAkInBlockList("ak2")
+			convey.So(res, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("for expired", func() {
+			_, _ = akBlockList.saveIf(&models.AkBlockListRecord{Ak: "ak", FailureCount: 3,
+				BlockedUntil: time.Now().Add(-time.Second).Unix()}, nil)
+			res, _ := isAkInBlockList("ak")
 			convey.So(res, convey.ShouldBeFalse)
 		})
 	})
@@ -56,48 +99,189 @@ func TestIsAkInBlockList(t *testing.T) {
 
 func TestIsAkInValidationList(t *testing.T) {
 	convey.Convey("isAkInValidationList", t, func() {
+		akBlockList = newMemoryBlockListStore()
 		convey.Convey("for success", func() {
-			InitAuthInfoList()
-			startValidatingAk("ak")
+			processAkForBlockListing("ak", "127.0.0.1")
 			res := isAkInValidationList("ak")
 			convey.So(res, convey.ShouldBeTrue)
 		})
 		convey.Convey("for fail", func() {
-			InitAuthInfoList()
 			res := isAkInValidationList("ak")
 			convey.So(res, convey.ShouldBeFalse)
 		})
-	})
-}
+		convey.Convey("for expired", func() {
+			_, _ = akBlockList.saveIf(&models.AkBlockListRecord{Ak: "ak", FailureCount: 1,
+				ValidateUntil: time.Now().Add(-time.Second).Unix()}, nil)
+			res := isAkInValidationList("ak")
+			convey.So(res, convey.ShouldBeFalse)
 
-func TestStopValidatingAk(t *testing.T) {
-	convey.Convey("stopValidatingAk", t, func() {
-		convey.Convey("for success", func() {
-			InitAuthInfoList()
-			startValidatingAk("ak")
-			stopValidatingAk("ak")
+			// The failures are counted afresh
+			processAkForBlockListing("ak", "127.0.0.1")
+			record, _ := akBlockList.get("ak")
+			convey.So(record.FailureCount, convey.ShouldEqual, 1)
 		})
 	})
 }
 
 func TestClearAkFromBlockListing(t *testing.T) {
 	convey.Convey("clearAkFromBlockListing", t, func() {
+		akBlockList = newMemoryBlockListStore()
 		convey.Convey("for success", func() {
-			InitAuthInfoList()
-			startValidatingAk("ak")
+			processAkForBlockListing("ak", "127.0.0.1")
 			clearAkFromBlockListing("ak")
+			convey.So(isAkInValidationList("ak"), convey.ShouldBeFalse)
+		})
+		convey.Convey("keeps the block listing", func() {
+			blockAk("ak")
+			clearAkFromBlockListing("ak")
+			convey.So(isBlockListed("ak"), convey.ShouldBeTrue)
 		})
 	})
 }
 
 func TestProcessAkForBlockListing(t *testing.T) {
 	convey.Convey("processAkForBlockListing", t, func() {
+		akBlockList = newMemoryBlockListStore()
 		convey.Convey("for success", func() {
-			startValidatingAk("ak")
-			processAkForBlockListing("ak")
+			processAkForBlockListing("ak", "127.0.0.1")
+			processAkForBlockListing("ak", "127.0.0.1")
+			record, _ := akBlockList.get("ak")
+			convey.So(record.FailureCount, convey.ShouldEqual, 2)
 		})
-		convey.Convey("for fail", func() {
-			processAkForBlockListing("ak")
+		convey.Convey("for configured threshold", func() {
+			patches := gomonkey.ApplyFunc(akValidationCounter, func() int64 {
+				return 1
+			})
+			defer patches.Reset()
+			processAkForBlockListing("ak", "127.0.0.1")
+			convey.So(isBlockListed("ak"), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestDbBlockListStore(t *testing.T) {
+	previousDb := adapter.Db
+	defer func() {
+		adapter.Db = previousDb
+		akBlockList = newMemoryBlockListStore()
+	}()
+
+	convey.Convey("db block list store", t, func() {
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		adapter.Db = db
+		akBlockList = &dbBlockListStore{}
+
+		convey.Convey("shares the block listing", func() {
+			blockAk("ak")
+			record := &models.AkBlockListRecord{Ak: "ak"}
+			convey.So(db.ReadData(record, akColumn), convey.ShouldBeNil)
+			convey.So(record.BlockedUntil, convey.ShouldBeGreaterThan, time.Now().Unix())
+
+			// Another instance reading the same database
+			akBlockList = &dbBlockListStore{}
+			convey.So(isBlockListed("ak"), convey.ShouldBeTrue)
+			records, err := listBlockListedAks()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(records), convey.ShouldEqual, 1)
+		})
+		convey.Convey("for db failure", func() {
+			patches := gomonkey.ApplyMethod(reflect.TypeOf(db), "ReadData",
+				func(*adapter.MemoryDb, interface{}, ...string) error {
+					return errors.New("db error")
+				})
+			patches.ApplyMethod(reflect.TypeOf(db), "QueryTable", func(*adapter.MemoryDb, string,
+				interface{}) (int64, error) {
+				return 0, errors.New("db error")
+			})
+			defer patches.Reset()
+			processAkForBlockListing("ak", "127.0.0.1")
+			// The Ak is refused while its block listing can not be read
+			_, err := isAkInBlockList("ak")
+			convey.So(err, convey.ShouldNotBeNil)
+			_, err = listBlockListedAks()
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+		convey.Convey("counts the failures of the concurrent requests", func() {
+			patches := gomonkey.ApplyFunc(akValidationCounter, func() int64 {
+				return 100
+			})
+			defer patches.Reset()
+			var wait sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wait.Add(1)
+				go func() {
+					defer wait.Done()
+					processAkForBlockListing("ak", "127.0.0.1")
+				}()
+			}
+			wait.Wait()
+			record, _ := akBlockList.get("ak")
+			convey.So(record.FailureCount, convey.ShouldEqual, 4)
+		})
+		convey.Convey("keeps the record changed meanwhile", func() {
+			processAkForBlockListing("ak", "127.0.0.1")
+			stored, _ := akBlockList.get("ak")
+			processAkForBlockListing("ak", "127.0.0.1")
+			saved, err := akBlockList.saveIf(&models.AkBlockListRecord{Ak: "ak", FailureCount: 2}, stored)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(saved, convey.ShouldBeFalse)
+			convey.So(akBlockList.removeIf(stored), convey.ShouldBeNil)
+			record, _ := akBlockList.get("ak")
+			convey.So(record.FailureCount, convey.ShouldEqual, 2)
+		})
+		convey.Convey("purges the expired records", func() {
+			_, _ = akBlockList.saveIf(&models.AkBlockListRecord{Ak: "expired", FailureCount: 1,
+				ValidateUntil: time.Now().Add(-time.Second).Unix()}, nil)
+			processAkForBlockListing("ak", "127.0.0.1")
+			purgeAkBlockList()
+			record, _ := akBlockList.get("expired")
+			convey.So(record, convey.ShouldBeNil)
+			record, _ = akBlockList.get("ak")
+			convey.So(record, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func getBlockListController(ak string) *BlockListController {
+	c := &BlockListController{}
+	tokenController := getController()
+	if ak != "" {
+		tokenController.Ctx.Request.Form = map[string][]string{akColumn: {ak}}
+	}
+	c.Init(tokenController.Ctx, "", "", nil)
+	return c
+}
+
+func TestBlockListController(t *testing.T) {
+	convey.Convey("block list management", t, func() {
+		akBlockList = newMemoryBlockListStore()
+		blockAk(blockListAk)
+		processAkForBlockListing("ak", "127.0.0.1")
+
+		convey.Convey("lists the block listed AKs", func() {
+			c := getBlockListController("")
+			c.Get()
+			records, ok := c.Data["json"].([]*models.AkBlockListRecord)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(len(records), convey.ShouldEqual, 1)
+			convey.So(records[0].Ak, convey.ShouldEqual, blockListAk)
+		})
+		convey.Convey("unblocks the AK", func() {
+			c := getBlockListController(blockListAk)
+			c.Delete()
+			convey.So(c.Data["json"], convey.ShouldEqual, "Unblock success.")
+			convey.So(isBlockListed(blockListAk), convey.ShouldBeFalse)
+		})
+		convey.Convey("for AK not block listed", func() {
+			c := getBlockListController("QVUJMSUMgS0VZLS0tLS1")
+			c.Delete()
+			convey.So(c.Ctx.ResponseWriter.Status, convey.ShouldEqual, http.StatusNotFound)
+		})
+		convey.Convey("for invalid AK", func() {
+			c := getBlockListController("ak")
+			c.Delete()
+			convey.So(c.Ctx.ResponseWriter.Status, convey.ShouldEqual, http.StatusBadRequest)
 		})
 	})
 }
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/util"
+)
+
+// BlockListController AK block list management controller
+type BlockListController struct {
+	BaseController
+}
+
+// @Title Get block listed AKs
+// @Description AKs locked out for repeated failed authentication
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 500 internal server error
+// @router /appMng/v1/blocklist [get]
+func (c *BlockListController) Get() {
+	log.Info("Get block listed AKs request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return
+	}
+	c.logReceivedMsg(clientIp)
+
+	records, err := listBlockListedAks()
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusInternalServerError, "Failed to get block listed AKs")
+		return
+	}
+	c.Data["json"] = records
+	c.handleLoggingForSuccess(clientIp, "")
+}
+
+// @Title Unblock AK
+// @Description unblock of an AK before its lockout expires
+// @Param   ak  query  string  true   "Block listed AK"
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 404 not found
+// @Failure 500 internal server error
+// @router /appMng/v1/blocklist [delete]
+func (c *BlockListController) Delete() {
+	log.Info("Unblock AK request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return
+	}
+	c.logReceivedMsg(clientIp)
+
+	ak := c.GetString(akColumn)
+	if util.ValidateAk(ak) != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, "Ak is invalid")
+		return
+	}
+	unblocked, err := unblockAk(ak)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusInternalServerError, "Failed to unblock AK")
+		return
+	}
+	if !unblocked {
+		c.handleLoggingForError(clientIp, http.StatusNotFound, "Ak is not block listed")
+		return
+	}
+	auditSecurityEvent(auditAkUnblocked, auditSuccess, clientIp, "", ak)
+	c.Data["json"] = "Unblock success."
+	c.handleLoggingForSuccess(clientIp, "Ak "+ak+" is unblocked")
+}
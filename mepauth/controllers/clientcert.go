@@ -0,0 +1,220 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/astaxie/beego/orm"
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const certSubjectColumn = "cert_subject"
+
+var errCertSubjectInUse = errors.New("certificate subject is mapped to another app instance")
+
+// Validate the certificate subject of the app instance, a subject identifies a single app instance
+func validateCertSubjectOf(appInsId string, certSubject string) error {
+	if err := util.ValidateCertSubject(certSubject); err != nil {
+		return err
+	}
+	authInfoRecord, err := readAuthInfoByCertSubject(certSubject)
+	if err != nil {
+		return err
+	}
+	if authInfoRecord != nil && authInfoRecord.AppInsId != appInsId {
+		return errCertSubjectInUse
+	}
+	return nil
+}
+
+// Read the auth info of the app instance mapped to the certificate subject, nil when none is
+func readAuthInfoByCertSubject(certSubject string) (*models.AuthInfoRecord, error) {
+	authInfoRecord := &models.AuthInfoRecord{
+		CertSubject: certSubject,
+	}
+	err := adapter.Db.ReadData(authInfoRecord, certSubjectColumn)
+	if err == orm.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil && err.Error() != util.PgOkMsg {
+		log.Error("Failed to read auth info record of certificate subject " + certSubject + ".")
+		return nil, err
+	}
+	return authInfoRecord, nil
+}
+
+// The client certificate verified against the configured client CA certificates, nil when the client sent none. The
+// certificate the api gateway forwards is trusted only on the connections the api gateway made with its own one
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if !util.IsApiGwClientCert(cert) {
+		return cert
+	}
+	return forwardedClientCert(r.Header.Get(util.ClientCertHeader))
+}
+
+// The client certificate the api gateway requested from the app, in the URL escaped PEM format of nginx
+func forwardedClientCert(escapedCert string) *x509.Certificate {
+	if escapedCert == "" {
+		return nil
+	}
+	certPem, err := url.PathUnescape(escapedCert)
+	if err != nil {
+		log.Warn("Failed to unescape the client certificate forwarded by api gateway.")
+		return nil
+	}
+	block, _ := pem.Decode([]byte(certPem))
+	if block == nil {
+		log.Warn("Failed to decode the client certificate forwarded by api gateway.")
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		log.Warn("Failed to parse the client certificate forwarded by api gateway.")
+		return nil
+	}
+	if err = util.VerifyClientCert(cert); err != nil {
+		log.Warn("Client certificate " + cert.Subject.String() + " forwarded by api gateway is not trusted.")
+		return nil
+	}
+	return cert
+}
+
+// Names the certificate may be mapped by, the URI and DNS SANs first and the subject common name last
+func certSubjectsOf(cert *x509.Certificate) []string {
+	subjects := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+1)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	subjects = append(subjects, cert.DNSNames...)
+	if cert.Subject.CommonName != "" {
+		subjects = append(subjects, cert.Subject.CommonName)
+	}
+	return subjects
+}
+
+// SHA-256 thumbprint of the DER encoded certificate as per RFC 8705 section 3.1
+func certThumbprintOf(cert *x509.Certificate) string {
+	thumbprint := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:])
+}
+
+// Read the auth info of the app instance the certificate is mapped to, nil when it is mapped to none
+func readAuthInfoByCert(cert *x509.Certificate) (*models.AuthInfoRecord, error) {
+	for _, certSubject := range certSubjectsOf(cert) {
+		if util.ValidateCertSubject(certSubject) != nil {
+			continue
+		}
+		authInfoRecord, err := readAuthInfoByCertSubject(certSubject)
+		if err != nil || authInfoRecord != nil {
+			return authInfoRecord, err
+		}
+	}
+	return nil, nil
+}
+
+// Check whether the OAuth2 client authenticates with its certificate as per RFC 8705 section 2, the client sends
+// no secret then
+func isTlsClientAuth(r *http.Request) bool {
+	return !hasBasicAuthHeader(r) && r.PostForm.Get(util.ClientSecretParam) == ""
+}
+
+// Check whether the client id identifies the auth info, by its current ak or by its previous ak till it expires
+func isClientIdOf(clientId string, authInfoRecord *models.AuthInfoRecord) bool {
+	return clientId == authInfoRecord.Ak || (clientId == authInfoRecord.PrevAk && isPrevAkValid(authInfoRecord))
+}
+
+// Handle the token request authenticated with the client certificate, the token is bound to the certificate
+func (c *TokenController) handleClientCert(clientIp string, cert *x509.Certificate) {
+	c.logReceivedMsg(clientIp)
+	authInfoRecord, err := readAuthInfoByCert(cert)
+	if err != nil {
+		c.writeErrorResponse(internalError, http.StatusInternalServerError)
+		c.logErrResponseMsg(clientIp, "Reading the app instance of the client certificate failed")
+		return
+	}
+	if authInfoRecord == nil {
+		auditSecurityEvent(auditClientAuthFailure, auditFailure, clientIp, "", "")
+		c.writeErrorResponse("Invalid client certificate.", http.StatusUnauthorized)
+		c.logErrResponseMsg(clientIp, "Client certificate "+cert.Subject.String()+" is not mapped to an app instance")
+		return
+	}
+	ak := authInfoRecord.Ak
+	if c.isRateLimited(akRateLimiter, ak, auditAkRateLimited, clientIp, ak) {
+		c.writeErrorResponse(tooManyRequests, http.StatusTooManyRequests)
+		c.logErrResponseMsgWithAk(clientIp, "Ak is rate limited", ak)
+		return
+	}
+	log.Info("Corresponding App Instance Id " + authInfoRecord.AppInsId + " found for client certificate " +
+		cert.Subject.String())
+
+	token, err := generateBoundJwtToken(authInfoRecord.AppInsId, clientIp, certThumbprintOf(cert))
+	if err != nil {
+		c.writeErrorResponse(internalError, http.StatusInternalServerError)
+		c.logErrResponseMsgWithAk(clientIp, "Generation of jwt token failed", ak)
+		return
+	}
+	c.sendResponseMsg(authInfoRecord.AppInsId, ak, &models.TokenInfo{
+		AccessToken: *token,
+		TokenType:   "Bearer",
+		ExpiresIn:   util.ExpiresVal,
+	}, clientIp)
+}
+
+// Authenticate the OAuth2 client with its certificate, the client id is optional and must be the ak of the app
+// instance the certificate is mapped to when sent. The error response is written on failure
+func (c *TokenController) authenticateClientCert(clientIp string, cert *x509.Certificate) (clientId string,
+	appInsId string, ok bool) {
+	authInfoRecord, err := readAuthInfoByCert(cert)
+	if err != nil {
+		c.writeOAuth2Error(clientIp, "", http.StatusInternalServerError, util.ErrServerError, serverError, false)
+		return "", "", false
+	}
+	clientId = c.Ctx.Request.PostForm.Get(util.ClientIdParam)
+	if authInfoRecord == nil || (clientId != "" && !isClientIdOf(clientId, authInfoRecord)) {
+		auditSecurityEvent(auditClientAuthFailure, auditFailure, clientIp, "", clientId)
+		c.writeOAuth2Error(clientIp, clientId, http.StatusUnauthorized, util.ErrInvalidClient,
+			"Client certificate authentication failed", false)
+		return "", "", false
+	}
+	if clientId == "" {
+		clientId = authInfoRecord.Ak
+	}
+	c.logReceivedMsgWithAk(clientIp, clientId)
+
+	if c.isRateLimited(akRateLimiter, clientId, auditAkRateLimited, clientIp, clientId) {
+		c.writeOAuth2Error(clientIp, clientId, http.StatusTooManyRequests, util.ErrTemporarilyUnavailable,
+			tooManyRequests, false)
+		return "", "", false
+	}
+	return clientId, authInfoRecord.AppInsId, true
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const (
+	certAppInsId   = "7abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+	certCommonName = "mec-app-1"
+	certDnsName    = "app1.mec.example.com"
+)
+
+func newClientCert(commonName string, dnsName string) *x509.Certificate {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	spiffeId, _ := url.Parse("spiffe://mec.example.com/" + commonName)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{dnsName},
+		URIs:         []*url.URL{spiffeId},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func withClientCert(c *TokenController, cert *x509.Certificate) {
+	c.Ctx.Request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestCertSubjects(t *testing.T) {
+	Convey("cert subjects", t, func() {
+		cert := newClientCert(certCommonName, certDnsName)
+		So(certSubjectsOf(cert), ShouldResemble, []string{"spiffe://mec.example.com/" + certCommonName, certDnsName,
+			certCommonName})
+
+		thumbprint := sha256.Sum256(cert.Raw)
+		So(certThumbprintOf(cert), ShouldEqual, base64.RawURLEncoding.EncodeToString(thumbprint[:]))
+	})
+}
+
+func TestVerifiedClientCert(t *testing.T) {
+	Convey("verified client cert", t, func() {
+		apiGwCert := newClientCert("kong", "kong.mec.example.com")
+		appCert := newClientCert(certCommonName, certDnsName)
+		escapedCert := url.PathEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: appCert.Raw})))
+		request := func(peerCert *x509.Certificate, forwardedCert string) *http.Request {
+			r, _ := http.NewRequest(http.MethodPost, "https://127.0.0.1/mep/token", nil)
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{peerCert}}}
+			if forwardedCert != "" {
+				r.Header.Set(util.ClientCertHeader, forwardedCert)
+			}
+			return r
+		}
+		patches := ApplyFunc(util.IsApiGwClientCert, func(cert *x509.Certificate) bool {
+			return cert.Subject.CommonName == "kong"
+		})
+		defer patches.Reset()
+
+		Convey("of the app connected directly", func() {
+			So(verifiedClientCert(request(appCert, escapedCert)), ShouldEqual, appCert)
+		})
+		Convey("forwarded by the api gateway", func() {
+			verifyPatches := ApplyFunc(util.VerifyClientCert, func(_ *x509.Certificate) error {
+				return nil
+			})
+			defer verifyPatches.Reset()
+			cert := verifiedClientCert(request(apiGwCert, escapedCert))
+			So(cert, ShouldNotBeNil)
+			So(cert.Equal(appCert), ShouldBeTrue)
+			So(verifiedClientCert(request(apiGwCert, "")), ShouldBeNil)
+			So(verifiedClientCert(request(apiGwCert, "garbage")), ShouldBeNil)
+		})
+		Convey("forwarded by the api gateway but not trusted", func() {
+			verifyPatches := ApplyFunc(util.VerifyClientCert, func(_ *x509.Certificate) error {
+				return errors.New("x509: certificate signed by unknown authority")
+			})
+			defer verifyPatches.Reset()
+			So(verifiedClientCert(request(apiGwCert, escapedCert)), ShouldBeNil)
+		})
+	})
+}
+
+func TestValidateCertSubjectOf(t *testing.T) {
+	previousDb := adapter.Db
+	defer func() { adapter.Db = previousDb }()
+
+	Convey("validate cert subject", t, func() {
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		_ = db.InsertData(&models.AuthInfoRecord{AppInsId: certAppInsId, CertSubject: certCommonName})
+		adapter.Db = db
+
+		So(validateCertSubjectOf(certAppInsId, certCommonName), ShouldBeNil)
+		So(validateCertSubjectOf(otherAppInsId, certDnsName), ShouldBeNil)
+		So(validateCertSubjectOf(otherAppInsId, certCommonName), ShouldEqual, errCertSubjectInUse)
+		So(validateCertSubjectOf(otherAppInsId, " leading-space").Error(), ShouldEqual, util.CertSubjectFailMsg)
+	})
+}
+
+func TestTokenWithClientCert(t *testing.T) {
+	akBlockList = newMemoryBlockListStore()
+	previousDb := adapter.Db
+	defer func() { adapter.Db = previousDb }()
+
+	Convey("token with client certificate", t, func() {
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		_ = db.InsertData(&models.AuthInfoRecord{AppInsId: certAppInsId, Ak: oauth2Ak, CertSubject: certDnsName})
+		adapter.Db = db
+		cert := newClientCert(certCommonName, certDnsName)
+		var boundThumbprint string
+		patches := ApplyFunc(generateBoundJwtToken, func(_ string, _ string, certThumbprint string) (*string,
+			error) {
+			boundThumbprint = certThumbprint
+			// The token is cleared after the response, so it must not be a constant
+			token := string([]byte("jwtToken"))
+			return &token, nil
+		})
+		defer patches.Reset()
+
+		Convey("is bound to the certificate without an authorization header", func() {
+			c, _ := getOAuth2Controller(url.Values{}, "", "")
+			c.Ctx.Request.Header.Set(util.ContentType, "application/json")
+			withClientCert(c, cert)
+			c.Post()
+			_, ok := c.Data["json"].(*models.TokenInfo)
+			So(ok, ShouldBeTrue)
+			So(boundThumbprint, ShouldEqual, certThumbprintOf(cert))
+		})
+
+		Convey("is bound to the certificate with tls_client_auth", func() {
+			c, _ := getOAuth2Controller(clientCredentialsForm(oauth2Ak, ""), "", "")
+			withClientCert(c, cert)
+			c.Post()
+			_, ok := c.Data["json"].(*models.TokenInfo)
+			So(ok, ShouldBeTrue)
+			So(boundThumbprint, ShouldEqual, certThumbprintOf(cert))
+		})
+
+		Convey("for the client id of another app", func() {
+			c, recorder := getOAuth2Controller(clientCredentialsForm("QVUJMSUMgS0VZLS0tLS0", ""), "", "")
+			withClientCert(c, cert)
+			c.Post()
+			So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidClient)
+		})
+
+		Convey("for a certificate mapped to no app", func() {
+			c, recorder := getOAuth2Controller(url.Values{}, "", "")
+			c.Ctx.Request.Header.Set(util.ContentType, "application/json")
+			withClientCert(c, newClientCert("unknown-app", "unknown.mec.example.com"))
+			c.Post()
+			So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+			So(boundThumbprint, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestGenerateBoundJwtToken(t *testing.T) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	publicKeyDer, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer}))
+	previousDb := adapter.Db
+	defer func() { adapter.Db = previousDb }()
+
+	Convey("generate bound jwt token", t, func() {
+		adapter.Db = newRevocationDb(certAppInsId)
+		patches := ApplyFunc(util.GetJwtSigningKey, func() (string, *rsa.PrivateKey, error) {
+			// The signing key is cleared after use
+			signingKey := *privateKey
+			signingKey.D = new(big.Int).Set(privateKey.D)
+			return "kid", &signingKey, nil
+		})
+		patches.ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+			return []util.JwtKeyInfo{{Kid: "kid", PublicKey: publicKeyPem}}, nil
+		})
+		patches.ApplyFunc(util.GetAppConfig, func(_ string) string {
+			return "mepauth"
+		})
+		defer patches.Reset()
+
+		token, err := generateBoundJwtToken(certAppInsId, "127.0.0.1", "thumbprint")
+		So(err, ShouldBeNil)
+		claims, err := parseIssuedToken(*token)
+		So(err, ShouldBeNil)
+		So(claims.Cnf, ShouldNotBeNil)
+		So(claims.Cnf.X5tS256, ShouldEqual, "thumbprint")
+
+		token, err = generateJwtToken(certAppInsId, "127.0.0.1")
+		So(err, ShouldBeNil)
+		claims, err = parseIssuedToken(*token)
+		So(err, ShouldBeNil)
+		So(claims.Cnf, ShouldBeNil)
+	})
+}
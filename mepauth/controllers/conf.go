@@ -24,12 +24,20 @@ import (
 	log "github.com/sirupsen/logrus"
 	"mepauth/adapter"
 	"net/http"
+	"strings"
 
 	"mepauth/models"
 	"mepauth/util"
 )
 
-const appInstanceID string = "app_ins_id"
+const (
+	appInstanceID          string = "app_ins_id"
+	skColumn                      = "sk"
+	nonceColumn                   = "nonce"
+	appNameColumn                 = "app_name"
+	requiredServicesColumn        = "required_services"
+	scopeColumn                   = "scope"
+)
 
 // ConfController configuration controller
 type ConfController struct {
@@ -56,6 +64,11 @@ func (c *ConfController) Put() {
 	var appInstanceInfo *models.AppInstanceInfo
 	// Get application instance ID from param
 	appInsId := c.Ctx.Input.Param(util.UrlApplicationId)
+	// Tells the audit event of a created configuration from an updated one
+	auditEvent := auditConfCreated
+	if util.ValidateUUID(appInsId) == nil && isAuthInfoConfigured(appInsId) {
+		auditEvent = auditConfUpdated
+	}
 
 	if err = json.Unmarshal(c.Ctx.Input.RequestBody, &appInstanceInfo); err == nil {
 		c.Data["json"] = appInstanceInfo
@@ -78,23 +91,35 @@ func (c *ConfController) Put() {
 		if reqServices != nil {
 			strReqServices = string(reqServices)
 		}
-		err = ConfigureAkAndSk(appInsId, ak, &skByte, appName, strReqServices)
+		err = ConfigureAkAndSk(appInsId, ak, &skByte, appName, strReqServices, appAuthInfo.CertSubject,
+			appAuthInfo.Scope)
 		if err != nil {
 			switch err.Error() {
 			case util.AppIDFailMsg:
-				c.handleLoggingForError(clientIp, http.StatusBadRequest, "Invalid input for application instance ID")
+				c.handleConfFailure(auditEvent, clientIp, appInsId, ak, http.StatusBadRequest,
+					"Invalid input for application instance ID")
+				return
+			case util.AkFailMsg, util.SkFailMsg:
+				c.handleConfFailure(auditEvent, clientIp, appInsId, ak, http.StatusBadRequest,
+					"Invalid input for ak or sk")
+				return
+			case util.CertSubjectFailMsg, errCertSubjectInUse.Error():
+				c.handleConfFailure(auditEvent, clientIp, appInsId, ak, http.StatusBadRequest,
+					"Invalid input for certificate subject")
 				return
-			case util.AkFailMsg:
-			case util.SkFailMsg:
-				c.handleLoggingForError(clientIp, http.StatusBadRequest, "Invalid input for ak or sk")
+			case util.ScopeFailMsg:
+				c.handleConfFailure(auditEvent, clientIp, appInsId, ak, http.StatusBadRequest,
+					"Invalid input for scope")
 				return
 			default:
-				c.handleLoggingForError(clientIp, http.StatusInternalServerError, "Error while saving configuration")
+				c.handleConfFailure(auditEvent, clientIp, appInsId, ak, http.StatusInternalServerError,
+					"Error while saving configuration")
 				return
 			}
 		}
+		auditSecurityEvent(auditEvent, auditSuccess, clientIp, appInsId, ak)
 	} else {
-		c.handleLoggingForError(clientIp, http.StatusBadRequest, err.Error())
+		c.handleConfFailure(auditEvent, clientIp, appInsId, "", http.StatusBadRequest, err.Error())
 		return
 	}
 	c.handleLoggingForSuccess(clientIp, "")
@@ -120,7 +145,15 @@ func (c *ConfController) Delete() {
 
 	appInsId := c.Ctx.Input.Param(util.UrlApplicationId)
 	if validateErr := util.ValidateUUID(appInsId); validateErr != nil {
-		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.AppIDFailMsg)
+		c.handleConfFailure(auditConfDeleted, clientIp, appInsId, "", http.StatusBadRequest, util.AppIDFailMsg)
+		return
+	}
+
+	// The tokens are revoked first, the configuration stays for a retry if the revocation fails
+	err = revokeAppInstanceTokens(appInsId)
+	if err != nil {
+		c.handleConfFailure(auditConfDeleted, clientIp, appInsId, "", http.StatusInternalServerError,
+			"Failed to revoke tokens")
 		return
 	}
 
@@ -130,9 +163,10 @@ func (c *ConfController) Delete() {
 
 	err = adapter.Db.DeleteData(authInfoRecord, appInstanceID)
 	if err != nil {
-		c.handleLoggingForError(clientIp, http.StatusBadRequest, err.Error())
+		c.handleConfFailure(auditConfDeleted, clientIp, appInsId, "", http.StatusBadRequest, err.Error())
 		return
 	}
+	auditSecurityEvent(auditConfDeleted, auditSuccess, clientIp, appInsId, "")
 	c.Data["json"] = "Delete success."
 	c.handleLoggingForSuccess(clientIp, "Delete success.")
 }
@@ -173,14 +207,34 @@ func (c *ConfController) Get() {
 	if len(authInfoRecord.RequiredServices) == 0 {
 		authInfoRecord.RequiredServices = "[]"
 	}
+	hideExpiredPrevAk(authInfoRecord)
 	c.Data["json"] = authInfoRecord
 	c.ServeJSON()
 	log.Info("Response message for ClientIP [" + clientIp + operation + c.Ctx.Request.Method + "]" +
 		resource + c.Ctx.Input.URL() + "] Result [Success]")
 }
 
-// ConfigureAkAndSk save Ak and Sk configuration into file
-func ConfigureAkAndSk(appInsID string, ak string, sk *[]byte, appName string, requiredServices string) error {
+// Audit the failed configuration change along with the error response
+func (c *ConfController) handleConfFailure(auditEvent string, clientIp string, appInsId string, ak string, code int,
+	errMsg string) {
+	auditSecurityEvent(auditEvent, auditFailure, clientIp, appInsId, ak)
+	c.handleLoggingForError(clientIp, code, errMsg)
+}
+
+// Check whether the app instance has its auth info configured
+func isAuthInfoConfigured(appInsId string) bool {
+	authInfoRecord := &models.AuthInfoRecord{
+		AppInsId: appInsId,
+	}
+	err := adapter.Db.ReadData(authInfoRecord, appInstanceID)
+	return err == nil || err.Error() == util.PgOkMsg
+}
+
+// ConfigureAkAndSk save Ak and Sk configuration into file, the app instance may also authenticate with the client
+// certificate of the subject when it is not empty. The stored subject and scope are kept when nil and cleared when
+// empty, an app instance without scope is granted no mp1 operation
+func ConfigureAkAndSk(appInsID string, ak string, sk *[]byte, appName string, requiredServices string,
+	certSubject *string, scope *string) error {
 
 	log.Infof("AK/SK configuration is received, the corresponding app is " + appInsID)
 
@@ -200,7 +254,21 @@ func ConfigureAkAndSk(appInsID string, ak string, sk *[]byte, appName string, re
 		return validateSkErr
 	}
 
-	saveAkAndSkErr := saveAkAndSk(appInsID, ak, sk, appName, requiredServices)
+	if certSubject != nil && *certSubject != "" {
+		if validateCertErr := validateCertSubjectOf(appInsID, *certSubject); validateCertErr != nil {
+			log.Error("Certificate subject " + *certSubject + " is invalid, appInstanceId is " + appInsID + ".")
+			return validateCertErr
+		}
+	}
+
+	if scope != nil {
+		if validateScopeErr := util.ValidateScope(*scope); validateScopeErr != nil {
+			log.Error("Scope is invalid, appInstanceId is " + appInsID + ".")
+			return validateScopeErr
+		}
+	}
+
+	saveAkAndSkErr := saveAkAndSk(appInsID, ak, sk, appName, requiredServices, certSubject, scope)
 	if saveAkAndSkErr != nil {
 		log.Error("Failed to save ak and sk to database, appInstanceId is " + appInsID + ".")
 		return saveAkAndSkErr
@@ -209,7 +277,8 @@ func ConfigureAkAndSk(appInsID string, ak string, sk *[]byte, appName string, re
 	return nil
 }
 
-func saveAkAndSk(appInsID string, ak string, sk *[]byte, appName string, requiredServices string) error {
+func saveAkAndSk(appInsID string, ak string, sk *[]byte, appName string, requiredServices string,
+	certSubject *string, scope *string) error {
 	cipherSkBytes, nonceBytes, err := getCipherAndNonce(sk)
 	if err != nil {
 		return err
@@ -222,7 +291,20 @@ func saveAkAndSk(appInsID string, ak string, sk *[]byte, appName string, require
 		AppName:          appName,
 		RequiredServices: requiredServices,
 	}
-	err = adapter.Db.InsertOrUpdateData(authInfoRecord, appInstanceID)
+	// The configured columns are updated, the previous pair of the last rotation stays valid till it expires
+	cols := []string{akColumn, skColumn, nonceColumn, appNameColumn, requiredServicesColumn}
+	if certSubject != nil {
+		authInfoRecord.CertSubject = *certSubject
+		cols = append(cols, certSubjectColumn)
+	}
+	if scope != nil {
+		authInfoRecord.Scope = strings.Join(strings.Fields(*scope), " ")
+		cols = append(cols, scopeColumn)
+	}
+	updated, err := adapter.Db.UpdateDataIf(authInfoRecord, nil, cols...)
+	if err == nil && !updated {
+		err = adapter.Db.InsertData(authInfoRecord)
+	}
 	util.ClearByteArray(nonceBytes)
 	if err != nil && err.Error() != util.PgOkMsg {
 		log.Error("Failed to save ak and sk to Datebase.")
@@ -84,31 +84,34 @@ func TestConfigureAkAndSk(t *testing.T) {
 	requiredServices := ""
 	Convey("configure ak and sk", t, func() {
 		Convey("for success", func() {
-			patches := ApplyFunc(saveAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string) error {
+			patches := ApplyFunc(saveAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string, _ *string, _ *string) error {
 				return nil
 			})
 			defer patches.Reset()
-			err := ConfigureAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := ConfigureAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 			So(err, ShouldBeNil)
 		})
 		Convey("for fail", func() {
-			patches := ApplyFunc(saveAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string) error {
+			patches := ApplyFunc(saveAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string, _ *string, _ *string) error {
 				return errors.New("error")
 			})
 			defer patches.Reset()
-			err := ConfigureAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := ConfigureAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 			So(err, ShouldNotBeNil)
 		})
 		Convey("invalid ak and sk", func() {
-			patches := ApplyFunc(saveAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string) error {
+			patches := ApplyFunc(saveAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string, _ *string, _ *string) error {
 				return nil
 			})
 			defer patches.Reset()
-			err := ConfigureAkAndSk(inValidAppInsID, validAk, &validSk, appName, requiredServices)
+			err := ConfigureAkAndSk(inValidAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 			So(err, ShouldNotBeNil)
-			err = ConfigureAkAndSk(validAppInsID, inValidAk, &validSk, appName, requiredServices)
+			err = ConfigureAkAndSk(validAppInsID, inValidAk, &validSk, appName, requiredServices, nil, nil)
 			So(err, ShouldNotBeNil)
-			err = ConfigureAkAndSk(validAppInsID, validAk, &inValidSk, appName, requiredServices)
+			err = ConfigureAkAndSk(validAppInsID, validAk, &inValidSk, appName, requiredServices, nil, nil)
+			So(err, ShouldNotBeNil)
+			invalidScope := "services:read all"
+			err = ConfigureAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, &invalidScope)
 			So(err, ShouldNotBeNil)
 		})
 	})
@@ -130,15 +133,91 @@ func TestSaveAkAndSk(t *testing.T) {
 			})
 
 			var pgdb *adapter.PgDb
-			patch2 := ApplyMethod(reflect.TypeOf(pgdb), "InsertOrUpdateData", func(*adapter.PgDb, interface{}, ...string) error {
-				return nil
+			patch2 := ApplyMethod(reflect.TypeOf(pgdb), "UpdateDataIf", func(*adapter.PgDb, interface{},
+				map[string]interface{}, ...string) (bool, error) {
+				return true, nil
 			})
 
 			defer patch1.Reset()
 			defer patch2.Reset()
-			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 			So(err, ShouldBeNil)
 		})
+		Convey("keeps the previous pair", func() {
+			patches := ApplyFunc(util.GetWorkKey, func() ([]byte, error) {
+				return []byte("00000000000000000000000000000000"), nil
+			})
+			defer patches.Reset()
+			db := &adapter.MemoryDb{}
+			_ = db.InitDatabase()
+			adapter.Db = db
+			defer func() { adapter.Db = &adapter.PgDb{} }()
+			_ = db.InsertData(&models.AuthInfoRecord{AppInsId: validAppInsID, Ak: "previousAk", PrevAk: "prevAk",
+				PrevSk: "prevSk", PrevNonce: "prevNonce", PrevExpiresAt: 100})
+
+			sk := []byte("oooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo")
+			err := saveAkAndSk(validAppInsID, validAk, &sk, appName, requiredServices, nil, nil)
+			So(err, ShouldBeNil)
+			record := &models.AuthInfoRecord{AppInsId: validAppInsID}
+			So(db.ReadData(record, appInstanceID), ShouldBeNil)
+			So(record.Ak, ShouldEqual, validAk)
+			So(record.AppName, ShouldEqual, appName)
+			So(record.PrevAk, ShouldEqual, "prevAk")
+			So(record.PrevSk, ShouldEqual, "prevSk")
+			So(record.PrevExpiresAt, ShouldEqual, 100)
+		})
+		Convey("keeps the cert subject unless sent", func() {
+			patches := ApplyFunc(util.GetWorkKey, func() ([]byte, error) {
+				return []byte("00000000000000000000000000000000"), nil
+			})
+			defer patches.Reset()
+			db := &adapter.MemoryDb{}
+			_ = db.InitDatabase()
+			adapter.Db = db
+			defer func() { adapter.Db = &adapter.PgDb{} }()
+			_ = db.InsertData(&models.AuthInfoRecord{AppInsId: validAppInsID, Ak: "previousAk", CertSubject: "mec-app"})
+
+			sk := []byte("oooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo")
+			So(saveAkAndSk(validAppInsID, validAk, &sk, appName, requiredServices, nil, nil), ShouldBeNil)
+			record := &models.AuthInfoRecord{AppInsId: validAppInsID}
+			So(db.ReadData(record, appInstanceID), ShouldBeNil)
+			So(record.Ak, ShouldEqual, validAk)
+			So(record.CertSubject, ShouldEqual, "mec-app")
+
+			cleared := ""
+			sk = []byte("oooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo")
+			So(saveAkAndSk(validAppInsID, validAk, &sk, appName, requiredServices, &cleared, nil), ShouldBeNil)
+			So(db.ReadData(record, appInstanceID), ShouldBeNil)
+			So(record.CertSubject, ShouldBeEmpty)
+		})
+		Convey("keeps the scope unless sent", func() {
+			patches := ApplyFunc(util.GetWorkKey, func() ([]byte, error) {
+				return []byte("00000000000000000000000000000000"), nil
+			})
+			defer patches.Reset()
+			db := &adapter.MemoryDb{}
+			_ = db.InitDatabase()
+			adapter.Db = db
+			defer func() { adapter.Db = &adapter.PgDb{} }()
+
+			scope := " services:read  timing:read "
+			sk := []byte("oooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo")
+			So(saveAkAndSk(validAppInsID, validAk, &sk, appName, requiredServices, nil, &scope), ShouldBeNil)
+			record := &models.AuthInfoRecord{AppInsId: validAppInsID}
+			So(db.ReadData(record, appInstanceID), ShouldBeNil)
+			So(record.Scope, ShouldEqual, "services:read timing:read")
+
+			sk = []byte("oooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo")
+			So(saveAkAndSk(validAppInsID, validAk, &sk, appName, requiredServices, nil, nil), ShouldBeNil)
+			So(db.ReadData(record, appInstanceID), ShouldBeNil)
+			So(record.Scope, ShouldEqual, "services:read timing:read")
+
+			cleared := ""
+			sk = []byte("oooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooooo")
+			So(saveAkAndSk(validAppInsID, validAk, &sk, appName, requiredServices, nil, &cleared), ShouldBeNil)
+			So(db.ReadData(record, appInstanceID), ShouldBeNil)
+			So(record.Scope, ShouldBeEmpty)
+		})
 		Convey("read fail", func() {
 			patches := ApplyFunc(util.GetWorkKey, func() ([]byte, error) {
 				return validKey, nil
@@ -147,7 +226,7 @@ func TestSaveAkAndSk(t *testing.T) {
 			patches.ApplyFunc(rand.Read, func(_ []byte) (n int, err error) {
 				return 1, errors.New("read fail")
 			})
-			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 
 			So(err.Error(), ShouldEqual, "read fail")
 		})
@@ -156,7 +235,7 @@ func TestSaveAkAndSk(t *testing.T) {
 				return nil, errors.New("get work key fail")
 			})
 			defer patches.Reset()
-			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 
 			So(err.Error(), ShouldEqual, "get work key fail")
 		})
@@ -168,7 +247,7 @@ func TestSaveAkAndSk(t *testing.T) {
 				return nil, errors.New("encrypt fail")
 			})
 			defer patches.Reset()
-			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 
 			So(err.Error(), ShouldEqual, "encrypt fail")
 		})
@@ -177,14 +256,18 @@ func TestSaveAkAndSk(t *testing.T) {
 				return validKey, nil
 			})
 			var pgdb *adapter.PgDb
-			patch2 := ApplyMethod(reflect.TypeOf(pgdb), "InsertOrUpdateData", func(*adapter.PgDb, interface{}, ...string) error {
+			patch2 := ApplyMethod(reflect.TypeOf(pgdb), "UpdateDataIf", func(*adapter.PgDb, interface{},
+				map[string]interface{}, ...string) (bool, error) {
+				return false, nil
+			})
+			patch2.ApplyMethod(reflect.TypeOf(pgdb), "InsertData", func(*adapter.PgDb, interface{}) error {
 				return errors.New("insert fail")
 			})
 
 			defer patch1.Reset()
 			defer patch2.Reset()
 
-			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices)
+			err := saveAkAndSk(validAppInsID, validAk, &validSk, appName, requiredServices, nil, nil)
 
 			So(err.Error(), ShouldEqual, "insert fail")
 		})
@@ -226,7 +309,7 @@ func TestPutSuccess(t *testing.T) {
 		bytes, _ := json.Marshal(appInstanceInfo)
 		c.Ctx.Input.RequestBody = bytes
 
-		patches := ApplyFunc(ConfigureAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string) error {
+		patches := ApplyFunc(ConfigureAkAndSk, func(_ string, _ string, _ *[]byte, _ string, _ string, _ *string, _ *string) error {
 			return nil
 		})
 		patches.Reset()
@@ -259,19 +342,37 @@ func TestDeleteSuccess(t *testing.T) {
 		appInstanceInfo := &models.AppInstanceInfo{}
 		appInstanceInfo.AuthInfo = authInfo
 
-		adapter.Db = &adapter.PgDb{}
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		_ = db.InsertData(&models.AuthInfoRecord{AppInsId: validAppInsID})
+		adapter.Db = db
 
 		bytes, _ := json.Marshal(appInstanceInfo)
 		c.Ctx.Input.RequestBody = bytes
 		c.Ctx.Input.SetParam(util.UrlApplicationId, validAppInsID)
+		c.Delete()
+		out := c.Data["json"]
+		So(out, ShouldEqual, "Delete success.")
+		So(db.ReadData(&models.AuthInfoRecord{AppInsId: validAppInsID}, appInstanceID), ShouldNotBeNil)
+		So(db.ReadData(&models.AppTokenRevocationRecord{AppInsId: validAppInsID}, appInstanceID), ShouldBeNil)
+	})
+	Convey("Test delete with token revocation failure", t, func() {
+		c := getConfController()
+		adapter.Db = &adapter.PgDb{}
+		c.Ctx.Input.SetParam(util.UrlApplicationId, "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f")
 		var pgdb *adapter.PgDb
+		deleted := false
 		patches := ApplyMethod(reflect.TypeOf(pgdb), "DeleteData", func(*adapter.PgDb, interface{}, ...string) error {
+			deleted = true
 			return nil
 		})
+		patches.ApplyMethod(reflect.TypeOf(pgdb), "ReadData", func(*adapter.PgDb, interface{}, ...string) error {
+			return errors.New("db error")
+		})
 		defer patches.Reset()
 		c.Delete()
-		out := c.Data["json"]
-		So(out, ShouldEqual, "Delete success.")
+		So(c.Data["json"], ShouldContainSubstring, "Failed to revoke tokens")
+		So(deleted, ShouldBeFalse)
 	})
 }
 
@@ -308,19 +409,19 @@ func TestGetSuccess(t *testing.T) {
 		appInstanceInfo := &models.AppInstanceInfo{}
 		appInstanceInfo.AuthInfo = authInfo
 
-		adapter.Db = &adapter.PgDb{}
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		_ = db.InsertData(&models.AuthInfoRecord{AppInsId: validAppInsID, Ak: "AK"})
+		adapter.Db = db
 
 		bytes, _ := json.Marshal(appInstanceInfo)
 		c.Ctx.Input.RequestBody = bytes
 		c.Ctx.Input.SetParam(util.UrlApplicationId, validAppInsID)
-		var pgdb *adapter.PgDb
-		patches := ApplyMethod(reflect.TypeOf(pgdb), "ReadData", func(*adapter.PgDb, interface{}, ...string) error {
-			return nil
-		})
-		defer patches.Reset()
 		c.Get()
-		out := c.Data["json"]
-		So(out, ShouldNotBeNil)
+		out, ok := c.Data["json"].(*models.AuthInfoRecord)
+		So(ok, ShouldBeTrue)
+		So(out.Ak, ShouldEqual, "AK")
+		So(out.RequiredServices, ShouldEqual, "[]")
 	})
 }
 
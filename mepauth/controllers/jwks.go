@@ -0,0 +1,97 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/models"
+	"mepauth/util"
+)
+
+// JwksController jwt signing key controller
+type JwksController struct {
+	BaseController
+}
+
+// @Title Get jwt verification keys
+// @Description public keys to verify the tokens with, in the JWK set format of RFC 7517
+// @Success 200 ok
+// @Failure 500 internal server error
+// @router /token/jwks [get]
+func (c *JwksController) Get() {
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return
+	}
+	c.logReceivedMsg(clientIp)
+
+	jwtKeys, err := util.GetJwtKeys()
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusInternalServerError, "Failed to get jwt keys")
+		return
+	}
+	jwkSet := &models.JwkSet{Keys: make([]models.Jwk, 0, len(jwtKeys))}
+	for _, jwtKey := range jwtKeys {
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(jwtKey.PublicKey))
+		if err != nil {
+			log.Error("Failed to parse jwt public key " + jwtKey.Kid)
+			continue
+		}
+		jwkSet.Keys = append(jwkSet.Keys, models.Jwk{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: jwt.SigningMethodRS512.Alg(),
+			Kid: jwtKey.Kid,
+			N:   util.JwkModulus(publicKey),
+			E:   util.JwkExponent(publicKey),
+		})
+	}
+	c.Data["json"] = jwkSet
+	c.handleLoggingForSuccess(clientIp, "")
+}
+
+// @Title Rotate jwt signing key
+// @Description rotation of the jwt signing key, the previous key stays valid till its tokens expire
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 500 internal server error
+// @router /appMng/v1/jwks/rotate [post]
+func (c *JwksController) Rotate() {
+	log.Info("Jwt signing key rotation request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return
+	}
+	c.logReceivedMsg(clientIp)
+
+	jwtKey, err := util.RotateJwtKey()
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusInternalServerError, "Failed to rotate jwt signing key")
+		return
+	}
+	c.Data["json"] = &models.JwtKeyRotation{Kid: jwtKey.Kid}
+	c.handleLoggingForSuccess(clientIp, "Jwt signing key rotated to "+jwtKey.Kid)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/models"
+	"mepauth/util"
+)
+
+func getJwksController() *JwksController {
+	c := &JwksController{}
+	tokenController := getController()
+	c.Init(tokenController.Ctx, "", "", nil)
+	return c
+}
+
+func TestJwksGet(t *testing.T) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	publicKeyDer, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer}))
+	kid := util.JwtKeyId(&privateKey.PublicKey)
+
+	Convey("get jwks", t, func() {
+		Convey("for success", func() {
+			patches := ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+				return []util.JwtKeyInfo{{Kid: kid, PublicKey: publicKeyPem}, {Kid: "invalid", PublicKey: "invalid"}}, nil
+			})
+			defer patches.Reset()
+			c := getJwksController()
+			c.Get()
+			out, ok := c.Data["json"].(*models.JwkSet)
+			So(ok, ShouldBeTrue)
+			So(len(out.Keys), ShouldEqual, 1)
+			So(out.Keys[0].Kid, ShouldEqual, kid)
+			So(out.Keys[0].Alg, ShouldEqual, "RS512")
+			So(out.Keys[0].E, ShouldEqual, "AQAB")
+		})
+		Convey("for fail", func() {
+			patches := ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+				return nil, errors.New("get jwt keys fail")
+			})
+			defer patches.Reset()
+			c := getJwksController()
+			c.Get()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
+
+func TestJwksRotate(t *testing.T) {
+	Convey("rotate jwt signing key", t, func() {
+		Convey("for success", func() {
+			patches := ApplyFunc(util.RotateJwtKey, func() (*util.JwtKeyInfo, error) {
+				return &util.JwtKeyInfo{Kid: "kid"}, nil
+			})
+			defer patches.Reset()
+			c := getJwksController()
+			c.Rotate()
+			out, ok := c.Data["json"].(*models.JwtKeyRotation)
+			So(ok, ShouldBeTrue)
+			So(out.Kid, ShouldEqual, "kid")
+		})
+		Convey("for fail", func() {
+			patches := ApplyFunc(util.RotateJwtKey, func() (*util.JwtKeyInfo, error) {
+				return nil, errors.New("rotate fail")
+			})
+			defer patches.Reset()
+			c := getJwksController()
+			c.Rotate()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/astaxie/beego/orm"
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const (
+	jwtKeyRingId     = "jwt"
+	idColumn         = "id"
+	kidColumn        = "kid"
+	keysColumn       = "keys"
+	keyVersionColumn = "version"
+)
+
+// InitJwtKeyStore shares the jwt key ring of the mepauth instances through the database
+func InitJwtKeyStore() {
+	util.SetJwtKeyStore(&dbJwtKeyStore{})
+}
+
+// dbJwtKeyStore keeps the jwt key ring in the database, its version guards the concurrent rotations
+type dbJwtKeyStore struct{}
+
+func (s *dbJwtKeyStore) LoadJwtKeyRing() ([]util.JwtKeyInfo, int64, error) {
+	record := &models.JwtKeyRingRecord{Id: jwtKeyRingId}
+	err := adapter.Db.ReadData(record, idColumn)
+	if err == orm.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var keys []util.JwtKeyInfo
+	if err = json.Unmarshal([]byte(record.Keys), &keys); err != nil {
+		// Replaced by a fresh ring on the next save
+		log.Error("Failed to parse jwt key ring")
+		return nil, record.Version, nil
+	}
+	return keys, record.Version, nil
+}
+
+func (s *dbJwtKeyStore) SaveJwtKeyRing(keys []util.JwtKeyInfo, version int64) (bool, error) {
+	keysBytes, err := json.Marshal(keys)
+	if err != nil {
+		return false, err
+	}
+	record := &models.JwtKeyRingRecord{Id: jwtKeyRingId, Keys: string(keysBytes), Version: version + 1}
+	if version != 0 {
+		return adapter.Db.UpdateDataIf(record, map[string]interface{}{keyVersionColumn: version}, keysColumn,
+			keyVersionColumn)
+	}
+	err = adapter.Db.InsertData(record)
+	if err == nil || err.Error() == util.PgOkMsg {
+		return true, nil
+	}
+	// Created by another instance meanwhile
+	if readErr := adapter.Db.ReadData(&models.JwtKeyRingRecord{Id: jwtKeyRingId}, idColumn); readErr == nil {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s *dbJwtKeyStore) SaveJwtKey(kid string, encryptedKey []byte, nonce []byte) error {
+	record := &models.JwtKeyRecord{
+		Kid:        kid,
+		PrivateKey: base64.StdEncoding.EncodeToString(encryptedKey),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+	}
+	err := adapter.Db.InsertOrUpdateData(record, kidColumn)
+	if err != nil && err.Error() != util.PgOkMsg {
+		return err
+	}
+	return nil
+}
+
+func (s *dbJwtKeyStore) ReadJwtKey(kid string) ([]byte, []byte, error) {
+	record := &models.JwtKeyRecord{Kid: kid}
+	if err := adapter.Db.ReadData(record, kidColumn); err != nil {
+		return nil, nil, err
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(record.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(record.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encryptedKey, nonce, nil
+}
+
+func (s *dbJwtKeyStore) RemoveJwtKey(kid string) error {
+	return adapter.Db.DeleteData(&models.JwtKeyRecord{Kid: kid}, kidColumn)
+}
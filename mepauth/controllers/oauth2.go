@@ -0,0 +1,224 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"crypto/subtle"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const (
+	cacheControl = "Cache-Control"
+	pragma       = "Pragma"
+	wwwAuth      = "WWW-Authenticate"
+	basicRealm   = `Basic realm="mepauth"`
+	serverError  = "Internal server error"
+)
+
+// Check whether the token request follows the OAuth2 token request format instead of the AK/SK signature
+func isOAuth2TokenRequest(r *http.Request) bool {
+	if hasBasicAuthHeader(r) {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(util.ContentType))
+	return err == nil && mediaType == util.FormUrlEncoded
+}
+
+func hasBasicAuthHeader(r *http.Request) bool {
+	header := r.Header.Get(authorization)
+	return len(header) > len(util.BasicAuthScheme) &&
+		strings.EqualFold(header[:len(util.BasicAuthScheme)+1], util.BasicAuthScheme+" ")
+}
+
+// Client id and secret are form encoded before the basic encoding as per RFC 6749 section 2.3.1, the clients which
+// do not encode them are also accepted as the ak and sk never carry a '%'
+func decodeClientCredential(value string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	decoded, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// Read the client credentials either from the basic authorization header or from the request body, a client must
+// use only one of them
+func getClientCredentials(r *http.Request) (clientId string, clientSecret string, isBasic bool, errCode string) {
+	postId, postSecret := r.PostForm.Get(util.ClientIdParam), r.PostForm.Get(util.ClientSecretParam)
+	if hasBasicAuthHeader(r) {
+		if postSecret != "" {
+			return "", "", true, util.ErrInvalidRequest
+		}
+		basicId, basicSecret, ok := r.BasicAuth()
+		if !ok {
+			return "", "", true, util.ErrInvalidClient
+		}
+		clientId, clientSecret = decodeClientCredential(basicId), decodeClientCredential(basicSecret)
+		// client_id may still be sent in the body, it must be the same client then
+		if postId != "" && postId != clientId {
+			return "", "", true, util.ErrInvalidRequest
+		}
+		return clientId, clientSecret, true, ""
+	}
+	if postId == "" || postSecret == "" {
+		return "", "", false, util.ErrInvalidClient
+	}
+	return postId, postSecret, false, ""
+}
+
+// Handle the client credentials grant of RFC 6749 section 4.4, the ak and sk of the app are the client id and secret
+func (c *TokenController) handleClientCredentials(clientIp string) {
+	c.logReceivedMsg(clientIp)
+	r := c.Ctx.Request
+	if err := r.ParseForm(); err != nil {
+		c.writeOAuth2Error(clientIp, "", http.StatusBadRequest, util.ErrInvalidRequest, "Malformed request body",
+			false)
+		return
+	}
+	grantType := r.PostForm.Get(util.GrantTypeParam)
+	if grantType == "" {
+		c.writeOAuth2Error(clientIp, "", http.StatusBadRequest, util.ErrInvalidRequest, "Missing grant_type",
+			false)
+		return
+	}
+	if grantType != util.GrantTypeClientCredential {
+		c.writeOAuth2Error(clientIp, "", http.StatusBadRequest, util.ErrUnsupportedGrantType,
+			"Only client_credentials grant is supported", false)
+		return
+	}
+
+	var clientId, appInsId, certThumbprint string
+	var isBasic, ok bool
+	// The token of the client authenticated with its certificate is bound to the certificate
+	if cert := verifiedClientCert(r); cert != nil && isTlsClientAuth(r) {
+		clientId, appInsId, ok = c.authenticateClientCert(clientIp, cert)
+		certThumbprint = certThumbprintOf(cert)
+	} else {
+		clientId, appInsId, isBasic, ok = c.authenticateClient(clientIp)
+	}
+	if !ok {
+		return
+	}
+
+	token, err := generateBoundJwtToken(appInsId, clientIp, certThumbprint)
+	if err != nil {
+		c.writeOAuth2Error(clientIp, clientId, http.StatusInternalServerError, util.ErrServerError, serverError,
+			isBasic)
+		return
+	}
+	log.Info("Client credentials grant accepted for App Instance Id " + appInsId + ", ClientAK " + clientId)
+	c.setNoCacheHeaders()
+	c.sendResponseMsg(appInsId, clientId, &models.TokenInfo{
+		AccessToken: *token,
+		TokenType:   "Bearer",
+		ExpiresIn:   util.ExpiresVal,
+	}, clientIp)
+}
+
+// Authenticate the client with its ak and sk, the error response is written on failure
+func (c *TokenController) authenticateClient(clientIp string) (clientId string, appInsId string, isBasic bool,
+	ok bool) {
+	clientId, clientSecret, isBasic, errCode := getClientCredentials(c.Ctx.Request)
+	if errCode == util.ErrInvalidRequest {
+		c.writeOAuth2Error(clientIp, "", http.StatusBadRequest, errCode,
+			"More than one client authentication method is used", isBasic)
+		return "", "", isBasic, false
+	}
+	if errCode != "" || util.ValidateAk(clientId) != nil {
+		c.writeOAuth2Error(clientIp, "", http.StatusUnauthorized, util.ErrInvalidClient,
+			"Client authentication failed", isBasic)
+		return "", "", isBasic, false
+	}
+	c.logReceivedMsgWithAk(clientIp, clientId)
+
+	if c.isRateLimited(akRateLimiter, clientId, auditAkRateLimited, clientIp, clientId) {
+		c.writeOAuth2Error(clientIp, clientId, http.StatusTooManyRequests, util.ErrTemporarilyUnavailable,
+			tooManyRequests, isBasic)
+		return "", "", isBasic, false
+	}
+
+	blocked, err := isAkInBlockList(clientId)
+	if err != nil {
+		c.writeOAuth2Error(clientIp, clientId, http.StatusServiceUnavailable, util.ErrTemporarilyUnavailable,
+			"Block listing is not available", isBasic)
+		return "", "", isBasic, false
+	}
+	if blocked {
+		c.writeOAuth2Error(clientIp, clientId, http.StatusUnauthorized, util.ErrInvalidClient, "Access is locked",
+			isBasic)
+		return "", "", isBasic, false
+	}
+
+	appInsId, sk, akExist := getAppInsIdSk(clientId)
+	if appInsId == "" || len(sk) == 0 {
+		if akExist {
+			c.writeOAuth2Error(clientIp, clientId, http.StatusInternalServerError, util.ErrServerError,
+				serverError, isBasic)
+		} else {
+			c.writeOAuth2Error(clientIp, clientId, http.StatusUnauthorized, util.ErrInvalidClient,
+				"Client authentication failed", isBasic)
+		}
+		return "", "", isBasic, false
+	}
+	isSecretValid := subtle.ConstantTimeCompare(sk, []byte(clientSecret)) == 1
+	// clear sk
+	util.ClearByteArray(sk)
+	if !isSecretValid {
+		auditSecurityEvent(auditClientAuthFailure, auditFailure, clientIp, appInsId, clientId)
+		processAkForBlockListing(clientId, clientIp)
+		c.writeOAuth2Error(clientIp, clientId, http.StatusUnauthorized, util.ErrInvalidClient,
+			"Client authentication failed", isBasic)
+		return "", "", isBasic, false
+	}
+	clearAkFromBlockListing(clientId)
+	return clientId, appInsId, isBasic, true
+}
+
+// Responses carrying tokens or credentials must not be cached as per RFC 6749 section 5.1
+func (c *BaseController) setNoCacheHeaders() {
+	c.Ctx.Output.Header(cacheControl, "no-store")
+	c.Ctx.Output.Header(pragma, "no-cache")
+}
+
+// Write the error response in the format of RFC 6749 section 5.2
+func (c *TokenController) writeOAuth2Error(clientIp string, ak string, code int, errCode string, errMsg string,
+	isBasic bool) {
+	log.Error(errMsg)
+	c.setNoCacheHeaders()
+	if code == http.StatusUnauthorized && isBasic {
+		c.Ctx.Output.Header(wwwAuth, basicRealm)
+	}
+	c.Data["json"] = &models.OAuth2Error{Error: errCode, ErrorDescription: errMsg}
+	c.Ctx.ResponseWriter.WriteHeader(code)
+	c.ServeJSON()
+	if ak == "" {
+		c.logErrResponseMsg(clientIp, errMsg)
+	} else {
+		c.logErrResponseMsgWithAk(clientIp, errMsg, ak)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey"
+	"github.com/astaxie/beego/context"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const (
+	oauth2AppInsId = "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+	oauth2Ak       = "QVUJMSUMgS0VZLS0+/0="
+	oauth2Sk       = "c2VjcmV0"
+)
+
+func getOAuth2Controller(form url.Values, basicId string, basicSecret string) (*TokenController,
+	*httptest.ResponseRecorder) {
+	c := &TokenController{}
+	c.Init(context.NewContext(), "", "", nil)
+	req, err := http.NewRequest("POST", "http://127.0.0.1/mep/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		log.Error("prepare http request failed")
+	}
+	req.Header.Set(util.ContentType, util.FormUrlEncoded)
+	if basicId != "" {
+		req.Header.Set(authorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(
+			url.QueryEscape(basicId)+":"+url.QueryEscape(basicSecret))))
+	}
+	req.Header.Set(xRealIp, "127.0.0.1")
+	recorder := httptest.NewRecorder()
+	c.Ctx.Request = req
+	c.Ctx.ResponseWriter = &context.Response{}
+	c.Ctx.ResponseWriter.ResponseWriter = recorder
+	c.Ctx.Output = context.NewOutput()
+	c.Ctx.Input = context.NewInput()
+	c.Ctx.Output.Reset(c.Ctx)
+	c.Ctx.Input.Reset(c.Ctx)
+	return c, recorder
+}
+
+func clientCredentialsForm(clientId string, clientSecret string) url.Values {
+	form := url.Values{}
+	form.Set(util.GrantTypeParam, util.GrantTypeClientCredential)
+	if clientId != "" {
+		form.Set(util.ClientIdParam, clientId)
+	}
+	if clientSecret != "" {
+		form.Set(util.ClientSecretParam, clientSecret)
+	}
+	return form
+}
+
+func oauth2ErrorCode(c *TokenController) string {
+	if out, ok := c.Data["json"].(*models.OAuth2Error); ok {
+		return out.Error
+	}
+	return ""
+}
+
+func TestIsOAuth2TokenRequest(t *testing.T) {
+	Convey("is oauth2 token request", t, func() {
+		c, _ := getOAuth2Controller(url.Values{}, "", "")
+		So(isOAuth2TokenRequest(c.Ctx.Request), ShouldBeTrue)
+
+		c.Ctx.Request.Header.Set(util.ContentType, "application/json")
+		So(isOAuth2TokenRequest(c.Ctx.Request), ShouldBeFalse)
+
+		c.Ctx.Request.Header.Set(authorization, "basic "+base64.StdEncoding.EncodeToString([]byte("id:secret")))
+		So(isOAuth2TokenRequest(c.Ctx.Request), ShouldBeTrue)
+
+		c.Ctx.Request.Header.Set(authorization, "SDK-HMAC-SHA256 Access=QVUJMSUMgS0VZLS0tLS0")
+		So(isOAuth2TokenRequest(c.Ctx.Request), ShouldBeFalse)
+	})
+}
+
+func TestHandleClientCredentials(t *testing.T) {
+	akBlockList = newMemoryBlockListStore()
+
+	Convey("handle client credentials", t, func() {
+		patches := ApplyFunc(getAppInsIdSk, func(ak string) (string, []byte, bool) {
+			if ak != oauth2Ak {
+				return "", nil, false
+			}
+			return oauth2AppInsId, []byte(oauth2Sk), true
+		})
+		patches.ApplyFunc(generateBoundJwtToken, func(_ string, _ string, _ string) (*string, error) {
+			// The token is cleared after the response, so it must not be a constant
+			token := string([]byte("jwtToken"))
+			return &token, nil
+		})
+		defer patches.Reset()
+
+		Convey("for success with client_secret_post", func() {
+			c, recorder := getOAuth2Controller(clientCredentialsForm(oauth2Ak, oauth2Sk), "", "")
+			c.Post()
+			out, ok := c.Data["json"].(*models.TokenInfo)
+			So(ok, ShouldBeTrue)
+			So(out.TokenType, ShouldEqual, "Bearer")
+			So(recorder.Header().Get(cacheControl), ShouldEqual, "no-store")
+		})
+
+		Convey("for success with client_secret_basic", func() {
+			c, _ := getOAuth2Controller(clientCredentialsForm("", ""), oauth2Ak, oauth2Sk)
+			c.Post()
+			_, ok := c.Data["json"].(*models.TokenInfo)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("for invalid secret", func() {
+			c, recorder := getOAuth2Controller(clientCredentialsForm("", ""), oauth2Ak, "d3Jvbmc=")
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidClient)
+			So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+			So(recorder.Header().Get(wwwAuth), ShouldEqual, basicRealm)
+			So(isAkInValidationList(oauth2Ak), ShouldBeTrue)
+			clearAkFromBlockListing(oauth2Ak)
+		})
+
+		Convey("for block listing not available", func() {
+			db := &adapter.MemoryDb{}
+			_ = db.InitDatabase()
+			previousDb := adapter.Db
+			adapter.Db = db
+			akBlockList = &dbBlockListStore{}
+			defer func() {
+				adapter.Db = previousDb
+				akBlockList = newMemoryBlockListStore()
+			}()
+			patches.ApplyMethod(reflect.TypeOf(db), "ReadData", func(*adapter.MemoryDb, interface{}, ...string) error {
+				return errors.New("db error")
+			})
+			c, recorder := getOAuth2Controller(clientCredentialsForm(oauth2Ak, oauth2Sk), "", "")
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrTemporarilyUnavailable)
+			So(recorder.Code, ShouldEqual, http.StatusServiceUnavailable)
+		})
+
+		Convey("for unknown client", func() {
+			c, recorder := getOAuth2Controller(clientCredentialsForm("QVUJMSUMgS0VZLS0tLS0", oauth2Sk), "", "")
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidClient)
+			So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("for missing client credentials", func() {
+			c, _ := getOAuth2Controller(clientCredentialsForm(oauth2Ak, ""), "", "")
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidClient)
+		})
+
+		Convey("for more than one authentication method", func() {
+			c, recorder := getOAuth2Controller(clientCredentialsForm("", oauth2Sk), oauth2Ak, oauth2Sk)
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidRequest)
+			So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("for unsupported grant type", func() {
+			form := clientCredentialsForm(oauth2Ak, oauth2Sk)
+			form.Set(util.GrantTypeParam, "password")
+			c, _ := getOAuth2Controller(form, "", "")
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrUnsupportedGrantType)
+		})
+
+		Convey("for missing grant type", func() {
+			c, _ := getOAuth2Controller(url.Values{}, oauth2Ak, oauth2Sk)
+			c.Post()
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidRequest)
+		})
+	})
+}
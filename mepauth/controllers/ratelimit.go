@@ -0,0 +1,65 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/astaxie/beego"
+
+	"mepauth/util"
+)
+
+const (
+	retryAfter      = "Retry-After"
+	tooManyRequests = "Too many requests"
+)
+
+// Token request rate limiters, nil when not enabled
+var (
+	clientIpRateLimiter *util.RateLimiter
+	akRateLimiter       *util.RateLimiter
+)
+
+// InitTokenRateLimit initializes the token request rate limits per client ip and per ak
+func InitTokenRateLimit() {
+	clientIpRateLimiter = util.NewRateLimiter(beego.AppConfig.DefaultInt64("token_rate_limit_ip", 0),
+		beego.AppConfig.DefaultInt64("token_rate_burst_ip", 1))
+	akRateLimiter = util.NewRateLimiter(beego.AppConfig.DefaultInt64("token_rate_limit_ak", 0),
+		beego.AppConfig.DefaultInt64("token_rate_burst_ak", 1))
+}
+
+// Take a token of the key from the limiter, the Retry-After header is set when the request is limited
+func (c *BaseController) isRateLimited(limiter *util.RateLimiter, key string, event string, clientIp string,
+	ak string) bool {
+	allowed, wait, lockedOut := limiter.Allow(key)
+	if allowed {
+		return false
+	}
+	if lockedOut {
+		auditSecurityEvent(event, auditDenied, clientIp, "", ak)
+	}
+	// Retry-After is in whole seconds, rounded up for the client not to retry too early
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Ctx.Output.Header(retryAfter, strconv.FormatInt(seconds, util.BaseVal))
+	return true
+}
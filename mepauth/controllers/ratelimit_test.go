@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/util"
+)
+
+func TestTokenRateLimit(t *testing.T) {
+	defer func() {
+		clientIpRateLimiter = nil
+		akRateLimiter = nil
+	}()
+
+	Convey("token rate limit", t, func() {
+		clientIpRateLimiter = nil
+		akRateLimiter = nil
+
+		Convey("limits the client ip", func() {
+			clientIpRateLimiter = util.NewRateLimiter(1, 1)
+			c, recorder := getOAuth2Controller(clientCredentialsForm("", ""), "", "")
+			c.Post()
+			So(recorder.Code, ShouldNotEqual, http.StatusTooManyRequests)
+
+			c, recorder = getOAuth2Controller(clientCredentialsForm("", ""), "", "")
+			c.Post()
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrTemporarilyUnavailable)
+			So(recorder.Header().Get(retryAfter), ShouldNotBeEmpty)
+		})
+
+		Convey("limits the ak whatever the client ip", func() {
+			akRateLimiter = util.NewRateLimiter(1, 1)
+			patches := ApplyFunc(getAppInsIdSk, func(ak string) (string, []byte, bool) {
+				return oauth2AppInsId, []byte(oauth2Sk), true
+			})
+			defer patches.Reset()
+			c, _ := getOAuth2Controller(clientCredentialsForm(oauth2Ak, "d3Jvbmc="), "", "")
+			c.Post()
+			c, recorder := getOAuth2Controller(clientCredentialsForm(oauth2Ak, "d3Jvbmc="), "", "")
+			c.Ctx.Request.Header.Set(xRealIp, "127.0.0.2")
+			c.Post()
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(recorder.Header().Get(retryAfter), ShouldEqual, "60")
+			clearAkFromBlockListing(oauth2Ak)
+		})
+
+		Convey("limits the signed token request", func() {
+			clientIpRateLimiter = util.NewRateLimiter(1, 1)
+			clientIpRateLimiter.Allow("127.0.0.1")
+			c := getController()
+			c.Post()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusTooManyRequests)
+		})
+	})
+}
@@ -0,0 +1,385 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+	"github.com/dgrijalva/jwt-go/v4"
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const (
+	tokenIdSize = 16
+	// Tokens expire an hour after their issue, the revocations are kept for the api gateway till then
+	tokenLifetime = time.Hour
+	// Interval of purging the expired revocations and of republishing the revocations to the api gateway
+	revocationSyncInterval = time.Minute
+	// Attempts of raising the token generation of an app instance revoked concurrently by another instance
+	revocationAttempts = 3
+	revokedTokenTable  = "revoked_token_record"
+	appRevocationTable = "app_token_revocation_record"
+	generationColumn   = "generation"
+	revokedAtColumn    = "revoked_at"
+)
+
+// RevocationPublisher publishes the revoked tokens to the api gateway which rejects them
+type RevocationPublisher interface {
+	PublishTokenRevocations(revocations *models.TokenRevocations) error
+}
+
+var (
+	revocationPublisher      RevocationPublisher
+	revocationPublisherMutex sync.Mutex
+)
+
+// SetRevocationPublisher sets the api gateway to publish the revoked tokens to
+func SetRevocationPublisher(publisher RevocationPublisher) {
+	revocationPublisherMutex.Lock()
+	defer revocationPublisherMutex.Unlock()
+	revocationPublisher = publisher
+}
+
+// StartTokenRevocationSync purges the expired revocations and republishes the others to the api gateway, so that
+// the revocations of the other mepauth instances, of a failed publishing and the plugins enabled later get them too
+func StartTokenRevocationSync() {
+	go func() {
+		ticker := time.NewTicker(revocationSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := publishTokenRevocations(); err != nil {
+				log.Error("Failed to publish token revocations, will be retried")
+			}
+		}
+	}()
+}
+
+// @Title Revoke token
+// @Description revocation of an access token by its client as per RFC 7009
+// @Param   authorization  header    string  false  "Basic authorization with the client id(AK) and secret(SK)"
+// @Param   token          formData  string  true   "Access token to revoke"
+// @Param   client_id      formData  string  false  "Client id(AK), when not sent with basic authorization"
+// @Param   client_secret  formData  string  false  "Client secret(SK), when not sent with basic authorization"
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 401 unauthorized
+// @router /token/revoke [post]
+func (c *TokenController) Revoke() {
+	log.Info("Revoke token request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	token, ok := c.parseTokenForm(clientIp)
+	if !ok {
+		return
+	}
+	clientId, appInsId, isBasic, ok := c.authenticateClient(clientIp)
+	if !ok {
+		return
+	}
+
+	// An invalid or expired token needs no revocation, the client is not informed as per RFC 7009 section 2.2
+	claims, err := parseIssuedToken(token)
+	if err == nil {
+		if claims.Subject != appInsId {
+			c.writeOAuth2Error(clientIp, clientId, http.StatusBadRequest, util.ErrUnauthorizedClient,
+				"Token is not issued to the client", isBasic)
+			return
+		}
+		if err = revokeToken(claims); err == nil {
+			err = publishTokenRevocations()
+		}
+		if err != nil {
+			c.writeOAuth2Error(clientIp, clientId, http.StatusInternalServerError, util.ErrServerError, serverError,
+				isBasic)
+			return
+		}
+		log.Info("Token " + claims.ID + " of App Instance Id " + appInsId + " is revoked")
+	}
+	c.setNoCacheHeaders()
+	c.Ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	log.Info("Response message for ClientIP [" + clientIp + "] ClientAK [" + clientId + "]" + operation +
+		c.Ctx.Request.Method + "]" + resource + c.Ctx.Input.URL() + "] Result [Success]")
+}
+
+// @Title Introspect token
+// @Description state of an access token as per RFC 7662, a client only gets the state of its own tokens
+// @Param   authorization  header    string  false  "Basic authorization with the client id(AK) and secret(SK)"
+// @Param   token          formData  string  true   "Access token to introspect"
+// @Param   client_id      formData  string  false  "Client id(AK), when not sent with basic authorization"
+// @Param   client_secret  formData  string  false  "Client secret(SK), when not sent with basic authorization"
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 401 unauthorized
+// @router /token/introspect [post]
+func (c *TokenController) Introspect() {
+	log.Info("Introspect token request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	token, ok := c.parseTokenForm(clientIp)
+	if !ok {
+		return
+	}
+	clientId, appInsId, isBasic, ok := c.authenticateClient(clientIp)
+	if !ok {
+		return
+	}
+
+	// The token of another client is reported inactive, as per RFC 7662 section 4 nothing is disclosed about it
+	introspection := &models.TokenIntrospection{}
+	claims, err := parseIssuedToken(token)
+	if err == nil && claims.Subject == appInsId {
+		revoked, err := isTokenRevoked(claims)
+		if err != nil {
+			c.writeOAuth2Error(clientIp, clientId, http.StatusInternalServerError, util.ErrServerError, serverError,
+				isBasic)
+			return
+		}
+		if !revoked {
+			introspection = &models.TokenIntrospection{
+				Active:    true,
+				TokenType: "Bearer",
+				Scope:     claims.Scope,
+				Sub:       claims.Subject,
+				Iss:       claims.Issuer,
+				Jti:       claims.ID,
+				Exp:       claims.ExpiresAt.Unix(),
+				Iat:       claims.IssuedAt.Unix(),
+				Cnf:       claims.Cnf,
+			}
+		}
+	}
+	c.setNoCacheHeaders()
+	c.Data["json"] = introspection
+	c.handleLoggingForSuccess(clientIp, "")
+}
+
+// Validate the source address and read the token parameter of the revocation and introspection requests
+func (c *TokenController) parseTokenForm(clientIp string) (string, bool) {
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return "", false
+	}
+	c.logReceivedMsg(clientIp)
+	if c.isRateLimited(clientIpRateLimiter, clientIp, auditClientIpRateLimited, clientIp, "") {
+		c.writeOAuth2Error(clientIp, "", http.StatusTooManyRequests, util.ErrTemporarilyUnavailable,
+			tooManyRequests, false)
+		return "", false
+	}
+	r := c.Ctx.Request
+	if err = r.ParseForm(); err != nil {
+		c.writeOAuth2Error(clientIp, "", http.StatusBadRequest, util.ErrInvalidRequest, "Malformed request body",
+			false)
+		return "", false
+	}
+	token := r.PostForm.Get(util.TokenParam)
+	if token == "" {
+		c.writeOAuth2Error(clientIp, "", http.StatusBadRequest, util.ErrInvalidRequest, "Missing token", false)
+		return "", false
+	}
+	return token, true
+}
+
+func generateTokenId() (string, error) {
+	tokenId := make([]byte, tokenIdSize)
+	if _, err := rand.Read(tokenId); err != nil {
+		log.Error("Failed to generate token id")
+		return "", err
+	}
+	return hex.EncodeToString(tokenId), nil
+}
+
+// Verify the token is issued by mepauth and not expired yet, a token of a withdrawn key is no more valid
+func parseIssuedToken(tokenString string) (*jwtClaims, error) {
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return util.GetJwtVerificationKey(kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS512.Alg()}),
+		jwt.WithIssuer(util.GetAppConfig("mepauth_key")))
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID == "" || claims.Subject == "" || claims.ExpiresAt == nil || claims.IssuedAt == nil {
+		return nil, errors.New("token claims are incomplete")
+	}
+	return claims, nil
+}
+
+// Record the revoked token till it expires
+func revokeToken(claims *jwtClaims) error {
+	revokedTokenRecord := &models.RevokedTokenRecord{
+		Jti:       claims.ID,
+		AppInsId:  claims.Subject,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	}
+	err := adapter.Db.InsertOrUpdateData(revokedTokenRecord, "jti")
+	if err != nil && err.Error() != util.PgOkMsg {
+		log.Error("Failed to save revoked token to database.")
+		return err
+	}
+	return nil
+}
+
+// Revoke all the tokens issued to the app instance so far by raising its token generation, and reject them on the
+// api gateway
+func revokeAppInstanceTokens(appInsId string) error {
+	for attempt := 0; attempt < revocationAttempts; attempt++ {
+		revoked, err := raiseTokenGeneration(appInsId)
+		if err != nil {
+			log.Error("Failed to save token revocation of app instance to database.")
+			return err
+		}
+		if revoked {
+			return publishTokenRevocations()
+		}
+	}
+	log.Error("Token generation of app instance is raised concurrently, revocation is not saved.")
+	return errors.New("token generation is raised concurrently")
+}
+
+// Raise the token generation of the app instance only if no other instance raised it meanwhile, a generation
+// lowered by a stale update would revoke the later tokens no more
+func raiseTokenGeneration(appInsId string) (bool, error) {
+	revocationRecord := &models.AppTokenRevocationRecord{
+		AppInsId: appInsId,
+	}
+	err := adapter.Db.ReadData(revocationRecord, appInstanceID)
+	if err == orm.ErrNoRows {
+		revocationRecord.RevokedAt = time.Now().Unix()
+		revocationRecord.Generation = 1
+		err = adapter.Db.InsertData(revocationRecord)
+		if err == nil || err.Error() == util.PgOkMsg {
+			return true, nil
+		}
+		// Inserted by another instance meanwhile
+		if readErr := adapter.Db.ReadData(&models.AppTokenRevocationRecord{AppInsId: appInsId},
+			appInstanceID); readErr == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	generation := revocationRecord.Generation
+	revocationRecord.RevokedAt = time.Now().Unix()
+	revocationRecord.Generation = generation + 1
+	return adapter.Db.UpdateDataIf(revocationRecord, map[string]interface{}{generationColumn: generation},
+		revokedAtColumn, generationColumn)
+}
+
+// Generation of the tokens issued to the app instance now, the tokens of the earlier generations are revoked
+func tokenGeneration(appInsId string) (int64, error) {
+	revocationRecord := &models.AppTokenRevocationRecord{
+		AppInsId: appInsId,
+	}
+	err := adapter.Db.ReadData(revocationRecord, appInstanceID)
+	if err == orm.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		log.Error("Failed to read token revocation of app instance from database.")
+		return 0, err
+	}
+	return revocationRecord.Generation, nil
+}
+
+// Check the revocation of the token itself and of all the tokens of its app instance
+func isTokenRevoked(claims *jwtClaims) (bool, error) {
+	revokedTokenRecord := &models.RevokedTokenRecord{
+		Jti: claims.ID,
+	}
+	err := adapter.Db.ReadData(revokedTokenRecord, "jti")
+	if err == nil {
+		return true, nil
+	}
+	if err != orm.ErrNoRows {
+		log.Error("Failed to read revoked token from database.")
+		return false, err
+	}
+
+	generation, err := tokenGeneration(claims.Subject)
+	if err != nil {
+		return false, err
+	}
+	return claims.Generation < generation, nil
+}
+
+// Purge the revocations of the expired tokens and publish the others to the api gateway. The generations are kept
+// as the later tokens are issued with them, only the ones older than the token lifetime are not published
+func publishTokenRevocations() error {
+	revocations, err := purgeTokenRevocations(time.Now())
+	if err != nil {
+		return err
+	}
+	revocationPublisherMutex.Lock()
+	publisher := revocationPublisher
+	revocationPublisherMutex.Unlock()
+	if publisher == nil {
+		return nil
+	}
+	if err = publisher.PublishTokenRevocations(revocations); err != nil {
+		log.Error("Failed to publish token revocations to api gateway.")
+		return err
+	}
+	return nil
+}
+
+func purgeTokenRevocations(now time.Time) (*models.TokenRevocations, error) {
+	revocations := &models.TokenRevocations{
+		RevokedTokens: make(map[string]int64),
+		RevokedApps:   make(map[string]int64),
+	}
+	var revokedTokenRecords []*models.RevokedTokenRecord
+	_, err := adapter.Db.QueryTable(revokedTokenTable, &revokedTokenRecords)
+	if err != nil && err != orm.ErrNoRows {
+		log.Error("Failed to read revoked tokens from database.")
+		return nil, err
+	}
+	for _, record := range revokedTokenRecords {
+		if record.ExpiresAt > now.Unix() {
+			revocations.RevokedTokens[record.Jti] = record.ExpiresAt
+			continue
+		}
+		if err = adapter.Db.DeleteData(&models.RevokedTokenRecord{Jti: record.Jti}, "jti"); err != nil {
+			log.Warn("Failed to purge expired revoked token, will be retried.")
+		}
+	}
+
+	var revocationRecords []*models.AppTokenRevocationRecord
+	_, err = adapter.Db.QueryTable(appRevocationTable, &revocationRecords)
+	if err != nil && err != orm.ErrNoRows {
+		log.Error("Failed to read token revocations of app instances from database.")
+		return nil, err
+	}
+	for _, record := range revocationRecords {
+		if record.RevokedAt > now.Add(-tokenLifetime).Unix() {
+			revocations.RevokedApps[record.AppInsId] = record.Generation
+		}
+	}
+	return revocations, nil
+}
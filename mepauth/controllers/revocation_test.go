@@ -0,0 +1,247 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey"
+	"github.com/astaxie/beego"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const otherAppInsId = "6abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+
+type mockRevocationPublisher struct {
+	published []*models.TokenRevocations
+	err       error
+}
+
+func (p *mockRevocationPublisher) PublishTokenRevocations(revocations *models.TokenRevocations) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, revocations)
+	return nil
+}
+
+// Database of the test with the auth info records of the clients
+func newRevocationDb(appInsIds ...string) *adapter.MemoryDb {
+	db := &adapter.MemoryDb{}
+	_ = db.InitDatabase()
+	for _, appInsId := range appInsIds {
+		_ = db.InsertData(&models.AuthInfoRecord{AppInsId: appInsId, RequiredServices: `["service1"]`,
+			Scope: "services:read"})
+	}
+	return db
+}
+
+func revokedTokenCount(db *adapter.MemoryDb) int64 {
+	var records []models.RevokedTokenRecord
+	num, _ := db.QueryTable("revoked_token_record", &records)
+	return num
+}
+
+func tokenForm(token string) url.Values {
+	form := url.Values{}
+	form.Set(util.TokenParam, token)
+	return form
+}
+
+func introspectionOf(c *TokenController) *models.TokenIntrospection {
+	if out, ok := c.Data["json"].(*models.TokenIntrospection); ok {
+		return out
+	}
+	return nil
+}
+
+func TestTokenRevocation(t *testing.T) {
+	err := beego.LoadAppConfig("ini", "../conf/app.conf")
+	if err != nil {
+		log.Error(err.Error())
+	}
+	akBlockList = newMemoryBlockListStore()
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	publicKeyDer, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	publicKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer}))
+	previousDb := adapter.Db
+	defer func() { adapter.Db = previousDb }()
+
+	Convey("token revocation", t, func() {
+		db := newRevocationDb(oauth2AppInsId, otherAppInsId)
+		adapter.Db = db
+		patches := ApplyFunc(util.GetJwtSigningKey, func() (string, *rsa.PrivateKey, error) {
+			// The signing key is cleared after use
+			signingKey := *privateKey
+			signingKey.D = new(big.Int).Set(privateKey.D)
+			return "kid", &signingKey, nil
+		})
+		patches.ApplyFunc(getAppInsIdSk, func(ak string) (string, []byte, bool) {
+			if ak != oauth2Ak {
+				return "", nil, false
+			}
+			return oauth2AppInsId, []byte(oauth2Sk), true
+		})
+		patches.ApplyFunc(util.GetJwtKeys, func() ([]util.JwtKeyInfo, error) {
+			return []util.JwtKeyInfo{{Kid: "kid", PublicKey: publicKeyPem}}, nil
+		})
+		defer patches.Reset()
+
+		token, err := generateJwtToken(oauth2AppInsId, "127.0.0.1")
+		So(err, ShouldBeNil)
+
+		Convey("introspects an active token", func() {
+			c, _ := getOAuth2Controller(tokenForm(*token), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			out := introspectionOf(c)
+			So(out, ShouldNotBeNil)
+			So(out.Active, ShouldBeTrue)
+			So(out.Sub, ShouldEqual, oauth2AppInsId)
+			So(out.Jti, ShouldNotBeEmpty)
+			So(out.Scope, ShouldEqual, "services:read")
+		})
+
+		Convey("introspects a revoked token as inactive", func() {
+			c, recorder := getOAuth2Controller(tokenForm(*token), oauth2Ak, oauth2Sk)
+			c.Revoke()
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(revokedTokenCount(db), ShouldEqual, 1)
+
+			c, _ = getOAuth2Controller(tokenForm(*token), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			So(introspectionOf(c).Active, ShouldBeFalse)
+		})
+
+		Convey("introspects the tokens of a deleted app instance as inactive", func() {
+			So(revokeAppInstanceTokens(oauth2AppInsId), ShouldBeNil)
+			c, _ := getOAuth2Controller(tokenForm(*token), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			So(introspectionOf(c).Active, ShouldBeFalse)
+
+			// The tokens issued later are not revoked, even within the second of the revocation
+			laterToken, err := generateJwtToken(oauth2AppInsId, "127.0.0.1")
+			So(err, ShouldBeNil)
+			c, _ = getOAuth2Controller(tokenForm(*laterToken), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			So(introspectionOf(c).Active, ShouldBeTrue)
+
+			So(revokeAppInstanceTokens(oauth2AppInsId), ShouldBeNil)
+			c, _ = getOAuth2Controller(tokenForm(*laterToken), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			So(introspectionOf(c).Active, ShouldBeFalse)
+		})
+
+		Convey("publishes the revocations to the api gateway", func() {
+			publisher := &mockRevocationPublisher{}
+			SetRevocationPublisher(publisher)
+			defer SetRevocationPublisher(nil)
+
+			c, recorder := getOAuth2Controller(tokenForm(*token), oauth2Ak, oauth2Sk)
+			c.Revoke()
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(revokeAppInstanceTokens(otherAppInsId), ShouldBeNil)
+			So(len(publisher.published), ShouldEqual, 2)
+			revocations := publisher.published[1]
+			So(len(revocations.RevokedTokens), ShouldEqual, 1)
+			So(revocations.RevokedApps, ShouldResemble, map[string]int64{otherAppInsId: 1})
+
+			// The expired tokens are purged, the generations are kept for the later tokens
+			_ = db.InsertOrUpdateData(&models.RevokedTokenRecord{Jti: "expired", AppInsId: oauth2AppInsId,
+				ExpiresAt: time.Now().Add(-time.Second).Unix()})
+			_ = db.InsertOrUpdateData(&models.AppTokenRevocationRecord{AppInsId: otherAppInsId,
+				RevokedAt: time.Now().Add(-tokenLifetime).Unix(), Generation: 1})
+			So(publishTokenRevocations(), ShouldBeNil)
+			revocations = publisher.published[2]
+			So(len(revocations.RevokedTokens), ShouldEqual, 1)
+			So(revocations.RevokedApps, ShouldBeEmpty)
+			So(revokedTokenCount(db), ShouldEqual, 1)
+			generation, _ := tokenGeneration(otherAppInsId)
+			So(generation, ShouldEqual, 1)
+		})
+
+		Convey("fails the revocation when publishing fails", func() {
+			SetRevocationPublisher(&mockRevocationPublisher{err: errors.New("api gateway error")})
+			defer SetRevocationPublisher(nil)
+
+			c, recorder := getOAuth2Controller(tokenForm(*token), oauth2Ak, oauth2Sk)
+			c.Revoke()
+			So(recorder.Code, ShouldEqual, http.StatusInternalServerError)
+			So(revokeAppInstanceTokens(otherAppInsId), ShouldNotBeNil)
+		})
+
+		Convey("introspects an invalid token as inactive", func() {
+			c, _ := getOAuth2Controller(tokenForm("invalid"), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			So(introspectionOf(c).Active, ShouldBeFalse)
+		})
+
+		Convey("ignores the revocation of an invalid token", func() {
+			c, recorder := getOAuth2Controller(tokenForm("invalid"), oauth2Ak, oauth2Sk)
+			c.Revoke()
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(revokedTokenCount(db), ShouldEqual, 0)
+		})
+
+		Convey("refuses the revocation of a token of another client", func() {
+			otherToken, err := generateJwtToken(otherAppInsId, "127.0.0.1")
+			So(err, ShouldBeNil)
+			c, recorder := getOAuth2Controller(tokenForm(*otherToken), oauth2Ak, oauth2Sk)
+			c.Revoke()
+			So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrUnauthorizedClient)
+			So(revokedTokenCount(db), ShouldEqual, 0)
+		})
+
+		Convey("introspects a token of another client as inactive", func() {
+			otherToken, err := generateJwtToken(otherAppInsId, "127.0.0.1")
+			So(err, ShouldBeNil)
+			c, _ := getOAuth2Controller(tokenForm(*otherToken), oauth2Ak, oauth2Sk)
+			c.Introspect()
+			out := introspectionOf(c)
+			So(out.Active, ShouldBeFalse)
+			So(out.Sub, ShouldBeEmpty)
+		})
+
+		Convey("requires client authentication", func() {
+			c, recorder := getOAuth2Controller(tokenForm(*token), oauth2Ak, "d3Jvbmc=")
+			c.Introspect()
+			So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+			clearAkFromBlockListing(oauth2Ak)
+		})
+
+		Convey("requires the token", func() {
+			c, recorder := getOAuth2Controller(url.Values{}, oauth2Ak, oauth2Sk)
+			c.Revoke()
+			So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+			So(oauth2ErrorCode(c), ShouldEqual, util.ErrInvalidRequest)
+		})
+	})
+}
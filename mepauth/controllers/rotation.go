@@ -0,0 +1,215 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package controllers implements mep auth controller
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/astaxie/beego/orm"
+	log "github.com/sirupsen/logrus"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const (
+	prevAkColumn        = "prev_ak"
+	prevSkColumn        = "prev_sk"
+	prevNonceColumn     = "prev_nonce"
+	prevExpiresAtColumn = "prev_expires_at"
+	// Random bytes of the generated ak and sk, their base64 encoding is of the length ValidateAk and ValidateSk accept
+	generatedAkSize = 15
+	generatedSkSize = 48
+	// Seconds the previous credential pair stays valid after a rotation, when not configured
+	defaultAkRotationOverlap = 86400
+)
+
+var (
+	errAuthInfoNotFound = errors.New("auth info record does not exist")
+	errAuthInfoChanged  = errors.New("auth info record is changed concurrently")
+)
+
+// @Title Rotate AK/SK configuration
+// @Description generation of a new ak & sk, the previous pair stays valid till the rotation overlap expires
+// @Param   applicationId  path  string  true   "APP instance ID"
+// @Success 200 ok
+// @Failure 400 bad request
+// @Failure 404 not found
+// @Failure 500 internal server error
+// @router /appMng/v1/applications/:applicationId/confs/rotate [post]
+func (c *ConfController) Rotate() {
+	log.Info("Rotate AK/SK configuration request received.")
+	clientIp := c.Ctx.Request.Header.Get(xRealIp)
+	err := c.validateSrcAddress(clientIp)
+	if err != nil {
+		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
+		return
+	}
+	c.logReceivedMsg(clientIp)
+
+	appInsId := c.Ctx.Input.Param(util.UrlApplicationId)
+	if validateErr := util.ValidateUUID(appInsId); validateErr != nil {
+		c.handleConfFailure(auditAkRotated, clientIp, appInsId, "", http.StatusBadRequest, util.AppIDFailMsg)
+		return
+	}
+
+	rotation, err := rotateAkAndSk(appInsId)
+	if err == errAuthInfoNotFound {
+		c.handleConfFailure(auditAkRotated, clientIp, appInsId, "", http.StatusNotFound,
+			"AK/SK configuration does not exist")
+		return
+	}
+	if err == errAuthInfoChanged {
+		c.handleConfFailure(auditAkRotated, clientIp, appInsId, "", http.StatusConflict,
+			"AK/SK configuration is changed concurrently")
+		return
+	}
+	if err != nil {
+		c.handleConfFailure(auditAkRotated, clientIp, appInsId, "", http.StatusInternalServerError,
+			"Error while rotating configuration")
+		return
+	}
+	auditSecurityEvent(auditAkRotated, auditSuccess, clientIp, appInsId, rotation.Credentials.AccessKeyId)
+	c.setNoCacheHeaders()
+	c.Data["json"] = rotation
+	c.handleLoggingForSuccess(clientIp, "AK/SK of "+appInsId+" rotated to "+rotation.Credentials.AccessKeyId)
+}
+
+// Seconds the previous credential pair stays valid after a rotation
+func akRotationOverlap() int64 {
+	return beego.AppConfig.DefaultInt64("ak_rotation_overlap", defaultAkRotationOverlap)
+}
+
+func generateCredential(size int) (string, error) {
+	credential := make([]byte, size)
+	if _, err := rand.Read(credential); err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(credential)
+	util.ClearByteArray(credential)
+	return encoded, nil
+}
+
+// Replace the ak and sk of the app instance by a generated pair, the replaced pair becomes the previous one. The pair
+// is replaced only if no other instance changed it meanwhile, so that no rotation loses the pair saved by another
+func rotateAkAndSk(appInsId string) (*models.CredentialRotation, error) {
+	authInfoRecord := &models.AuthInfoRecord{
+		AppInsId: appInsId,
+	}
+	err := adapter.Db.ReadData(authInfoRecord, appInstanceID)
+	if err == orm.ErrNoRows {
+		return nil, errAuthInfoNotFound
+	}
+	if err != nil && err.Error() != util.PgOkMsg {
+		log.Error("Failed to read auth info record of " + appInsId + ".")
+		return nil, err
+	}
+
+	ak, err := generateCredential(generatedAkSize)
+	if err != nil {
+		log.Error("Failed to generate ak.")
+		return nil, err
+	}
+	sk, err := generateCredential(generatedSkSize)
+	if err != nil {
+		log.Error("Failed to generate sk.")
+		return nil, err
+	}
+	// The sk is cleared by the encryption, it is returned from its own copy
+	skBytes := []byte(sk)
+	cipherSkBytes, nonceBytes, err := getCipherAndNonce(&skBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := map[string]interface{}{akColumn: authInfoRecord.Ak, skColumn: authInfoRecord.Sk}
+	authInfoRecord.PrevAk = authInfoRecord.Ak
+	authInfoRecord.PrevSk = authInfoRecord.Sk
+	authInfoRecord.PrevNonce = authInfoRecord.Nonce
+	authInfoRecord.PrevExpiresAt = time.Now().Unix() + akRotationOverlap()
+	authInfoRecord.Ak = ak
+	authInfoRecord.Sk = string(cipherSkBytes)
+	authInfoRecord.Nonce = string(nonceBytes)
+	updated, err := adapter.Db.UpdateDataIf(authInfoRecord, expected, akColumn, skColumn, nonceColumn,
+		prevAkColumn, prevSkColumn, prevNonceColumn, prevExpiresAtColumn)
+	util.ClearByteArray(nonceBytes)
+	if err != nil {
+		log.Error("Failed to save rotated ak and sk to database, appInstanceId is " + appInsId + ".")
+		return nil, err
+	}
+	if !updated {
+		log.Error("Ak of " + appInsId + " is changed concurrently, rotation is aborted.")
+		return nil, errAuthInfoChanged
+	}
+	log.Info("Ak of " + appInsId + " is rotated, previous Ak " + authInfoRecord.PrevAk + " expires at " +
+		time.Unix(authInfoRecord.PrevExpiresAt, 0).UTC().Format(time.RFC3339))
+	return &models.CredentialRotation{
+		Credentials: models.Credentials{
+			AccessKeyId: ak,
+			SecretKey:   sk,
+		},
+		PreviousAccessKeyId: authInfoRecord.PrevAk,
+		PreviousExpiresAt:   authInfoRecord.PrevExpiresAt,
+	}, nil
+}
+
+// Read the auth info of the current ak or of the previous ak till it expires, along with the encoded sk and nonce
+// of the matching pair
+func readAuthInfoByAk(ak string) (*models.AuthInfoRecord, []byte, []byte) {
+	authInfoRecord := &models.AuthInfoRecord{
+		Ak: ak,
+	}
+	readErr := adapter.Db.ReadData(authInfoRecord, "ak")
+	if readErr == nil || readErr.Error() == util.PgOkMsg {
+		return authInfoRecord, []byte(authInfoRecord.Sk), []byte(authInfoRecord.Nonce)
+	}
+
+	authInfoRecord = &models.AuthInfoRecord{
+		PrevAk: ak,
+	}
+	readErr = adapter.Db.ReadData(authInfoRecord, prevAkColumn)
+	if readErr != nil && readErr.Error() != util.PgOkMsg {
+		return nil, nil, nil
+	}
+	if !isPrevAkValid(authInfoRecord) {
+		log.Info("Previous Ak " + ak + " of " + authInfoRecord.AppInsId + " is expired")
+		return nil, nil, nil
+	}
+	return authInfoRecord, []byte(authInfoRecord.PrevSk), []byte(authInfoRecord.PrevNonce)
+}
+
+func isPrevAkValid(authInfoRecord *models.AuthInfoRecord) bool {
+	return authInfoRecord.PrevAk != "" && authInfoRecord.PrevExpiresAt > time.Now().Unix()
+}
+
+// The expired previous pair is no more reported
+func hideExpiredPrevAk(authInfoRecord *models.AuthInfoRecord) {
+	if isPrevAkValid(authInfoRecord) {
+		return
+	}
+	authInfoRecord.PrevAk = ""
+	authInfoRecord.PrevSk = ""
+	authInfoRecord.PrevNonce = ""
+	authInfoRecord.PrevExpiresAt = 0
+}
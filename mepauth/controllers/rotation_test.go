@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controllers
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"mepauth/adapter"
+	"mepauth/models"
+	"mepauth/util"
+)
+
+const rotationAppInsId = "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+
+func getRotateController(appInsId string) *ConfController {
+	c := &ConfController{}
+	tokenController := getController()
+	c.Init(tokenController.Ctx, "", "", nil)
+	c.Ctx.Input.SetParam(util.UrlApplicationId, appInsId)
+	return c
+}
+
+func TestRotateAkAndSk(t *testing.T) {
+	previousDb := adapter.Db
+	defer func() { adapter.Db = previousDb }()
+	patches := ApplyFunc(util.GetWorkKey, func() ([]byte, error) {
+		// The work key is cleared after use
+		return make([]byte, 32), nil
+	})
+	defer patches.Reset()
+
+	Convey("rotate ak and sk", t, func() {
+		db := &adapter.MemoryDb{}
+		_ = db.InitDatabase()
+		adapter.Db = db
+		sk := []byte(oauth2Sk)
+		So(saveAkAndSk(rotationAppInsId, oauth2Ak, &sk, "app", "[]", nil, nil), ShouldBeNil)
+
+		c := getRotateController(rotationAppInsId)
+		c.Rotate()
+		rotation, ok := c.Data["json"].(*models.CredentialRotation)
+		So(ok, ShouldBeTrue)
+		So(util.ValidateAk(rotation.Credentials.AccessKeyId), ShouldBeNil)
+		newSk := []byte(rotation.Credentials.SecretKey)
+		So(util.ValidateSk(&newSk), ShouldBeNil)
+		So(rotation.PreviousAccessKeyId, ShouldEqual, oauth2Ak)
+		So(rotation.PreviousExpiresAt, ShouldBeGreaterThan, time.Now().Unix())
+
+		Convey("both the pairs are valid in the overlap", func() {
+			appInsId, sk, _ := getAppInsIdSk(rotation.Credentials.AccessKeyId)
+			So(appInsId, ShouldEqual, rotationAppInsId)
+			So(string(sk), ShouldEqual, rotation.Credentials.SecretKey)
+
+			appInsId, sk, _ = getAppInsIdSk(oauth2Ak)
+			So(appInsId, ShouldEqual, rotationAppInsId)
+			So(string(sk), ShouldEqual, oauth2Sk)
+		})
+
+		Convey("the previous pair expires after the overlap", func() {
+			record := models.AuthInfoRecord{AppInsId: rotationAppInsId}
+			_ = db.ReadData(&record, appInstanceID)
+			record.PrevExpiresAt = time.Now().Add(-time.Second).Unix()
+			_ = db.InsertOrUpdateData(&record, appInstanceID)
+
+			appInsId, _, ok := getAppInsIdSk(oauth2Ak)
+			So(appInsId, ShouldBeEmpty)
+			So(ok, ShouldBeFalse)
+
+			hideExpiredPrevAk(&record)
+			So(record.PrevAk, ShouldBeEmpty)
+		})
+
+		Convey("a second rotation replaces the previous pair", func() {
+			c := getRotateController(rotationAppInsId)
+			c.Rotate()
+			second := c.Data["json"].(*models.CredentialRotation)
+			So(second.PreviousAccessKeyId, ShouldEqual, rotation.Credentials.AccessKeyId)
+			_, _, ok := getAppInsIdSk(oauth2Ak)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("the concurrent rotations keep the pairs they replaced", func() {
+			var wait sync.WaitGroup
+			rotations := make([]*models.CredentialRotation, 4)
+			for i := range rotations {
+				wait.Add(1)
+				go func(i int) {
+					defer wait.Done()
+					rotations[i], _ = rotateAkAndSk(rotationAppInsId)
+				}(i)
+			}
+			wait.Wait()
+
+			// No two rotations replaced the same pair, the last one is saved
+			record := models.AuthInfoRecord{AppInsId: rotationAppInsId}
+			_ = db.ReadData(&record, appInstanceID)
+			replaced := make(map[string]bool)
+			saved := false
+			for _, rotation := range rotations {
+				if rotation == nil {
+					continue
+				}
+				So(replaced[rotation.PreviousAccessKeyId], ShouldBeFalse)
+				replaced[rotation.PreviousAccessKeyId] = true
+				saved = saved || rotation.Credentials.AccessKeyId == record.Ak
+			}
+			So(saved, ShouldBeTrue)
+		})
+
+		Convey("a rotation conflicting with another is refused", func() {
+			patches := ApplyMethod(reflect.TypeOf(db), "UpdateDataIf", func(*adapter.MemoryDb, interface{},
+				map[string]interface{}, ...string) (bool, error) {
+				return false, nil
+			})
+			defer patches.Reset()
+			c := getRotateController(rotationAppInsId)
+			c.Rotate()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusConflict)
+		})
+
+		Convey("for unknown app instance", func() {
+			c := getRotateController("6abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f")
+			c.Rotate()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("for invalid app instance id", func() {
+			c := getRotateController("invalid")
+			c.Rotate()
+			So(c.Ctx.ResponseWriter.Status, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
@@ -19,6 +19,7 @@ package controllers
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"mepauth/adapter"
 	"net/http"
@@ -45,11 +46,14 @@ type TokenController struct {
 }
 
 // @Title Process token information
-// @Description create token and return the same
+// @Description create token and return the same, an app with a client certificate may authenticate with it instead
 // @Param   Content-Type   header  string  true   "MIME type, fill in application/json"
 // @Param   authorization  header  string  true   "Certification Information"
 // @Param   x-sdk-date     header  string  true   "Signature time, current timestamp, format: YYYYMMDDTHHMMSSZ"
 // @Param   Host           header  string  true   "Consistent with the host field used to generate the authentication information signature"
+// @Param   grant_type     formData  string  false  "OAuth2 grant type, only client_credentials is supported"
+// @Param   client_id      formData  string  false  "OAuth2 client id(AK), when not sent with basic authorization"
+// @Param   client_secret  formData  string  false  "OAuth2 client secret(SK), when not sent with basic authorization"
 // @Success 200 ok
 // @Failure 400 bad request
 // @router /token [post]
@@ -61,8 +65,27 @@ func (c *TokenController) Post() {
 		c.handleLoggingForError(clientIp, http.StatusBadRequest, util.ClientIpaddressInvalid)
 		return
 	}
+	isOAuth2 := isOAuth2TokenRequest(c.Ctx.Request)
+	if c.isRateLimited(clientIpRateLimiter, clientIp, auditClientIpRateLimited, clientIp, "") {
+		if isOAuth2 {
+			c.writeOAuth2Error(clientIp, "", http.StatusTooManyRequests, util.ErrTemporarilyUnavailable,
+				tooManyRequests, false)
+		} else {
+			c.handleLoggingForError(clientIp, http.StatusTooManyRequests, tooManyRequests)
+		}
+		return
+	}
+	if isOAuth2 {
+		c.handleClientCredentials(clientIp)
+		return
+	}
 	// Below we first check the formats of the header is correct or not
 	header := c.Ctx.Input.Header(authorization)
+	// The apps provisioned with a client certificate may authenticate with it instead of the signature
+	if cert := verifiedClientCert(c.Ctx.Request); header == "" && cert != nil {
+		c.handleClientCert(clientIp, cert)
+		return
+	}
 	ak, signHeader, sig := parseAuthHeader(header)
 	if ak == "" || signHeader == "" || sig == "" {
 		c.logReceivedMsg(clientIp)
@@ -78,7 +101,19 @@ func (c *TokenController) Post() {
 
 	c.logReceivedMsgWithAk(clientIp, ak)
 
-	if isAkInBlockList(ak) {
+	if c.isRateLimited(akRateLimiter, ak, auditAkRateLimited, clientIp, ak) {
+		c.writeErrorResponse(tooManyRequests, http.StatusTooManyRequests)
+		c.logErrResponseMsgWithAk(clientIp, "Ak is rate limited", ak)
+		return
+	}
+
+	blocked, err := isAkInBlockList(ak)
+	if err != nil {
+		c.writeErrorResponse("Service unavailable.", http.StatusServiceUnavailable)
+		c.logErrResponseMsgWithAk(clientIp, "Block listing of Ak is not available", ak)
+		return
+	}
+	if blocked {
 		c.writeErrorResponse("Access is locked.", http.StatusForbidden)
 		c.logErrResponseMsgWithAk(clientIp, "Ak is blockListed", ak)
 		return
@@ -102,16 +137,39 @@ func (c *TokenController) Post() {
 	if tokenInfo == nil {
 		return
 	}
-	c.sendResponseMsg(ak, tokenInfo, clientIp)
+	c.sendResponseMsg(appInsId, ak, tokenInfo, clientIp)
 }
 
 type jwtClaims struct {
 	jwt.StandardClaims
-	ClientIp string `json:"clientip"`
+	ClientIp string   `json:"clientip"`
+	Scope    string   `json:"scope"`
+	Services []string `json:"services"`
+	// Token generation of the app instance, the tokens of the generations before a revocation are revoked
+	Generation int64 `json:"gen,omitempty"`
+	// Certificate the token is bound to when the client authenticated with its certificate
+	Cnf *models.TokenConfirmation `json:"cnf,omitempty"`
 }
 
 func generateJwtToken(appInsId string, clientIp string) (*string, error) {
-	privateKey, err := util.GetPrivateKey()
+	return generateBoundJwtToken(appInsId, clientIp, "")
+}
+
+// Generate the token bound to the client certificate of the thumbprint, a token of an empty thumbprint is unbound
+func generateBoundJwtToken(appInsId string, clientIp string, certThumbprint string) (*string, error) {
+	jti, err := generateTokenId()
+	if err != nil {
+		return nil, err
+	}
+	services, scope, err := getTokenGrants(appInsId)
+	if err != nil {
+		return nil, err
+	}
+	generation, err := tokenGeneration(appInsId)
+	if err != nil {
+		return nil, err
+	}
+	kid, privateKey, err := util.GetJwtSigningKey()
 	if privateKey == nil || err != nil {
 		return nil, errors.New("failed to get private key")
 	}
@@ -127,16 +185,27 @@ func generateJwtToken(appInsId string, clientIp string) (*string, error) {
 		}
 		return nil, errors.New(msg)
 	}
+	now := time.Now()
 	claims := jwtClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: jwt.At(time.Now().Add(time.Hour * 1)),
+			ExpiresAt: jwt.At(now.Add(tokenLifetime)),
+			IssuedAt:  jwt.At(now),
 			Issuer:    mepAuthKey,
 			Subject:   appInsId,
+			ID:        jti,
 		},
-		ClientIp: clientIp,
+		ClientIp:   clientIp,
+		Scope:      scope,
+		Services:   services,
+		Generation: generation,
+	}
+	if certThumbprint != "" {
+		claims.Cnf = &models.TokenConfirmation{X5tS256: certThumbprint}
 	}
 
 	jwtToken := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+	// The api gateway selects the verification key by the key id
+	jwtToken.Header["kid"] = kid
 
 	token, err := jwtToken.SignedString(privateKey)
 	// Clear the private key
@@ -154,22 +223,18 @@ func generateJwtToken(appInsId string, clientIp string) (*string, error) {
 // Get app instance Id and Sk
 func getAppInsIdSk(ak string) (string, []byte, bool) {
 	//authInfoRecord, readErr := ReadDataFromFile(ak)
-	authInfoRecord := &models.AuthInfoRecord{
-		Ak: ak,
-	}
-	readErr := adapter.Db.ReadData(authInfoRecord, "ak")
-	if readErr != nil && readErr.Error() != util.PgOkMsg {
+	authInfoRecord, encodedSk, encodedNonce := readAuthInfoByAk(ak)
+	if authInfoRecord == nil {
 		log.Error("Auth info record does not exist")
 		return "", nil, false
 	}
-	encodedSk := []byte(authInfoRecord.Sk)
+
 	cipherSkBytes := make([]byte, hex.DecodedLen(len(encodedSk)), http.StatusOK)
 	_, errDecodeSk := hex.Decode(cipherSkBytes, encodedSk)
 	if errDecodeSk != nil {
 		log.Error("Decode of secret key failed")
 		return "", nil, true
 	}
-	encodedNonce := []byte(authInfoRecord.Nonce)
 	nonceBytes := make([]byte, hex.DecodedLen(len(encodedNonce)), 30)
 	_, errDecodeNonce := hex.Decode(nonceBytes, encodedNonce)
 	if errDecodeNonce != nil {
@@ -264,7 +329,8 @@ func (c *TokenController) isSignatureValid(ak string, sk []byte, signHeader stri
 	}
 
 	if !signIsValid {
-		processAkForBlockListing(ak)
+		auditSecurityEvent(auditSignatureFailure, auditFailure, clientIp, "", ak)
+		processAkForBlockListing(ak, clientIp)
 		c.writeErrorResponse("Invalid access or signature.", http.StatusUnauthorized)
 		c.logErrResponseMsgWithAk(clientIp, "Signature is invalid", ak)
 		return false
@@ -272,6 +338,29 @@ func (c *TokenController) isSignatureValid(ak string, sk []byte, signHeader stri
 	return true
 }
 
+// Get the services the app instance is permitted to call through the api gateway and the mp1 operation scopes
+// configured for it, an app instance without configured scope is granted none
+func getTokenGrants(appInsId string) ([]string, string, error) {
+	authInfoRecord := &models.AuthInfoRecord{
+		AppInsId: appInsId,
+	}
+	readErr := adapter.Db.ReadData(authInfoRecord, appInstanceID)
+	if readErr != nil && readErr.Error() != util.PgOkMsg {
+		log.Error("Auth info record does not exist")
+		return nil, "", readErr
+	}
+	services := make([]string, 0)
+	if len(authInfoRecord.RequiredServices) == 0 {
+		return services, authInfoRecord.Scope, nil
+	}
+	var requiredServices []string
+	if err := json.Unmarshal([]byte(authInfoRecord.RequiredServices), &requiredServices); err != nil {
+		log.Error("Required services of app instance " + appInsId + " are invalid")
+		return nil, "", err
+	}
+	return append(services, requiredServices...), authInfoRecord.Scope, nil
+}
+
 func (c *TokenController) getTokenInfo(appInsId string, ak string) *models.TokenInfo {
 	clientIp := c.Ctx.Request.Header.Get(xRealIp)
 	if clientIp == "" {
@@ -301,11 +390,12 @@ func (c *TokenController) checkAkExistAndWriteErrorRes(akExist bool) {
 	}
 }
 
-func (c *TokenController) sendResponseMsg(ak string, tokenInfo *models.TokenInfo, clientIp string) {
+func (c *TokenController) sendResponseMsg(appInsId string, ak string, tokenInfo *models.TokenInfo, clientIp string) {
 	c.Data["json"] = tokenInfo
 	c.ServeJSON()
 	bKey := *(*[]byte)(unsafe.Pointer(&tokenInfo.AccessToken))
 	util.ClearByteArray(bKey)
 	log.Info("Response message for ClientIP [" + clientIp + "] ClientAK [" + ak + "]" +
 		" operation [" + c.Ctx.Request.Method + "] resource [" + c.Ctx.Input.URL() + "] Result [Success]")
+	auditSecurityEvent(auditTokenIssued, auditSuccess, clientIp, appInsId, ak)
 }
@@ -118,7 +118,7 @@ func TestValidateSignature(t *testing.T) {
 			patches := ApplyFunc(isAkSignatureValid, func(_ *http.Request, _ []byte, _ string, _ string) (bool, error) {
 				return false, nil
 			})
-			patches.ApplyFunc(processAkForBlockListing, func(_ string) {
+			patches.ApplyFunc(processAkForBlockListing, func(_ string, _ string) {
 				return
 			})
 			defer patches.Reset()
@@ -335,8 +335,11 @@ func TestGenerateJwtToken(t *testing.T) {
 	}
 	Convey("generate jwt token", t, func() {
 		Convey("for success", func() {
-			patches := ApplyFunc(util.GetPrivateKey, func() (*rsa.PrivateKey, error) {
-				return priv, nil
+			patches := ApplyFunc(util.GetJwtSigningKey, func() (string, *rsa.PrivateKey, error) {
+				return "kid", priv, nil
+			})
+			patches.ApplyFunc(getTokenGrants, func(string) ([]string, string, error) {
+				return []string{}, "", nil
 			})
 			patches.ApplyMethod(reflect.TypeOf(token), "SignedString", func(_ *jwt.Token, _ interface{}, _ ...jwt.SigningOption) (string, error) {
 				return "token_content", nil
@@ -349,8 +352,11 @@ func TestGenerateJwtToken(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 		Convey("for fail", func() {
-			patches := ApplyFunc(util.GetPrivateKey, func() (*rsa.PrivateKey, error) {
-				return nil, errors.New("get private key fail")
+			patches := ApplyFunc(util.GetJwtSigningKey, func() (string, *rsa.PrivateKey, error) {
+				return "", nil, errors.New("get private key fail")
+			})
+			patches.ApplyFunc(getTokenGrants, func(string) ([]string, string, error) {
+				return []string{}, "", nil
 			})
 			defer patches.Reset()
 			token, err := generateJwtToken(appInsId, clientIp)
@@ -405,3 +411,41 @@ func TestPost(t *testing.T) {
 		})
 	})
 }
+
+func TestGetTokenGrants(t *testing.T) {
+	appInsId := "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+	adapter.Db = &adapter.PgDb{}
+	var pgdb *adapter.PgDb
+	Convey("get token grants", t, func() {
+		Convey("for success", func() {
+			patches := ApplyMethod(reflect.TypeOf(pgdb), "ReadData", func(_ *adapter.PgDb, data interface{}, _ ...string) error {
+				data.(*models.AuthInfoRecord).RequiredServices = `["service1","service2"]`
+				data.(*models.AuthInfoRecord).Scope = "services:read timing:read"
+				return nil
+			})
+			defer patches.Reset()
+			services, scope, err := getTokenGrants(appInsId)
+			So(err, ShouldBeNil)
+			So(services, ShouldResemble, []string{"service1", "service2"})
+			So(scope, ShouldEqual, "services:read timing:read")
+		})
+		Convey("for nothing configured", func() {
+			patches := ApplyMethod(reflect.TypeOf(pgdb), "ReadData", func(*adapter.PgDb, interface{}, ...string) error {
+				return nil
+			})
+			defer patches.Reset()
+			services, scope, err := getTokenGrants(appInsId)
+			So(err, ShouldBeNil)
+			So(services, ShouldBeEmpty)
+			So(scope, ShouldBeEmpty)
+		})
+		Convey("for fail", func() {
+			patches := ApplyMethod(reflect.TypeOf(pgdb), "ReadData", func(*adapter.PgDb, interface{}, ...string) error {
+				return errors.New("read data fail")
+			})
+			defer patches.Reset()
+			_, _, err := getTokenGrants(appInsId)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -73,6 +73,8 @@ func readPropertiesFile(filename string) (util.AppConfigProperties, error) {
 func main() {
 
 	adapter.InitDb()
+	// The jwt signing keys are shared by the mepauth instances through the database
+	controllers.InitJwtKeyStore()
 	configFilePath := filepath.FromSlash("/usr/mep/mprop/mepauth.properties")
 	appConfig, err := readPropertiesFile(configFilePath)
 	if err != nil {
@@ -110,8 +112,14 @@ func main() {
 		services := []byte("")
 		reqSer = &services
 	}
+	// The initial app is granted the optional scope, no mp1 operation without it
+	var scope *string
+	if scopeBytes, ok := appConfig["SCOPE"]; ok {
+		scopeStr := string(*scopeBytes)
+		scope = &scopeStr
+	}
 	err = controllers.ConfigureAkAndSk(string(*appConfig["APP_INST_ID"]),
-		string(*appConfig["ACCESS_KEY"]), appConfig["SECRET_KEY"], "initApp", string(*reqSer))
+		string(*appConfig["ACCESS_KEY"]), appConfig["SECRET_KEY"], "initApp", string(*reqSer), nil, scope)
 	if err != nil {
 		log.Error("Failed to configure ak sk values")
 		return
@@ -122,10 +130,28 @@ func main() {
 			log.Error("Failed to add TLS configuration for beego")
 			return
 		}
+		if util.GetAppConfig("client_cacert") != "" {
+			if err = util.EnableClientCertAuth(tlsConf, "client_cacert"); err != nil {
+				log.Error("Failed to add client certificate authentication for beego")
+				return
+			}
+			if util.GetAppConfig("apigw_client_cert") != "" {
+				if err = util.LoadApiGwClientCert("apigw_client_cert"); err != nil {
+					log.Error("Failed to load the client certificate of api gateway")
+					return
+				}
+			}
+		}
 		beego.BeeApp.Server.TLSConfig = tlsConf
 	}
 
+	controllers.InitAuditLog()
+	controllers.StartAuditEventPurge()
 	controllers.InitAuthInfoList()
+	controllers.StartAkBlockListPurge()
+	controllers.InitTokenRateLimit()
+	util.StartJwtKeyRotation()
+	controllers.StartTokenRevocationSync()
 	setSwaggerConfig()
 	beego.ErrorController(&controllers.ErrorController{})
 	beego.Run()
@@ -161,6 +187,10 @@ func doInitialization(trustedNetworks *[]byte) bool {
 	}
 
 	initializer := &apiGwInitializer{tlsConfig: config}
+	// The rotated jwt signing keys are published to the api gateway before they sign any token
+	util.SetJwtKeyPublisher(initializer)
+	// The revoked tokens are rejected by the api gateway
+	controllers.SetRevocationPublisher(initializer)
 
 	err = initializer.InitAPIGateway(trustedNetworks)
 	if err != nil {
@@ -65,6 +65,9 @@ func TestInitDb(t *testing.T) {
 			patch5 := gomonkey.ApplyMethod(reflect.TypeOf(pgdb), "InitOrmer", func(*adapter.PgDb) error {
 				return nil
 			})
+			patch5.ApplyMethod(reflect.TypeOf(pgdb), "MigrateSchema", func(*adapter.PgDb) error {
+				return nil
+			})
 
 			defer patch5.Reset()
 			adapter.InitDb()
@@ -222,7 +225,8 @@ func TestMainFunc(t *testing.T) {
 			patches.ApplyFunc(util.EncryptAndSaveJwtPwd, func(jwtPrivateKeyPwd *[]byte) error {
 				return nil
 			})
-			patches.ApplyFunc(controllers.ConfigureAkAndSk, func(appInsID string, ak string, sk *[]byte, appName string, requiredServices string) error {
+			patches.ApplyFunc(controllers.ConfigureAkAndSk, func(appInsID string, ak string, sk *[]byte, appName string, requiredServices string,
+				certSubject *string, scope *string) error {
 				return nil
 			})
 			patches.ApplyFunc(util.TLSConfig, func(crtName string) (*tls.Config, error) {
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package model contains mep auth data model
+package models
+
+import (
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(AuditEventRecord))
+}
+
+// AuditEvent security audit event of an authentication or of a configuration change
+type AuditEvent struct {
+	Time     string `json:"time"`
+	Event    string `json:"event"`
+	Outcome  string `json:"outcome"`
+	AppInsId string `json:"app_ins_id,omitempty"`
+	Ak       string `json:"ak,omitempty"`
+	ClientIp string `json:"client_ip,omitempty"`
+}
+
+// AuditEventRecord security audit event persisted to be queried from any mepauth instance, the records older than the
+// retention are purged
+type AuditEventRecord struct {
+	Id        string `orm:"pk" json:"id"`
+	CreatedAt int64  `orm:"index" json:"created_at"`
+	Event     string `json:"event"`
+	Outcome   string `json:"outcome"`
+	AppInsId  string `json:"app_ins_id"`
+	Ak        string `json:"ak"`
+	ClientIp  string `json:"client_ip"`
+}
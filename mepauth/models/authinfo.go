@@ -18,8 +18,6 @@
 package models
 
 import (
-	"time"
-
 	"github.com/astaxie/beego/orm"
 )
 
@@ -35,14 +33,15 @@ type AuthInfoRecord struct {
 	Nonce            string `json:"nonce"`
 	AppName          string `json:"app_name"`
 	RequiredServices string `json:"required_services"`
-}
-
-// AkSessionInfo AK session information data structure
-type AkSessionInfo struct {
-	ClearTimer      *time.Timer
-	State           string
-	Ak              string
-	ValidateCounter int64
+	// The credential pair replaced by the last rotation stays valid till PrevExpiresAt
+	PrevAk        string `json:"prev_ak"`
+	PrevSk        string `json:"prev_sk"`
+	PrevNonce     string `json:"prev_nonce"`
+	PrevExpiresAt int64  `json:"prev_expires_at"`
+	// Subject common name or SAN of the client certificate the app instance may also authenticate with
+	CertSubject string `json:"cert_subject"`
+	// Space separated mp1 operation scopes granted in the access tokens, none when empty
+	Scope string `json:"scope"`
 }
 
 // TokenInfo token information data structure
@@ -52,9 +51,39 @@ type TokenInfo struct {
 	ExpiresIn   uint32 `json:"expires_in"`
 }
 
+// OAuth2Error error response of the token endpoint as per RFC 6749 section 5.2
+type OAuth2Error struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Jwk public key of the token signature as per RFC 7517
+type Jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JwkSet public keys of the token signature, the tokens of a retired key are verified till they expire
+type JwkSet struct {
+	Keys []Jwk `json:"keys"`
+}
+
+// JwtKeyRotation jwt signing key rotation result
+type JwtKeyRotation struct {
+	Kid string `json:"kid"`
+}
+
 // AuthInfo authentication information data structure
 type AuthInfo struct {
 	Credentials Credentials `json:"credentials"`
+	// The stored subject is kept when not sent and cleared when sent empty
+	CertSubject *string `json:"certSubject,omitempty"`
+	// Space separated mp1 operation scopes granted to the app, kept when not sent and cleared when sent empty
+	Scope *string `json:"scope,omitempty"`
 }
 
 // Credentials data structure
@@ -63,6 +92,13 @@ type Credentials struct {
 	SecretKey   string `json:"secretKey"`
 }
 
+// CredentialRotation credential pair generated by a rotation, the secret key is returned only once
+type CredentialRotation struct {
+	Credentials         Credentials `json:"credentials"`
+	PreviousAccessKeyId string      `json:"previousAccessKeyId"`
+	PreviousExpiresAt   int64       `json:"previousExpiresAt"`
+}
+
 // AppAuthInfo application authentication information data structure
 type AppAuthInfo struct {
 	AuthInfo AuthInfo `json:"authInfo"`
@@ -0,0 +1,34 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package model contains mep auth data model
+package models
+
+import (
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(AkBlockListRecord))
+}
+
+// AkBlockListRecord failed authentications of an AK, the AK is block listed when they reach the threshold
+type AkBlockListRecord struct {
+	Ak            string `orm:"pk" json:"ak"`
+	FailureCount  int64  `json:"failure_count"`
+	ValidateUntil int64  `json:"validate_until"`
+	BlockedUntil  int64  `json:"blocked_until"`
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package model contains mep auth data model
+package models
+
+import (
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(JwtKeyRingRecord), new(JwtKeyRecord))
+}
+
+// JwtKeyRingRecord jwt signing keys shared by the mepauth instances, the version guards the concurrent rotations
+type JwtKeyRingRecord struct {
+	Id      string `orm:"pk" json:"id"`
+	Keys    string `orm:"type(text)" json:"keys"`
+	Version int64  `json:"version"`
+}
+
+// JwtKeyRecord private key of a rotated jwt signing key, encrypted by the work key
+type JwtKeyRecord struct {
+	Kid        string `orm:"pk" json:"kid"`
+	PrivateKey string `orm:"type(text)" json:"private_key"`
+	Nonce      string `json:"nonce"`
+}
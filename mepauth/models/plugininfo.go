@@ -30,3 +30,36 @@ type ConfigInfo struct {
 	Timeout      int    `json:"timeout"`
 	Keepalive    int    `json:"keepalive"`
 }
+
+// JwtCredential jwt credential of the api gateway consumer, the key matches the kid of the token
+type JwtCredential struct {
+	Key          string `json:"key"`
+	Algorithm    string `json:"algorithm"`
+	RsaPublicKey string `json:"rsa_public_key"`
+}
+
+// PluginList plugins of an api gateway service
+type PluginList struct {
+	Data []PluginInfo `json:"data"`
+	Next string       `json:"next"`
+}
+
+// PluginInfo api gateway plugin along with its configurations
+type PluginInfo struct {
+	Id     string                 `json:"id"`
+	Name   string                 `json:"name"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// TokenRevocations revoked tokens rejected by the appid-header plugin, the tokens keyed by jti along with their
+// expiry and the app instances along with the generation their tokens must reach
+type TokenRevocations struct {
+	RevokedTokens map[string]int64 `json:"revoked_tokens"`
+	RevokedApps   map[string]int64 `json:"revoked_apps"`
+}
+
+// ApiGwCertificate certificate along with its private key the api gateway connects to the upstream services with
+type ApiGwCertificate struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package model contains mep auth data model
+package models
+
+import (
+	"github.com/astaxie/beego/orm"
+)
+
+func init() {
+	orm.RegisterModel(new(RevokedTokenRecord), new(AppTokenRevocationRecord))
+}
+
+// RevokedTokenRecord token revoked by its client, the record is needed only till the token expires
+type RevokedTokenRecord struct {
+	Jti       string `orm:"pk" json:"jti"`
+	AppInsId  string `json:"app_ins_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// AppTokenRevocationRecord all the tokens of the app instance issued before the generation are revoked, the
+// generation is kept so that the tokens issued after the revocation stay valid
+type AppTokenRevocationRecord struct {
+	AppInsId   string `orm:"pk" json:"app_ins_id"`
+	RevokedAt  int64  `json:"revoked_at"`
+	Generation int64  `json:"generation"`
+}
+
+// TokenIntrospection token introspection response as per RFC 7662 section 2.2
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	// Certificate the token is bound to, as per RFC 8705 section 3.2
+	Cnf *TokenConfirmation `json:"cnf,omitempty"`
+}
+
+// TokenConfirmation confirmation of the client certificate a token is bound to as per RFC 8705 section 3.1
+type TokenConfirmation struct {
+	X5tS256 string `json:"x5t#S256"`
+}
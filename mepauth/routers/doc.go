@@ -23,8 +23,11 @@ import (
 )
 
 const (
-	confController  = "mepauth/controllers:ConfController"
-	tokenController = "mepauth/controllers:TokenController"
+	confController      = "mepauth/controllers:ConfController"
+	tokenController     = "mepauth/controllers:TokenController"
+	jwksController      = "mepauth/controllers:JwksController"
+	blockListController = "mepauth/controllers:BlockListController"
+	auditController     = "mepauth/controllers:AuditController"
 )
 
 const (
@@ -41,6 +44,13 @@ const (
 	AuthTokenPath              = rootPath + authTokenPrefix
 	AppManagePath              = rootPath + appManagePrefix
 	confControllerRoute        = appManagePrefix + "/applications/:applicationId/confs"
+	confRotateRoute            = confControllerRoute + "/rotate"
+	jwksRoute                  = authTokenPrefix + "/jwks"
+	revokeRoute                = authTokenPrefix + "/revoke"
+	introspectRoute            = authTokenPrefix + "/introspect"
+	jwksRotateRoute            = appManagePrefix + "/jwks/rotate"
+	blockListRoute             = appManagePrefix + "/blocklist"
+	auditRoute                 = appManagePrefix + "/audit"
 )
 
 func init() {
@@ -68,6 +78,14 @@ func init() {
 			MethodParams:     param.Make(),
 			Filters:          nil,
 			Params:           nil})
+	beego.GlobalControllerRouter[confController] = append(beego.GlobalControllerRouter[confController],
+		beego.ControllerComments{
+			Method:           "Rotate",
+			Router:           confRotateRoute,
+			AllowHTTPMethods: []string{post},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
 
 	beego.GlobalControllerRouter[tokenController] = append(beego.GlobalControllerRouter[tokenController],
 		beego.ControllerComments{
@@ -77,4 +95,63 @@ func init() {
 			MethodParams:     param.Make(),
 			Filters:          nil,
 			Params:           nil})
+	beego.GlobalControllerRouter[tokenController] = append(beego.GlobalControllerRouter[tokenController],
+		beego.ControllerComments{
+			Method:           "Revoke",
+			Router:           revokeRoute,
+			AllowHTTPMethods: []string{post},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+	beego.GlobalControllerRouter[tokenController] = append(beego.GlobalControllerRouter[tokenController],
+		beego.ControllerComments{
+			Method:           "Introspect",
+			Router:           introspectRoute,
+			AllowHTTPMethods: []string{post},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter[jwksController] = append(beego.GlobalControllerRouter[jwksController],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           jwksRoute,
+			AllowHTTPMethods: []string{get},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+	beego.GlobalControllerRouter[jwksController] = append(beego.GlobalControllerRouter[jwksController],
+		beego.ControllerComments{
+			Method:           "Rotate",
+			Router:           jwksRotateRoute,
+			AllowHTTPMethods: []string{post},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter[blockListController] = append(beego.GlobalControllerRouter[blockListController],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           blockListRoute,
+			AllowHTTPMethods: []string{get},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+	beego.GlobalControllerRouter[blockListController] = append(beego.GlobalControllerRouter[blockListController],
+		beego.ControllerComments{
+			Method:           "Delete",
+			Router:           blockListRoute,
+			AllowHTTPMethods: []string{deleteOp},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
+
+	beego.GlobalControllerRouter[auditController] = append(beego.GlobalControllerRouter[auditController],
+		beego.ControllerComments{
+			Method:           "Get",
+			Router:           auditRoute,
+			AllowHTTPMethods: []string{get},
+			MethodParams:     param.Make(),
+			Filters:          nil,
+			Params:           nil})
 }
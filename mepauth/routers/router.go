@@ -37,6 +37,9 @@ func init() {
 		beego.NSInclude(
 			&controllers.ConfController{},
 			&controllers.TokenController{},
+			&controllers.JwksController{},
+			&controllers.BlockListController{},
+			&controllers.AuditController{},
 		),
 	)
 	beego.AddNamespace(ns)
@@ -24,6 +24,8 @@ const (
 	// ak and sk is base64 string generated by mecm
 	akRegex                string = `^[\w+/=]{20}$`
 	skRegex                string = `^[\w+/=]{64}$`
+	certSubjectRegex       string = `^[\x21-\x7e]([\x20-\x7e]{0,254}[\x21-\x7e])?$`
+	scopeRegex             string = `^[a-z][a-z_]{0,63}:[a-z]{1,16}$`
 	AuthHeaderRegex        string = `^SDK-HMAC-SHA256 Access=([\w=+/]{20}), SignedHeaders=([^, ]{28}), Signature=([^, ]{64})$`
 	ValidationCounter      int64  = 3
 	ValidateListClearTimer int64  = 300
@@ -69,8 +71,30 @@ const (
 	PluginPath               string = "/plugins"
 	MepAppJwtName            string = "mepauth.jwt"
 	JwtPlugin                       = "jwt"
+	ClientCertPlugin                = "client-cert-header"
+	ClientCertHeader                = "X-Client-Cert"
 )
 
+// OAuth2 related constants
+const (
+	GrantTypeParam            = "grant_type"
+	ClientIdParam             = "client_id"
+	ClientSecretParam         = "client_secret"
+	GrantTypeClientCredential = "client_credentials"
+	FormUrlEncoded            = "application/x-www-form-urlencoded"
+	BasicAuthScheme           = "Basic"
+	ErrInvalidRequest         = "invalid_request"
+	ErrInvalidClient          = "invalid_client"
+	ErrUnsupportedGrantType   = "unsupported_grant_type"
+	ErrServerError            = "server_error"
+	ErrUnauthorizedClient     = "unauthorized_client"
+	ErrTemporarilyUnavailable = "temporarily_unavailable"
+	TokenParam                = "token"
+)
+
+// MaxScopeCount most scopes granted to an app, the scope names are defined by the mp1 operations of mepserver
+const MaxScopeCount = 32
+
 // Other
 const componentContent = "j7k0UwOJSsIfi3dzainoBdkcpJJJOJlzd2oBwMQxXdaZ3oCswITWUyLP4eldxdcKGmDvG1qwUEfQjAg71ZeFYyHgXa5OpBlmug3z06bs7ssr2XYTuPydK6y4K34UfsgRKEwMgGP1Ieo8x20lbjXcq0tJG4Q7xgakXs59NwnBeNg2N8R1FgfqD0z9weWgxd7DdJZkDpbJgdANT31y4KDeDCpJXld6XQOxi99mO2xQdMcH6OUyIfgDP7dPaJU57D33"
 const PgOkMsg string = "LastInsertId is not supported by this driver"
@@ -81,7 +105,9 @@ const ClientIpaddressInvalid = "clientIp address is invalid"
 
 // Failure messages
 const (
-	AppIDFailMsg = "Application Instance ID validation failed"
-	AkFailMsg    = "validate ak failed"
-	SkFailMsg    = "validate sk failed"
+	AppIDFailMsg       = "Application Instance ID validation failed"
+	AkFailMsg          = "validate ak failed"
+	SkFailMsg          = "validate sk failed"
+	CertSubjectFailMsg = "validate certificate subject failed"
+	ScopeFailMsg       = "validate scope failed"
 )
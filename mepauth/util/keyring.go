@@ -0,0 +1,423 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package util implements mep auth utility functions and contain constants
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego"
+	"github.com/dgrijalva/jwt-go/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const jwtKeyCheckInterval = time.Minute
+
+// JwtKeyInfo public information of a jwt signing key
+type JwtKeyInfo struct {
+	Kid         string `json:"kid"`
+	PublicKey   string `json:"publicKey"`
+	CreatedAt   int64  `json:"createdAt"`
+	RetireAt    int64  `json:"retireAt,omitempty"`
+	Provisioned bool   `json:"provisioned,omitempty"`
+}
+
+// JwtKeyPublisher publishes the jwt verification keys to the api gateway
+type JwtKeyPublisher interface {
+	PublishJwtKey(kid string, publicKey string) error
+	WithdrawJwtKey(kid string) error
+}
+
+// JwtKeyStore keeps the key ring and the rotated keys in the database shared by the mepauth instances
+type JwtKeyStore interface {
+	// LoadJwtKeyRing reads the key ring along with its version, no keys and version 0 if the ring is not created yet
+	LoadJwtKeyRing() ([]JwtKeyInfo, int64, error)
+	// SaveJwtKeyRing replaces the ring only if it is still at the version, version 0 creates it. Returns false if
+	// another instance changed the ring meanwhile
+	SaveJwtKeyRing(keys []JwtKeyInfo, version int64) (bool, error)
+	// SaveJwtKey stores the private key of a rotated key, encrypted by the work key
+	SaveJwtKey(kid string, encryptedKey []byte, nonce []byte) error
+	// ReadJwtKey reads the encrypted private key of a rotated key along with its nonce
+	ReadJwtKey(kid string) ([]byte, []byte, error)
+	// RemoveJwtKey removes the private key of a withdrawn key
+	RemoveJwtKey(kid string) error
+}
+
+// The first key signs the new tokens, the others are retired keys still accepted till their tokens expire. The ring
+// is read from the store on every use, a rotation is saved only if no other instance changed the ring meanwhile
+type jwtKeyRing struct {
+	mutex     sync.Mutex
+	publisher JwtKeyPublisher
+	store     JwtKeyStore
+}
+
+var keyRing = &jwtKeyRing{}
+
+// JwtKeyId generates the key id as the JWK thumbprint of RFC 7638
+func JwtKeyId(publicKey *rsa.PublicKey) string {
+	thumbprintInput := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, JwkExponent(publicKey),
+		JwkModulus(publicKey))
+	sum := sha256.Sum256([]byte(thumbprintInput))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JwkModulus encodes the modulus of the public key as per RFC 7518 section 6.3.1
+func JwkModulus(publicKey *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+}
+
+// JwkExponent encodes the exponent of the public key as per RFC 7518 section 6.3.1
+func JwkExponent(publicKey *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+}
+
+// SetJwtKeyPublisher sets the api gateway to publish the keys to, without it the keys are only served on jwks
+func SetJwtKeyPublisher(publisher JwtKeyPublisher) {
+	keyRing.mutex.Lock()
+	defer keyRing.mutex.Unlock()
+	keyRing.publisher = publisher
+}
+
+// SetJwtKeyStore sets the database the key ring is shared through
+func SetJwtKeyStore(store JwtKeyStore) {
+	keyRing.mutex.Lock()
+	defer keyRing.mutex.Unlock()
+	keyRing.store = store
+}
+
+// GetJwtKeys gets the keys to verify the tokens with, the signing key first
+func GetJwtKeys() ([]JwtKeyInfo, error) {
+	store, err := getJwtKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	keys, _, err := loadJwtKeyRing(store)
+	return keys, err
+}
+
+// GetJwtSigningKey gets the current signing key along with its key id, the caller must clear the key after use
+func GetJwtSigningKey() (string, *rsa.PrivateKey, error) {
+	store, err := getJwtKeyStore()
+	if err != nil {
+		return "", nil, err
+	}
+	keys, _, err := loadJwtKeyRing(store)
+	if err != nil {
+		return "", nil, err
+	}
+	current := keys[0]
+	if current.Provisioned {
+		privateKey, err := GetPrivateKey()
+		return current.Kid, privateKey, err
+	}
+	privateKey, err := readRotatedJwtKey(store, current.Kid)
+	return current.Kid, privateKey, err
+}
+
+// GetJwtVerificationKey gets the public key of a signing key which is not withdrawn yet
+func GetJwtVerificationKey(kid string) (*rsa.PublicKey, error) {
+	keys, err := GetJwtKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Kid == kid {
+			return jwt.ParseRSAPublicKeyFromPEM([]byte(key.PublicKey))
+		}
+	}
+	return nil, errors.New("jwt key is not found")
+}
+
+// RotateJwtKey generates a new signing key, the previous key is kept for the overlap window so that the tokens
+// already issued stay valid. The new key is published to the api gateway before any token is signed with it, the
+// rotation is aborted if another instance changed the key ring meanwhile
+func RotateJwtKey() (*JwtKeyInfo, error) {
+	store, err := getJwtKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	keys, version, err := loadJwtKeyRing(store)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := jwt.ParseRSAPublicKeyFromPEM([]byte(keys[0].PublicKey))
+	if err != nil {
+		log.Error("Failed to parse the current jwt public key")
+		return nil, errors.New("failed to parse the current jwt public key")
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, previous.N.BitLen())
+	if err != nil {
+		log.Error("Failed to generate jwt signing key")
+		return nil, errors.New("failed to generate jwt signing key")
+	}
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		clearPrivateKey(privateKey)
+		return nil, errors.New("failed to marshal jwt public key")
+	}
+	key := JwtKeyInfo{
+		Kid:       JwtKeyId(&privateKey.PublicKey),
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer})),
+		CreatedAt: time.Now().Unix(),
+	}
+	err = saveRotatedJwtKey(store, key.Kid, privateKey)
+	clearPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	publisher := getJwtKeyPublisher()
+	if publisher != nil {
+		if err = publisher.PublishJwtKey(key.Kid, key.PublicKey); err != nil {
+			log.Error("Failed to publish the new jwt key, rotation is aborted")
+			_ = store.RemoveJwtKey(key.Kid)
+			return nil, err
+		}
+	}
+
+	keys[0].RetireAt = time.Now().Add(jwtKeyOverlap()).Unix()
+	saved, err := store.SaveJwtKeyRing(append([]JwtKeyInfo{key}, keys...), version)
+	if err != nil {
+		log.Error("Failed to save jwt key ring, rotation is aborted")
+		return nil, err
+	}
+	if !saved {
+		log.Warn("Jwt key ring is changed by another instance, rotation is aborted")
+		if publisher != nil {
+			_ = publisher.WithdrawJwtKey(key.Kid)
+		}
+		_ = store.RemoveJwtKey(key.Kid)
+		return nil, errors.New("jwt key ring is changed concurrently")
+	}
+	log.Info("Jwt signing key rotated to " + key.Kid + ", previous key " + keys[0].Kid + " is retired")
+	return &key, nil
+}
+
+// StartJwtKeyRotation starts the scheduled rotation of the signing key and the withdrawal of the retired keys
+func StartJwtKeyRotation() {
+	go func() {
+		ticker := time.NewTicker(jwtKeyCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			checkJwtKeys()
+		}
+	}()
+}
+
+func checkJwtKeys() {
+	keys, err := GetJwtKeys()
+	if err != nil {
+		return
+	}
+	interval := jwtKeyRotationInterval()
+	if interval > 0 && time.Since(time.Unix(keys[0].CreatedAt, 0)) >= interval {
+		if _, err = RotateJwtKey(); err != nil {
+			log.Error("Scheduled rotation of jwt signing key failed, will be retried")
+		}
+	}
+	retireJwtKeys()
+}
+
+// Withdraw the retired keys once all the tokens signed by them are expired
+func retireJwtKeys() {
+	store, err := getJwtKeyStore()
+	if err != nil {
+		return
+	}
+	keys, version, err := loadJwtKeyRing(store)
+	if err != nil {
+		return
+	}
+	now := time.Now().Unix()
+	kept := []JwtKeyInfo{keys[0]}
+	var withdrawn []JwtKeyInfo
+	for _, key := range keys[1:] {
+		if key.RetireAt > now {
+			kept = append(kept, key)
+			continue
+		}
+		if publisher := getJwtKeyPublisher(); publisher != nil {
+			if err = publisher.WithdrawJwtKey(key.Kid); err != nil {
+				log.Error("Failed to withdraw the retired jwt key " + key.Kid + ", will be retried")
+				kept = append(kept, key)
+				continue
+			}
+		}
+		withdrawn = append(withdrawn, key)
+	}
+	if len(withdrawn) == 0 {
+		return
+	}
+
+	saved, err := store.SaveJwtKeyRing(kept, version)
+	if err != nil || !saved {
+		log.Warn("Jwt key ring is not saved, withdrawal of the retired keys will be retried")
+		return
+	}
+	for _, key := range withdrawn {
+		if !key.Provisioned {
+			_ = store.RemoveJwtKey(key.Kid)
+		}
+		log.Info("Retired jwt key " + key.Kid + " is withdrawn")
+	}
+}
+
+func getJwtKeyPublisher() JwtKeyPublisher {
+	keyRing.mutex.Lock()
+	defer keyRing.mutex.Unlock()
+	return keyRing.publisher
+}
+
+func getJwtKeyStore() (JwtKeyStore, error) {
+	keyRing.mutex.Lock()
+	defer keyRing.mutex.Unlock()
+	if keyRing.store == nil {
+		log.Error("Jwt key store is not set")
+		return nil, errors.New("jwt key store is not set")
+	}
+	return keyRing.store, nil
+}
+
+// Load the key ring along with its version, a fresh ring is started from the provisioned key
+func loadJwtKeyRing(store JwtKeyStore) ([]JwtKeyInfo, int64, error) {
+	keys, version, err := store.LoadJwtKeyRing()
+	if err != nil {
+		log.Error("Failed to read jwt key ring")
+		return nil, 0, err
+	}
+	if len(keys) != 0 {
+		return keys, version, nil
+	}
+
+	publicKeyPem, err := GetPublicKey()
+	if err != nil {
+		return nil, 0, err
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyPem)
+	if err != nil {
+		log.Error("Failed to parse jwt public key")
+		return nil, 0, errors.New("failed to parse jwt public key")
+	}
+	keys = []JwtKeyInfo{{
+		Kid:         JwtKeyId(publicKey),
+		PublicKey:   string(publicKeyPem),
+		CreatedAt:   time.Now().Unix(),
+		Provisioned: true,
+	}}
+	saved, err := store.SaveJwtKeyRing(keys, version)
+	if err != nil {
+		log.Error("Failed to save jwt key ring")
+		return nil, 0, err
+	}
+	if !saved {
+		// Started by another instance meanwhile
+		keys, version, err = store.LoadJwtKeyRing()
+		if err == nil && len(keys) == 0 {
+			err = errors.New("jwt key ring is empty")
+		}
+		return keys, version, err
+	}
+	return keys, version + 1, nil
+}
+
+// The rotated keys are saved encrypted by the work key
+func saveRotatedJwtKey(store JwtKeyStore, kid string, privateKey *rsa.PrivateKey) error {
+	nonce := make([]byte, NonceSize, 20)
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.New("failed to generate random jwt key nonce")
+	}
+	workKey, err := GetWorkKey()
+	if err != nil {
+		log.Error("Failed to get work key")
+		return err
+	}
+	keyData := x509.MarshalPKCS1PrivateKey(privateKey)
+	encryptedKey, err := EncryptByAES256GCM(keyData, workKey, nonce)
+	ClearByteArray(keyData)
+	ClearByteArray(workKey)
+	if err != nil {
+		return errors.New("failed to encrypt jwt signing key")
+	}
+
+	err = store.SaveJwtKey(kid, encryptedKey, nonce)
+	ClearByteArray(encryptedKey)
+	ClearByteArray(nonce)
+	if err != nil {
+		log.Error("Failed to save jwt signing key")
+		return errors.New("failed to save jwt signing key")
+	}
+	return nil
+}
+
+func readRotatedJwtKey(store JwtKeyStore, kid string) (*rsa.PrivateKey, error) {
+	encryptedKey, nonce, err := store.ReadJwtKey(kid)
+	if err != nil {
+		log.Error("Failed to read jwt signing key")
+		return nil, err
+	}
+	workKey, err := GetWorkKey()
+	if err != nil {
+		log.Error("Failed to get work key")
+		ClearByteArray(encryptedKey)
+		return nil, err
+	}
+	keyData, err := DecryptByAES256GCM(encryptedKey, workKey, nonce)
+	ClearByteArray(encryptedKey)
+	ClearByteArray(workKey)
+	if err != nil {
+		log.Error("Failed to decrypt jwt signing key")
+		return nil, errors.New("failed to decrypt jwt signing key")
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(keyData)
+	ClearByteArray(keyData)
+	if err != nil {
+		return nil, errors.New("failed to parse jwt signing key")
+	}
+	return privateKey, nil
+}
+
+func clearPrivateKey(privateKey *rsa.PrivateKey) {
+	privateKeyBits := privateKey.D.Bits()
+	for i := 0; i < len(privateKeyBits); i++ {
+		privateKeyBits[i] = 0
+	}
+}
+
+// Scheduled rotation interval, zero disables the scheduled rotation
+func jwtKeyRotationInterval() time.Duration {
+	return time.Duration(beego.AppConfig.DefaultInt64("jwt_key_rotation_interval", 0)) * time.Hour
+}
+
+// Overlap window of a retired key, never shorter than the validity of the tokens
+func jwtKeyOverlap() time.Duration {
+	overlap := beego.AppConfig.DefaultInt64("jwt_key_rotation_overlap", ExpiresVal)
+	if overlap < ExpiresVal {
+		overlap = ExpiresVal
+	}
+	return time.Duration(overlap) * time.Second
+}
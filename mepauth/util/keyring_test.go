@@ -0,0 +1,222 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mockJwtKeyPublisher struct {
+	published []string
+	withdrawn []string
+	err       error
+}
+
+func (p *mockJwtKeyPublisher) PublishJwtKey(kid string, _ string) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, kid)
+	return nil
+}
+
+func (p *mockJwtKeyPublisher) WithdrawJwtKey(kid string) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.withdrawn = append(p.withdrawn, kid)
+	return nil
+}
+
+// mockJwtKeyStore shared database of the mepauth instances
+type mockJwtKeyStore struct {
+	mutex      sync.Mutex
+	keys       []JwtKeyInfo
+	version    int64
+	privateKey map[string][]byte
+	nonce      map[string][]byte
+}
+
+func newMockJwtKeyStore() *mockJwtKeyStore {
+	return &mockJwtKeyStore{privateKey: make(map[string][]byte), nonce: make(map[string][]byte)}
+}
+
+func (s *mockJwtKeyStore) LoadJwtKeyRing() ([]JwtKeyInfo, int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]JwtKeyInfo(nil), s.keys...), s.version, nil
+}
+
+func (s *mockJwtKeyStore) SaveJwtKeyRing(keys []JwtKeyInfo, version int64) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.version != version {
+		return false, nil
+	}
+	s.keys = append([]JwtKeyInfo(nil), keys...)
+	s.version++
+	return true, nil
+}
+
+func (s *mockJwtKeyStore) SaveJwtKey(kid string, encryptedKey []byte, nonce []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.privateKey[kid] = append([]byte(nil), encryptedKey...)
+	s.nonce[kid] = append([]byte(nil), nonce...)
+	return nil
+}
+
+func (s *mockJwtKeyStore) ReadJwtKey(kid string) ([]byte, []byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	encryptedKey, ok := s.privateKey[kid]
+	if !ok {
+		return nil, nil, errors.New("jwt key is not found")
+	}
+	return append([]byte(nil), encryptedKey...), append([]byte(nil), s.nonce[kid]...), nil
+}
+
+func (s *mockJwtKeyStore) RemoveJwtKey(kid string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.privateKey, kid)
+	delete(s.nonce, kid)
+	return nil
+}
+
+func (s *mockJwtKeyStore) countJwtKeys() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.privateKey)
+}
+
+func TestJwtKeyRotation(t *testing.T) {
+	provisionedKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	publicKeyDer, _ := x509.MarshalPKIXPublicKey(&provisionedKey.PublicKey)
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDer})
+	patches := ApplyFunc(GetPublicKey, func() ([]byte, error) {
+		return publicKeyPem, nil
+	})
+	patches.ApplyFunc(GetPrivateKey, func() (*rsa.PrivateKey, error) {
+		return provisionedKey, nil
+	})
+	patches.ApplyFunc(GetWorkKey, func() ([]byte, error) {
+		// The work key is cleared after use
+		return make([]byte, 32), nil
+	})
+	defer patches.Reset()
+
+	publisher := &mockJwtKeyPublisher{}
+	store := newMockJwtKeyStore()
+	keyRing = &jwtKeyRing{}
+	SetJwtKeyPublisher(publisher)
+	SetJwtKeyStore(store)
+	defer func() { keyRing = &jwtKeyRing{} }()
+
+	Convey("jwt key rotation", t, func() {
+		Convey("starts with the provisioned key", func() {
+			kid, privateKey, err := GetJwtSigningKey()
+			So(err, ShouldBeNil)
+			So(kid, ShouldEqual, JwtKeyId(&provisionedKey.PublicKey))
+			So(privateKey, ShouldEqual, provisionedKey)
+		})
+
+		Convey("signs with the new key after rotation", func() {
+			provisionedKid := JwtKeyId(&provisionedKey.PublicKey)
+			rotated, err := RotateJwtKey()
+			So(err, ShouldBeNil)
+			So(publisher.published, ShouldResemble, []string{rotated.Kid})
+
+			kid, privateKey, err := GetJwtSigningKey()
+			So(err, ShouldBeNil)
+			So(kid, ShouldEqual, rotated.Kid)
+			So(JwtKeyId(&privateKey.PublicKey), ShouldEqual, rotated.Kid)
+
+			keys, _ := GetJwtKeys()
+			So(len(keys), ShouldEqual, 2)
+			So(keys[1].Kid, ShouldEqual, provisionedKid)
+			So(keys[1].RetireAt, ShouldBeGreaterThan, time.Now().Unix())
+
+			// The rotated key is shared with the other instances
+			keyRing = &jwtKeyRing{publisher: publisher, store: store}
+			keys, _ = GetJwtKeys()
+			So(keys[0].Kid, ShouldEqual, rotated.Kid)
+
+			Convey("withdraws the retired key after the overlap", func() {
+				retireJwtKeys()
+				So(publisher.withdrawn, ShouldBeEmpty)
+
+				keys, version, _ := store.LoadJwtKeyRing()
+				keys[1].RetireAt = time.Now().Add(-time.Second).Unix()
+				_, _ = store.SaveJwtKeyRing(keys, version)
+				retireJwtKeys()
+				So(publisher.withdrawn, ShouldResemble, []string{provisionedKid})
+				keys, _ = GetJwtKeys()
+				So(len(keys), ShouldEqual, 1)
+			})
+		})
+
+		Convey("keeps the signing key when publishing fails", func() {
+			keys, _ := GetJwtKeys()
+			count := store.countJwtKeys()
+			publisher.err = errors.New("api gateway error")
+			defer func() { publisher.err = nil }()
+			_, err := RotateJwtKey()
+			So(err, ShouldNotBeNil)
+
+			kid, _, _ := GetJwtSigningKey()
+			So(kid, ShouldEqual, keys[0].Kid)
+			So(store.countJwtKeys(), ShouldEqual, count)
+		})
+
+		Convey("rotates once when the instances rotate concurrently", func() {
+			keys, _ := GetJwtKeys()
+			count := store.countJwtKeys()
+			var wait sync.WaitGroup
+			results := make([]error, 4)
+			for i := range results {
+				wait.Add(1)
+				go func(i int) {
+					defer wait.Done()
+					_, results[i] = RotateJwtKey()
+				}(i)
+			}
+			wait.Wait()
+
+			rotated := 0
+			for _, err := range results {
+				if err == nil {
+					rotated++
+				}
+			}
+			So(rotated, ShouldBeGreaterThanOrEqualTo, 1)
+			newKeys, _ := GetJwtKeys()
+			So(len(newKeys), ShouldEqual, len(keys)+rotated)
+			So(store.countJwtKeys(), ShouldEqual, count+rotated)
+		})
+	})
+}
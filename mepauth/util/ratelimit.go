@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package util implements mep auth utility functions and contain constants
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+const rateLimitPruneInterval = time.Minute
+
+type tokenBucket struct {
+	tokens   float64
+	lastFill time.Time
+	limited  bool
+}
+
+// RateLimiter token bucket rate limiter keyed by the client, a nil limiter allows everything
+type RateLimiter struct {
+	mutex     sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+// NewRateLimiter creates a rate limiter of perMinute requests with a burst, nil when perMinute is not positive
+func NewRateLimiter(perMinute int64, burst int64) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:      float64(perMinute) / time.Minute.Seconds(),
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// Allow takes a token of the key, when none is left it returns the time till the next token and whether the key is
+// limited for the first time since it was last allowed
+func (l *RateLimiter) Allow(key string) (allowed bool, retryAfter time.Duration, lockedOut bool) {
+	if l == nil {
+		return true, 0, false
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, lastFill: now}
+		l.buckets[key] = bucket
+	}
+	l.fill(bucket, now)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.limited = false
+		return true, 0, false
+	}
+	lockedOut = !bucket.limited
+	bucket.limited = true
+	retryAfter = time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, retryAfter, lockedOut
+}
+
+func (l *RateLimiter) fill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens += now.Sub(bucket.lastFill).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.lastFill = now
+}
+
+// A full bucket is as good as none, removing them keeps the clients cycling the keys from growing the limiter
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < rateLimitPruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, bucket := range l.buckets {
+		l.fill(bucket, now)
+		if bucket.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
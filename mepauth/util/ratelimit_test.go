@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimiter(t *testing.T) {
+	Convey("rate limiter", t, func() {
+		Convey("allows the burst and limits the rest", func() {
+			limiter := NewRateLimiter(60, 2)
+			allowed, _, _ := limiter.Allow("key")
+			So(allowed, ShouldBeTrue)
+			allowed, _, _ = limiter.Allow("key")
+			So(allowed, ShouldBeTrue)
+
+			allowed, retryAfter, lockedOut := limiter.Allow("key")
+			So(allowed, ShouldBeFalse)
+			So(lockedOut, ShouldBeTrue)
+			So(retryAfter, ShouldBeGreaterThan, 0)
+			So(retryAfter, ShouldBeLessThanOrEqualTo, time.Second)
+
+			// The lockout is reported once
+			_, _, lockedOut = limiter.Allow("key")
+			So(lockedOut, ShouldBeFalse)
+
+			// The other keys have their own buckets
+			allowed, _, _ = limiter.Allow("other")
+			So(allowed, ShouldBeTrue)
+		})
+
+		Convey("refills the bucket over time", func() {
+			limiter := NewRateLimiter(60, 1)
+			limiter.Allow("key")
+			limiter.buckets["key"].lastFill = time.Now().Add(-time.Second)
+			allowed, _, _ := limiter.Allow("key")
+			So(allowed, ShouldBeTrue)
+		})
+
+		Convey("prunes the full buckets", func() {
+			limiter := NewRateLimiter(60, 1)
+			limiter.Allow("key")
+			limiter.buckets["key"].lastFill = time.Now().Add(-time.Minute)
+			limiter.lastPrune = time.Now().Add(-rateLimitPruneInterval)
+			limiter.Allow("other")
+			_, ok := limiter.buckets["key"]
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("allows everything when disabled", func() {
+			limiter := NewRateLimiter(0, 1)
+			So(limiter, ShouldBeNil)
+			allowed, _, _ := limiter.Allow("key")
+			So(allowed, ShouldBeTrue)
+		})
+	})
+}
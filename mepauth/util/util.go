@@ -58,6 +58,11 @@ const jwtPrivateKeyPwdNonceFilePath string = "jwt_private_key_nonce_pwd"
 type AppConfigProperties map[string]*[]byte
 
 var KeyComponentFromUserStr *[]byte
+
+// The CA certificates the client certificates are verified against, and the client certificate of the api gateway the
+// certificates it forwards are trusted on the connections of
+var clientCertPool *x509.CertPool
+var apiGwClientCert *x509.Certificate
 var cipherSuiteMap = map[string]uint16{
 	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
@@ -251,6 +256,78 @@ func TLSConfig(crtName string) (*tls.Config, error) {
 	}, nil
 }
 
+// EnableClientCertAuth requests the client certificates of the TLS configuration, they are verified against the CA
+// certificates in the file named by the caCertName configuration. The certificate is not required so that the
+// clients authenticating with their ak and sk are still served
+func EnableClientCertAuth(tlsConfig *tls.Config, caCertName string) error {
+	caCertConfig := GetAppConfig(caCertName)
+	if len(caCertConfig) == 0 {
+		log.Error("Client CA certificate name is not set")
+		return errors.New("client ca certificate name configuration is not set")
+	}
+
+	caCrt, err := ioutil.ReadFile(caCertConfig)
+	if err != nil {
+		log.Error("Unable to read client CA certificate file")
+		return err
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caCrt) {
+		log.Error("Failed to decode client CA certificate file")
+		return errors.New("failed to decode client ca certificate file")
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	clientCertPool = clientCAs
+	return nil
+}
+
+// LoadApiGwClientCert reads the client certificate the api gateway connects with from the file named by the certName
+// configuration, the api gateway terminates the TLS of the apps and forwards the certificates they presented
+func LoadApiGwClientCert(certName string) error {
+	certConfig := GetAppConfig(certName)
+	if len(certConfig) == 0 {
+		log.Error("Api gateway client certificate name is not set")
+		return errors.New("api gateway client certificate name configuration is not set")
+	}
+
+	certPem, err := ioutil.ReadFile(certConfig)
+	if err != nil {
+		log.Error("Unable to read api gateway client certificate file")
+		return err
+	}
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		log.Error("Failed to decode api gateway client certificate file")
+		return errors.New("failed to decode api gateway client certificate file")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		log.Error("Failed to parse api gateway client certificate")
+		return err
+	}
+	apiGwClientCert = cert
+	return nil
+}
+
+// IsApiGwClientCert checks whether the verified client certificate is the one the api gateway connects with
+func IsApiGwClientCert(cert *x509.Certificate) bool {
+	return apiGwClientCert != nil && cert.Equal(apiGwClientCert)
+}
+
+// VerifyClientCert verifies the client certificate forwarded by the api gateway against the client CA certificates
+func VerifyClientCert(cert *x509.Certificate) error {
+	if clientCertPool == nil {
+		return errors.New("client certificate authentication is not enabled")
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     clientCertPool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
 func getCipherSuites(sslCiphers string) []uint16 {
 	cipherSuiteArr := make([]uint16, 0, 5)
 	cipherSuiteNameList := strings.Split(sslCiphers, ",")
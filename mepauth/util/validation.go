@@ -24,6 +24,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"net"
 	"regexp"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -60,6 +61,30 @@ func ValidateSk(sk *[]byte) error {
 	return nil
 }
 
+// ValidateCertSubject validates the client certificate subject mapped to an app instance
+func ValidateCertSubject(subject string) error {
+	isMatch, errMatch := regexp.MatchString(certSubjectRegex, subject)
+	if errMatch != nil || !isMatch {
+		return errors.New(CertSubjectFailMsg)
+	}
+	return nil
+}
+
+// ValidateScope validates the space separated scopes granted to an app instance
+func ValidateScope(scope string) error {
+	scopes := strings.Fields(scope)
+	if len(scopes) > MaxScopeCount {
+		return errors.New(ScopeFailMsg)
+	}
+	for _, s := range scopes {
+		isMatch, errMatch := regexp.MatchString(scopeRegex, s)
+		if errMatch != nil || !isMatch {
+			return errors.New(ScopeFailMsg)
+		}
+	}
+	return nil
+}
+
 // Validate Server Name
 func validateServerName(serverName string) (bool, error) {
 	if len(serverName) > maxHostNameLen {
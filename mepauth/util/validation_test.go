@@ -17,6 +17,7 @@
 package util
 
 import (
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -48,6 +49,17 @@ func TestValidateSk(t *testing.T) {
 	})
 }
 
+func TestValidateCertSubject(t *testing.T) {
+	Convey("validate cert subject", t, func() {
+		So(ValidateCertSubject("mec-app-1"), ShouldBeNil)
+		So(ValidateCertSubject("spiffe://mec.example.com/mec app 1"), ShouldBeNil)
+		So(ValidateCertSubject(""), ShouldNotBeNil)
+		So(ValidateCertSubject("mec-app-1 "), ShouldNotBeNil)
+		So(ValidateCertSubject("mec-app\n1"), ShouldNotBeNil)
+		So(ValidateCertSubject(strings.Repeat("a", 257)), ShouldNotBeNil)
+	})
+}
+
 func TestValidateServerName(t *testing.T) {
 	Convey("validate server name", t, func() {
 		ok, err := validateServerName("edgegallery.org")
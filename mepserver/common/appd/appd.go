@@ -32,6 +32,41 @@ const DBFailure = "put app config rule to data-store failed"
 
 // AppDCommon appd common functions
 type AppDCommon struct {
+	// revision of the app config the conditional request was evaluated against, 0 if unconditional
+	configRevision int64
+}
+
+// AppDConfigETag strong e-tag of the app config representation
+func AppDConfigETag(appDConfig *models.AppDConfig) string {
+	appDConfigBytes, err := json.Marshal(appDConfig)
+	if err != nil {
+		return ""
+	}
+	return meputil.GenerateStrongETag(appDConfigBytes)
+}
+
+// CheckPreconditions evaluates the If-Match and If-None-Match headers against the stored app config, the revision
+// read is compared again when the task is staged so that a concurrent modification is rejected as well
+func (a *AppDCommon) CheckPreconditions(r *http.Request, appInstanceId string) (code workspace.ErrCode, msg string) {
+	if len(r.Header.Get(meputil.IfMatchHeader)) == 0 && len(r.Header.Get(meputil.IfNoneMatchHeader)) == 0 {
+		return 0, ""
+	}
+	record, revision, errCode := backend.GetRecordWithRevision(meputil.AppDConfigKeyPath + appInstanceId)
+	if errCode != 0 {
+		log.Errorf(nil, "App config (appId: %s) retrieval from data-store failed.", appInstanceId)
+		return workspace.ErrCode(errCode), "get app config rule from data-store failed"
+	}
+	appDInStore := &models.AppDConfig{}
+	if err := json.Unmarshal(record, appDInStore); err != nil {
+		log.Errorf(err, "Failed to parse the appd config from data-store.")
+		return meputil.OperateDataWithEtcdErr, "parsing app config rule from data-store failed"
+	}
+	if !meputil.CheckETagPreconditions(r, AppDConfigETag(appDInStore)) {
+		log.Warn("E-Tag miss-match.")
+		return meputil.EtagMissMatchErr, "e-tag miss-match"
+	}
+	a.configRevision = revision
+	return 0, ""
 }
 
 // IsAppInstanceAlreadyCreated checks the app instance already configured or not
@@ -110,21 +145,25 @@ func (a *AppDCommon) stageAppTerminationProgress(appInstanceId string, taskId st
 	return subscribed, false
 }
 
+// addJobsToDb adds the job and the task in one transaction, conditional on the app config revision of the
+// conditional request
 func (a *AppDCommon) addJobsToDb(appInstanceId string, taskId string, appDConfigBytes []byte) int {
-	// Add to Jobs DB
-	errCode := backend.PutRecord(meputil.AppDLCMJobsPath+appInstanceId, appDConfigBytes)
-	if errCode != 0 {
-		log.Errorf(nil, "App config (appId: %s) insertion on data-store failed.", appInstanceId)
+	var cmps []backend.Compare
+	if a.configRevision != 0 {
+		cmps = append(cmps, backend.RevisionCmp(meputil.AppDConfigKeyPath+appInstanceId, a.configRevision))
+	}
+	errCode := backend.ApplyTxn(cmps, []backend.Op{
+		backend.PutOp(meputil.AppDLCMJobsPath+appInstanceId, appDConfigBytes),
+		backend.PutOp(meputil.AppDLCMTasksPath+taskId, []byte(appInstanceId)),
+	})
+	if errCode == meputil.EtagMissMatchErr {
+		log.Warnf("App config (appId: %s) modified concurrently.", appInstanceId)
 		return errCode
 	}
-
-	errCode = backend.PutRecord(meputil.AppDLCMTasksPath+taskId, []byte(appInstanceId))
 	if errCode != 0 {
-		_ = backend.DeletePaths([]string{meputil.AppDLCMJobsPath + appInstanceId}, true)
-		log.Errorf(nil, "App config (taskId: %s) insertion on data-store failed.", appInstanceId)
+		log.Errorf(nil, "App config (appId: %s, taskId: %s) insertion on data-store failed.", appInstanceId, taskId)
 		return errCode
 	}
-
 	return 0
 }
 
@@ -158,8 +197,11 @@ func (a *AppDCommon) StageNewTask(appInstanceId string, taskId string,
 
 	var err error
 	var appDConfigBytes []byte
+	// The task id is kept with the job to resume the task after a restart
+	appDConfigInput.TaskId = taskId
 	if appDConfigInput.Operation == http.MethodDelete {
 		appDInStore.Operation = appDConfigInput.Operation
+		appDInStore.TaskId = taskId
 		appDConfigBytes, err = json.Marshal(appDInStore)
 
 		// App name is required to build the url for data-plane
@@ -174,6 +216,9 @@ func (a *AppDCommon) StageNewTask(appInstanceId string, taskId string,
 	}
 
 	errCode := a.addJobsToDb(appInstanceId, taskId, appDConfigBytes)
+	if errCode == meputil.EtagMissMatchErr {
+		return meputil.EtagMissMatchErr, "app config modified concurrently"
+	}
 	if errCode != 0 {
 		log.Errorf(nil, "Adding jobs to DB failed(%).", errCode)
 		return workspace.ErrCode(errCode), DBFailure
@@ -194,11 +239,17 @@ func (a *AppDCommon) StageNewTask(appInstanceId string, taskId string,
 		log.Errorf(nil, "Duplicate dns entry found in the request.")
 		return meputil.DuplicateOperation, "duplicate dns entry"
 	}
-	return a.writeStatusToStore(taskStatus, appInstanceId, taskId)
+	if code, msg = a.writeStatusToStore(taskStatus, appInstanceId, taskId); code != 0 {
+		return code, msg
+	}
+	a.pruneTaskHistory(appInstanceId, taskId)
+	return 0, ""
 }
 
 func (a *AppDCommon) writeStatusToStore(taskStatus *models.TaskStatus, appInstanceId string, taskId string) (code workspace.ErrCode, msg string) {
 
+	taskStatus.CreatedAt = meputil.CurrentTimeMillis()
+	taskStatus.UpdatedAt = taskStatus.CreatedAt
 	statusBytes, err := json.Marshal(taskStatus)
 	if err != nil {
 		_ = backend.DeletePaths([]string{meputil.AppDLCMJobsPath + appInstanceId, meputil.AppDLCMTasksPath + taskId},
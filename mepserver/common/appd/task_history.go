@@ -0,0 +1,156 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appd
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	meputil "mepserver/common/util"
+)
+
+// GenerateTaskProgress derives the result and the percentage of a task from its status
+func (a *AppDCommon) GenerateTaskProgress(taskId string, appInstanceId string,
+	taskStatus *models.TaskStatus) models.TaskProgress {
+	total := len(taskStatus.TrafficRuleStatusLst) + len(taskStatus.DNSRuleStatusLst)
+
+	var state string
+	progress := 100
+	if total != 0 {
+		progress = (taskStatus.Progress * 100) / total
+	}
+	if taskStatus.Progress == total {
+		state = meputil.TaskStateSuccess
+	} else if taskStatus.Progress >= 0 {
+		state = meputil.TaskStateProcessing
+	} else {
+		state = meputil.TaskStateFailure
+		progress = 0
+	}
+	return a.GenerateTaskResponse(taskId, appInstanceId, state, strconv.Itoa(progress), taskStatus.Details)
+}
+
+// IsTaskFinished checks the task either completed or failed
+func (a *AppDCommon) IsTaskFinished(taskStatus *models.TaskStatus) bool {
+	total := len(taskStatus.TrafficRuleStatusLst) + len(taskStatus.DNSRuleStatusLst)
+	return taskStatus.Progress == total || taskStatus.Progress == meputil.TaskProgressFailure
+}
+
+// IsTaskInProgress checks the task is the on-going operation of the app instance
+func (a *AppDCommon) IsTaskInProgress(appInstanceId string, taskId string, taskStatus *models.TaskStatus) bool {
+	if a.IsTaskFinished(taskStatus) {
+		return false
+	}
+	jobEntry, errCode := backend.GetRecord(meputil.AppDLCMJobsPath + appInstanceId)
+	if errCode != 0 {
+		return false
+	}
+	job := &models.AppDConfig{}
+	if err := json.Unmarshal(jobEntry, job); err != nil {
+		return false
+	}
+	return job.TaskId == taskId
+}
+
+// GetTaskStatus reads the app instance and the status of the task
+func (a *AppDCommon) GetTaskStatus(taskId string) (appInstanceId string, taskStatus *models.TaskStatus,
+	code workspace.ErrCode, msg string) {
+	taskEntry, errCode := backend.GetRecord(meputil.AppDLCMTasksPath + taskId)
+	if errCode != 0 {
+		log.Errorf(nil, "Get task rule from data-store failed.")
+		return "", nil, workspace.ErrCode(errCode), "task rule retrieval failed"
+	}
+	appInstanceId = string(taskEntry)
+
+	statusEntry, errCode := backend.GetRecord(meputil.AppDLCMTaskStatusPath + appInstanceId + "/" + taskId)
+	if errCode != 0 {
+		log.Errorf(nil, "Get task status rule from data-store failed.")
+		return "", nil, workspace.ErrCode(errCode), "task status rule retrieval failed"
+	}
+	taskStatus = &models.TaskStatus{}
+	if err := json.Unmarshal(statusEntry, taskStatus); err != nil {
+		log.Errorf(nil, "Failed to parse the task status from data-store.")
+		return "", nil, meputil.OperateDataWithEtcdErr, "parse task status from data-store failed"
+	}
+	return appInstanceId, taskStatus, 0, ""
+}
+
+// GetTaskHistory lists the tasks of the app instance, the latest first
+func (a *AppDCommon) GetTaskHistory(appInstanceId string) ([]models.TaskHistoryEntry, int) {
+	records, errCode := backend.GetRecords(meputil.AppDLCMTaskStatusPath + appInstanceId + "/")
+	if errCode != 0 {
+		log.Errorf(nil, "Get task history from data-store failed.")
+		return nil, errCode
+	}
+	history := make([]models.TaskHistoryEntry, 0, len(records))
+	for taskId, record := range records {
+		taskStatus := &models.TaskStatus{}
+		if err := json.Unmarshal(record, taskStatus); err != nil {
+			continue
+		}
+		history = append(history, models.TaskHistoryEntry{
+			TaskProgress: a.GenerateTaskProgress(taskId, appInstanceId, taskStatus),
+			CreatedAt:    taskStatus.CreatedAt,
+			UpdatedAt:    taskStatus.UpdatedAt,
+		})
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].CreatedAt != history[j].CreatedAt {
+			return history[i].CreatedAt > history[j].CreatedAt
+		}
+		return history[i].TaskId < history[j].TaskId
+	})
+	return history, 0
+}
+
+// pruneTaskHistory removes the finished tasks beyond the retention limits, the tasks in progress are kept
+func (a *AppDCommon) pruneTaskHistory(appInstanceId string, currentTaskId string) {
+	history, errCode := a.GetTaskHistory(appInstanceId)
+	if errCode != 0 {
+		return
+	}
+	retainedAfter := meputil.CurrentTimeMillis() - meputil.AppDTaskHistoryRetention.Milliseconds()
+	var paths []string
+	finished, pruned := 0, 0
+	for _, entry := range history {
+		if entry.TaskId == currentTaskId || entry.ConfigResult == meputil.TaskStateProcessing {
+			continue
+		}
+		finished++
+		// Tasks recorded without a time are only limited by count
+		if finished <= meputil.AppDTaskHistoryLimit && (entry.CreatedAt == 0 || entry.CreatedAt > retainedAfter) {
+			continue
+		}
+		pruned++
+		paths = append(paths,
+			meputil.AppDLCMTaskStatusPath+appInstanceId+"/"+entry.TaskId,
+			meputil.AppDLCMTasksPath+entry.TaskId,
+			meputil.AppDLCMFailedJobsPath+entry.TaskId,
+			meputil.AppDLCMTaskCancelPath+entry.TaskId)
+	}
+	if pruned == 0 {
+		return
+	}
+	log.Infof("Pruning %d tasks from the task history of app %s.", pruned, appInstanceId)
+	_ = backend.DeletePaths(paths, true)
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	meputil "mepserver/common/util"
+)
+
+// Claim ownership of a work item shared by the replicas, another replica may take it over once it expires
+type Claim struct {
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+var instanceId = newInstanceId()
+
+func newInstanceId() string {
+	hostName, err := os.Hostname()
+	if err != nil {
+		hostName = "mepserver"
+	}
+	return fmt.Sprintf("%s-%d", hostName, os.Getpid())
+}
+
+// InstanceId identifies this replica as the owner of the claims
+func InstanceId() string {
+	return instanceId
+}
+
+// GetClaim reads the claim on the key, nil if nobody holds it or the claim expired
+func GetClaim(key string) (*Claim, int64, int) {
+	kv, err := DB().Get(context.Background(), key)
+	if err != nil {
+		log.Errorf(nil, "Read claim from data-store failed.")
+		return nil, 0, meputil.OperateDataWithEtcdErr
+	}
+	if kv == nil {
+		return nil, 0, 0
+	}
+	claim := &Claim{}
+	if err = json.Unmarshal(kv.Value, claim); err != nil || claim.ExpiresAt <= meputil.CurrentTimeMillis() {
+		return nil, kv.Revision, 0
+	}
+	return claim, kv.Revision, 0
+}
+
+// AcquireClaim takes the claim on the key for the ttl, or renews it if this replica already holds it. The claim is
+// written conditionally on its modification revision so that only one of the competing replicas gets it. Returns the
+// revision of the held claim, false if another replica holds a live claim
+func AcquireClaim(key string, ttl time.Duration) (int64, bool, int) {
+	claim, revision, errCode := GetClaim(key)
+	if errCode != 0 {
+		return 0, false, errCode
+	}
+	if claim != nil && claim.Owner != instanceId {
+		return 0, false, 0
+	}
+	claimBytes, err := json.Marshal(&Claim{Owner: instanceId,
+		ExpiresAt: meputil.CurrentTimeMillis() + ttl.Milliseconds()})
+	if err != nil {
+		return 0, false, meputil.ParseInfoErr
+	}
+	errCode = ApplyTxn([]Compare{RevisionCmp(key, revision)}, []Op{PutOp(key, claimBytes)})
+	if errCode == meputil.EtagMissMatchErr {
+		return 0, false, 0
+	}
+	if errCode != 0 {
+		return 0, false, errCode
+	}
+	claim, revision, errCode = GetClaim(key)
+	if errCode != 0 || claim == nil || claim.Owner != instanceId {
+		return 0, false, errCode
+	}
+	return revision, true, 0
+}
+
+// ReleaseClaim deletes the claim unless it was taken over meanwhile
+func ReleaseClaim(key string, revision int64) {
+	if errCode := ApplyTxn([]Compare{RevisionCmp(key, revision)}, []Op{DeleteOp(key, false)}); errCode != 0 {
+		log.Warnf("Claim(%s) not released, it expires with its ttl.", key)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	meputil "mepserver/common/util"
+)
+
+const (
+	testClaimKey = "/claims/item1"
+	errorInClaim = "Error in claim"
+)
+
+func TestAcquireClaim(t *testing.T) {
+	defer SetDB(SetDB(NewMemoryDatastore()))
+
+	revision, claimed, errCode := AcquireClaim(testClaimKey, time.Minute)
+	assert.Equal(t, 0, errCode, errorInClaim)
+	assert.True(t, claimed, errorInClaim)
+
+	// Renewed by the owner
+	renewed, claimed, _ := AcquireClaim(testClaimKey, time.Minute)
+	assert.True(t, claimed, errorInClaim)
+	assert.Greater(t, renewed, revision, errorInClaim)
+
+	// Released only with the current revision
+	ReleaseClaim(testClaimKey, revision)
+	claim, _, _ := GetClaim(testClaimKey)
+	assert.Equal(t, InstanceId(), claim.Owner, errorInClaim)
+	ReleaseClaim(testClaimKey, renewed)
+	claim, _, _ = GetClaim(testClaimKey)
+	assert.Nil(t, claim, errorInClaim)
+}
+
+func TestAcquireClaimOfOtherReplica(t *testing.T) {
+	defer SetDB(SetDB(NewMemoryDatastore()))
+
+	other, _ := json.Marshal(&Claim{Owner: "other", ExpiresAt: meputil.CurrentTimeMillis() + 60000})
+	assert.Equal(t, 0, PutRecord(testClaimKey, other), errorInClaim)
+	_, claimed, errCode := AcquireClaim(testClaimKey, time.Minute)
+	assert.Equal(t, 0, errCode, errorInClaim)
+	assert.False(t, claimed, "Live claim of the other replica taken")
+
+	expired, _ := json.Marshal(&Claim{Owner: "other", ExpiresAt: meputil.CurrentTimeMillis() - 1})
+	assert.Equal(t, 0, PutRecord(testClaimKey, expired), errorInClaim)
+	_, claimed, _ = AcquireClaim(testClaimKey, time.Minute)
+	assert.True(t, claimed, "Expired claim not taken over")
+}
@@ -21,21 +21,143 @@ import (
 	"context"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
-	"github.com/apache/servicecomb-service-center/server/core/backend"
-	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 
 	meputil "mepserver/common/util"
 )
 
+// KeyValue a record along with its modification revision
+type KeyValue struct {
+	Key      string
+	Value    []byte
+	Revision int64
+}
+
+// MaxTxnOps most operations in one transaction, etcd rejects larger ones with its default --max-txn-ops
+const MaxTxnOps = 128
+
+// OpType type of a write operation in a transaction
+type OpType int
+
+const (
+	// OpPut writes the value on the key
+	OpPut OpType = iota
+	// OpDelete deletes the key, or all keys under it when Prefix is set
+	OpDelete
+)
+
+// Op a write operation in a transaction
+type Op struct {
+	Type   OpType
+	Key    string
+	Value  []byte
+	Prefix bool
+}
+
+// PutOp operation writing the value on the key
+func PutOp(key string, value []byte) Op {
+	return Op{Type: OpPut, Key: key, Value: value}
+}
+
+// DeleteOp operation deleting the key, or all keys under it when prefix is set
+func DeleteOp(key string, prefix bool) Op {
+	return Op{Type: OpDelete, Key: key, Prefix: prefix}
+}
+
+// Compare condition of a transaction, the key must still be at the given modification revision, revision 0 expects
+// the key not to exist
+type Compare struct {
+	Key      string
+	Revision int64
+}
+
+// RevisionCmp condition on the modification revision of the key
+func RevisionCmp(key string, revision int64) Compare {
+	return Compare{Key: key, Revision: revision}
+}
+
+// ListOptions pagination of a prefix listing, zero Limit lists all the records
+type ListOptions struct {
+	Limit    int64
+	Continue string
+}
+
+// ListResult one page of a prefix listing, Continue is empty on the last page. Count is the number of records from
+// the start of the page to the end of the prefix
+type ListResult struct {
+	Kvs      []*KeyValue
+	Continue string
+	Count    int64
+}
+
+// EventType type of a watched change
+type EventType int
+
+const (
+	// EventPut the key was created or modified
+	EventPut EventType = iota
+	// EventDelete the key was deleted
+	EventDelete
+)
+
+// WatchEvent a change on a watched key
+type WatchEvent struct {
+	Type EventType
+	Kv   *KeyValue
+}
+
+// Datastore key value store of the mep server records
+type Datastore interface {
+	// Get reads the record on the key, nil if it does not exist
+	Get(ctx context.Context, key string) (*KeyValue, error)
+	// List reads the records under the prefix in key order, one page at a time
+	List(ctx context.Context, prefix string, options ListOptions) (*ListResult, error)
+	// Txn applies all the operations atomically if all the compares hold, returns false otherwise
+	Txn(ctx context.Context, cmps []Compare, ops []Op) (bool, error)
+	// Watch calls onEvent for every change under the prefix until the context is done
+	Watch(ctx context.Context, prefix string, onEvent func(WatchEvent)) error
+}
+
+var (
+	db      Datastore = &EtcdDatastore{}
+	dbMutex sync.RWMutex
+)
+
+// DB the datastore used by the record functions
+func DB() Datastore {
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+	return db
+}
+
+// SetDB replaces the datastore and returns the previous one
+func SetDB(datastore Datastore) Datastore {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	previous := db
+	db = datastore
+	return previous
+}
+
+// prefixEnd smallest key greater than all the keys with the prefix
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	// All 0xff, no upper bound
+	return "\x00"
+}
+
 // GetRecord Read a single record from the data store on given path
 func GetRecord(path string) (record []byte, errorCode int) {
 	log.Debugf("DB: Read request: %v.", path)
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(path), registry.WithPrefix()),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	resp, err := DB().List(context.Background(), path, ListOptions{Limit: 1})
 	if err != nil {
 		log.Errorf(nil, "Get single entry from data-store failed.")
 		return nil, meputil.OperateDataWithEtcdErr
@@ -47,20 +169,32 @@ func GetRecord(path string) (record []byte, errorCode int) {
 	return resp.Kvs[0].Value, 0
 }
 
+// GetRecordWithRevision Read a single record along with its modification revision, used for the conditional updates
+func GetRecordWithRevision(path string) (record []byte, revision int64, errorCode int) {
+	log.Debugf("DB: Read request: %v.", path)
+	kv, err := DB().Get(context.Background(), path)
+	if err != nil {
+		log.Errorf(nil, "Get single entry from data-store failed.")
+		return nil, 0, meputil.OperateDataWithEtcdErr
+	}
+	if kv == nil {
+		log.Errorf(nil, "Record does not exists on given path.")
+		return nil, 0, meputil.SubscriptionNotFound
+	}
+	return kv.Value, kv.Revision, 0
+}
+
 // GetRecords Read multiple records on the given path
 func GetRecords(path string) (records map[string][]byte, errorCode int) {
 	log.Debugf("DB: Read requests: %v.", path)
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(path), registry.WithPrefix()),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	resp, err := DB().List(context.Background(), path, ListOptions{})
 	if err != nil {
 		log.Errorf(nil, "Get entries from data-store failed.")
 		return nil, meputil.OperateDataWithEtcdErr
 	}
 	resultList := make(map[string][]byte)
-	for _, kvs := range resp.Kvs {
-		resultList[filepath.Base(string(kvs.Key))] = kvs.Value
+	for _, kv := range resp.Kvs {
+		resultList[filepath.Base(kv.Key)] = kv.Value
 	}
 	return resultList, 0
 }
@@ -68,17 +202,14 @@ func GetRecords(path string) (records map[string][]byte, errorCode int) {
 // GetRecordsWithCompleteKeyPath Read multiple records on the given path
 func GetRecordsWithCompleteKeyPath(path string) (records map[string][]byte, errorCode int) {
 	log.Debugf("DB: Read requests: %v.", path)
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(path), registry.WithPrefix()),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	resp, err := DB().List(context.Background(), path, ListOptions{})
 	if err != nil {
 		log.Errorf(nil, "Get entries with path from data-store failed.")
 		return nil, meputil.OperateDataWithEtcdErr
 	}
 	resultList := make(map[string][]byte)
-	for _, kvs := range resp.Kvs {
-		resultList[string(kvs.Key)] = kvs.Value
+	for _, kv := range resp.Kvs {
+		resultList[kv.Key] = kv.Value
 	}
 	return resultList, 0
 }
@@ -86,10 +217,7 @@ func GetRecordsWithCompleteKeyPath(path string) (records map[string][]byte, erro
 // PutRecord Write new record to the given path
 func PutRecord(path string, value []byte) int {
 	log.Debugf("DB: Write request: %v.", path)
-	opts := []registry.PluginOp{
-		registry.OpPut(registry.WithStrKey(path), registry.WithValue(value)),
-	}
-	_, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	_, err := DB().Txn(context.Background(), nil, []Op{PutOp(path, value)})
 	if err != nil {
 		log.Errorf(nil, "Write to data-store failed.")
 		return meputil.OperateDataWithEtcdErr
@@ -97,13 +225,32 @@ func PutRecord(path string, value []byte) int {
 	return 0
 }
 
+// PutRecordIfRevision Write the record only if the record on cmpPath is still at the given modification revision,
+// revision 0 expects no record on cmpPath. Returns EtagMissMatchErr if it was modified meanwhile
+func PutRecordIfRevision(path string, value []byte, cmpPath string, revision int64) int {
+	log.Debugf("DB: Conditional write request: %v.", path)
+	return ApplyTxn([]Compare{RevisionCmp(cmpPath, revision)}, []Op{PutOp(path, value)})
+}
+
+// ApplyTxn Apply the write operations atomically if all the compares hold. Returns EtagMissMatchErr if any of the
+// compared records was modified meanwhile
+func ApplyTxn(cmps []Compare, ops []Op) int {
+	succeeded, err := DB().Txn(context.Background(), cmps, ops)
+	if err != nil {
+		log.Errorf(nil, "Transaction on data-store failed.")
+		return meputil.OperateDataWithEtcdErr
+	}
+	if !succeeded {
+		log.Warnf("Records modified concurrently, transaction rejected.")
+		return meputil.EtagMissMatchErr
+	}
+	return 0
+}
+
 // DeleteRecord Deletes a record on the given path
 func DeleteRecord(path string) int {
 	log.Debugf("DB: Delete request: %v.", path)
-	opts := []registry.PluginOp{
-		registry.OpDel(registry.WithStrKey(path), registry.WithPrefix()),
-	}
-	_, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	_, err := DB().Txn(context.Background(), nil, []Op{DeleteOp(path, true)})
 	if err != nil {
 		log.Errorf(nil, "Delete entries from data-store failed.")
 		return meputil.OperateDataWithEtcdErr
@@ -111,17 +258,38 @@ func DeleteRecord(path string) int {
 	return 0
 }
 
-// DeletePaths Delete the db entries one by one as per the input paths
+// DeletePaths Delete the db entries of all the input paths in transactions of at most MaxTxnOps paths, on failure the
+// entries of the failed transaction are deleted one by one if continueOnFailure is set
 func DeletePaths(paths []string, continueOnFailure bool) int {
+	for start := 0; start < len(paths); start += MaxTxnOps {
+		end := start + MaxTxnOps
+		if end > len(paths) {
+			end = len(paths)
+		}
+		if errCode := deletePathsInTxn(paths[start:end], continueOnFailure); errCode != 0 {
+			return errCode
+		}
+	}
+	return 0
+}
+
+func deletePathsInTxn(paths []string, continueOnFailure bool) int {
+	ops := make([]Op, 0, len(paths))
 	for _, pathEntry := range paths {
-		errCode := DeleteRecord(pathEntry)
-		if errCode != 0 {
+		ops = append(ops, DeleteOp(pathEntry, true))
+	}
+	_, err := DB().Txn(context.Background(), nil, ops)
+	if err == nil {
+		return 0
+	}
+	log.Errorf(nil, "Delete entries from data-store failed.")
+	if !continueOnFailure {
+		return meputil.OperateDataWithEtcdErr
+	}
+	for _, pathEntry := range paths {
+		if errCode := DeleteRecord(pathEntry); errCode != 0 {
 			log.Errorf(nil, "Cache(path: %s) delete from etcd failed, "+
 				"this might lead to data inconsistency.", strings.TrimPrefix(pathEntry, meputil.DBRootPath))
-			if continueOnFailure {
-				continue
-			}
-			return errCode
 		}
 	}
 	return 0
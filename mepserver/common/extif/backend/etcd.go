@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+
+	"github.com/apache/servicecomb-service-center/server/core/backend"
+	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+)
+
+// EtcdDatastore Datastore on the etcd of the service center registry
+type EtcdDatastore struct {
+}
+
+// Get reads the record on the key, nil if it does not exist
+func (e *EtcdDatastore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	opts := []registry.PluginOp{
+		registry.OpGet(registry.WithStrKey(key)),
+	}
+	resp, err := backend.Registry().TxnWithCmp(ctx, opts, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return toKeyValue(resp.Kvs[0]), nil
+}
+
+// List reads the records under the prefix in key order. A page reads one record past the limit from the range start
+// key, the extra record being where the next page continues
+func (e *EtcdDatastore) List(ctx context.Context, prefix string, options ListOptions) (*ListResult, error) {
+	opOptions := []registry.PluginOpOption{registry.GET, registry.WithAscendOrder()}
+	if len(options.Continue) == 0 {
+		opOptions = append(opOptions, registry.WithStrKey(prefix), registry.WithPrefix())
+	} else {
+		opOptions = append(opOptions, registry.WithStrKey(options.Continue), registry.WithStrEndKey(prefixEnd(prefix)))
+	}
+	if options.Limit > 0 {
+		// The offset of the extra record keeps the registry plugin on the first page of the range
+		opOptions = append(opOptions, registry.WithLimit(options.Limit+1), registry.WithOffset(options.Limit))
+	}
+	resp, err := backend.Registry().Do(ctx, opOptions...)
+	if err != nil {
+		return nil, err
+	}
+	result := &ListResult{Kvs: make([]*KeyValue, 0, len(resp.Kvs)), Count: resp.Count}
+	for _, kv := range resp.Kvs {
+		if options.Limit > 0 && int64(len(result.Kvs)) == options.Limit {
+			result.Continue = string(kv.Key)
+			break
+		}
+		result.Kvs = append(result.Kvs, toKeyValue(kv))
+	}
+	return result, nil
+}
+
+// Txn applies all the operations atomically if all the compares hold
+func (e *EtcdDatastore) Txn(ctx context.Context, cmps []Compare, ops []Op) (bool, error) {
+	pluginOps := make([]registry.PluginOp, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			pluginOps = append(pluginOps, registry.OpPut(registry.WithStrKey(op.Key), registry.WithValue(op.Value)))
+		case OpDelete:
+			opOptions := []registry.PluginOpOption{registry.WithStrKey(op.Key)}
+			if op.Prefix {
+				opOptions = append(opOptions, registry.WithPrefix())
+			}
+			pluginOps = append(pluginOps, registry.OpDel(opOptions...))
+		}
+	}
+	cmpOps := make([]registry.CompareOp, 0, len(cmps))
+	for _, cmp := range cmps {
+		cmpOps = append(cmpOps, registry.OpCmp(registry.CmpStrModRev(cmp.Key), registry.CMP_EQUAL, cmp.Revision))
+	}
+	resp, err := backend.Registry().TxnWithCmp(ctx, pluginOps, cmpOps, nil)
+	if err != nil {
+		return false, err
+	}
+	// An unconditional transaction always applies
+	return len(cmps) == 0 || resp.Succeeded, nil
+}
+
+// Watch calls onEvent for every change under the prefix until the context is done
+func (e *EtcdDatastore) Watch(ctx context.Context, prefix string, onEvent func(WatchEvent)) error {
+	return backend.Registry().Watch(ctx, registry.WithStrKey(prefix), registry.WithPrefix(),
+		registry.WithWatchCallback(func(message string, evt *registry.PluginResponse) error {
+			eventType := EventPut
+			if evt.Action == registry.Delete {
+				eventType = EventDelete
+			}
+			for _, kv := range evt.Kvs {
+				onEvent(WatchEvent{Type: eventType, Kv: toKeyValue(kv)})
+			}
+			return nil
+		}))
+}
+
+func toKeyValue(kv *mvccpb.KeyValue) *KeyValue {
+	return &KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision}
+}
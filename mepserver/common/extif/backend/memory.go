@@ -0,0 +1,193 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryDatastore in-memory Datastore with etcd like revisions, used to run the plans without etcd
+type MemoryDatastore struct {
+	mutex         sync.Mutex
+	records       map[string]*KeyValue
+	revision      int64
+	watchers      map[int]*memoryWatcher
+	nextWatcherId int
+}
+
+// memoryWatcher queues the events without bound so that a Txn never waits for a watcher, even one writing back to
+// the datastore from its callback
+type memoryWatcher struct {
+	prefix  string
+	mutex   sync.Mutex
+	pending []WatchEvent
+	notify  chan struct{}
+}
+
+// NewMemoryDatastore creates an empty in-memory datastore
+func NewMemoryDatastore() *MemoryDatastore {
+	return &MemoryDatastore{
+		records:  make(map[string]*KeyValue),
+		watchers: make(map[int]*memoryWatcher),
+	}
+}
+
+// Get reads the record on the key, nil if it does not exist
+func (m *MemoryDatastore) Get(ctx context.Context, key string) (*KeyValue, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	kv, ok := m.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return copyKeyValue(kv), nil
+}
+
+// List reads the records under the prefix in key order, one page at a time
+func (m *MemoryDatastore) List(ctx context.Context, prefix string, options ListOptions) (*ListResult, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0)
+	for key := range m.records {
+		if strings.HasPrefix(key, prefix) && key >= options.Continue {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := &ListResult{Kvs: make([]*KeyValue, 0, len(keys)), Count: int64(len(keys))}
+	for _, key := range keys {
+		if options.Limit > 0 && int64(len(result.Kvs)) == options.Limit {
+			result.Continue = key
+			break
+		}
+		result.Kvs = append(result.Kvs, copyKeyValue(m.records[key]))
+	}
+	return result, nil
+}
+
+// Txn applies all the operations atomically if all the compares hold, all the writes share one revision
+func (m *MemoryDatastore) Txn(ctx context.Context, cmps []Compare, ops []Op) (bool, error) {
+	m.mutex.Lock()
+	for _, cmp := range cmps {
+		var revision int64
+		if kv, ok := m.records[cmp.Key]; ok {
+			revision = kv.Revision
+		}
+		if revision != cmp.Revision {
+			m.mutex.Unlock()
+			return false, nil
+		}
+	}
+	m.revision++
+	var events []WatchEvent
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			value := make([]byte, len(op.Value))
+			copy(value, op.Value)
+			kv := &KeyValue{Key: op.Key, Value: value, Revision: m.revision}
+			m.records[op.Key] = kv
+			events = append(events, WatchEvent{Type: EventPut, Kv: copyKeyValue(kv)})
+		case OpDelete:
+			for key, kv := range m.records {
+				if key == op.Key || (op.Prefix && strings.HasPrefix(key, op.Key)) {
+					delete(m.records, key)
+					events = append(events, WatchEvent{Type: EventDelete,
+						Kv: &KeyValue{Key: key, Revision: m.revision, Value: kv.Value}})
+				}
+			}
+		}
+	}
+	watchers := make([]*memoryWatcher, 0, len(m.watchers))
+	for _, watcher := range m.watchers {
+		watchers = append(watchers, watcher)
+	}
+	m.mutex.Unlock()
+
+	// Delivered outside the lock, the watchers may write to the datastore
+	for _, watcher := range watchers {
+		watcher.send(events)
+	}
+	return true, nil
+}
+
+// Watch calls onEvent for every change under the prefix until the context is done
+func (m *MemoryDatastore) Watch(ctx context.Context, prefix string, onEvent func(WatchEvent)) error {
+	watcher := &memoryWatcher{
+		prefix: prefix,
+		notify: make(chan struct{}, 1),
+	}
+	m.mutex.Lock()
+	id := m.nextWatcherId
+	m.nextWatcherId++
+	m.watchers[id] = watcher
+	m.mutex.Unlock()
+
+	defer func() {
+		m.mutex.Lock()
+		delete(m.watchers, id)
+		m.mutex.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.notify:
+			for _, evt := range watcher.take() {
+				onEvent(evt)
+			}
+		}
+	}
+}
+
+// Revision current revision of the datastore
+func (m *MemoryDatastore) Revision() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.revision
+}
+
+func (w *memoryWatcher) send(events []WatchEvent) {
+	w.mutex.Lock()
+	for _, evt := range events {
+		if strings.HasPrefix(evt.Kv.Key, w.prefix) {
+			w.pending = append(w.pending, evt)
+		}
+	}
+	w.mutex.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) take() []WatchEvent {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	events := w.pending
+	w.pending = nil
+	return events
+}
+
+func copyKeyValue(kv *KeyValue) *KeyValue {
+	value := make([]byte, len(kv.Value))
+	copy(value, kv.Value)
+	return &KeyValue{Key: kv.Key, Value: value, Revision: kv.Revision}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	meputil "mepserver/common/util"
+)
+
+const errorInDatastore = "Error in memory datastore"
+
+var watchedEvents = make(chan WatchEvent, 10)
+
+func TestMemoryDatastoreList(t *testing.T) {
+	ctx := context.Background()
+	ds := NewMemoryDatastore()
+	for _, key := range []string{"/a/3", "/a/1", "/b/1", "/a/2"} {
+		_, err := ds.Txn(ctx, nil, []Op{PutOp(key, []byte(key))})
+		assert.NoError(t, err, errorInDatastore)
+	}
+
+	page, err := ds.List(ctx, "/a/", ListOptions{Limit: 2})
+	assert.NoError(t, err, errorInDatastore)
+	assert.Equal(t, 2, len(page.Kvs), errorInDatastore)
+	assert.Equal(t, "/a/1", page.Kvs[0].Key, errorInDatastore)
+	assert.Equal(t, "/a/2", page.Kvs[1].Key, errorInDatastore)
+	assert.Equal(t, "/a/3", page.Continue, errorInDatastore)
+
+	page, err = ds.List(ctx, "/a/", ListOptions{Limit: 2, Continue: page.Continue})
+	assert.NoError(t, err, errorInDatastore)
+	assert.Equal(t, 1, len(page.Kvs), errorInDatastore)
+	assert.Equal(t, "/a/3", page.Kvs[0].Key, errorInDatastore)
+	assert.Empty(t, page.Continue, errorInDatastore)
+
+	page, _ = ds.List(ctx, "/", ListOptions{})
+	assert.Equal(t, 4, len(page.Kvs), errorInDatastore)
+}
+
+func TestMemoryDatastoreTxn(t *testing.T) {
+	ctx := context.Background()
+	ds := NewMemoryDatastore()
+
+	// Create only if absent
+	ok, _ := ds.Txn(ctx, []Compare{RevisionCmp("/job", 0)},
+		[]Op{PutOp("/job", []byte("1")), PutOp("/task", []byte("1"))})
+	assert.True(t, ok, errorInDatastore)
+	ok, _ = ds.Txn(ctx, []Compare{RevisionCmp("/job", 0)}, []Op{PutOp("/job", []byte("2"))})
+	assert.False(t, ok, errorInDatastore)
+
+	job, _ := ds.Get(ctx, "/job")
+	task, _ := ds.Get(ctx, "/task")
+	assert.Equal(t, "1", string(job.Value), errorInDatastore)
+	assert.Equal(t, job.Revision, task.Revision, errorInDatastore)
+
+	// Compare and swap on the revision
+	ok, _ = ds.Txn(ctx, []Compare{RevisionCmp("/job", job.Revision)}, []Op{PutOp("/job", []byte("2"))})
+	assert.True(t, ok, errorInDatastore)
+	ok, _ = ds.Txn(ctx, []Compare{RevisionCmp("/job", job.Revision)}, []Op{DeleteOp("/job", false)})
+	assert.False(t, ok, errorInDatastore)
+	job, _ = ds.Get(ctx, "/job")
+	assert.Equal(t, "2", string(job.Value), errorInDatastore)
+
+	ok, _ = ds.Txn(ctx, nil, []Op{DeleteOp("/", true)})
+	assert.True(t, ok, errorInDatastore)
+	job, _ = ds.Get(ctx, "/job")
+	assert.Nil(t, job, errorInDatastore)
+}
+
+func TestMemoryDatastoreWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ds := NewMemoryDatastore()
+	done := make(chan struct{})
+	go func() {
+		_ = ds.Watch(ctx, "/watched/", func(evt WatchEvent) {
+			watchedEvents <- evt
+		})
+		close(done)
+	}()
+	// Wait for the watcher to register
+	for {
+		ds.mutex.Lock()
+		registered := len(ds.watchers) == 1
+		ds.mutex.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_, _ = ds.Txn(ctx, nil, []Op{PutOp("/other/1", []byte("1")), PutOp("/watched/1", []byte("1"))})
+	_, _ = ds.Txn(ctx, nil, []Op{DeleteOp("/watched/1", false)})
+	evt := <-watchedEvents
+	assert.Equal(t, EventPut, evt.Type, errorInDatastore)
+	assert.Equal(t, "/watched/1", evt.Kv.Key, errorInDatastore)
+	evt = <-watchedEvents
+	assert.Equal(t, EventDelete, evt.Type, errorInDatastore)
+
+	cancel()
+	<-done
+	assert.Empty(t, ds.watchers, errorInDatastore)
+}
+
+func TestRecordsOnMemoryDatastore(t *testing.T) {
+	previousDB := SetDB(NewMemoryDatastore())
+	defer SetDB(previousDB)
+
+	assert.Equal(t, 0, PutRecord("/appd/1", []byte("config")), errorInDatastore)
+	record, revision, errCode := GetRecordWithRevision("/appd/1")
+	assert.Equal(t, 0, errCode, errorInDatastore)
+	assert.Equal(t, "config", string(record), errorInDatastore)
+
+	assert.Equal(t, 0, PutRecordIfRevision("/jobs/1", []byte("job"), "/appd/1", revision), errorInDatastore)
+	assert.Equal(t, 0, PutRecord("/appd/1", []byte("modified")), errorInDatastore)
+	assert.Equal(t, meputil.EtagMissMatchErr, PutRecordIfRevision("/jobs/1", []byte("job"), "/appd/1", revision),
+		errorInDatastore)
+
+	records, errCode := GetRecords("/appd/")
+	assert.Equal(t, 0, errCode, errorInDatastore)
+	assert.Equal(t, 1, len(records), errorInDatastore)
+
+	assert.Equal(t, 0, DeletePaths([]string{"/appd/", "/jobs/"}, false), errorInDatastore)
+	_, errCode = GetRecord("/jobs/1")
+	assert.Equal(t, meputil.SubscriptionNotFound, errCode, errorInDatastore)
+}
+
+func TestMemoryDatastoreWatcherWritesBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ds := NewMemoryDatastore()
+	copied := make(chan struct{}, 1)
+	go func() {
+		_ = ds.Watch(ctx, "/watched/", func(evt WatchEvent) {
+			// Writing from the callback queues an event for this same watcher
+			if evt.Type == EventPut && !strings.HasPrefix(evt.Kv.Key, "/watched/copy/") {
+				_, _ = ds.Txn(ctx, nil, []Op{PutOp("/watched/copy/"+evt.Kv.Key, evt.Kv.Value)})
+				return
+			}
+			if evt.Kv.Key == "/watched/copy//watched/199" {
+				copied <- struct{}{}
+			}
+		})
+	}()
+	for {
+		ds.mutex.Lock()
+		registered := len(ds.watchers) == 1
+		ds.mutex.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 200; i++ {
+		_, err := ds.Txn(ctx, nil, []Op{PutOp("/watched/"+strconv.Itoa(i), []byte("1"))})
+		assert.NoError(t, err, errorInDatastore)
+	}
+	select {
+	case <-copied:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "watcher blocked writing back", errorInDatastore)
+	}
+}
+
+// txnCountingDatastore rejects the transactions larger than etcd accepts
+type txnCountingDatastore struct {
+	*MemoryDatastore
+	txns int
+}
+
+func (c *txnCountingDatastore) Txn(ctx context.Context, cmps []Compare, ops []Op) (bool, error) {
+	c.txns++
+	if len(ops) > MaxTxnOps {
+		return false, fmt.Errorf("too many operations in txn request")
+	}
+	return c.MemoryDatastore.Txn(ctx, cmps, ops)
+}
+
+func TestDeletePathsInBatches(t *testing.T) {
+	ds := &txnCountingDatastore{MemoryDatastore: NewMemoryDatastore()}
+	previousDB := SetDB(ds)
+	defer SetDB(previousDB)
+
+	paths := make([]string, 0, 2*MaxTxnOps+1)
+	for i := 0; i < 2*MaxTxnOps+1; i++ {
+		path := "/appd/" + strconv.Itoa(i)
+		assert.Equal(t, 0, PutRecord(path, []byte("config")), errorInDatastore)
+		paths = append(paths, path)
+	}
+	ds.txns = 0
+	assert.Equal(t, 0, DeletePaths(paths, false), errorInDatastore)
+	assert.Equal(t, 3, ds.txns, errorInDatastore)
+	records, _ := GetRecords("/appd/")
+	assert.Empty(t, records, errorInDatastore)
+}
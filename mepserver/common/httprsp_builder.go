@@ -43,6 +43,7 @@ type SendHttpRsp struct {
 	workspace.TaskBase
 	W          http.ResponseWriter `json:"w,in"`
 	HttpRsp    interface{}         `json:"httpRsp,in"`
+	Hijacked   bool                `json:"hijacked,in"`
 	StatusCode int
 }
 
@@ -83,6 +84,10 @@ func (t *SendHttpRsp) OnRequest(data string) workspace.TaskCode {
 	}
 	log.Infof(successEventLogFormat, util.GetClientIp(t.R), util.GetAppInstanceId(t.R), util.GetMethodFromReq(t.R),
 		util.GetHttpResourceInfo(t.R))
+	// connection taken over by the handler, e.g. upgraded to websocket
+	if t.Hijacked {
+		return workspace.TaskFinish
+	}
 	t.writeResponse(t.W, t.HttpErrInf, t.HttpRsp)
 	return workspace.TaskFinish
 }
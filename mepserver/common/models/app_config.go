@@ -30,6 +30,8 @@ type AppDConfig struct {
 	AppName        string                  `json:"appName" validate:"required,min=1,max=63"`
 	// Operation specifies the type of the request
 	Operation string `json:"operation,omitempty"` // For local use in the DB only
+	// TaskId of the sync task processing the job
+	TaskId string `json:"taskId,omitempty"` // For local use in the DB only
 }
 
 // TaskStatus hold the status of asynchronous sync task for app configuration
@@ -39,6 +41,8 @@ type TaskStatus struct {
 	DNSRuleStatusLst     []RuleStatus               `json:"dnsRuleStatusList"`
 	Details              string                     `json:"details" validate:"omitempty"`
 	TerminationStatus    meputil.AppTerminateStatus `json:"terminationStatus,omitempty"`
+	CreatedAt            int64                      `json:"createdAt,omitempty"`
+	UpdatedAt            int64                      `json:"updatedAt,omitempty"`
 }
 
 // RuleStatus holds status of either traffic or dns rules on sync from eg to data-plane
@@ -57,6 +61,13 @@ type TaskProgress struct {
 	Details       string `json:"Detailed"`
 }
 
+// TaskHistoryEntry holds the outcome of a sync task in the task history of an app, times are in milliseconds
+type TaskHistoryEntry struct {
+	TaskProgress
+	CreatedAt int64 `json:"createdAt"`
+	UpdatedAt int64 `json:"updatedAt"`
+}
+
 //Use ProblemDetails struct for Returning task fail immediate response
 /* type TaskFail struct {
 	Type     string   `json:"type"`
@@ -19,9 +19,11 @@ package models
 
 // AppTerminationNotificationSubscription represents a subscription to the notifications from the  MEC platform regarding the availability of a MEC service or a list of MEC services.
 type AppTerminationNotificationSubscription struct {
-	SubscriptionId    string `json:"subscriptionId,omitempty"`
-	SubscriptionType  string `json:"subscriptionType" validate:"required,oneof=AppTerminationNotificationSubscription SerAvailabilityNotificationSubscription"`
-	CallbackReference string `json:"callbackReference" validate:"required,uri"`
-	Links             Links  `json:"_links,omitempty" validate:"required"`
-	AppInstanceId     string `json:"appInstanceId" validate:"required,uuid"`
+	SubscriptionId     string              `json:"subscriptionId,omitempty"`
+	SubscriptionType   string              `json:"subscriptionType" validate:"required,oneof=AppTerminationNotificationSubscription SerAvailabilityNotificationSubscription"`
+	CallbackReference  string              `json:"callbackReference,omitempty" validate:"required_without=WebsockNotifConfig,omitempty,uri"`
+	WebsockNotifConfig *WebsockNotifConfig `json:"websockNotifConfig,omitempty"`
+	ExpiryDeadline     *TimeStamp          `json:"expiryDeadline,omitempty"`
+	Links              Links               `json:"_links,omitempty" validate:"required"`
+	AppInstanceId      string              `json:"appInstanceId" validate:"required,uuid"`
 }
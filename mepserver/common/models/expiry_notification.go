@@ -0,0 +1,26 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package models implements mep server object models
+package models
+
+// ExpiryNotification sent to the app before the subscription is removed on its expiry deadline
+type ExpiryNotification struct {
+	NotificationType string          `json:"notificationType"`
+	TimeStamp        TimeStamp       `json:"timeStamp"`
+	ExpiryDeadline   TimeStamp       `json:"expiryDeadline"`
+	Links            SerSubscription `json:"_links"`
+}
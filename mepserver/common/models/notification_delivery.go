@@ -0,0 +1,35 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package models implements mep server object models
+package models
+
+import "encoding/json"
+
+// NotificationDelivery represents an outbound notification waiting for delivery or failed permanently
+type NotificationDelivery struct {
+	DeliveryId        string          `json:"deliveryId"`
+	NotificationType  string          `json:"notificationType"`
+	AppInstanceId     string          `json:"appInstanceId"`
+	SubscriptionId    string          `json:"subscriptionId"`
+	CallbackReference string          `json:"callbackReference"`
+	Payload           json.RawMessage `json:"payload"`
+	Attempts          int             `json:"attempts"`
+	CreatedAt         int64           `json:"createdAt"`
+	NextAttemptAt     int64           `json:"nextAttemptAt,omitempty"`
+	FailedAt          int64           `json:"failedAt,omitempty"`
+	LastError         string          `json:"lastError,omitempty"`
+}
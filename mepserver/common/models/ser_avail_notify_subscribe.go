@@ -19,11 +19,26 @@ package models
 
 // SerAvailabilityNotificationSubscription represents a subscription to the notifications from the  MEC platform regarding the availability of a MEC service or a list of MEC services.
 type SerAvailabilityNotificationSubscription struct {
-	SubscriptionId    string            `json:"subscriptionId,omitempty"`
-	SubscriptionType  string            `json:"subscriptionType" validate:"required,oneof=AppTerminationNotificationSubscription SerAvailabilityNotificationSubscription"`
-	CallbackReference string            `json:"callbackReference" validate:"required,uri"`
-	Links             Links             `json:"_links" validate:"required"`
-	FilteringCriteria FilteringCriteria `json:"filteringCriteria,omitempty"`
+	SubscriptionId     string              `json:"subscriptionId,omitempty"`
+	SubscriptionType   string              `json:"subscriptionType" validate:"required,oneof=AppTerminationNotificationSubscription SerAvailabilityNotificationSubscription"`
+	CallbackReference  string              `json:"callbackReference,omitempty" validate:"required_without=WebsockNotifConfig,omitempty,uri"`
+	WebsockNotifConfig *WebsockNotifConfig `json:"websockNotifConfig,omitempty"`
+	ExpiryDeadline     *TimeStamp          `json:"expiryDeadline,omitempty"`
+	Links              Links               `json:"_links" validate:"required"`
+	FilteringCriteria  FilteringCriteria   `json:"filteringCriteria,omitempty"`
+}
+
+// WebsockNotifConfig negotiates the websocket used to deliver the notifications to the app instead of the callback
+// reference. The websocket uri is selected by the MEC platform when the app requests it.
+type WebsockNotifConfig struct {
+	WebsocketUri        string `json:"websocketUri,omitempty"`
+	RequestWebsocketUri bool   `json:"requestWebsocketUri,omitempty"`
+}
+
+// TestNotification sent over a newly connected websocket, the app echoes it back to complete the handshake
+type TestNotification struct {
+	NotificationType string          `json:"notificationType"`
+	Links            SerSubscription `json:"_links"`
 }
 
 type Links struct {
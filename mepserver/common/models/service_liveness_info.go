@@ -22,6 +22,7 @@ import (
 	"github.com/apache/servicecomb-service-center/server/core/proto"
 	meputil "mepserver/common/util"
 	"strconv"
+	"time"
 )
 
 // ServiceLivenessInfo represents the liveness request body
@@ -37,6 +38,11 @@ type TimeStamp struct {
 	Nanoseconds uint32 `json:"nanoSeconds"`
 }
 
+// Time converts the timestamp to time
+func (t *TimeStamp) Time() time.Time {
+	return time.Unix(int64(t.Seconds), int64(t.Nanoseconds))
+}
+
 // ServiceLivenessUpdate represents the liveness update body
 type ServiceLivenessUpdate struct {
 	State string `json:"state" validate:"required,oneof=ACTIVE"`
@@ -316,6 +316,7 @@ func (s *ServiceInfo) RegisterToApiGw(uri string, serviceName string, isUpdateRe
 	meputil.ApiGWInterface.AddOrUpdateApiGwRoute(serInfo)
 	if !isUpdateReq {
 		meputil.ApiGWInterface.EnableJwtPlugin(serInfo)
+		meputil.ApiGWInterface.EnableAppIdPlugin(serInfo)
 	}
 }
 
@@ -0,0 +1,447 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package notification implements the persistent outbound notification queue
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	meputil "mepserver/common/util"
+)
+
+// Sender delivers the notification payload to the callback reference of the subscription
+type Sender func(delivery *models.NotificationDelivery) error
+
+var (
+	senders      = make(map[string]Sender)
+	sendersMutex sync.RWMutex
+
+	wake         = make(chan struct{}, 1)
+	startOnce    sync.Once
+	processMutex sync.Mutex
+
+	seqMutex sync.Mutex
+	lastSeq  int64
+)
+
+// RegisterSender registers the sender for a notification type
+func RegisterSender(notificationType string, sender Sender) {
+	sendersMutex.Lock()
+	defer sendersMutex.Unlock()
+	senders[notificationType] = sender
+}
+
+// Start starts the background dispatcher, subsequent calls are ignored
+func Start() {
+	startOnce.Do(func() {
+		go dispatch()
+		go maintainWebsockets()
+	})
+}
+
+// Trigger wakes up the dispatcher to process the queue without waiting for the next interval
+func Trigger() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue persists the notification in the queue, notifications of a subscription are delivered in the order they
+// are queued
+func Enqueue(notificationType, appInstanceId, subscriptionId, callbackReference string, payload []byte) error {
+	delivery := newDelivery(notificationType, appInstanceId, subscriptionId, callbackReference, payload)
+	if err := putDelivery(queueKey(delivery), delivery); err != nil {
+		return err
+	}
+	log.Debugf("Notification(id: %s, type: %s) queued for subscription %s.", delivery.DeliveryId,
+		notificationType, subscriptionId)
+	Trigger()
+	return nil
+}
+
+// EnqueueIf persists the notification together with the given operations in one transaction conditional on the
+// comparisons, so that a notification recorded as sent by the operations is queued exactly once
+func EnqueueIf(cmps []backend.Compare, ops []backend.Op, notificationType, appInstanceId, subscriptionId,
+	callbackReference string, payload []byte) int {
+	delivery := newDelivery(notificationType, appInstanceId, subscriptionId, callbackReference, payload)
+	deliveryBytes, err := json.Marshal(delivery)
+	if err != nil {
+		return meputil.ParseInfoErr
+	}
+	ops = append(ops, backend.PutOp(queueKey(delivery), deliveryBytes))
+	if errCode := backend.ApplyTxn(cmps, ops); errCode != 0 {
+		return errCode
+	}
+	log.Debugf("Notification(id: %s, type: %s) queued for subscription %s.", delivery.DeliveryId,
+		notificationType, subscriptionId)
+	Trigger()
+	return 0
+}
+
+func newDelivery(notificationType, appInstanceId, subscriptionId, callbackReference string,
+	payload []byte) *models.NotificationDelivery {
+	now := meputil.CurrentTimeMillis()
+	return &models.NotificationDelivery{
+		DeliveryId:        meputil.GenerateUniqueId(),
+		NotificationType:  notificationType,
+		AppInstanceId:     appInstanceId,
+		SubscriptionId:    subscriptionId,
+		CallbackReference: callbackReference,
+		Payload:           payload,
+		CreatedAt:         now,
+		NextAttemptAt:     now,
+	}
+}
+
+func dispatch() {
+	interval := meputil.NotificationDispatchInterval
+	for {
+		select {
+		case <-time.After(interval):
+		case <-wake:
+		}
+		interval = nextDispatchInterval(interval, ProcessQueue())
+	}
+}
+
+// nextDispatchInterval polls at the base interval while notifications are queued, otherwise backs off
+func nextDispatchInterval(interval time.Duration, queued int) time.Duration {
+	if queued != 0 {
+		return meputil.NotificationDispatchInterval
+	}
+	interval *= 2
+	if interval > meputil.NotificationMaxDispatchInterval {
+		interval = meputil.NotificationMaxDispatchInterval
+	}
+	return interval
+}
+
+// ProcessQueue delivers all the due notifications and returns the number of notifications found queued.
+// Subscriptions are processed in parallel, each one only by the replica holding its claim. The notifications of a
+// websocket held by another replica are left to that replica
+func ProcessQueue() int {
+	processMutex.Lock()
+	defer processMutex.Unlock()
+
+	records, errCode := backend.GetRecordsWithCompleteKeyPath(meputil.NotificationQueuePath)
+	if errCode != 0 {
+		log.Errorf(nil, "Read notification queue failed.")
+		return 0
+	}
+	groups := make(map[string][]string)
+	for key := range records {
+		group := path.Dir(key)
+		groups[group] = append(groups[group], key)
+	}
+
+	var wg sync.WaitGroup
+	for group, keys := range groups {
+		sort.Strings(keys)
+		if !isDue(records[keys[0]]) || isWebsocketElsewhere(records[keys[0]]) {
+			continue
+		}
+		wg.Add(1)
+		go func(group string) {
+			defer wg.Done()
+			processSubscription(group)
+		}(group)
+	}
+	wg.Wait()
+	return len(records)
+}
+
+// isDue whether the first queued notification of a subscription is to be attempted now
+func isDue(record []byte) bool {
+	delivery := &models.NotificationDelivery{}
+	if err := json.Unmarshal(record, delivery); err != nil {
+		return true
+	}
+	return delivery.NextAttemptAt <= meputil.CurrentTimeMillis()
+}
+
+// isWebsocketElsewhere whether the notifications of a subscription go to a websocket held by another replica
+func isWebsocketElsewhere(record []byte) bool {
+	delivery := &models.NotificationDelivery{}
+	if err := json.Unmarshal(record, delivery); err != nil || len(delivery.CallbackReference) != 0 {
+		return false
+	}
+	websocketsMutex.RLock()
+	_, ok := websockets[delivery.SubscriptionId]
+	websocketsMutex.RUnlock()
+	if ok {
+		return false
+	}
+	owner := getWebsocketOwner(delivery.AppInstanceId, delivery.SubscriptionId)
+	return owner != nil && owner.Owner != backend.InstanceId()
+}
+
+// processSubscription claims the subscription and delivers its queued notifications in order, stops at the first one
+// waiting for a retry. The queue is read again once claimed, another replica may have delivered some meanwhile
+func processSubscription(group string) {
+	claimKey := meputil.NotificationClaimPath + strings.TrimPrefix(group, meputil.NotificationQueuePath)
+	revision, claimed, errCode := backend.AcquireClaim(claimKey, meputil.NotificationClaimTTL)
+	if errCode != 0 || !claimed {
+		return
+	}
+	defer func() {
+		backend.ReleaseClaim(claimKey, revision)
+	}()
+
+	records, errCode := backend.GetRecordsWithCompleteKeyPath(group + "/")
+	if errCode != 0 {
+		log.Errorf(nil, "Read notification queue failed.")
+		return
+	}
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		delivery := &models.NotificationDelivery{}
+		if err := json.Unmarshal(records[key], delivery); err != nil {
+			log.Errorf(nil, "Invalid notification in queue(%s), dropped.", key)
+			_ = backend.DeleteRecord(key)
+			continue
+		}
+		// Renewed before every attempt, so the claim outlives the slow deliveries
+		if revision, claimed, errCode = backend.AcquireClaim(claimKey, meputil.NotificationClaimTTL); errCode != 0 ||
+			!claimed {
+			log.Warnf("Notification claim of %s lost, delivery left to the other replica.", group)
+			return
+		}
+		if !deliver(key, delivery) {
+			return
+		}
+	}
+}
+
+// deliver returns true if the notification is completed, either delivered or moved to the dead letters. A
+// notification for a websocket held by another replica is left queued without counting an attempt
+func deliver(key string, delivery *models.NotificationDelivery) bool {
+	now := meputil.CurrentTimeMillis()
+	if delivery.NextAttemptAt > now {
+		return false
+	}
+
+	err := send(delivery)
+	if err == nil {
+		log.Infof("Notification(id: %s, type: %s) delivered to %s.", delivery.DeliveryId,
+			delivery.NotificationType, delivery.CallbackReference)
+		if errCode := backend.DeleteRecord(key); errCode != 0 {
+			log.Errorf(nil, "Delete delivered notification(%s) from queue failed.", delivery.DeliveryId)
+		}
+		return true
+	}
+	if err == errWebsocketElsewhere {
+		log.Debugf("Notification(id: %s, type: %s) left to the replica holding the websocket.", delivery.DeliveryId,
+			delivery.NotificationType)
+		return false
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= meputil.NotificationMaxAttempts {
+		log.Errorf(nil, "Notification(id: %s, type: %s) delivery failed after %d attempts, moved to dead letters.",
+			delivery.DeliveryId, delivery.NotificationType, delivery.Attempts)
+		moveToDeadLetters(key, delivery)
+		return true
+	}
+	delivery.NextAttemptAt = now + backoff(delivery.Attempts).Milliseconds()
+	log.Warnf("Notification(id: %s, type: %s) delivery attempt %d failed, retry later.", delivery.DeliveryId,
+		delivery.NotificationType, delivery.Attempts)
+	if err = putDelivery(key, delivery); err != nil {
+		log.Errorf(nil, "Update notification(%s) retry state failed.", delivery.DeliveryId)
+	}
+	return false
+}
+
+// send delivers the notification with the sender of its type, notifications without callback reference are for the
+// subscriptions which requested a websocket
+func send(delivery *models.NotificationDelivery) error {
+	if len(delivery.CallbackReference) == 0 {
+		return sendWebsocket(delivery)
+	}
+	sendersMutex.RLock()
+	sender, ok := senders[delivery.NotificationType]
+	sendersMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("no sender for notification type %s", delivery.NotificationType)
+	}
+	return sender(delivery)
+}
+
+// backoff exponential retry delay after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := meputil.NotificationBaseBackoff << uint(attempts-1)
+	if delay <= 0 || delay > meputil.NotificationMaxBackoff {
+		delay = meputil.NotificationMaxBackoff
+	}
+	return delay
+}
+
+// moveToDeadLetters moves the notification in one transaction, it is neither lost nor delivered again
+func moveToDeadLetters(key string, delivery *models.NotificationDelivery) {
+	delivery.FailedAt = meputil.CurrentTimeMillis()
+	delivery.NextAttemptAt = 0
+	deliveryBytes, err := json.Marshal(delivery)
+	if err != nil {
+		log.Errorf(nil, "Marshal notification(%s) failed.", delivery.DeliveryId)
+		return
+	}
+	if errCode := backend.ApplyTxn(nil, []backend.Op{
+		backend.PutOp(meputil.NotificationDeadLetterPath+delivery.DeliveryId, deliveryBytes),
+		backend.DeleteOp(key, false),
+	}); errCode != 0 {
+		log.Errorf(nil, "Move failed notification(%s) to dead letters failed.", delivery.DeliveryId)
+	}
+}
+
+// GetDeadLetters returns all the notifications which failed permanently
+func GetDeadLetters() ([]*models.NotificationDelivery, int) {
+	records, errCode := backend.GetRecords(meputil.NotificationDeadLetterPath)
+	if errCode != 0 {
+		return nil, errCode
+	}
+	deliveries := make([]*models.NotificationDelivery, 0, len(records))
+	for _, record := range records {
+		delivery := &models.NotificationDelivery{}
+		if err := json.Unmarshal(record, delivery); err != nil {
+			log.Warn("Invalid dead letter notification, ignored.")
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].FailedAt < deliveries[j].FailedAt
+	})
+	return deliveries, 0
+}
+
+// GetDeadLetter returns a notification which failed permanently
+func GetDeadLetter(deliveryId string) (*models.NotificationDelivery, int) {
+	delivery, _, errCode := getDeadLetter(deliveryId)
+	return delivery, errCode
+}
+
+func getDeadLetter(deliveryId string) (*models.NotificationDelivery, int64, int) {
+	record, revision, errCode := backend.GetRecordWithRevision(meputil.NotificationDeadLetterPath + deliveryId)
+	if errCode != 0 {
+		return nil, 0, errCode
+	}
+	delivery := &models.NotificationDelivery{}
+	if err := json.Unmarshal(record, delivery); err != nil {
+		log.Errorf(nil, "Parse dead letter notification(%s) failed.", deliveryId)
+		return nil, 0, meputil.ParseInfoErr
+	}
+	return delivery, revision, 0
+}
+
+// ReplayDeadLetter moves the failed notification back to the queue with a fresh retry budget, the move is
+// conditional on the dead letter so that concurrent replays queue it only once
+func ReplayDeadLetter(deliveryId string) (*models.NotificationDelivery, int) {
+	delivery, revision, errCode := getDeadLetter(deliveryId)
+	if errCode != 0 {
+		return nil, errCode
+	}
+	delivery.Attempts = 0
+	delivery.FailedAt = 0
+	delivery.NextAttemptAt = meputil.CurrentTimeMillis()
+	deliveryBytes, err := json.Marshal(delivery)
+	if err != nil {
+		return nil, meputil.ParseInfoErr
+	}
+	key := meputil.NotificationDeadLetterPath + deliveryId
+	errCode = backend.ApplyTxn([]backend.Compare{backend.RevisionCmp(key, revision)}, []backend.Op{
+		backend.PutOp(queueKey(delivery), deliveryBytes),
+		backend.DeleteOp(key, false),
+	})
+	if errCode != 0 {
+		log.Errorf(nil, "Replay notification(%s) from dead letters failed.", deliveryId)
+		return nil, errCode
+	}
+	log.Infof("Notification(id: %s, type: %s) replayed.", deliveryId, delivery.NotificationType)
+	Trigger()
+	return delivery, 0
+}
+
+// DeleteDeadLetter discards a notification which failed permanently
+func DeleteDeadLetter(deliveryId string) int {
+	if _, errCode := backend.GetRecord(meputil.NotificationDeadLetterPath + deliveryId); errCode != 0 {
+		return errCode
+	}
+	return backend.DeleteRecord(meputil.NotificationDeadLetterPath + deliveryId)
+}
+
+// PurgeSubscription discards the queued and dead letter notifications of a removed subscription, all the
+// subscriptions of the app are purged if the subscription id is empty
+func PurgeSubscription(appInstanceId, subscriptionId string) int {
+	queuePrefix := meputil.NotificationQueuePath + appInstanceId + "/"
+	if len(subscriptionId) != 0 {
+		queuePrefix += subscriptionId + "/"
+	}
+	deadLetters, errCode := GetDeadLetters()
+	if errCode != 0 {
+		return errCode
+	}
+	paths := []string{queuePrefix}
+	for _, delivery := range deadLetters {
+		if delivery.AppInstanceId == appInstanceId &&
+			(len(subscriptionId) == 0 || delivery.SubscriptionId == subscriptionId) {
+			paths = append(paths, meputil.NotificationDeadLetterPath+delivery.DeliveryId)
+		}
+	}
+	return backend.DeletePaths(paths, true)
+}
+
+func putDelivery(key string, delivery *models.NotificationDelivery) error {
+	deliveryBytes, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("marshal notification failed")
+	}
+	if errCode := backend.PutRecord(key, deliveryBytes); errCode != 0 {
+		return fmt.Errorf("write notification to data-store failed(%d)", errCode)
+	}
+	return nil
+}
+
+// queueKey generates the queue key, the fixed width sequence keeps the order within a subscription
+func queueKey(delivery *models.NotificationDelivery) string {
+	seqMutex.Lock()
+	seq := time.Now().UnixNano()
+	if seq <= lastSeq {
+		seq = lastSeq + 1
+	}
+	lastSeq = seq
+	seqMutex.Unlock()
+	return fmt.Sprintf("%s%s/%s/%020d", meputil.NotificationQueuePath, delivery.AppInstanceId,
+		delivery.SubscriptionId, seq)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	meputil "mepserver/common/util"
+)
+
+const (
+	testType      = "TestNotification"
+	testAppInstId = "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+	testSubId     = "05ec8ba0-c6d6-4ead-9c1a-1ab5b0aefa8c"
+	testCallback  = "http://127.0.0.1:8080/callback"
+	errorInQueue  = "Error in notification queue"
+)
+
+var (
+	sendMutex sync.Mutex
+	delivered []string
+	failSend  bool
+)
+
+// useMemoryDatastore runs the queue on an in-memory datastore, returns the restore function
+func useMemoryDatastore() func() {
+	delivered = nil
+	failSend = false
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	RegisterSender(testType, func(delivery *models.NotificationDelivery) error {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		if failSend {
+			return fmt.Errorf("connection refused")
+		}
+		delivered = append(delivered, string(delivery.Payload))
+		return nil
+	})
+	return func() {
+		backend.SetDB(previousDB)
+	}
+}
+
+func countKeys(prefix string) int {
+	records, _ := backend.GetRecordsWithCompleteKeyPath(prefix)
+	return len(records)
+}
+
+// expireRetries makes all the queued notifications due for delivery
+func expireRetries(t *testing.T) {
+	records, _ := backend.GetRecordsWithCompleteKeyPath(meputil.NotificationQueuePath)
+	for key := range records {
+		delivery := &models.NotificationDelivery{}
+		_ = json.Unmarshal(records[key], delivery)
+		delivery.NextAttemptAt = 0
+		assert.NoError(t, putDelivery(key, delivery), errorInQueue)
+	}
+}
+
+func TestNotificationQueueOrder(t *testing.T) {
+	defer useMemoryDatastore()()
+
+	for _, payload := range []string{`{"seq":1}`, `{"seq":2}`, `{"seq":3}`} {
+		assert.NoError(t, Enqueue(testType, testAppInstId, testSubId, testCallback, []byte(payload)), errorInQueue)
+	}
+	assert.Equal(t, 3, countKeys(meputil.NotificationQueuePath), errorInQueue)
+
+	ProcessQueue()
+	assert.Equal(t, []string{`{"seq":1}`, `{"seq":2}`, `{"seq":3}`}, delivered, errorInQueue)
+	assert.Equal(t, 0, countKeys(meputil.NotificationQueuePath), errorInQueue)
+}
+
+func TestNotificationQueueRetry(t *testing.T) {
+	defer useMemoryDatastore()()
+
+	failSend = true
+	assert.NoError(t, Enqueue(testType, testAppInstId, testSubId, testCallback, []byte(`{"seq":1}`)), errorInQueue)
+	assert.NoError(t, Enqueue(testType, testAppInstId, testSubId, testCallback, []byte(`{"seq":2}`)), errorInQueue)
+
+	// Failed notification blocks the later ones of the same subscription until the retry
+	ProcessQueue()
+	failSend = false
+	ProcessQueue()
+	assert.Empty(t, delivered, errorInQueue)
+	assert.Equal(t, 2, countKeys(meputil.NotificationQueuePath), errorInQueue)
+
+	expireRetries(t)
+	ProcessQueue()
+	assert.Equal(t, []string{`{"seq":1}`, `{"seq":2}`}, delivered, errorInQueue)
+	assert.Equal(t, 0, countKeys(meputil.NotificationQueuePath), errorInQueue)
+}
+
+func TestNotificationDeadLetters(t *testing.T) {
+	defer useMemoryDatastore()()
+
+	failSend = true
+	assert.NoError(t, Enqueue(testType, testAppInstId, testSubId, testCallback, []byte(`{"seq":1}`)), errorInQueue)
+	for i := 0; i < meputil.NotificationMaxAttempts; i++ {
+		expireRetries(t)
+		ProcessQueue()
+	}
+	assert.Equal(t, 0, countKeys(meputil.NotificationQueuePath), errorInQueue)
+
+	deadLetters, errCode := GetDeadLetters()
+	assert.Equal(t, 0, errCode, errorInQueue)
+	assert.Equal(t, 1, len(deadLetters), errorInQueue)
+	assert.Equal(t, meputil.NotificationMaxAttempts, deadLetters[0].Attempts, errorInQueue)
+	assert.Equal(t, "connection refused", deadLetters[0].LastError, errorInQueue)
+	deliveryId := deadLetters[0].DeliveryId
+
+	failSend = false
+	delivery, errCode := ReplayDeadLetter(deliveryId)
+	assert.Equal(t, 0, errCode, errorInQueue)
+	assert.Equal(t, 0, delivery.Attempts, errorInQueue)
+	assert.Equal(t, 0, countKeys(meputil.NotificationDeadLetterPath), errorInQueue)
+	ProcessQueue()
+	assert.Equal(t, []string{`{"seq":1}`}, delivered, errorInQueue)
+
+	_, errCode = GetDeadLetter(deliveryId)
+	assert.NotEqual(t, 0, errCode, errorInQueue)
+	assert.NotEqual(t, 0, DeleteDeadLetter(deliveryId), errorInQueue)
+}
+
+func TestNotificationQueueClaimedByOtherReplica(t *testing.T) {
+	defer useMemoryDatastore()()
+
+	assert.NoError(t, Enqueue(testType, testAppInstId, testSubId, testCallback, []byte(`{"seq":1}`)), errorInQueue)
+	claimKey := meputil.NotificationClaimPath + testAppInstId + "/" + testSubId
+	claim, _ := json.Marshal(&backend.Claim{Owner: "other-replica",
+		ExpiresAt: meputil.CurrentTimeMillis() + time.Minute.Milliseconds()})
+	assert.Equal(t, 0, backend.PutRecord(claimKey, claim), errorInQueue)
+
+	// Delivered only by the replica holding the claim
+	assert.Equal(t, 1, ProcessQueue(), errorInQueue)
+	assert.Empty(t, delivered, errorInQueue)
+
+	// Taken over once the claim of the other replica expires
+	claim, _ = json.Marshal(&backend.Claim{Owner: "other-replica", ExpiresAt: meputil.CurrentTimeMillis() - 1})
+	assert.Equal(t, 0, backend.PutRecord(claimKey, claim), errorInQueue)
+	ProcessQueue()
+	assert.Equal(t, []string{`{"seq":1}`}, delivered, errorInQueue)
+	assert.Equal(t, 0, countKeys(meputil.NotificationClaimPath), errorInQueue)
+	assert.Equal(t, 0, ProcessQueue(), errorInQueue)
+}
+
+func TestNotificationDispatchInterval(t *testing.T) {
+	base := meputil.NotificationDispatchInterval
+	assert.Equal(t, 2*base, nextDispatchInterval(base, 0), errorInQueue)
+	assert.Equal(t, base, nextDispatchInterval(8*base, 3), errorInQueue)
+	assert.Equal(t, meputil.NotificationMaxDispatchInterval,
+		nextDispatchInterval(meputil.NotificationMaxDispatchInterval, 0), errorInQueue)
+}
+
+func TestNotificationBackoff(t *testing.T) {
+	assert.Equal(t, meputil.NotificationBaseBackoff, backoff(1), errorInQueue)
+	assert.Equal(t, 4*meputil.NotificationBaseBackoff, backoff(3), errorInQueue)
+	assert.Equal(t, meputil.NotificationMaxBackoff, backoff(64), errorInQueue)
+}
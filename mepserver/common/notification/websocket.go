@@ -0,0 +1,312 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+	"github.com/gorilla/websocket"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	meputil "mepserver/common/util"
+)
+
+// websocketConn notification websocket of a subscription, writes are serialized
+type websocketConn struct {
+	appInstanceId string
+	conn          *websocket.Conn
+	writeMutex    sync.Mutex
+}
+
+var (
+	websockets      = make(map[string]*websocketConn)
+	websocketsMutex sync.RWMutex
+
+	// errWebsocketElsewhere the websocket of the subscription is held by another replica
+	errWebsocketElsewhere = errors.New("websocket connected to another replica")
+)
+
+// AttachWebsocket completes the test notification handshake on the connected websocket and then uses it to deliver
+// the notifications of the subscription. The app must echo the test notification back within the handshake timeout.
+// A new websocket replaces the previous one of the same subscription, this replica is recorded as its owner so that
+// the other replicas leave its notifications to this one.
+func AttachWebsocket(appInstanceId, subscriptionId, subscriptionHref string, conn *websocket.Conn) error {
+	testNotification, err := json.Marshal(&models.TestNotification{
+		NotificationType: meputil.TestNotification,
+		Links:            models.SerSubscription{Subscription: models.SerLinkType{Href: subscriptionHref}},
+	})
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("marshal test notification failed")
+	}
+	if err = handshake(conn, testNotification); err != nil {
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "test notification not acknowledged"),
+			time.Now().Add(meputil.WebsocketWriteTimeout))
+		_ = conn.Close()
+		return err
+	}
+
+	ws := &websocketConn{appInstanceId: appInstanceId, conn: conn}
+	websocketsMutex.Lock()
+	prev := websockets[subscriptionId]
+	websockets[subscriptionId] = ws
+	websocketsMutex.Unlock()
+	if prev != nil {
+		_ = prev.conn.Close()
+	}
+	if errCode := putWebsocketOwner(appInstanceId, subscriptionId); errCode != 0 {
+		log.Errorf(nil, "Record owner of the notification websocket of subscription %s failed.", subscriptionId)
+	}
+	log.Infof("Notification websocket connected for subscription %s.", subscriptionId)
+
+	go readWebsocket(subscriptionId, ws)
+	Trigger()
+	return nil
+}
+
+func handshake(conn *websocket.Conn, testNotification []byte) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(meputil.WebsocketWriteTimeout)); err != nil {
+		return fmt.Errorf("set websocket write deadline failed")
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, testNotification); err != nil {
+		return fmt.Errorf("send test notification failed")
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(meputil.WebsocketHandshakeTimeout)); err != nil {
+		return fmt.Errorf("set websocket read deadline failed")
+	}
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("test notification not acknowledged")
+	}
+	ack := &models.TestNotification{}
+	if err = json.Unmarshal(reply, ack); err != nil || ack.NotificationType != meputil.TestNotification {
+		return fmt.Errorf("invalid test notification acknowledgement")
+	}
+	return conn.SetReadDeadline(time.Time{})
+}
+
+// readWebsocket drains the messages from the app to process the control frames, the websocket is released once the
+// app disconnects
+func readWebsocket(subscriptionId string, ws *websocketConn) {
+	for {
+		if _, _, err := ws.conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	websocketsMutex.Lock()
+	current := websockets[subscriptionId] == ws
+	if current {
+		delete(websockets, subscriptionId)
+	}
+	websocketsMutex.Unlock()
+	_ = ws.conn.Close()
+	if current {
+		releaseWebsocketOwner(ws.appInstanceId, subscriptionId)
+	}
+	log.Infof("Notification websocket disconnected for subscription %s.", subscriptionId)
+}
+
+// sendWebsocket delivers the notification over the websocket of the subscription, the queue retries the delivery
+// while the app is not connected. Fails with errWebsocketElsewhere if another replica holds the websocket
+func sendWebsocket(delivery *models.NotificationDelivery) error {
+	websocketsMutex.RLock()
+	ws, ok := websockets[delivery.SubscriptionId]
+	websocketsMutex.RUnlock()
+	if !ok {
+		if owner := getWebsocketOwner(delivery.AppInstanceId, delivery.SubscriptionId); owner != nil &&
+			owner.Owner != backend.InstanceId() {
+			return errWebsocketElsewhere
+		}
+		return fmt.Errorf("no websocket connected for subscription %s", delivery.SubscriptionId)
+	}
+
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	if err := ws.conn.SetWriteDeadline(time.Now().Add(meputil.WebsocketWriteTimeout)); err != nil {
+		return fmt.Errorf("set websocket write deadline failed")
+	}
+	if err := ws.conn.WriteMessage(websocket.TextMessage, delivery.Payload); err != nil {
+		_ = ws.conn.Close()
+		return fmt.Errorf("write to websocket failed")
+	}
+	return nil
+}
+
+// CloseWebsocket disconnects the websocket of the subscription, the replica holding it is requested to close it if
+// it is not connected to this one
+func CloseWebsocket(appInstanceId, subscriptionId string) {
+	if closeLocalWebsocket(subscriptionId) {
+		return
+	}
+	if owner := getWebsocketOwner(appInstanceId, subscriptionId); owner != nil &&
+		owner.Owner != backend.InstanceId() {
+		requestWebsocketClose(owner.Owner, appInstanceId, subscriptionId)
+	}
+}
+
+// CloseAppWebsockets disconnects all the websockets of the app instance, including the ones held by the other replicas
+func CloseAppWebsockets(appInstanceId string) {
+	closing := make(map[string]*websocketConn)
+	websocketsMutex.Lock()
+	for subscriptionId, ws := range websockets {
+		if ws.appInstanceId == appInstanceId {
+			closing[subscriptionId] = ws
+			delete(websockets, subscriptionId)
+		}
+	}
+	websocketsMutex.Unlock()
+	for subscriptionId, ws := range closing {
+		closeWebsocket(appInstanceId, subscriptionId, ws)
+	}
+
+	records, errCode := backend.GetRecordsWithCompleteKeyPath(meputil.WebsocketOwnerPath + appInstanceId + "/")
+	if errCode != 0 {
+		log.Errorf(nil, "Read owners of the notification websockets of app %s failed.", appInstanceId)
+		return
+	}
+	for key, record := range records {
+		owner := &backend.Claim{}
+		if err := json.Unmarshal(record, owner); err != nil || owner.Owner == backend.InstanceId() ||
+			owner.ExpiresAt <= meputil.CurrentTimeMillis() {
+			continue
+		}
+		requestWebsocketClose(owner.Owner, appInstanceId, path.Base(key))
+	}
+}
+
+func closeWebsocket(appInstanceId, subscriptionId string, ws *websocketConn) {
+	ws.writeMutex.Lock()
+	_ = ws.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "subscription deleted"),
+		time.Now().Add(meputil.WebsocketWriteTimeout))
+	ws.writeMutex.Unlock()
+	_ = ws.conn.Close()
+	releaseWebsocketOwner(appInstanceId, subscriptionId)
+}
+
+func websocketOwnerKey(appInstanceId, subscriptionId string) string {
+	return meputil.WebsocketOwnerPath + appInstanceId + "/" + subscriptionId
+}
+
+// putWebsocketOwner records this replica as the owner of the websocket, it overrides the previous owner as the app
+// connected to this replica last
+func putWebsocketOwner(appInstanceId, subscriptionId string) int {
+	ownerBytes, err := json.Marshal(&backend.Claim{Owner: backend.InstanceId(),
+		ExpiresAt: meputil.CurrentTimeMillis() + meputil.WebsocketOwnerTTL.Milliseconds()})
+	if err != nil {
+		return meputil.ParseInfoErr
+	}
+	return backend.PutRecord(websocketOwnerKey(appInstanceId, subscriptionId), ownerBytes)
+}
+
+// getWebsocketOwner returns the live owner of the websocket of the subscription, nil if no replica holds it
+func getWebsocketOwner(appInstanceId, subscriptionId string) *backend.Claim {
+	owner, _, errCode := backend.GetClaim(websocketOwnerKey(appInstanceId, subscriptionId))
+	if errCode != 0 {
+		return nil
+	}
+	return owner
+}
+
+// releaseWebsocketOwner deletes the owner record unless another replica got the websocket meanwhile
+func releaseWebsocketOwner(appInstanceId, subscriptionId string) {
+	key := websocketOwnerKey(appInstanceId, subscriptionId)
+	owner, revision, errCode := backend.GetClaim(key)
+	if errCode != 0 || owner == nil || owner.Owner != backend.InstanceId() {
+		return
+	}
+	backend.ReleaseClaim(key, revision)
+}
+
+// requestWebsocketClose asks the owner replica to close the websocket of the subscription
+func requestWebsocketClose(owner, appInstanceId, subscriptionId string) {
+	if errCode := backend.PutRecord(meputil.WebsocketClosePath+owner+"/"+subscriptionId,
+		[]byte(appInstanceId)); errCode != 0 {
+		log.Errorf(nil, "Request close of the notification websocket of subscription %s failed.", subscriptionId)
+		return
+	}
+	log.Infof("Close of the notification websocket of subscription %s requested from %s.", subscriptionId, owner)
+}
+
+// maintainWebsockets renews the owner records of the websockets held by this replica and closes the websockets as
+// requested by the other replicas
+func maintainWebsockets() {
+	go watchWebsocketCloses()
+	for {
+		time.Sleep(meputil.WebsocketOwnerRenewInterval)
+		renewWebsocketOwners()
+	}
+}
+
+// renewWebsocketOwners extends the owner records, a websocket replaced on another replica is closed
+func renewWebsocketOwners() {
+	websocketsMutex.RLock()
+	local := make(map[string]*websocketConn, len(websockets))
+	for subscriptionId, ws := range websockets {
+		local[subscriptionId] = ws
+	}
+	websocketsMutex.RUnlock()
+	for subscriptionId, ws := range local {
+		_, owned, errCode := backend.AcquireClaim(websocketOwnerKey(ws.appInstanceId, subscriptionId),
+			meputil.WebsocketOwnerTTL)
+		if errCode != 0 || owned {
+			continue
+		}
+		log.Infof("Notification websocket of subscription %s replaced on another replica.", subscriptionId)
+		closeLocalWebsocket(subscriptionId)
+	}
+}
+
+// watchWebsocketCloses closes the websockets of this replica as requested by the other replicas
+func watchWebsocketCloses() {
+	prefix := meputil.WebsocketClosePath + backend.InstanceId() + "/"
+	for {
+		err := backend.DB().Watch(context.Background(), prefix, func(evt backend.WatchEvent) {
+			if evt.Type != backend.EventPut {
+				return
+			}
+			closeLocalWebsocket(strings.TrimPrefix(evt.Kv.Key, prefix))
+			_ = backend.DeleteRecord(evt.Kv.Key)
+		})
+		if err != nil {
+			log.Errorf(nil, "Watch notification websocket close requests failed.")
+		}
+		time.Sleep(meputil.WebsocketWatchRetryInterval)
+	}
+}
+
+// closeLocalWebsocket returns true if the websocket of the subscription was held by this replica
+func closeLocalWebsocket(subscriptionId string) bool {
+	websocketsMutex.Lock()
+	ws, ok := websockets[subscriptionId]
+	delete(websockets, subscriptionId)
+	websocketsMutex.Unlock()
+	if ok {
+		closeWebsocket(ws.appInstanceId, subscriptionId, ws)
+	}
+	return ok
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	meputil "mepserver/common/util"
+)
+
+const (
+	testSubHref      = "/mec_service_mgmt/v1/applications/" + testAppInstId + "/subscriptions/" + testSubId
+	errorInWebsocket = "Error in notification websocket"
+)
+
+var attachResult = make(chan error, 1)
+
+func newWebsocketServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			attachResult <- err
+			return
+		}
+		attachResult <- AttachWebsocket(testAppInstId, testSubId, testSubHref, conn)
+	}))
+}
+
+func dialWebsocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.NoError(t, err, errorInWebsocket)
+	return conn
+}
+
+func TestWebsocketDelivery(t *testing.T) {
+	defer useMemoryDatastore()()
+	server := newWebsocketServer()
+	defer server.Close()
+	conn := dialWebsocket(t, server)
+	defer conn.Close()
+
+	// Handshake with the test notification
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err, errorInWebsocket)
+	testNotification := &models.TestNotification{}
+	assert.NoError(t, json.Unmarshal(msg, testNotification), errorInWebsocket)
+	assert.Equal(t, meputil.TestNotification, testNotification.NotificationType, errorInWebsocket)
+	assert.Equal(t, testSubHref, testNotification.Links.Subscription.Href, errorInWebsocket)
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, msg), errorInWebsocket)
+	assert.NoError(t, <-attachResult, errorInWebsocket)
+	owner := getWebsocketOwner(testAppInstId, testSubId)
+	assert.NotNil(t, owner, errorInWebsocket)
+	assert.Equal(t, backend.InstanceId(), owner.Owner, errorInWebsocket)
+
+	err = send(&models.NotificationDelivery{NotificationType: meputil.SerAvailabilityNotification,
+		SubscriptionId: testSubId, Payload: []byte(`{"seq":1}`)})
+	assert.NoError(t, err, errorInWebsocket)
+	_, msg, err = conn.ReadMessage()
+	assert.NoError(t, err, errorInWebsocket)
+	assert.Equal(t, `{"seq":1}`, string(msg), errorInWebsocket)
+
+	CloseAppWebsockets(testAppInstId)
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), errorInWebsocket)
+	assert.Nil(t, getWebsocketOwner(testAppInstId, testSubId), errorInWebsocket)
+	err = send(&models.NotificationDelivery{NotificationType: meputil.SerAvailabilityNotification,
+		SubscriptionId: testSubId, Payload: []byte(`{"seq":2}`)})
+	assert.Error(t, err, errorInWebsocket)
+}
+
+func TestWebsocketHandshakeFailed(t *testing.T) {
+	defer useMemoryDatastore()()
+	server := newWebsocketServer()
+	defer server.Close()
+	conn := dialWebsocket(t, server)
+	defer conn.Close()
+
+	_, _, err := conn.ReadMessage()
+	assert.NoError(t, err, errorInWebsocket)
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"notificationType":"Other"}`)),
+		errorInWebsocket)
+	select {
+	case err = <-attachResult:
+		assert.Error(t, err, errorInWebsocket)
+	case <-time.After(meputil.WebsocketHandshakeTimeout):
+		t.Error("Websocket handshake not completed")
+	}
+
+	websocketsMutex.RLock()
+	_, ok := websockets[testSubId]
+	websocketsMutex.RUnlock()
+	assert.False(t, ok, errorInWebsocket)
+}
+
+func TestWebsocketOnOtherReplica(t *testing.T) {
+	defer useMemoryDatastore()()
+	ownerBytes, _ := json.Marshal(&backend.Claim{Owner: "other-replica",
+		ExpiresAt: meputil.CurrentTimeMillis() + time.Minute.Milliseconds()})
+	assert.Equal(t, 0, backend.PutRecord(websocketOwnerKey(testAppInstId, testSubId), ownerBytes),
+		errorInWebsocket)
+
+	// Left to the replica holding the websocket without counting an attempt
+	assert.NoError(t, Enqueue(testType, testAppInstId, testSubId, "", []byte(`{"seq":1}`)), errorInWebsocket)
+	assert.Equal(t, 1, ProcessQueue(), errorInWebsocket)
+	records, _ := backend.GetRecordsWithCompleteKeyPath(meputil.NotificationQueuePath)
+	for _, record := range records {
+		delivery := &models.NotificationDelivery{}
+		assert.NoError(t, json.Unmarshal(record, delivery), errorInWebsocket)
+		assert.Equal(t, 0, delivery.Attempts, errorInWebsocket)
+	}
+	assert.Equal(t, 0, countKeys(meputil.NotificationClaimPath), errorInWebsocket)
+
+	// Close requested from the replica holding the websocket
+	CloseWebsocket(testAppInstId, testSubId)
+	assert.Equal(t, 1, countKeys(meputil.WebsocketClosePath+"other-replica/"), errorInWebsocket)
+	assert.Equal(t, 0, backend.DeleteRecord(meputil.WebsocketClosePath+"other-replica/"+testSubId),
+		errorInWebsocket)
+	CloseAppWebsockets(testAppInstId)
+	assert.Equal(t, 1, countKeys(meputil.WebsocketClosePath+"other-replica/"), errorInWebsocket)
+
+	// Attempted by any replica once the owner record expires
+	ownerBytes, _ = json.Marshal(&backend.Claim{Owner: "other-replica", ExpiresAt: meputil.CurrentTimeMillis() - 1})
+	assert.Equal(t, 0, backend.PutRecord(websocketOwnerKey(testAppInstId, testSubId), ownerBytes),
+		errorInWebsocket)
+	ProcessQueue()
+	records, _ = backend.GetRecordsWithCompleteKeyPath(meputil.NotificationQueuePath)
+	for _, record := range records {
+		delivery := &models.NotificationDelivery{}
+		assert.NoError(t, json.Unmarshal(record, delivery), errorInWebsocket)
+		assert.Equal(t, 1, delivery.Attempts, errorInWebsocket)
+	}
+}
+
+func TestWebsocketCloseRequest(t *testing.T) {
+	defer useMemoryDatastore()()
+	server := newWebsocketServer()
+	defer server.Close()
+	conn := dialWebsocket(t, server)
+	defer conn.Close()
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err, errorInWebsocket)
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, msg), errorInWebsocket)
+	assert.NoError(t, <-attachResult, errorInWebsocket)
+
+	go watchWebsocketCloses()
+	// Requested by another replica until the watch is established
+	closeKey := meputil.WebsocketClosePath + backend.InstanceId() + "/" + testSubId
+	closed := make(chan error, 1)
+	go func() {
+		_, _, readErr := conn.ReadMessage()
+		closed <- readErr
+	}()
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, 0, backend.PutRecord(closeKey, []byte(testAppInstId)), errorInWebsocket)
+		select {
+		case err = <-closed:
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), errorInWebsocket)
+			assert.Nil(t, getWebsocketOwner(testAppInstId, testSubId), errorInWebsocket)
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	t.Error("Websocket not closed on request")
+}
@@ -129,16 +129,29 @@ func (a *ApiGwIf) DeleteApiGwRoute(serviceName string) {
 func (a *ApiGwIf) EnableJwtPlugin(serInfo SerInfo) {
 	serName := serInfo.SerName
 	apiGwPluginUrl := a.baseURL + serviceUrl + serName + "/plugins"
-	jwtConfig := fmt.Sprintf(`{ "name": "%s", "config": { "claims_to_verify": ["exp"] } }`, JwtPlugin)
+	jwtConfig := fmt.Sprintf(`{ "name": "%s", "config": { "claims_to_verify": ["exp"], "key_claim_name": "kid" } }`,
+		JwtPlugin)
 	_, err := SendPostRequest(apiGwPluginUrl, []byte(jwtConfig), a.tlsCfg)
 	if err != nil {
 		log.Error("Enable apiGw jwt plugin failed", err)
 	}
 }
 
+// EnableAppIdPlugin enables kong appid-header plugin, restricting the service to the tokens granting it
+func (a *ApiGwIf) EnableAppIdPlugin(serInfo SerInfo) {
+	serName := serInfo.SerName
+	apiGwPluginUrl := a.baseURL + serviceUrl + serName + "/plugins"
+	appIdConfig := fmt.Sprintf(`{ "name": "%s", "config": { "service_name": "%s" } }`, AppidPlugin, serName)
+	_, err := SendPostRequest(apiGwPluginUrl, []byte(appIdConfig), a.tlsCfg)
+	if err != nil {
+		log.Error("Enable apiGw appid-header plugin failed", err)
+	}
+}
+
 func (a *ApiGwIf) DeleteJwtPlugin(serviceName string) {
 	apiGwPluginUrl := a.baseURL + serviceUrl + serviceName + "/plugins"
-	jwtConfig := fmt.Sprintf(`{ "name": "%s", "config": { "claims_to_verify": ["exp"] } }`, JwtPlugin)
+	jwtConfig := fmt.Sprintf(`{ "name": "%s", "config": { "claims_to_verify": ["exp"], "key_claim_name": "kid" } }`,
+		JwtPlugin)
 	_, err := SendPostRequest(apiGwPluginUrl, []byte(jwtConfig), a.tlsCfg)
 	if err != nil {
 		log.Error("Register API GW jwt plugin failed.", err)
@@ -48,6 +48,21 @@ const (
 	CallbackUrlNotFound         = 22
 )
 
+// Mp1 operation scopes of the access token, mepauth grants the scopes configured for the app instance
+const (
+	ScopeServicesRead       = "services:read"
+	ScopeServicesWrite      = "services:write"
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+	ScopeDnsRulesRead       = "dns_rules:read"
+	ScopeDnsRulesWrite      = "dns_rules:write"
+	ScopeTrafficRulesRead   = "traffic_rules:read"
+	ScopeTrafficRulesWrite  = "traffic_rules:write"
+	ScopeTimingRead         = "timing:read"
+	ScopeTransportsRead     = "transports:read"
+	ScopeAppLifecycleWrite  = "app_lifecycle:write"
+)
+
 // Mep server api paths
 const (
 	RootPath              = "/mep"
@@ -73,7 +88,9 @@ const (
 	CapabilityPath         = Mm5RootPath + MecPlatformConfigPath + "/capabilities"
 	AppDConfigPath         = Mm5RootPath + MecAppDConfigPath + "/applications/:appInstanceId/appd_configuration"
 	AppDQueryResPath       = Mm5RootPath + MecAppDConfigPath + "/tasks/:taskId/appd_configuration"
+	AppDTasksPath          = Mm5RootPath + MecAppDConfigPath + "/applications/:appInstanceId/tasks"
 	AppInsTerminationPath  = RootPath + MecAppSupportPath + "/applications/:appInstanceId/AppInstanceTermination"
+	DeadLettersPath        = Mm5RootPath + MecPlatformConfigPath + "/notifications/dead_letters"
 
 	KongHttpLogPath        = RootPath + MecServiceGovernPath + "/kong_log"
 	SubscribeStatisticPath = RootPath + MecServiceGovernPath + "/subscribe_statistic"
@@ -84,6 +101,10 @@ const (
 	SubscriptionIdPath = "/:subscriptionId"
 	ServiceIdPath      = "/:serviceId"
 	CapabilityIdPath   = "/:capabilityId"
+	DeliveryIdPath     = "/:deliveryId"
+	ReplayPath         = "/replay"
+	RetryPath          = "/retry"
+	WebsocketPath      = "/websocket"
 	Liveness           = "/liveness"
 	CurrentTIme        = "/current_time"
 	TimingCaps         = "/timing_caps"
@@ -104,14 +125,24 @@ const (
 
 const DBRootPath = "/cse-sr/etsi/"
 const (
-	EndAppSubKeyPath          = DBRootPath + "app-end-subscribe/"
-	AvailAppSubKeyPath        = DBRootPath + "subscribe/"
-	AppDConfigKeyPath         = DBRootPath + "appd/"
-	AppDLCMJobsPath           = DBRootPath + "mep/applcm/jobs/"
-	AppDLCMTasksPath          = DBRootPath + "mep/applcm/tasks/"
-	AppDLCMTaskStatusPath     = DBRootPath + "mep/applcm/taskstatus/"
-	TransportInfoPath         = DBRootPath + "transports/"
-	AppConfirmTerminationPath = DBRootPath + "app-confirm-termination/"
+	EndAppSubKeyPath           = DBRootPath + "app-end-subscribe/"
+	AvailAppSubKeyPath         = DBRootPath + "subscribe/"
+	AppDConfigKeyPath          = DBRootPath + "appd/"
+	AppDLCMJobsPath            = DBRootPath + "mep/applcm/jobs/"
+	AppDLCMTasksPath           = DBRootPath + "mep/applcm/tasks/"
+	AppDLCMTaskStatusPath      = DBRootPath + "mep/applcm/taskstatus/"
+	AppDLCMTaskCancelPath      = DBRootPath + "mep/applcm/taskcancel/"
+	AppDLCMFailedJobsPath      = DBRootPath + "mep/applcm/failedjobs/"
+	AppDLCMTaskClaimPath       = DBRootPath + "mep/applcm/taskclaim/"
+	TransportInfoPath          = DBRootPath + "transports/"
+	AppConfirmTerminationPath  = DBRootPath + "app-confirm-termination/"
+	NotificationQueuePath      = DBRootPath + "notification/queue/"
+	NotificationClaimPath      = DBRootPath + "notification/claim/"
+	NotificationDeadLetterPath = DBRootPath + "notification/deadletter/"
+	WebsocketOwnerPath         = DBRootPath + "notification/websocket/owner/"
+	WebsocketClosePath         = DBRootPath + "notification/websocket/close/"
+	ExpiryNotifiedPath         = DBRootPath + "subscription/expirynotified/"
+	HeartbeatLeaderPath        = DBRootPath + "heartbeat/leader"
 )
 
 const (
@@ -140,7 +171,20 @@ const RequestBodyLength = 4096
 const ServicesMaxCount = 50
 const AppSubscriptionCount = 50
 const ServerHeader = "Server"
+const ETagHeader = "ETag"
+const IfMatchHeader = "If-Match"
+const IfNoneMatchHeader = "If-None-Match"
+const ForwardedProtoHeader = "X-Forwarded-Proto"
+const ForwardedHostHeader = "X-Forwarded-Host"
+
+// Schemes of the websocket uri handed to the apps
+const (
+	HttpsProtocol         = "https"
+	WebsocketScheme       = "ws"
+	WebsocketSecureScheme = "wss"
+)
 const JwtPlugin = "jwt"
+const AppidPlugin = "appid-header"
 
 const specialCharRegex string = `^.*['~!@#$%^&*()-_=+\|[{}\];:'",<.>/?].*$`
 const singleDigitRegex string = `^.*\d.*$`
@@ -159,6 +203,10 @@ const ComponentContent = "j7k0UwOJSsIfi3dzainoBdkcpJJJOJlzd2oBwMQxXdaZ3oCswITWUy
 const ErrorRequestBodyMessage = "request body invalid"
 const XRealIp = "X-Real-Ip"
 
+// TokenScopeHeader scopes of the access token, set by the appid-header plugin of the api gateway once the token is
+// verified
+const TokenScopeHeader = "X-Token-Scope"
+
 // MaxFQDNLength As per RFC-1035 section-2.3.4, the maximum length of full FQDN name is 255 octets including
 // one length and one null terminating character. Hence it is limited as 253.
 const MaxFQDNLength = 253
@@ -306,6 +354,60 @@ const (
 )
 
 const AppTerminateNotification = "AppTerminationNotification"
+const SerAvailabilityNotification = "SerAvailabilityNotification"
+const TestNotification = "TestNotification"
+const ExpiryNotification = "ExpiryNotification"
+
+// Notification delivery retry settings, an idle dispatcher polls the queue less often up to the max interval. A
+// subscription's notifications are delivered by the replica holding its claim
+const (
+	NotificationMaxAttempts         = 6
+	NotificationBaseBackoff         = 2 * time.Second
+	NotificationMaxBackoff          = 5 * time.Minute
+	NotificationDispatchInterval    = 1 * time.Second
+	NotificationMaxDispatchInterval = 30 * time.Second
+	NotificationClaimTTL            = 60 * time.Second
+)
+
+// Subscription expiry settings, the expiry notification is sent within the notice period before the deadline
+const (
+	SubscriptionSweepInterval      = 10 * time.Second
+	SubscriptionExpiryNoticePeriod = 60 * time.Second
+)
+
+// Heartbeat supervision settings, the leader lease is renewed several times within its ttl. A service staying
+// suspended for the grace period is deregistered
+const (
+	HeartbeatLeaderTTL           int64 = 15
+	HeartbeatLeaderRenewInterval       = 5 * time.Second
+	DefaultSuspendedGracePeriod        = 5 * time.Minute
+	SuspendedGracePeriodKey            = "suspended_grace_period"
+)
+
+// App config sync task recovery settings. A task is run by the replica holding its claim, the claim is renewed while
+// the task runs and the pending tasks are checked periodically for the claims left to expire by a stopped replica
+const (
+	AppDTaskRecoveryInterval      = 60 * time.Second
+	AppDTaskRecoveryRetryInterval = 5 * time.Second
+	AppDTaskClaimTTL              = 60 * time.Second
+	AppDTaskClaimRenewInterval    = 20 * time.Second
+)
+
+// Retention of the finished app config sync tasks, older or more tasks are pruned from the history of the app
+const (
+	AppDTaskHistoryLimit     = 20
+	AppDTaskHistoryRetention = 7 * 24 * time.Hour
+)
+
+// Websocket notification transport settings. The replica holding the websocket of a subscription is recorded as its
+// owner, the record is renewed several times within its ttl while the websocket is connected
+const (
+	WebsocketHandshakeTimeout   = 10 * time.Second
+	WebsocketWriteTimeout       = 10 * time.Second
+	WebsocketOwnerTTL           = 60 * time.Second
+	WebsocketOwnerRenewInterval = 20 * time.Second
+	WebsocketWatchRetryInterval = 5 * time.Second
+)
 const MaxGracefulTimeout uint32 = 5
 const AppTerminationSleepDuration = 100
 const AppTerminationTimeout = MaxGracefulTimeout * 10
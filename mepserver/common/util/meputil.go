@@ -42,6 +42,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/pbkdf2"
 
@@ -178,6 +179,94 @@ func GetServiceInstance(ctx context.Context, serviceId string) (*proto.MicroServ
 	return instance, err
 }
 
+// GetServiceInstanceWithRevision get service instance along with the modification revision of its record
+func GetServiceInstanceWithRevision(ctx context.Context, serviceId string) (*proto.MicroServiceInstance, int64, error) {
+	domainProject := util.ParseDomainProject(ctx)
+	serviceID := serviceId[:len(serviceId)/2]
+	instanceID := serviceId[len(serviceId)/2:]
+	key := core.GenerateInstanceKey(domainProject, serviceID, instanceID)
+	resp, err := backend.Store().Instance().Search(ctx, registry.WithStrKey(key))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("domainProject %s service Id %s not exist", domainProject, serviceID)
+	}
+	instance, ok := resp.Kvs[0].Value.(*proto.MicroServiceInstance)
+	if !ok {
+		return nil, 0, fmt.Errorf("instance parse failed")
+	}
+	return instance, resp.Kvs[0].ModRevision, nil
+}
+
+// UpdateInstanceIfRevision updates the instance only if its record is still at the given modification revision,
+// returns EtagMissMatchErr if it was modified meanwhile
+func UpdateInstanceIfRevision(ctx context.Context, instance *proto.MicroServiceInstance, revision int64) int {
+	domainProject := util.ParseDomainProject(ctx)
+	leaseID, err := svcutil.GetLeaseId(ctx, domainProject, instance.ServiceId, instance.InstanceId)
+	if err != nil || leaseID == -1 {
+		log.Errorf(err, "Get lease of instance %s failed.", instance.InstanceId)
+		return SerErrServiceUpdFailed
+	}
+	instance.ModTimestamp = strconv.FormatInt(time.Now().Unix(), FormatIntBase)
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return ParseInfoErr
+	}
+	key := core.GenerateInstanceKey(domainProject, instance.ServiceId, instance.InstanceId)
+	opts := []registry.PluginOp{
+		registry.OpPut(registry.WithStrKey(key), registry.WithValue(data), registry.WithLease(leaseID)),
+	}
+	cmps := []registry.CompareOp{
+		registry.OpCmp(registry.CmpStrModRev(key), registry.CMP_EQUAL, revision),
+	}
+	resp, err := backend.Registry().TxnWithCmp(ctx, opts, cmps, nil)
+	if err != nil {
+		log.Errorf(err, "Update instance %s failed.", instance.InstanceId)
+		return SerErrServiceUpdFailed
+	}
+	if !resp.Succeeded {
+		log.Warnf("Instance %s modified concurrently, update rejected.", instance.InstanceId)
+		return EtagMissMatchErr
+	}
+	return 0
+}
+
+// DeleteInstanceIfRevision deletes the instance only if its record is still at the given modification revision,
+// returns EtagMissMatchErr if it was modified meanwhile. The instance lease is revoked once the records are deleted
+func DeleteInstanceIfRevision(ctx context.Context, serviceId string, instanceId string, revision int64) int {
+	domainProject := util.ParseDomainProject(ctx)
+	leaseID, err := svcutil.GetLeaseId(ctx, domainProject, serviceId, instanceId)
+	if err != nil {
+		log.Errorf(err, "Get lease of instance %s failed.", instanceId)
+		return SerErrServiceInstanceFailed
+	}
+	if leaseID == -1 {
+		return SerInstanceNotFound
+	}
+	key := core.GenerateInstanceKey(domainProject, serviceId, instanceId)
+	opts := []registry.PluginOp{
+		registry.OpDel(registry.WithStrKey(key)),
+		registry.OpDel(registry.WithStrKey(core.GenerateInstanceLeaseKey(domainProject, serviceId, instanceId))),
+	}
+	cmps := []registry.CompareOp{
+		registry.OpCmp(registry.CmpStrModRev(key), registry.CMP_EQUAL, revision),
+	}
+	resp, err := backend.Registry().TxnWithCmp(ctx, opts, cmps, nil)
+	if err != nil {
+		log.Errorf(err, "Delete instance %s failed.", instanceId)
+		return SerErrServiceInstanceFailed
+	}
+	if !resp.Succeeded {
+		log.Warnf("Instance %s modified concurrently, delete rejected.", instanceId)
+		return EtagMissMatchErr
+	}
+	if err = backend.Registry().LeaseRevoke(ctx, leaseID); err != nil {
+		log.Warnf("Revoke lease of deleted instance %s failed, released on expiry.", instanceId)
+	}
+	return 0
+}
+
 // FindInstanceByKey get instance by key
 func FindInstanceByKey(result url.Values) (*proto.FindInstancesResponse, error) {
 	serCategoryId := result.Get("ser_category_id")
@@ -289,6 +378,15 @@ func GetSubscribeKeyPath(subscribeType string) string {
 	return subscribeKeyPath
 }
 
+// GetSubscriptionLocation location of the subscription resource, relative to the mep root path
+func GetSubscriptionLocation(subscribeType, appInstanceId, subscriptionId string) string {
+	basePath := MecServicePath
+	if subscribeType == AppTerminationNotificationSubscription {
+		basePath = MecAppSupportPath
+	}
+	return fmt.Sprintf("%s/applications/%s/subscriptions/%s", basePath, appInstanceId, subscriptionId)
+}
+
 // ValidateAppInstanceIdWithHeader validate appInstanceId in header
 func ValidateAppInstanceIdWithHeader(id string, r *http.Request) error {
 	if id == r.Header.Get("X-AppinstanceID") {
@@ -300,6 +398,17 @@ func ValidateAppInstanceIdWithHeader(id string, r *http.Request) error {
 	return errors.New("UnAuthorization to access the resource")
 }
 
+// ValidateTokenScope validates the operation scope is granted by the access token of the request. The scopes are
+// taken from the header the api gateway sets after verifying the token, a request without it is denied
+func ValidateTokenScope(scope string, r *http.Request) error {
+	for _, granted := range strings.Fields(r.Header.Get(TokenScopeHeader)) {
+		if granted == scope {
+			return nil
+		}
+	}
+	return errors.New("insufficient scope, " + scope + " is required to access the resource")
+}
+
 // GetHttpResourceInfo get resource info
 func GetHttpResourceInfo(r *http.Request) string {
 	resource := r.URL.String()
@@ -646,6 +755,32 @@ func GenerateStrongETag(body []byte) string {
 	return fmt.Sprintf("\"%x\"", sha256.Sum256(body))
 }
 
+// CheckETagPreconditions Evaluates the If-Match and If-None-Match headers of the request against the current ETag of
+// the resource. More details could be found here: https://tools.ietf.org/html/rfc7232#section-3
+func CheckETagPreconditions(r *http.Request, etag string) bool {
+	if ifMatch := r.Header.Get(IfMatchHeader); len(ifMatch) != 0 && !matchETag(ifMatch, etag, false) {
+		return false
+	}
+	if ifNoneMatch := r.Header.Get(IfNoneMatchHeader); len(ifNoneMatch) != 0 && matchETag(ifNoneMatch, etag, true) {
+		return false
+	}
+	return true
+}
+
+// matchETag checks the etag against the comma separated list in the header, If-None-Match uses weak comparison
+func matchETag(header string, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // IsHttpStatusOK Checks whether the status code is in the success range from 200 to 299
 func IsHttpStatusOK(statusCode int) bool {
 	return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
@@ -662,6 +797,11 @@ func GenerateUniqueId() string {
 	return uuid.NewV4().String()
 }
 
+// CurrentTimeMillis current unix time in milliseconds
+func CurrentTimeMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
 // AppConfigProperties represents application config map
 type AppConfigProperties map[string]string
 
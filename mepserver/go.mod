@@ -14,11 +14,13 @@ require (
 	github.com/apache/servicecomb-service-center v0.0.0-20191027084911-c2dc0caef706
 	github.com/astaxie/beego v1.12.0
 	github.com/beevik/ntp v0.3.0
+	github.com/coreos/etcd v3.3.6+incompatible
 	github.com/dgrijalva/jwt-go/v4 v4.0.0-preview1
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-chassis/paas-lager v1.1.1 // indirect
 	github.com/go-mesh/openlogging v1.0.1 // indirect
 	github.com/go-playground/validator/v10 v10.4.1
+	github.com/gorilla/websocket v1.2.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.2.0 // indirect
 	github.com/olivere/elastic/v7 v7.0.20
 	github.com/satori/go.uuid v1.2.0
@@ -21,12 +21,14 @@ import (
 	"errors"
 	"os"
 
+	"mepserver/common/notification"
 	_ "mepserver/common/tls"
 	"mepserver/common/util"
 	_ "mepserver/mm5"
 	_ "mepserver/mm5/plans"
 	_ "mepserver/mp1"
-	_ "mepserver/mp1/event"
+	"mepserver/mp1/event"
+	"mepserver/mp1/heartbeat"
 	_ "mepserver/mp1/uuid"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
@@ -53,7 +55,9 @@ func main() {
 		}
 
 	}
-	go heartbeatProcess()
+	heartbeat.Start()
+	go event.SubscriptionExpiryProcess()
+	notification.Start()
 	util.ApiGWInterface = util.NewApiGwIf()
 	server.Run()
 }
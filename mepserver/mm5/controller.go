@@ -81,6 +81,7 @@ func (m *Mm5Service) Init() error {
 	}
 	log.Infof("Data-plane initialized to %s.", m.config.DataPlane.Type)
 	m.mp2Worker.InitializeWorker(dataPlane, dnsAgent, m.config.DNSAgent.Type)
+	go m.mp2Worker.ResumePendingTasks()
 
 	m.mepAuthBaseUrl, err = meputil.ReadMepAuthEndpoint()
 	if err != nil {
@@ -112,6 +113,19 @@ func (m *Mm5Service) URLPatterns() []rest.Route {
 		{Method: rest.HTTP_METHOD_GET, Path: meputil.KongHttpLogPath, Func: m.queryHttpLog},
 		{Method: rest.HTTP_METHOD_GET, Path: meputil.SubscribeStatisticPath, Func: m.querySubscribeStatistic},
 		{Method: rest.HTTP_METHOD_GET, Path: meputil.GovernServicesPath, Func: m.queryAllServices},
+
+		// Notification dead letters
+		{Method: rest.HTTP_METHOD_GET, Path: meputil.DeadLettersPath, Func: m.getDeadLetters},
+		{Method: rest.HTTP_METHOD_GET, Path: meputil.DeadLettersPath + meputil.DeliveryIdPath, Func: m.getDeadLetter},
+		{Method: rest.HTTP_METHOD_POST, Path: meputil.DeadLettersPath + meputil.DeliveryIdPath + meputil.ReplayPath,
+			Func: m.replayDeadLetter},
+		{Method: rest.HTTP_METHOD_DELETE, Path: meputil.DeadLettersPath + meputil.DeliveryIdPath,
+			Func: m.deleteDeadLetter},
+
+		// AppD configuration tasks
+		{Method: rest.HTTP_METHOD_DELETE, Path: meputil.AppDQueryResPath, Func: m.cancelResourceTask},
+		{Method: rest.HTTP_METHOD_POST, Path: meputil.AppDQueryResPath + meputil.RetryPath, Func: m.retryResourceTask},
+		{Method: rest.HTTP_METHOD_GET, Path: meputil.AppDTasksPath, Func: m.getTaskHistory},
 	}
 }
 
@@ -190,12 +204,43 @@ func (m *Mm5Service) getResourceTasks(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (m *Mm5Service) cancelResourceTask(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DecodeTaskRestReq{},
+		&plans.TaskCancel{})
+	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusAccepted})
+
+	workspace.WkRun(workPlan)
+}
+
+func (m *Mm5Service) retryResourceTask(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DecodeTaskRestReq{},
+		(&plans.TaskRetry{}).WithWorker(&m.mp2Worker))
+	workPlan.Finally(&common.SendHttpRsp{})
+
+	workspace.WkRun(workPlan)
+}
+
+func (m *Mm5Service) getTaskHistory(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DecodeAppDRestReq{},
+		&plans.TaskHistoryGet{})
+	workPlan.Finally(&common.SendHttpRsp{})
+
+	workspace.WkRun(workPlan)
+}
+
 func (m *Mm5Service) terminateAppInstance(w http.ResponseWriter, r *http.Request) {
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
 		&plans.DecodeAppTerminationReq{},
 		(&plans.DeleteAppDConfigWithSync{}).WithWorker(&m.mp2Worker),
 		&plans.DeleteService{},
+		&plans.DeleteAppSubscriptions{},
 		(&plans.DeleteFromMepauth{}).WithEndPoint(m.mepAuthBaseUrl))
 	workPlan.Finally(&common.SendHttpRsp{})
 
@@ -237,3 +282,42 @@ func (m *Mm5Service) queryAllServices(w http.ResponseWriter, r *http.Request) {
 
 	workspace.WkRun(workPlan)
 }
+
+func (m *Mm5Service) getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DeadLettersGet{})
+	workPlan.Finally(&common.SendHttpRsp{})
+
+	workspace.WkRun(workPlan)
+}
+
+func (m *Mm5Service) getDeadLetter(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DecodeDeadLetterReq{},
+		&plans.DeadLetterGet{})
+	workPlan.Finally(&common.SendHttpRsp{})
+
+	workspace.WkRun(workPlan)
+}
+
+func (m *Mm5Service) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DecodeDeadLetterReq{},
+		&plans.DeadLetterReplay{})
+	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusAccepted})
+
+	workspace.WkRun(workPlan)
+}
+
+func (m *Mm5Service) deleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		&plans.DecodeDeadLetterReq{},
+		&plans.DeadLetterDelete{})
+	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
+
+	workspace.WkRun(workPlan)
+}
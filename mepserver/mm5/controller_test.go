@@ -33,6 +33,7 @@ import (
 	"mepserver/common/extif/dataplane"
 	"mepserver/common/extif/dns"
 	"mepserver/common/models"
+	"mepserver/common/notification"
 	"mepserver/mm5/plans"
 	"mepserver/mm5/task"
 	"mepserver/mp1/event"
@@ -40,10 +41,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
-	"path/filepath"
 	"reflect"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
@@ -64,6 +63,7 @@ const defaultAppInstanceId = "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
 
 const panicFormatString = "Panic: %v"
 const getTaskStatusFormat = "/mepcfg/app_lcm/v1/tasks/%s/appd_configuration"
+const taskHistoryUrlFormat = "/mepcfg/app_lcm/v1/applications/%s/tasks"
 const appConfigUrlFormat = "/mepcfg/app_lcm/v1/applications/%s/appd_configuration"
 const delAppInstFormat = "/mep/mec_app_support/v1/applications/%s/AppInstanceTermination"
 const kongLogFormat = "/service_govern/v1/kong_log"
@@ -80,6 +80,7 @@ const maxIPVal = 255
 const ipAddFormatter = "%d.%d.%d.%d"
 
 const getCapabilitiesUrl = "/mepcfg/mec_platform_config/v1/capabilities"
+const deadLettersUrl = "/mepcfg/mec_platform_config/v1/notifications/dead_letters"
 
 const defCapabilityId = "16384563dca094183778a41ea7701d15"
 const defCapabilityId2 = "f7e898d1c9ea9edd05e1181bc09afc5e"
@@ -187,53 +188,6 @@ func (m *mockHttpWriterWithoutWrite) WriteHeader(statusCode int) {
 	return
 }
 
-// DB implementation with concurrency protector
-type safeDB struct {
-	mu sync.Mutex
-	db map[string][]byte
-}
-
-func (c *safeDB) Put(key string, value []byte) {
-	c.mu.Lock()
-	if c.db == nil {
-		c.db = make(map[string][]byte)
-	}
-	c.db[key] = value
-	c.mu.Unlock()
-}
-
-func (c *safeDB) String() {
-	c.mu.Lock()
-	for k, v := range c.db {
-		log.Infof("DB: Key-> %v; Value-> %v.", k, string(v))
-	}
-	c.mu.Unlock()
-}
-
-func (c *safeDB) Get(key string) []byte {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.db[key]
-}
-
-func (c *safeDB) GetMultiple(path string) map[string][]byte {
-	c.mu.Lock()
-	resultList := make(map[string][]byte)
-	for k, v := range c.db {
-		if strings.HasPrefix(k, path) {
-			resultList[filepath.Base(k)] = v
-		}
-	}
-	defer c.mu.Unlock()
-	return resultList
-}
-
-func (c *safeDB) Delete(key string) {
-	c.mu.Lock()
-	delete(c.db, key)
-	c.mu.Unlock()
-}
-
 // Query Task Status with valid values
 func TestGetTaskStatus(t *testing.T) {
 	defer func() {
@@ -444,6 +398,12 @@ func TestDeleteConfigRules(t *testing.T) {
 		return taskId.String()
 	})
 
+	// The sync is not verified here, keep it off the data-store of the later tests
+	var worker *task.Worker
+	patches.ApplyMethod(reflect.TypeOf(worker), "StartNewTask", func(w *task.Worker, appName, appInstanceId,
+		taskId string) {
+	})
+
 	// 1
 	service.URLPatterns()[3].Func(mockWriter, getRequest)
 
@@ -1056,35 +1016,8 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	db := safeDB{}
-	patches.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
-		log.Infof("Get path: %v.", path)
-		db.String()
-		if db.Get(path) != nil {
-			log.Infof("Found the path in db: %s.", string(db.Get(path)))
-			return db.Get(path), 0
-		}
-
-		return nil, util.SubscriptionNotFound
-	})
-
-	patches.ApplyFunc(backend.PutRecord, func(path string, value []byte) int {
-		log.Infof("Put path: %v.", path)
-		log.Infof("Put value: %v.", string(value))
-		db.String()
-		db.Put(path, value)
-		// Return Success.
-		return 0
-	})
-
-	patches.ApplyFunc(backend.DeletePaths, func(paths []string, continueOnFailure bool) int {
-		log.Infof("Delete path: %v", paths)
-		db.String()
-		for _, path := range paths {
-			db.Delete(path)
-		}
-		return 0
-	})
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
 
 	patches.ApplyFunc(util.GenerateUniqueId, func() string {
 		return taskId.String()
@@ -1259,35 +1192,8 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
-	db := safeDB{}
-	patches.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
-		log.Infof("Get path: %v.", path)
-		db.String()
-		if db.Get(path) != nil {
-			log.Infof("Found the path in db: %s.", string(db.Get(path)))
-			return db.Get(path), 0
-		}
-
-		return nil, util.SubscriptionNotFound
-	})
-
-	patches.ApplyFunc(backend.PutRecord, func(path string, value []byte) int {
-		log.Infof("Put path: %v.", path)
-		log.Infof("Put value: %v.", string(value))
-		db.String()
-		db.Put(path, value)
-		// Return Success.
-		return 0
-	})
-
-	patches.ApplyFunc(backend.DeletePaths, func(paths []string, continueOnFailure bool) int {
-		log.Infof("Delete path: %v", paths)
-		db.String()
-		for _, path := range paths {
-			db.Delete(path)
-		}
-		return 0
-	})
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
 
 	patches.ApplyFunc(util.GenerateUniqueId, func() string {
 		return taskId.String()
@@ -1433,35 +1339,8 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
-	db := safeDB{}
-	patches.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
-		log.Infof("Get path: %v.", path)
-		db.String()
-		if db.Get(path) != nil {
-			log.Infof("Found the path in db: %s.", string(db.Get(path)))
-			return db.Get(path), 0
-		}
-
-		return nil, util.SubscriptionNotFound
-	})
-
-	patches.ApplyFunc(backend.PutRecord, func(path string, value []byte) int {
-		log.Infof("Put path: %v.", path)
-		log.Infof("Put value: %v.", string(value))
-		db.String()
-		db.Put(path, value)
-		// Return Success.
-		return 0
-	})
-
-	patches.ApplyFunc(backend.DeletePaths, func(paths []string, continueOnFailure bool) int {
-		log.Infof("Delete path: %v", paths)
-		db.String()
-		for _, path := range paths {
-			db.Delete(path)
-		}
-		return 0
-	})
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
 
 	patches.ApplyFunc(util.GenerateUniqueId, func() string {
 		return taskId.String()
@@ -1641,17 +1520,8 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
-	db := safeDB{}
-	patches.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
-		log.Infof("Get path: %v.", path)
-		db.String()
-		if db.Get(path) != nil {
-			log.Infof("Found the path in db: %s.", string(db.Get(path)))
-			return db.Get(path), 0
-		}
-
-		return nil, util.SubscriptionNotFound
-	})
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
 	a := &appd.AppDCommon{}
 	patches.ApplyMethod(reflect.TypeOf(a), "IsAppInstanceAlreadyCreated", func(t *appd.AppDCommon, appInstanceId string) bool {
 		return true
@@ -1770,17 +1640,8 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
-	db := safeDB{}
-	patches.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
-		log.Infof("Get path: %v.", path)
-		db.String()
-		if db.Get(path) != nil {
-			log.Infof("Found the path in db: %s.", string(db.Get(path)))
-			return db.Get(path), 0
-		}
-
-		return nil, util.SubscriptionNotFound
-	})
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
 	a := &appd.AppDCommon{}
 	patches.ApplyMethod(reflect.TypeOf(a), "IsDuplicateAppNameExists", func(t *appd.AppDCommon, appName string) bool {
 		return true
@@ -1899,17 +1760,8 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 403)
 
-	db := safeDB{}
-	patches.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
-		log.Infof("Get path: %v.", path)
-		db.String()
-		if db.Get(path) != nil {
-			log.Infof("Found the path in db: %s.", string(db.Get(path)))
-			return db.Get(path), 0
-		}
-
-		return nil, util.SubscriptionNotFound
-	})
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
 
 	a := &appd.AppDCommon{}
 	patches.ApplyMethod(reflect.TypeOf(a), "IsAnyOngoingOperationExist", func(t *appd.AppDCommon, appName string) bool {
@@ -2959,7 +2811,7 @@ func TestAppDUpdate(t *testing.T) {
 		State:         util.InactiveState,
 	}
 	DNSRule = append(DNSRule, updateDnsRule)
-	appConfig := models.AppDConfig{TrafficRule, DNSRule, true, "abc", "PUT"}
+	appConfig := models.AppDConfig{TrafficRule, DNSRule, true, "abc", "PUT", ""}
 	appConfigBytes, _ := json.Marshal(appConfig)
 	// Create http get request
 	getRequest, _ := http.NewRequest("GET", getCapabilitiesUrl, bytes.NewReader(appConfigBytes))
@@ -3093,7 +2945,7 @@ func TestAppDUpdateAppNameIncorrect(t *testing.T) {
 		State:         util.InactiveState,
 	}
 	DNSRule = append(DNSRule, updateDnsRule)
-	appConfig := models.AppDConfig{TrafficRule, DNSRule, true, "invalid", "PUT"}
+	appConfig := models.AppDConfig{TrafficRule, DNSRule, true, "invalid", "PUT", ""}
 	appConfigBytes, _ := json.Marshal(appConfig)
 	// Create http get request
 	getRequest, _ := http.NewRequest("GET", getCapabilitiesUrl, bytes.NewReader(appConfigBytes))
@@ -4048,7 +3900,7 @@ func TestAppInstanceTerminationStatus(t *testing.T) {
 		State:         util.InactiveState,
 	}
 	DNSRule = append(DNSRule, updateDnsRule)
-	appConfig := models.AppDConfig{TrafficRule, DNSRule, true, "invalid", "PUT"}
+	appConfig := models.AppDConfig{TrafficRule, DNSRule, true, "invalid", "PUT", ""}
 	appConfigBytes, _ := json.Marshal(appConfig)
 
 	dnsTestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -4368,3 +4220,168 @@ func TestInitRootKeyAndWorkKey(t *testing.T) {
 	fmt.Println(certPwd, err)
 	assert.Equal(t, 7, count)
 }
+
+// Query and discard the notification dead letters
+func TestNotificationDeadLetters(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mm5Service{}
+	patches := gomonkey.ApplyFunc(notification.GetDeadLetters, func() ([]*models.NotificationDelivery, int) {
+		return []*models.NotificationDelivery{{DeliveryId: "703e0f3b-b993-4d35-8d93-a469a4909ca3",
+			NotificationType: "AppTerminationNotification", Attempts: 6}}, 0
+	})
+	patches.ApplyFunc(notification.DeleteDeadLetter, func(string) int {
+		return 0
+	})
+	defer patches.Reset()
+
+	getRequest, _ := http.NewRequest("GET", deadLettersUrl, bytes.NewReader([]byte("")))
+	mockWriter := &mockHttpWriter{}
+	responseHeader := http.Header{}
+	mockWriter.On("Header").Return(responseHeader)
+	mockWriter.On("Write", []byte("[{\"deliveryId\":\"703e0f3b-b993-4d35-8d93-a469a4909ca3\","+
+		"\"notificationType\":\"AppTerminationNotification\",\"appInstanceId\":\"\",\"subscriptionId\":\"\","+
+		"\"callbackReference\":\"\",\"payload\":null,\"attempts\":6,\"createdAt\":0}]\n")).Return(0, nil)
+	mockWriter.On("WriteHeader", 200)
+
+	// 12 is the order of the dead letters get handler in the URLPattern
+	service.URLPatterns()[12].Func(mockWriter, getRequest)
+	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader), responseCheckFor200)
+	mockWriter.AssertExpectations(t)
+
+	deleteRequest, _ := http.NewRequest("DELETE", deadLettersUrl+"/703e0f3b-b993-4d35-8d93-a469a4909ca3",
+		bytes.NewReader([]byte("")))
+	deleteRequest.URL.RawQuery = ":deliveryId=703e0f3b-b993-4d35-8d93-a469a4909ca3"
+	mockDeleteWriter := &mockHttpWriter{}
+	deleteHeader := http.Header{}
+	mockDeleteWriter.On("Header").Return(deleteHeader)
+	mockDeleteWriter.On("Write", []byte("\"\"\n")).Return(0, nil)
+	mockDeleteWriter.On("WriteHeader", 204)
+
+	// 15 is the order of the dead letter delete handler in the URLPattern
+	service.URLPatterns()[15].Func(mockDeleteWriter, deleteRequest)
+	assert.Equal(t, "204", deleteHeader.Get(responseStatusHeader), "Response check for 204 failed")
+	mockDeleteWriter.AssertExpectations(t)
+
+	invalidRequest, _ := http.NewRequest("DELETE", deadLettersUrl+"/invalid", bytes.NewReader([]byte("")))
+	invalidRequest.URL.RawQuery = ":deliveryId=invalid"
+	mockInvalidWriter := &mockHttpWriter{}
+	invalidHeader := http.Header{}
+	mockInvalidWriter.On("Header").Return(invalidHeader)
+	mockInvalidWriter.On("Write", []byte("{\"title\":\"Request parameter error\",\"status\":14,"+
+		"\"detail\":\"deliveryId validation failed, invalid uuid\"}\n")).Return(0, nil)
+	mockInvalidWriter.On("WriteHeader", 400)
+
+	service.URLPatterns()[15].Func(mockInvalidWriter, invalidRequest)
+	assert.Equal(t, "400", invalidHeader.Get(responseStatusHeader), responseCheckFor400)
+	mockInvalidWriter.AssertExpectations(t)
+}
+
+func stageTaskRecords(t *testing.T, taskId string, status *models.TaskStatus, job *models.AppDConfig, jobPath string) {
+	statusBytes, _ := json.Marshal(status)
+	assert.Equal(t, 0, backend.PutRecord(util.AppDLCMTaskStatusPath+defaultAppInstanceId+"/"+taskId, statusBytes))
+	assert.Equal(t, 0, backend.PutRecord(util.AppDLCMTasksPath+taskId, []byte(defaultAppInstanceId)))
+	jobBytes, _ := json.Marshal(job)
+	assert.Equal(t, 0, backend.PutRecord(jobPath, jobBytes))
+}
+
+// Cancel a task in progress, retry a failed task and list the task history of the app
+func TestAppDTaskCancelRetryHistory(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+	n1 := &task.Worker{}
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(n1), "ProcessDataPlaneSync", func(*task.Worker, string, string,
+		string) {
+		return
+	})
+	defer patches.Reset()
+
+	const runningTaskId = "3b0b0cc0-52a5-4d5b-9f06-8f7f28a0a001"
+	const failedTaskId = "3b0b0cc0-52a5-4d5b-9f06-8f7f28a0a002"
+	ruleStatus := []models.RuleStatus{{Id: "r144", State: util.WaitMp2, Method: util.OperCreate}}
+	job := &models.AppDConfig{AppName: "app", Operation: http.MethodPost, TaskId: runningTaskId,
+		AppDNSRule: []dataplane.DNSRule{{DNSRuleID: "r144", DomainName: "www.example.com", IPAddress: "1.2.3.4"}}}
+	stageTaskRecords(t, runningTaskId, &models.TaskStatus{DNSRuleStatusLst: ruleStatus,
+		CreatedAt: util.CurrentTimeMillis() - 1000},
+		job, util.AppDLCMJobsPath+defaultAppInstanceId)
+
+	service := Mm5Service{}
+	cancelRequest, _ := http.NewRequest("DELETE", fmt.Sprintf(getTaskStatusFormat, runningTaskId),
+		bytes.NewReader([]byte("")))
+	cancelRequest.URL.RawQuery = ":taskId=" + runningTaskId
+	mockCancelWriter := &mockHttpWriterWithoutWrite{}
+	cancelHeader := http.Header{}
+	mockCancelWriter.On("Header").Return(cancelHeader)
+	mockCancelWriter.On("Write").Return(0, nil)
+	mockCancelWriter.On("WriteHeader", 202)
+
+	// 16 is the order of the task cancel handler in the URLPattern
+	service.URLPatterns()[16].Func(mockCancelWriter, cancelRequest)
+	assert.Equal(t, "202", cancelHeader.Get(responseStatusHeader), "Response check for 202 failed")
+	cancelRecord, errCode := backend.GetRecord(util.AppDLCMTaskCancelPath + runningTaskId)
+	assert.Equal(t, 0, errCode)
+	assert.Equal(t, defaultAppInstanceId, string(cancelRecord))
+
+	// The task failed meanwhile
+	_ = backend.DeletePaths([]string{util.AppDLCMJobsPath + defaultAppInstanceId,
+		util.AppDLCMTaskCancelPath + runningTaskId}, false)
+	job.TaskId = failedTaskId
+	stageTaskRecords(t, failedTaskId, &models.TaskStatus{Progress: util.TaskProgressFailure,
+		DNSRuleStatusLst: ruleStatus, Details: "Cancelled on request.", CreatedAt: util.CurrentTimeMillis() - 2000}, job,
+		util.AppDLCMFailedJobsPath+failedTaskId)
+
+	retryRequest, _ := http.NewRequest("POST", fmt.Sprintf(getTaskStatusFormat, failedTaskId)+util.RetryPath,
+		bytes.NewReader([]byte("")))
+	retryRequest.URL.RawQuery = ":taskId=" + failedTaskId
+	mockRetryWriter := &mockHttpWriterWithoutWrite{}
+	retryHeader := http.Header{}
+	mockRetryWriter.On("Header").Return(retryHeader)
+	mockRetryWriter.On("Write").Return(0, nil)
+	mockRetryWriter.On("WriteHeader", 200)
+
+	// 17 is the order of the task retry handler in the URLPattern
+	service.URLPatterns()[17].Func(mockRetryWriter, retryRequest)
+	assert.Equal(t, "200", retryHeader.Get(responseStatusHeader), responseCheckFor200)
+	retried := models.TaskProgress{}
+	_ = json.Unmarshal(mockRetryWriter.response, &retried)
+	assert.Equal(t, util.TaskStateProcessing, retried.ConfigResult)
+	_, errCode = backend.GetRecord(util.AppDLCMFailedJobsPath + failedTaskId)
+	assert.Equal(t, util.SubscriptionNotFound, errCode)
+
+	// Retry is allowed only once
+	mockRetryAgainWriter := &mockHttpWriterWithoutWrite{}
+	retryAgainHeader := http.Header{}
+	mockRetryAgainWriter.On("Header").Return(retryAgainHeader)
+	mockRetryAgainWriter.On("Write").Return(0, nil)
+	mockRetryAgainWriter.On("WriteHeader", 404)
+	service.URLPatterns()[17].Func(mockRetryAgainWriter, retryRequest)
+	assert.Equal(t, "404", retryAgainHeader.Get(responseStatusHeader), "Response check for 404 failed")
+
+	historyRequest, _ := http.NewRequest("GET", fmt.Sprintf(taskHistoryUrlFormat, defaultAppInstanceId),
+		bytes.NewReader([]byte("")))
+	historyRequest.URL.RawQuery = ":appInstanceId=" + defaultAppInstanceId
+	mockHistoryWriter := &mockHttpWriterWithoutWrite{}
+	historyHeader := http.Header{}
+	mockHistoryWriter.On("Header").Return(historyHeader)
+	mockHistoryWriter.On("Write").Return(0, nil)
+	mockHistoryWriter.On("WriteHeader", 200)
+
+	// 18 is the order of the task history handler in the URLPattern
+	service.URLPatterns()[18].Func(mockHistoryWriter, historyRequest)
+	assert.Equal(t, "200", historyHeader.Get(responseStatusHeader), responseCheckFor200)
+	var history []models.TaskHistoryEntry
+	_ = json.Unmarshal(mockHistoryWriter.response, &history)
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, retried.TaskId, history[0].TaskId)
+	assert.Equal(t, runningTaskId, history[1].TaskId)
+	assert.Equal(t, util.TaskStateFailure, history[2].ConfigResult)
+}
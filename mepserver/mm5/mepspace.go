@@ -38,6 +38,7 @@ type MepSpace struct {
 	DNSRuleId     string          `json:"dnsRuleId"`
 	CapabilityId  string          `json:"capabilityId"`
 	TaskId        string          `json:"taskId"`
+	DeliveryId    string          `json:"deliveryId"`
 	QueryParam    url.Values      `json:"queryParam"`
 	CoreRequest   interface{}     `json:"coreRequest"`
 	CoreRsp       interface{}     `json:"coreRsp"`
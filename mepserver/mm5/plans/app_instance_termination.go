@@ -34,6 +34,7 @@ import (
 	"mepserver/common/arch/workspace"
 	"mepserver/common/extif/backend"
 	"mepserver/common/models"
+	"mepserver/common/notification"
 	meputil "mepserver/common/util"
 	"mepserver/mm5/task"
 	"net/http"
@@ -163,6 +164,35 @@ func checkErr(response *proto.UnregisterInstanceResponse, err error) (int, strin
 	return 0, ""
 }
 
+// DeleteAppSubscriptions removes the subscriptions of the terminated app instance, the subscriptions are kept while
+// the graceful termination is in progress and removed by the sync worker once it is over
+type DeleteAppSubscriptions struct {
+	workspace.TaskBase
+	appd.AppDCommon
+	AppInstanceId string `json:"appInstanceId,in"`
+}
+
+// OnRequest handles the subscriptions deletion
+func (t *DeleteAppSubscriptions) OnRequest(data string) workspace.TaskCode {
+	if subscribed, _ := t.AppTerminationIsSubscribed(t.AppInstanceId); subscribed {
+		log.Info("App termination subscribed, subscriptions are removed after the graceful termination.")
+		return workspace.TaskFinish
+	}
+	for _, subscribeType := range []string{meputil.SerAvailabilityNotificationSubscription,
+		meputil.AppTerminationNotificationSubscription} {
+		errCode := backend.DeleteRecord(meputil.GetSubscribeKeyPath(subscribeType) + t.AppInstanceId + "/")
+		if errCode != 0 {
+			log.Errorf(nil, "Delete %s of the terminated app from etcd failed.", subscribeType)
+		}
+	}
+	notification.CloseAppWebsockets(t.AppInstanceId)
+	if errCode := notification.PurgeSubscription(t.AppInstanceId, ""); errCode != 0 {
+		log.Errorf(nil, "Purge notifications of the terminated app failed.")
+	}
+	log.Info("Successfully deleted application subscriptions.")
+	return workspace.TaskFinish
+}
+
 // DeleteFromMepauth handles delete from mep-atuh
 type DeleteFromMepauth struct {
 	workspace.TaskBase
@@ -34,6 +34,7 @@ type DeleteAppDConfig struct {
 	workspace.TaskBase
 	appd.AppDCommon
 	Ctx           context.Context     `json:"ctx,in"`
+	R             *http.Request       `json:"r,in"`
 	W             http.ResponseWriter `json:"w,in"`
 	AppInstanceId string              `json:"appInstanceId,in"`
 	RestBody      interface{}         `json:"restBody,in"`
@@ -68,6 +69,12 @@ func (t *DeleteAppDConfig) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 
+	// Check for E-Tags precondition. More details could be found here: https://tools.ietf.org/html/rfc7232#section-2.3
+	if errCode, msg := t.CheckPreconditions(t.R, t.AppInstanceId); errCode != 0 {
+		t.SetFirstErrorCode(errCode, msg)
+		return workspace.TaskFinish
+	}
+
 	var appDConfig models.AppDConfig
 	appDConfig.Operation = http.MethodDelete
 
@@ -25,14 +25,16 @@ import (
 	"mepserver/common/extif/backend"
 	"mepserver/common/models"
 	"mepserver/common/util"
+	"net/http"
 )
 
 // AppDConfigGet step to get the appd config
 type AppDConfigGet struct {
 	workspace.TaskBase
 	appd.AppDCommon
-	AppInstanceId string      `json:"appInstanceId,in"`
-	HttpRsp       interface{} `json:"httpRsp,out"`
+	W             http.ResponseWriter `json:"w,in"`
+	AppInstanceId string              `json:"appInstanceId,in"`
+	HttpRsp       interface{}         `json:"httpRsp,out"`
 }
 
 // OnRequest handles appd config retrieval
@@ -53,6 +55,7 @@ func (t *AppDConfigGet) OnRequest(inputData string) workspace.TaskCode {
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "parse appd config  from data-store failed")
 		return workspace.TaskFinish
 	}
+	t.W.Header().Set(util.ETagHeader, appd.AppDConfigETag(appDInStore))
 	t.HttpRsp = appDInStore
 	return workspace.TaskFinish
 }
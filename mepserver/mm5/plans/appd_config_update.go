@@ -35,6 +35,7 @@ type UpdateAppDConfig struct {
 	workspace.TaskBase
 	appd.AppDCommon
 	Ctx           context.Context     `json:"ctx,in"`
+	R             *http.Request       `json:"r,in"`
 	W             http.ResponseWriter `json:"w,in"`
 	AppInstanceId string              `json:"appInstanceId,in"`
 	RestBody      interface{}         `json:"restBody,in"`
@@ -76,6 +77,12 @@ func (t *UpdateAppDConfig) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 
+	// Check for E-Tags precondition. More details could be found here: https://tools.ietf.org/html/rfc7232#section-2.3
+	if errCode, msg := t.CheckPreconditions(t.R, t.AppInstanceId); errCode != 0 {
+		t.SetFirstErrorCode(errCode, msg)
+		return workspace.TaskFinish
+	}
+
 	appDConfigInput.Operation = http.MethodPut
 	taskId := meputil.GenerateUniqueId()
 
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plans implements mep server mm5 interfaces
+package plans
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	"mepserver/common/appd"
+	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	meputil "mepserver/common/util"
+	"mepserver/mm5/task"
+)
+
+// TaskCancel step to cancel a task in progress, the rules already applied are reverted by the worker
+type TaskCancel struct {
+	workspace.TaskBase
+	appd.AppDCommon
+	TaskId  string      `json:"taskId,in"`
+	HttpRsp interface{} `json:"httpRsp,out"`
+}
+
+// OnRequest handles the task cancel
+func (t *TaskCancel) OnRequest(data string) workspace.TaskCode {
+	log.Debugf("Cancel request arrived for taskId %s.", t.TaskId)
+
+	appInstanceId, taskStatus, errCode, msg := t.GetTaskStatus(t.TaskId)
+	if errCode != 0 {
+		t.SetFirstErrorCode(errCode, msg)
+		return workspace.TaskFinish
+	}
+	if !t.IsTaskInProgress(appInstanceId, t.TaskId, taskStatus) {
+		log.Errorf(nil, "Task %s is not in progress.", t.TaskId)
+		t.SetFirstErrorCode(meputil.ForbiddenOperation, "task is not in progress")
+		return workspace.TaskFinish
+	}
+
+	if code := backend.PutRecord(meputil.AppDLCMTaskCancelPath+t.TaskId, []byte(appInstanceId)); code != 0 {
+		log.Errorf(nil, "Task cancel request insertion on data-store failed.")
+		t.SetFirstErrorCode(workspace.ErrCode(code), "put task cancel request to data-store failed")
+		return workspace.TaskFinish
+	}
+
+	progress := t.GenerateTaskProgress(t.TaskId, appInstanceId, taskStatus)
+	progress.Details = "Cancellation requested"
+	t.HttpRsp = progress
+	return workspace.TaskFinish
+}
+
+// TaskRetry step to run a failed task again from its stored job
+type TaskRetry struct {
+	workspace.TaskBase
+	appd.AppDCommon
+	TaskId  string      `json:"taskId,in"`
+	HttpRsp interface{} `json:"httpRsp,out"`
+	worker  *task.Worker
+}
+
+// WithWorker inputs worker instance
+func (t *TaskRetry) WithWorker(w *task.Worker) *TaskRetry {
+	t.worker = w
+	return t
+}
+
+// OnRequest handles the task retry, the job is staged as a new task
+func (t *TaskRetry) OnRequest(data string) workspace.TaskCode {
+	log.Debugf("Retry request arrived for taskId %s.", t.TaskId)
+
+	appInstanceId, taskStatus, errCode, msg := t.GetTaskStatus(t.TaskId)
+	if errCode != 0 {
+		t.SetFirstErrorCode(errCode, msg)
+		return workspace.TaskFinish
+	}
+	if taskStatus.Progress != meputil.TaskProgressFailure {
+		log.Errorf(nil, "Task %s is not failed.", t.TaskId)
+		t.SetFirstErrorCode(meputil.ForbiddenOperation, "only a failed task can be retried")
+		return workspace.TaskFinish
+	}
+
+	jobEntry, code := backend.GetRecord(meputil.AppDLCMFailedJobsPath + t.TaskId)
+	if code != 0 {
+		log.Errorf(nil, "Job of the failed task %s not found.", t.TaskId)
+		t.SetFirstErrorCode(workspace.ErrCode(code), "job of the failed task retrieval failed")
+		return workspace.TaskFinish
+	}
+	job := &models.AppDConfig{}
+	if err := json.Unmarshal(jobEntry, job); err != nil {
+		log.Errorf(nil, "Failed to parse the job of the failed task.")
+		t.SetFirstErrorCode(meputil.ParseInfoErr, "parse job of the failed task failed")
+		return workspace.TaskFinish
+	}
+
+	if errCode, msg = t.checkRetryAllowed(appInstanceId, job); errCode != 0 {
+		t.SetFirstErrorCode(errCode, msg)
+		return workspace.TaskFinish
+	}
+
+	taskId := meputil.GenerateUniqueId()
+	errCode, msg = t.StageNewTask(appInstanceId, taskId, job, false)
+	if errCode != 0 {
+		t.SetFirstErrorCode(errCode, msg)
+		return workspace.TaskFinish
+	}
+	// The job is retried only once, the new task keeps its own copy on failure
+	_ = backend.DeleteRecord(meputil.AppDLCMFailedJobsPath + t.TaskId)
+
+	t.worker.StartNewTask(job.AppName, appInstanceId, taskId)
+
+	log.Infof("Task %s retried as task %s.", t.TaskId, taskId)
+	t.HttpRsp = t.GenerateTaskResponse(taskId, appInstanceId, meputil.TaskStateProcessing, "0",
+		"Operation In progress")
+	return workspace.TaskFinish
+}
+
+func (t *TaskRetry) checkRetryAllowed(appInstanceId string, job *models.AppDConfig) (workspace.ErrCode, string) {
+	if t.IsAnyOngoingOperationExist(appInstanceId) {
+		log.Errorf(nil, "App instance has other operation in progress.")
+		return meputil.ForbiddenOperation, "app instance has other operation in progress"
+	}
+	if job.Operation == http.MethodPost {
+		if t.IsAppInstanceAlreadyCreated(appInstanceId) {
+			log.Errorf(nil, "Duplicate app instance.")
+			return meputil.DuplicateOperation, "duplicate app instance"
+		}
+		if t.IsDuplicateAppNameExists(job.AppName) {
+			log.Errorf(nil, "Duplicate app name.")
+			return meputil.DuplicateOperation, "duplicate app name"
+		}
+		return 0, ""
+	}
+	if !t.IsAppInstanceAlreadyCreated(appInstanceId) {
+		log.Errorf(nil, "App instance not found.")
+		return meputil.SerInstanceNotFound, "app instance not found"
+	}
+	return 0, ""
+}
+
+// TaskHistoryGet step to list the tasks of an app instance
+type TaskHistoryGet struct {
+	workspace.TaskBase
+	appd.AppDCommon
+	AppInstanceId string      `json:"appInstanceId,in"`
+	HttpRsp       interface{} `json:"httpRsp,out"`
+}
+
+// OnRequest handles the task history query
+func (t *TaskHistoryGet) OnRequest(data string) workspace.TaskCode {
+	log.Debugf("Query request arrived to fetch task history for appId %s.", t.AppInstanceId)
+
+	history, errCode := t.GetTaskHistory(t.AppInstanceId)
+	if errCode != 0 {
+		t.SetFirstErrorCode(workspace.ErrCode(errCode), "task history retrieval failed")
+		return workspace.TaskFinish
+	}
+	t.HttpRsp = history
+	return workspace.TaskFinish
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plans implements mep server mm5 interfaces
+package plans
+
+import (
+	"github.com/apache/servicecomb-service-center/pkg/log"
+	"mepserver/common/arch/workspace"
+	"mepserver/common/notification"
+	meputil "mepserver/common/util"
+	"net/http"
+)
+
+// DecodeDeadLetterReq step to decode the dead letter notification request
+type DecodeDeadLetterReq struct {
+	workspace.TaskBase
+	R          *http.Request `json:"r,in"`
+	DeliveryId string        `json:"deliveryId,out"`
+}
+
+// OnRequest handle dead letter request decoding
+func (t *DecodeDeadLetterReq) OnRequest(data string) workspace.TaskCode {
+	queryReq, _ := meputil.GetHTTPTags(t.R)
+	t.DeliveryId = queryReq.Get(":deliveryId")
+	if err := meputil.ValidateUUID(t.DeliveryId); err != nil {
+		log.Error("DeliveryId validation failed.", err)
+		t.SetFirstErrorCode(meputil.RequestParamErr, "deliveryId validation failed, invalid uuid")
+	}
+	return workspace.TaskFinish
+}
+
+// DeadLettersGet step to list the notifications failed permanently
+type DeadLettersGet struct {
+	workspace.TaskBase
+	HttpRsp interface{} `json:"httpRsp,out"`
+}
+
+// OnRequest handles the dead letter list query
+func (t *DeadLettersGet) OnRequest(data string) workspace.TaskCode {
+	deliveries, errCode := notification.GetDeadLetters()
+	if errCode != 0 {
+		log.Errorf(nil, "Get dead letter notifications from data-store failed.")
+		t.SetFirstErrorCode(workspace.ErrCode(errCode), "dead letter notifications retrieval failed")
+		return workspace.TaskFinish
+	}
+	t.HttpRsp = deliveries
+	return workspace.TaskFinish
+}
+
+// DeadLetterGet step to get a notification failed permanently
+type DeadLetterGet struct {
+	workspace.TaskBase
+	DeliveryId string      `json:"deliveryId,in"`
+	HttpRsp    interface{} `json:"httpRsp,out"`
+}
+
+// OnRequest handles the dead letter query
+func (t *DeadLetterGet) OnRequest(data string) workspace.TaskCode {
+	delivery, errCode := notification.GetDeadLetter(t.DeliveryId)
+	if errCode != 0 {
+		log.Errorf(nil, "Get dead letter notification from data-store failed.")
+		t.SetFirstErrorCode(workspace.ErrCode(errCode), "dead letter notification retrieval failed")
+		return workspace.TaskFinish
+	}
+	t.HttpRsp = delivery
+	return workspace.TaskFinish
+}
+
+// DeadLetterReplay step to queue a failed notification again for delivery
+type DeadLetterReplay struct {
+	workspace.TaskBase
+	DeliveryId string      `json:"deliveryId,in"`
+	HttpRsp    interface{} `json:"httpRsp,out"`
+}
+
+// OnRequest handles the dead letter replay
+func (t *DeadLetterReplay) OnRequest(data string) workspace.TaskCode {
+	delivery, errCode := notification.ReplayDeadLetter(t.DeliveryId)
+	if errCode != 0 {
+		log.Errorf(nil, "Replay dead letter notification failed.")
+		t.SetFirstErrorCode(workspace.ErrCode(errCode), "dead letter notification replay failed")
+		return workspace.TaskFinish
+	}
+	t.HttpRsp = delivery
+	return workspace.TaskFinish
+}
+
+// DeadLetterDelete step to discard a notification failed permanently
+type DeadLetterDelete struct {
+	workspace.TaskBase
+	DeliveryId string      `json:"deliveryId,in"`
+	HttpRsp    interface{} `json:"httpRsp,out"`
+}
+
+// OnRequest handles the dead letter delete
+func (t *DeadLetterDelete) OnRequest(data string) workspace.TaskCode {
+	if errCode := notification.DeleteDeadLetter(t.DeliveryId); errCode != 0 {
+		log.Errorf(nil, "Delete dead letter notification failed.")
+		t.SetFirstErrorCode(workspace.ErrCode(errCode), "dead letter notification delete failed")
+		return workspace.TaskFinish
+	}
+	t.HttpRsp = ""
+	return workspace.TaskFinish
+}
@@ -30,19 +30,20 @@ type appDJobDB struct {
 	appDConfig    *models.AppDConfig
 }
 
-func newAppDJobDB(appInstanceId string) *appDJobDB {
+// loadAppDJobDB reads the job, the error code tells a missing job apart from a failed read
+func loadAppDJobDB(appInstanceId string) (*appDJobDB, int) {
 	jobsEntry, errCode := backend.GetRecord(util.AppDLCMJobsPath + appInstanceId)
 	if errCode != 0 {
 		log.Errorf(nil, "Retrieve jobs from temp-cache on data-store failed.")
-		return nil
+		return nil, errCode
 	}
 	appDConfig := &models.AppDConfig{}
 	err := json.Unmarshal(jobsEntry, appDConfig)
 	if err != nil {
 		log.Errorf(nil, "Failed to parse the appd config from data-store.")
-		return nil
+		return nil, util.ParseInfoErr
 	}
-	return &appDJobDB{appInstanceId, appDConfig}
+	return &appDJobDB{appInstanceId, appDConfig}, 0
 }
 
 func (a *appDJobDB) deleteEntry() error {
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"encoding/json"
+	"runtime/debug"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	"mepserver/common/util"
+)
+
+// ResumePendingTasks recovers the sync tasks left in-flight by a stopped mep-server replica, the pending tasks are
+// checked periodically and a task is recovered only once the claim of its owner expired. A task is resumed from the
+// rule states recorded in its status, a task which was already reverting its rules is rolled back
+func (w *Worker) ResumePendingTasks() {
+	for {
+		interval := util.AppDTaskRecoveryInterval
+		if errCode := w.resumePendingTasks(); errCode != 0 {
+			log.Warnf("Retrieve pending jobs from data-store failed(%d), retrying.", errCode)
+			interval = util.AppDTaskRecoveryRetryInterval
+		}
+		time.Sleep(interval)
+	}
+}
+
+// resumePendingTasks makes one pass over the pending jobs
+func (w *Worker) resumePendingTasks() int {
+	jobs, errCode := backend.GetRecords(util.AppDLCMJobsPath)
+	if errCode != 0 {
+		return errCode
+	}
+	for appInstanceId := range w.unstagedJobs {
+		if _, ok := jobs[appInstanceId]; !ok {
+			delete(w.unstagedJobs, appInstanceId)
+		}
+	}
+	for appInstanceId, job := range jobs {
+		appDConfig := &models.AppDConfig{}
+		if err := json.Unmarshal(job, appDConfig); err != nil {
+			log.Errorf(nil, "Failed to parse the pending job(app-id: %s), discarding it.", appInstanceId)
+			_ = backend.DeletePaths([]string{util.AppDLCMJobsPath + appInstanceId}, true)
+			continue
+		}
+		w.recoverTask(appDConfig.AppName, appInstanceId, appDConfig.TaskId)
+	}
+	return 0
+}
+
+func (w *Worker) recoverTask(appName, appInstanceId, taskId string) {
+	if len(taskId) == 0 {
+		// Staged without a task reference, nothing is applied on the data-plane yet
+		log.Warnf("Pending job(app-id: %s) has no task, discarding it.", appInstanceId)
+		_ = backend.DeletePaths([]string{util.AppDLCMJobsPath + appInstanceId}, true)
+		return
+	}
+	if !acquireTask(taskId) {
+		log.Debugf("Pending task(app-id: %s, task-id: %s) is in progress.", appInstanceId, taskId)
+		return
+	}
+	// The job is read again as the task might have been completed after the pending jobs were listed
+	job, revision, isPending := pendingJob(appInstanceId, taskId)
+	if !isPending {
+		releaseTask(taskId)
+		return
+	}
+
+	taskStatus, errCode := loadStatusDB(appInstanceId, taskId)
+	if errCode == util.SubscriptionNotFound && w.isUnstaged(appInstanceId, revision) {
+		// Interrupted while staging, nothing is applied on the data-plane yet
+		log.Warnf("Pending job(app-id: %s, task-id: %s) has no task status, discarding it.", appInstanceId, taskId)
+		_ = backend.DeletePaths([]string{util.AppDLCMJobsPath + appInstanceId, util.AppDLCMTasksPath + taskId}, true)
+		releaseTask(taskId)
+		return
+	}
+	if errCode != 0 {
+		// Left for the next pass
+		releaseTask(taskId)
+		return
+	}
+	delete(w.unstagedJobs, appInstanceId)
+
+	if taskStatus.status.Progress == util.TaskProgressFailure {
+		// Rules already reverted, only the job is left to keep for a retry
+		log.Infof("Cleaning the failed task(app-id: %s, task-id: %s).", appInstanceId, taskId)
+		_ = backend.ApplyTxn(nil, []backend.Op{
+			backend.PutOp(util.AppDLCMFailedJobsPath+taskId, job),
+			backend.DeleteOp(util.AppDLCMJobsPath+appInstanceId, false),
+			backend.DeleteOp(util.AppDLCMTaskCancelPath+taskId, false),
+		})
+		releaseTask(taskId)
+		return
+	}
+
+	w.waitWorkerFinish.Add(1)
+	if len(taskStatus.status.Details) != 0 {
+		log.Infof("Rolling back the interrupted task(app-id: %s, task-id: %s).", appInstanceId, taskId)
+		go w.processAppDConfigRollback(appName, appInstanceId, taskId)
+		return
+	}
+	log.Infof("Resuming the interrupted task(app-id: %s, task-id: %s).", appInstanceId, taskId)
+	go w.ProcessAppDConfigSync(appName, appInstanceId, taskId)
+}
+
+// isUnstaged tells whether the job was found without its task status on the previous pass as well, the status is
+// written shortly after the job hence a job seen once might still be in staging
+func (w *Worker) isUnstaged(appInstanceId string, revision int64) bool {
+	if w.unstagedJobs == nil {
+		w.unstagedJobs = make(map[string]int64)
+	}
+	if w.unstagedJobs[appInstanceId] == revision {
+		delete(w.unstagedJobs, appInstanceId)
+		return true
+	}
+	w.unstagedJobs[appInstanceId] = revision
+	return false
+}
+
+// pendingJob reads the job of the app instance along with its revision, only if it still belongs to the task
+func pendingJob(appInstanceId, taskId string) ([]byte, int64, bool) {
+	job, revision, errCode := backend.GetRecordWithRevision(util.AppDLCMJobsPath + appInstanceId)
+	if errCode != 0 {
+		return nil, 0, false
+	}
+	appDConfig := &models.AppDConfig{}
+	if err := json.Unmarshal(job, appDConfig); err != nil {
+		return nil, 0, false
+	}
+	return job, revision, appDConfig.TaskId == taskId
+}
+
+// processAppDConfigRollback reverts the rules applied by an interrupted task and marks the task as failed
+func (w *Worker) processAppDConfigRollback(appName, appInstanceId, taskId string) {
+	defer w.waitWorkerFinish.Done()
+	defer releaseTask(taskId)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf(nil, "Rollback process panic: %v.\n %s", r, string(debug.Stack()))
+		}
+	}()
+
+	syncJob, errCode := newTask(appName, appInstanceId, taskId, w.dataPlane, w.dnsAgent, w.dnsTypeConfig)
+	if errCode == util.OperateDataWithEtcdErr {
+		log.Warnf("Task(app-id: %s, task-id: %s) not readable, left for the recovery.", appInstanceId, taskId)
+		return
+	}
+	if syncJob == nil {
+		log.Error("Failed to rollback the task, something went wrong.", nil)
+		_ = backend.DeletePaths([]string{util.AppDLCMJobsPath + appInstanceId}, true)
+		return
+	}
+	if err := syncJob.handleErrorOnProcessing(); err != nil {
+		log.Error(dataInconsistentError, err)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/extif/dataplane"
+	"mepserver/common/extif/dataplane/none"
+	"mepserver/common/models"
+	"mepserver/common/util"
+)
+
+const (
+	resumedAppInstanceId    = "0d9e83d8-f9b6-4d23-a5d9-4c2b6c4a1b01"
+	rolledBackAppInstanceId = "0d9e83d8-f9b6-4d23-a5d9-4c2b6c4a1b02"
+	failedAppInstanceId     = "0d9e83d8-f9b6-4d23-a5d9-4c2b6c4a1b03"
+	stagedAppInstanceId     = "0d9e83d8-f9b6-4d23-a5d9-4c2b6c4a1b04"
+	recoveryTaskId          = "6c8f1c55-6fd3-4a4d-a0f0-1b2d4f1f0c10"
+	errorInRecovery         = "Error in pending task recovery"
+)
+
+func stagePendingTask(t *testing.T, appInstanceId, taskId string, status *models.TaskStatus) {
+	job := &models.AppDConfig{
+		AppName:    "AppName",
+		AppDNSRule: []dataplane.DNSRule{{DNSRuleID: ruleId, DomainName: "www.example.com", IPAddress: exampleIPAddress}},
+		Operation:  http.MethodPost,
+		TaskId:     taskId,
+	}
+	jobBytes, _ := json.Marshal(job)
+	assert.Equal(t, 0, backend.PutRecord(util.AppDLCMJobsPath+appInstanceId, jobBytes), errorInRecovery)
+	assert.Equal(t, 0, backend.PutRecord(util.AppDLCMTasksPath+taskId, []byte(appInstanceId)), errorInRecovery)
+	if status != nil {
+		statusBytes, _ := json.Marshal(status)
+		assert.Equal(t, 0, backend.PutRecord(util.AppDLCMTaskStatusPath+appInstanceId+"/"+taskId, statusBytes),
+			errorInRecovery)
+	}
+}
+
+func readTaskStatus(appInstanceId, taskId string) *models.TaskStatus {
+	record, errCode := backend.GetRecord(util.AppDLCMTaskStatusPath + appInstanceId + "/" + taskId)
+	if errCode != 0 {
+		return nil
+	}
+	status := &models.TaskStatus{}
+	_ = json.Unmarshal(record, status)
+	return status
+}
+
+func TestResumePendingTasks(t *testing.T) {
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+
+	// Interrupted after the rule was applied on the data-plane
+	stagePendingTask(t, resumedAppInstanceId, recoveryTaskId, &models.TaskStatus{Progress: 0,
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitLocal, Method: util.OperCreate}}})
+	// Interrupted while reverting the rule
+	stagePendingTask(t, rolledBackAppInstanceId, recoveryTaskId+"2", &models.TaskStatus{Progress: 0,
+		Details:          "Failed in configuring dns rule on remote dns-server/data-plane.",
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitLocal, Method: util.OperCreate}}})
+	// Interrupted after the failure was recorded
+	stagePendingTask(t, failedAppInstanceId, recoveryTaskId+"3", &models.TaskStatus{
+		Progress: util.TaskProgressFailure, Details: "Failed in configuring dns rule on remote dns-server/data-plane.",
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitMp2, Method: util.OperCreate}}})
+	// Interrupted before the task status was written
+	stagePendingTask(t, stagedAppInstanceId, recoveryTaskId+"4", nil)
+
+	worker := &Worker{dataPlane: &none.NoneDataPlane{}, dnsTypeConfig: util.DnsAgentTypeDataPlane}
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+	worker.waitWorkerFinish.Wait()
+
+	// The job without a task status might still be in staging on the first pass
+	_, errCode := backend.GetRecord(util.AppDLCMJobsPath + stagedAppInstanceId)
+	assert.Equal(t, 0, errCode, errorInRecovery)
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+
+	jobs, _ := backend.GetRecords(util.AppDLCMJobsPath)
+	assert.Empty(t, jobs, errorInRecovery)
+
+	status := readTaskStatus(resumedAppInstanceId, recoveryTaskId)
+	assert.Equal(t, 1, status.Progress, errorInRecovery)
+	assert.Equal(t, util.WaitConfigDBWrite, status.DNSRuleStatusLst[0].State, errorInRecovery)
+	config, errCode := backend.GetRecord(util.AppDConfigKeyPath + resumedAppInstanceId)
+	assert.Equal(t, 0, errCode, errorInRecovery)
+	assert.NotContains(t, string(config), recoveryTaskId, errorInRecovery)
+
+	status = readTaskStatus(rolledBackAppInstanceId, recoveryTaskId+"2")
+	assert.Equal(t, util.TaskProgressFailure, status.Progress, errorInRecovery)
+	_, errCode = backend.GetRecord(util.AppDConfigKeyPath + rolledBackAppInstanceId)
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+
+	_, errCode = backend.GetRecord(util.AppDLCMTasksPath + recoveryTaskId + "4")
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+}
+
+func TestCancelTaskOnRequest(t *testing.T) {
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+
+	stagePendingTask(t, resumedAppInstanceId, recoveryTaskId, &models.TaskStatus{Progress: 0,
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitMp2, Method: util.OperCreate}}})
+	assert.Equal(t, 0, backend.PutRecord(util.AppDLCMTaskCancelPath+recoveryTaskId, []byte(resumedAppInstanceId)),
+		errorInRecovery)
+
+	worker := &Worker{dataPlane: &none.NoneDataPlane{}, dnsTypeConfig: util.DnsAgentTypeDataPlane}
+	worker.StartNewTask("AppName", resumedAppInstanceId, recoveryTaskId)
+	worker.waitWorkerFinish.Wait()
+
+	status := readTaskStatus(resumedAppInstanceId, recoveryTaskId)
+	assert.Equal(t, util.TaskProgressFailure, status.Progress, errorInRecovery)
+	assert.Equal(t, taskCancelledReason, status.Details, errorInRecovery)
+	assert.NotZero(t, status.UpdatedAt, errorInRecovery)
+
+	_, errCode := backend.GetRecord(util.AppDLCMJobsPath + resumedAppInstanceId)
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+	_, errCode = backend.GetRecord(util.AppDLCMTaskCancelPath + recoveryTaskId)
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+	failedJob, errCode := backend.GetRecord(util.AppDLCMFailedJobsPath + recoveryTaskId)
+	assert.Equal(t, 0, errCode, errorInRecovery)
+	assert.Contains(t, string(failedJob), http.MethodPost, errorInRecovery)
+}
+
+func TestResumePendingTasksSkipsActiveTask(t *testing.T) {
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+
+	stagePendingTask(t, resumedAppInstanceId, recoveryTaskId, &models.TaskStatus{Progress: 0,
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitMp2, Method: util.OperCreate}}})
+	assert.True(t, acquireTask(recoveryTaskId), errorInRecovery)
+	defer releaseTask(recoveryTaskId)
+
+	worker := &Worker{dataPlane: &none.NoneDataPlane{}, dnsTypeConfig: util.DnsAgentTypeDataPlane}
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+	worker.waitWorkerFinish.Wait()
+
+	_, errCode := backend.GetRecord(util.AppDLCMJobsPath + resumedAppInstanceId)
+	assert.Equal(t, 0, errCode, errorInRecovery)
+	status := readTaskStatus(resumedAppInstanceId, recoveryTaskId)
+	assert.Equal(t, util.WaitMp2, status.DNSRuleStatusLst[0].State, errorInRecovery)
+}
+
+func TestResumePendingTasksClaimedByOtherReplica(t *testing.T) {
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+
+	stagePendingTask(t, resumedAppInstanceId, recoveryTaskId, &models.TaskStatus{Progress: 0,
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitMp2, Method: util.OperCreate}}})
+	claimKey := util.AppDLCMTaskClaimPath + recoveryTaskId
+	claim, _ := json.Marshal(&backend.Claim{Owner: "other-replica",
+		ExpiresAt: util.CurrentTimeMillis() + time.Minute.Milliseconds()})
+	assert.Equal(t, 0, backend.PutRecord(claimKey, claim), errorInRecovery)
+
+	// Left to the replica running the task
+	worker := &Worker{dataPlane: &none.NoneDataPlane{}, dnsTypeConfig: util.DnsAgentTypeDataPlane}
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+	worker.waitWorkerFinish.Wait()
+	status := readTaskStatus(resumedAppInstanceId, recoveryTaskId)
+	assert.Equal(t, util.WaitMp2, status.DNSRuleStatusLst[0].State, errorInRecovery)
+
+	// Recovered once the claim of the stopped replica expires
+	claim, _ = json.Marshal(&backend.Claim{Owner: "other-replica", ExpiresAt: util.CurrentTimeMillis() - 1})
+	assert.Equal(t, 0, backend.PutRecord(claimKey, claim), errorInRecovery)
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+	worker.waitWorkerFinish.Wait()
+	_, errCode := backend.GetRecord(util.AppDLCMJobsPath + resumedAppInstanceId)
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+	_, errCode = backend.GetRecord(claimKey)
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+}
+
+// statusReadFailure fails the reads of the task status as an unavailable etcd would
+type statusReadFailure struct {
+	*backend.MemoryDatastore
+}
+
+func (s *statusReadFailure) List(ctx context.Context, prefix string,
+	options backend.ListOptions) (*backend.ListResult, error) {
+	if strings.HasPrefix(prefix, util.AppDLCMTaskStatusPath) {
+		return nil, fmt.Errorf("etcdserver: request timed out")
+	}
+	return s.MemoryDatastore.List(ctx, prefix, options)
+}
+
+func TestResumePendingTasksOnStatusReadFailure(t *testing.T) {
+	previousDB := backend.SetDB(&statusReadFailure{MemoryDatastore: backend.NewMemoryDatastore()})
+	defer backend.SetDB(previousDB)
+
+	stagePendingTask(t, resumedAppInstanceId, recoveryTaskId, &models.TaskStatus{Progress: 0,
+		DNSRuleStatusLst: []models.RuleStatus{{Id: ruleId, State: util.WaitMp2, Method: util.OperCreate}}})
+
+	// Kept for the next pass
+	worker := &Worker{dataPlane: &none.NoneDataPlane{}, dnsTypeConfig: util.DnsAgentTypeDataPlane}
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+	assert.Equal(t, 0, worker.resumePendingTasks(), errorInRecovery)
+	worker.waitWorkerFinish.Wait()
+	_, errCode := backend.GetRecord(util.AppDLCMJobsPath + resumedAppInstanceId)
+	assert.Equal(t, 0, errCode, errorInRecovery)
+	_, errCode = backend.GetRecord(util.AppDLCMTasksPath + recoveryTaskId)
+	assert.Equal(t, 0, errCode, errorInRecovery)
+	_, errCode = backend.GetRecord(util.AppDLCMTaskClaimPath + recoveryTaskId)
+	assert.NotEqual(t, 0, errCode, errorInRecovery)
+}
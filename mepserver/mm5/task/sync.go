@@ -28,6 +28,7 @@ import (
 	"mepserver/common/extif/dataplane"
 	"mepserver/common/extif/dns"
 	"mepserver/common/models"
+	"mepserver/common/notification"
 	"mepserver/common/util"
 	"net/http"
 	"os"
@@ -43,22 +44,41 @@ type Worker struct {
 	dnsTypeConfig    string
 	dataPlane        dataplane.DataPlane
 	dnsAgent         dns.DNSAgent
+	unstagedJobs     map[string]int64
 	appd.AppDCommon
 }
 
 const dataInconsistentError = "Failed to revert the data, this will lead to data inconsistency."
 const ExistRuleError = "existing rule expected"
+const taskCancelledReason = "Cancelled on request."
+
+var errTaskCancelled = fmt.Errorf("task cancelled on request")
+
+// heldTasks holds the claims of the tasks processed by this replica, a task is run by only one routine at a time
+var heldTasks sync.Map
+
+// taskClaim ownership of a task shared by the replicas, renewed in the data-store until the task is released
+type taskClaim struct {
+	key  string
+	stop chan struct{}
+	done chan struct{}
+}
 
 // InitializeWorker initialize worker instance
 func (w *Worker) InitializeWorker(dataPlane dataplane.DataPlane, dnsAgent dns.DNSAgent, dnsType string) *Worker {
 	w.dataPlane = dataPlane
 	w.dnsAgent = dnsAgent
 	w.dnsTypeConfig = dnsType
+	notification.RegisterSender(util.AppTerminateNotification, w.postTerminateNotification)
 	return w
 }
 
 // StartNewTask start new task for sync
 func (w *Worker) StartNewTask(appName, appInstanceId, taskId string) {
+	if !acquireTask(taskId) {
+		log.Infof("Appd sync task(task-id: %s) is already in progress.", taskId)
+		return
+	}
 	log.Infof("New appd sync task created(app-name: %s, app-id: %s, task-id: %s).", appName, appInstanceId, taskId)
 	w.waitWorkerFinish.Add(1)
 	go w.ProcessAppDConfigSync(appName, appInstanceId, taskId)
@@ -68,6 +88,7 @@ func (w *Worker) StartNewTask(appName, appInstanceId, taskId string) {
 // ProcessAppDConfigSync handles appd config sync
 func (w *Worker) ProcessAppDConfigSync(appName, appInstanceId, taskId string) {
 	defer w.waitWorkerFinish.Done()
+	defer releaseTask(taskId)
 	defer func() {
 		if r := recover(); r != nil {
 			log.Errorf(nil, "Sync process panic: %v.\n %s", r, string(debug.Stack()))
@@ -83,7 +104,11 @@ func (w *Worker) ProcessDataPlaneSync(appName, appInstanceId, taskId string) {
 		return
 	}
 
-	syncJob := newTask(appName, appInstanceId, taskId, w.dataPlane, w.dnsAgent, w.dnsTypeConfig)
+	syncJob, errCode := newTask(appName, appInstanceId, taskId, w.dataPlane, w.dnsAgent, w.dnsTypeConfig)
+	if errCode == util.OperateDataWithEtcdErr {
+		log.Warnf("Task(app-id: %s, task-id: %s) not readable, left for the recovery.", appInstanceId, taskId)
+		return
+	}
 	if syncJob == nil {
 		log.Error("Failed to process the task, something went wrong.", nil)
 		_ = backend.DeletePaths([]string{util.AppDLCMJobsPath + appInstanceId}, true)
@@ -116,6 +141,15 @@ func (w *Worker) ProcessDataPlaneSync(appName, appInstanceId, taskId string) {
 		}
 		return
 	}
+	if syncJob.isCancelRequested() {
+		log.Infof("Task(app-id: %s, task-id: %s) cancelled on request.", appInstanceId, taskId)
+		syncJob.statusDb.setFailureReason(taskCancelledReason)
+		err = syncJob.handleErrorOnProcessing()
+		if err != nil {
+			log.Error(dataInconsistentError, err)
+		}
+		return
+	}
 	err = syncJob.handleConfigDBWriteOnSuccess()
 	if err != nil {
 		log.Error("Failed to save appd config.", err)
@@ -151,18 +185,21 @@ type task struct {
 }
 
 func newTask(appName, appInstanceId, taskId string, dataPlane dataplane.DataPlane, dnsAgent dns.DNSAgent,
-	dnsType string) *task {
-	jobConfig := newAppDJobDB(appInstanceId)
+	dnsType string) (*task, int) {
+	jobConfig, errCode := loadAppDJobDB(appInstanceId)
 	if jobConfig == nil {
-		return nil
+		return nil, errCode
 	}
 	// No  need to check the return value, as this will fail for create request. Only required in modify and delete
 	appDConfig := newAppDConfigDB(appInstanceId)
 
-	taskStatus := newStatusDB(appInstanceId, taskId)
+	taskStatus, errCode := loadStatusDB(appInstanceId, taskId)
 	if taskStatus == nil {
-		_ = jobConfig.deleteEntry()
-		return nil
+		// The job is kept when the status could not be read, it is recovered later
+		if errCode != util.OperateDataWithEtcdErr {
+			_ = jobConfig.deleteEntry()
+		}
+		return nil, errCode
 	}
 
 	j := &task{
@@ -221,7 +258,7 @@ func newTask(appName, appInstanceId, taskId string, dataPlane dataplane.DataPlan
 		},
 	}
 
-	return j
+	return j, 0
 }
 
 // Generate a map of traffic rules based on the function type
@@ -326,6 +363,10 @@ func (t *task) processTrfEntryApply(trfNewRule *dataplane.TrafficRule, trfOldRul
 		if state < ruleStatus.State {
 			continue
 		}
+		if t.isCancelRequested() {
+			t.statusDb.setFailureReason(taskCancelledReason)
+			return errTaskCancelled
+		}
 		var err error
 		if operation != nil && operation.apply != nil {
 			log.Debugf("Traffic apply(method:%v, state: %v).", ruleStatus.Method, state)
@@ -417,6 +458,10 @@ func (t *task) processDNSEntryApply(dnsNewRule *dataplane.DNSRule, dnsOldRule *d
 		if state < ruleStatus.State {
 			continue
 		}
+		if t.isCancelRequested() {
+			t.statusDb.setFailureReason(taskCancelledReason)
+			return errTaskCancelled
+		}
 		var err error
 		if operation != nil && operation.apply != nil {
 			log.Debugf("DNS apply(method:%v, state: %v).", ruleStatus.Method, state)
@@ -712,10 +757,12 @@ func (t *task) handleConfigDBWriteOnSuccess() error {
 
 	operation := t.appDJobDb.appDConfig.Operation
 
-	// Cleaning the operation field to avoid it in save
-	t.appDJobDb.appDConfig.Operation = ""
+	// Cleaning the operation and task fields to avoid them in save, the job is kept as is for a retry on failure
+	appDConfig := *t.appDJobDb.appDConfig
+	appDConfig.Operation = ""
+	appDConfig.TaskId = ""
 
-	appDConfigBytes, err := json.Marshal(t.appDJobDb.appDConfig)
+	appDConfigBytes, err := json.Marshal(&appDConfig)
 	if err != nil {
 		log.Errorf(nil, "Can not marshal appd config info.")
 		return err
@@ -758,17 +805,90 @@ func (t *task) handleErrorOnProcessing() error {
 		return err
 	}
 
-	return t.cleanProcessingCache()
+	return t.cleanFailedProcessingCache()
 }
 
 // Handle any error cases during the process
 func (t *task) cleanProcessingCache() error {
-	if errCode := backend.DeletePaths([]string{util.AppDLCMJobsPath + t.appInstanceId}, false); errCode != 0 {
+	paths := []string{util.AppDLCMJobsPath + t.appInstanceId}
+	if len(t.taskId) != 0 {
+		paths = append(paths, util.AppDLCMTaskCancelPath+t.taskId)
+	}
+	if errCode := backend.DeletePaths(paths, false); errCode != 0 {
 		return fmt.Errorf("delete paths returned error(%d)", errCode)
 	}
 	return nil
 }
 
+// cleanFailedProcessingCache keeps the job of the failed task to retry it later
+func (t *task) cleanFailedProcessingCache() error {
+	jobBytes, err := json.Marshal(t.appDJobDb.appDConfig)
+	if err != nil {
+		log.Errorf(nil, "Can not marshal the job of the failed task.")
+		return t.cleanProcessingCache()
+	}
+	errCode := backend.ApplyTxn(nil, []backend.Op{
+		backend.PutOp(util.AppDLCMFailedJobsPath+t.taskId, jobBytes),
+		backend.DeleteOp(util.AppDLCMJobsPath+t.appInstanceId, false),
+		backend.DeleteOp(util.AppDLCMTaskCancelPath+t.taskId, false),
+	})
+	if errCode != 0 {
+		return fmt.Errorf("clean failed task returned error(%d)", errCode)
+	}
+	return nil
+}
+
+// acquireTask claims the task in the data-store, false if another routine or replica is processing it already
+func acquireTask(taskId string) bool {
+	key := util.AppDLCMTaskClaimPath + taskId
+	revision, claimed, errCode := backend.AcquireClaim(key, util.AppDTaskClaimTTL)
+	if errCode != 0 || !claimed {
+		return false
+	}
+	claim := &taskClaim{key: key, stop: make(chan struct{}), done: make(chan struct{})}
+	if _, loaded := heldTasks.LoadOrStore(taskId, claim); loaded {
+		return false
+	}
+	go claim.renew(revision)
+	return true
+}
+
+func releaseTask(taskId string) {
+	claim, loaded := heldTasks.LoadAndDelete(taskId)
+	if !loaded {
+		return
+	}
+	close(claim.(*taskClaim).stop)
+	<-claim.(*taskClaim).done
+}
+
+// renew keeps the claim alive while the task runs, a claim which could not be renewed expires with its ttl
+func (c *taskClaim) renew(revision int64) {
+	defer close(c.done)
+	ticker := time.NewTicker(util.AppDTaskClaimRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			backend.ReleaseClaim(c.key, revision)
+			return
+		case <-ticker.C:
+			renewed, claimed, errCode := backend.AcquireClaim(c.key, util.AppDTaskClaimTTL)
+			if errCode != 0 || !claimed {
+				log.Warnf("Task claim(%s) not renewed.", c.key)
+				continue
+			}
+			revision = renewed
+		}
+	}
+}
+
+// isCancelRequested checks the task is requested to be cancelled, the request holds the app instance of the task
+func (t *task) isCancelRequested() bool {
+	record, errCode := backend.GetRecord(util.AppDLCMTaskCancelPath + t.taskId)
+	return errCode == 0 && string(record) == t.appInstanceId
+}
+
 // TlsConfig Constructs tls configuration
 func tlsConfig() (*tls.Config, error) {
 	rootCAs := x509.NewCertPool()
@@ -784,6 +904,8 @@ func tlsConfig() (*tls.Config, error) {
 	}, nil
 }
 
+// sendTerminateNotification queues the termination notification, failed deliveries are retried by the notification
+// queue
 func (w *Worker) sendTerminateNotification(callbackUrl string, subscribeId string, appInstanceId string) error {
 	subscribeUri := bytes.ReplaceAll([]byte(util.EndAppSubscribePath), []byte(":appInstanceId"), []byte(appInstanceId))
 	confirmUri := bytes.ReplaceAll([]byte(util.ConfirmTerminationPath), []byte(":appInstanceId"), []byte(appInstanceId))
@@ -801,8 +923,15 @@ func (w *Worker) sendTerminateNotification(callbackUrl string, subscribeId strin
 		log.Errorf(nil, "Marshal failed with error %s.", err.Error())
 		return fmt.Errorf("marshal failed with error(%d)", err)
 	}
+
+	return notification.Enqueue(util.AppTerminateNotification, appInstanceId, subscribeId, callbackUrl, reqBody)
+}
+
+// postTerminateNotification delivers a queued termination notification to the app
+func (w *Worker) postTerminateNotification(delivery *models.NotificationDelivery) error {
+	callbackUrl := delivery.CallbackReference
 	// Create request
-	req, err := http.NewRequest("POST", callbackUrl, strings.NewReader(string(reqBody)))
+	req, err := http.NewRequest("POST", callbackUrl, strings.NewReader(string(delivery.Payload)))
 	if err != nil {
 		log.Errorf(nil, "Not able to send the request to application %s.", err.Error())
 		return fmt.Errorf("not able to send the request to application(%d)", err)
@@ -854,26 +983,19 @@ func (w *Worker) handleTerminationNotification(appInstanceId string) error {
 	if err != nil {
 		log.Error("Handle termination notification response failed, continue free resource", err)
 	}
-	// Clean up the resource
-	errCode := backend.DeleteRecord(util.AppConfirmTerminationPath + appInstanceId + "/")
-	if errCode != 0 {
-		log.Errorf(nil, "Delete confirm termination from etcd failed.")
-		return fmt.Errorf("delete confirm termination from etcd failed")
-	}
-	//Clear the terminate subscription
-	subscribeType := util.AppTerminationNotificationSubscription
-	errCode = backend.DeleteRecord(util.GetSubscribeKeyPath(subscribeType) + appInstanceId + "/")
+	// Clean up the termination confirmation and the subscriptions in one transaction
+	errCode := backend.DeletePaths([]string{
+		util.AppConfirmTerminationPath + appInstanceId + "/",
+		util.GetSubscribeKeyPath(util.AppTerminationNotificationSubscription) + appInstanceId + "/",
+		util.GetSubscribeKeyPath(util.SerAvailabilityNotificationSubscription) + appInstanceId + "/",
+	}, false)
 	if errCode != 0 {
-		log.Errorf(nil, "Delete termination notification subscription from etcd failed.")
-		return fmt.Errorf("delete termination notification subscription from etcd failed")
+		log.Errorf(nil, "Delete termination records from etcd failed.")
+		return fmt.Errorf("delete termination records from etcd failed")
 	}
-
-	//Clear the availability subscription subscription
-	subscribeType = util.SerAvailabilityNotificationSubscription
-	errCode = backend.DeleteRecord(util.GetSubscribeKeyPath(subscribeType) + appInstanceId + "/")
-	if errCode != 0 {
-		log.Errorf(nil, "Delete availability subscription  from etcd failed.")
-		return fmt.Errorf("availability subscription  from etcd failed")
+	notification.CloseAppWebsockets(appInstanceId)
+	if errCode = notification.PurgeSubscription(appInstanceId, ""); errCode != 0 {
+		log.Errorf(nil, "Purge notifications of the terminated app failed.")
 	}
 
 	log.Infof("Handle termination is completed for for %s.", appInstanceId) //Testing
@@ -30,6 +30,7 @@ import (
 	"mepserver/common/models"
 	"mepserver/common/util"
 	"net/http"
+	"os"
 	"testing"
 )
 
@@ -42,6 +43,12 @@ const ipAddFormatter = "%d.%d.%d.%d"
 var exampleIPAddress = fmt.Sprintf(ipAddFormatter, rand.Intn(maxIPVal), rand.Intn(maxIPVal), rand.Intn(maxIPVal),
 	rand.Intn(maxIPVal))
 
+// TestMain runs the package on the in-memory data-store, the records not patched by a test stay off etcd
+func TestMain(m *testing.M) {
+	backend.SetDB(backend.NewMemoryDatastore())
+	os.Exit(m.Run())
+}
+
 func TestProcessDataPlaneSync(t *testing.T) {
 
 	patch1 := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
@@ -82,8 +89,8 @@ func TestProcessDataPlaneSync(t *testing.T) {
 func TestProcessDataPlaneSyncForError(t *testing.T) {
 
 	patch1 := gomonkey.ApplyFunc(newTask, func(appName, appInstanceId string, taskId string,
-		dataPlane dataplane.DataPlane, dnsAgent dns.DNSAgent, dnsType string) *task {
-		return nil
+		dataPlane dataplane.DataPlane, dnsAgent dns.DNSAgent, dnsType string) (*task, int) {
+		return nil, util.SubscriptionNotFound
 	})
 	patch2 := gomonkey.ApplyFunc(backend.DeletePaths, func(paths []string, continueOnFailure bool) int {
 		return 0
@@ -228,12 +235,12 @@ func TestHandleConfigDBWriteOnSuccess(t *testing.T) {
 func TestNewTask(t *testing.T) {
 
 	appJobDB := &appDJobDB{appInstanceId: defaultAppInstanceId, appDConfig: &models.AppDConfig{AppName: "AppName"}}
-	patch1 := gomonkey.ApplyFunc(newAppDJobDB, func(path string) *appDJobDB {
-		return appJobDB
+	patch1 := gomonkey.ApplyFunc(loadAppDJobDB, func(path string) (*appDJobDB, int) {
+		return appJobDB, 0
 	})
 
-	patch2 := gomonkey.ApplyFunc(newStatusDB, func(appInstanceId, taskId string) *statusDB {
-		return nil
+	patch2 := gomonkey.ApplyFunc(loadStatusDB, func(appInstanceId, taskId string) (*statusDB, int) {
+		return nil, util.SubscriptionNotFound
 	})
 	patch3 := gomonkey.ApplyFunc(newAppDConfigDB, func(appInstanceId string) *appDConfigDB {
 		return nil
@@ -253,6 +260,21 @@ func TestNewTask(t *testing.T) {
 
 }
 
+func TestNewTaskKeepsJobOnReadFailure(t *testing.T) {
+	previousDB := backend.SetDB(&statusReadFailure{MemoryDatastore: backend.NewMemoryDatastore()})
+	defer backend.SetDB(previousDB)
+	stagePendingTask(t, resumedAppInstanceId, recoveryTaskId, nil)
+
+	worker := &Worker{dataPlane: &none.NoneDataPlane{}, dnsTypeConfig: util.DnsAgentTypeDataPlane}
+	worker.StartNewTask("AppName", resumedAppInstanceId, recoveryTaskId)
+	worker.waitWorkerFinish.Wait()
+
+	_, errCode := backend.GetRecord(util.AppDLCMJobsPath + resumedAppInstanceId)
+	assert.Equal(t, 0, errCode, "Job discarded on a transient read failure")
+	_, errCode = backend.GetRecord(util.AppDLCMTaskClaimPath + recoveryTaskId)
+	assert.NotEqual(t, 0, errCode, "Task claim not released")
+}
+
 func TestSetDNSOnLocalDns(t *testing.T) {
 
 	dnsRule := dataplane.DNSRule{DNSRuleID: ruleId, IPAddressType: "IP_V6", IPAddress: exampleIPAddress, State: "ACTIVE"}
@@ -32,20 +32,26 @@ type statusDB struct {
 }
 
 func newStatusDB(appInstanceId string, taskId string) *statusDB {
+	taskStatus, _ := loadStatusDB(appInstanceId, taskId)
+	return taskStatus
+}
+
+// loadStatusDB reads the task status, the error code tells a missing status apart from a failed read
+func loadStatusDB(appInstanceId string, taskId string) (*statusDB, int) {
 	path := util.AppDLCMTaskStatusPath + appInstanceId + "/" + taskId
 	statusEntry, errCode := backend.GetRecord(path)
 	if errCode != 0 {
 		log.Errorf(nil, "Retrieve task status from temp-cache on data-store failed.")
-		return nil
+		return nil, errCode
 	}
 	status := &models.TaskStatus{}
 	err := json.Unmarshal(statusEntry, status)
 	if err != nil {
 		log.Errorf(nil, "Failed to parse the task status from data-store.")
-		return nil
+		return nil, util.ParseInfoErr
 	}
 
-	return &statusDB{appInstanceId: appInstanceId, taskId: taskId, status: status}
+	return &statusDB{appInstanceId: appInstanceId, taskId: taskId, status: status}, 0
 }
 
 func (s *statusDB) searchRule(ruleList []models.RuleStatus, ruleId string) int {
@@ -103,6 +109,7 @@ func (s *statusDB) setStateAndProgress(ruleType util.AppDRuleType, ruleId string
 func (s *statusDB) pushDB() error {
 	path := util.AppDLCMTaskStatusPath + s.appInstanceId + "/" + s.taskId
 
+	s.status.UpdatedAt = util.CurrentTimeMillis()
 	statusBytes, err := json.Marshal(s.status)
 	if err != nil {
 		log.Errorf(nil, "Can not marshal task status info.")
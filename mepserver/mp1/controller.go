@@ -151,13 +151,20 @@ func (m *Mp1Service) URLPatterns() []rest.Route {
 		{Method: rest.HTTP_METHOD_POST, Path: meputil.ConfirmTerminationPath, Func: m.confirmTermination},
 		// provider app callback the consumer app
 		{Method: rest.HTTP_METHOD_POST, Path: meputil.CallbackPath, Func: m.callbackApp},
+		// websocket notifications
+		{Method: rest.HTTP_METHOD_GET, Path: meputil.AppSubscribePath + meputil.SubscriptionIdPath +
+			meputil.WebsocketPath, Func: m.appSubscribeWebsocket},
+		{Method: rest.HTTP_METHOD_GET, Path: meputil.EndAppSubscribePath + meputil.SubscriptionIdPath +
+			meputil.WebsocketPath, Func: m.appEndSubscribeWebsocket},
 	}
 }
 
 func (m *Mp1Service) appEndSubscribe(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try((&plans.DecodeRestReq{}).WithBody(&models.AppTerminationNotificationSubscription{}),
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsWrite),
+		(&plans.DecodeRestReq{}).WithBody(&models.AppTerminationNotificationSubscription{}),
 		(&plans.AppSubscribeLimit{}).WithType(meputil.AppTerminationNotificationSubscription),
 		(&plans.SubscribeIst{}).WithType(meputil.AppTerminationNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusCreated})
@@ -169,6 +176,7 @@ func (m *Mp1Service) getAppEndSubscribes(w http.ResponseWriter, r *http.Request)
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsRead),
 		&plans.DecodeRestReq{},
 		(&plans.GetSubscribes{}).WithType(meputil.AppTerminationNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -180,6 +188,7 @@ func (m *Mp1Service) getEndAppOneSubscribe(w http.ResponseWriter, r *http.Reques
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsRead),
 		&plans.DecodeRestReq{},
 		(&plans.GetOneSubscribe{}).WithType(meputil.AppTerminationNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -191,6 +200,7 @@ func (m *Mp1Service) delEndAppOneSubscribe(w http.ResponseWriter, r *http.Reques
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsWrite),
 		&plans.DecodeRestReq{},
 		(&plans.DelOneSubscribe{}).WithType(meputil.AppTerminationNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
@@ -198,10 +208,23 @@ func (m *Mp1Service) delEndAppOneSubscribe(w http.ResponseWriter, r *http.Reques
 	workspace.WkRun(workPlan)
 }
 
+func (m *Mp1Service) appEndSubscribeWebsocket(w http.ResponseWriter, r *http.Request) {
+
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsRead),
+		&plans.DecodeRestReq{},
+		(&plans.SubscribeWebsocket{}).WithType(meputil.AppTerminationNotificationSubscription))
+	workPlan.Finally(&common.SendHttpRsp{})
+
+	workspace.WkRun(workPlan)
+}
+
 func (m *Mp1Service) doAppSubscribe(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsWrite),
 		(&plans.DecodeRestReq{}).WithBody(&models.SerAvailabilityNotificationSubscription{}),
 		(&plans.AppSubscribeLimit{}).WithType(meputil.SerAvailabilityNotificationSubscription),
 		(&plans.SubscribeIst{}).WithType(meputil.SerAvailabilityNotificationSubscription))
@@ -210,10 +233,23 @@ func (m *Mp1Service) doAppSubscribe(w http.ResponseWriter, r *http.Request) {
 	workspace.WkRun(workPlan)
 }
 
+func (m *Mp1Service) appSubscribeWebsocket(w http.ResponseWriter, r *http.Request) {
+
+	workPlan := NewWorkSpace(w, r)
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsRead),
+		&plans.DecodeRestReq{},
+		(&plans.SubscribeWebsocket{}).WithType(meputil.SerAvailabilityNotificationSubscription))
+	workPlan.Finally(&common.SendHttpRsp{})
+
+	workspace.WkRun(workPlan)
+}
+
 func (m *Mp1Service) getAppSubscribes(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsRead),
 		&plans.DecodeRestReq{},
 		(&plans.GetSubscribes{}).WithType(meputil.SerAvailabilityNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -225,6 +261,7 @@ func (m *Mp1Service) getOneAppSubscribe(w http.ResponseWriter, r *http.Request)
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsRead),
 		&plans.DecodeRestReq{},
 		(&plans.GetOneSubscribe{}).WithType(meputil.SerAvailabilityNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -236,6 +273,7 @@ func (m *Mp1Service) delOneAppSubscribe(w http.ResponseWriter, r *http.Request)
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeSubscriptionsWrite),
 		&plans.DecodeRestReq{},
 		(&plans.DelOneSubscribe{}).WithType(meputil.SerAvailabilityNotificationSubscription))
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
@@ -247,6 +285,7 @@ func (m *Mp1Service) serviceRegister(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesWrite),
 		(&plans.DecodeRestReq{}).WithBody(&models.ServiceInfo{}),
 		&plans.RegisterLimit{},
 		&plans.RegisterServiceId{},
@@ -260,6 +299,7 @@ func (m *Mp1Service) serviceDiscover(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesRead),
 		&DiscoverDecode{},
 		&DiscoverService{},
 		&ToStrDiscover{},
@@ -273,6 +313,7 @@ func (m *Mp1Service) serviceUpdate(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesWrite),
 		(&plans.DecodeRestReq{}).WithBody(&models.ServiceInfo{}),
 		&plans.UpdateInstance{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -284,6 +325,7 @@ func (m *Mp1Service) getOneService(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesRead),
 		&plans.GetOneDecode{},
 		&plans.GetOneInstance{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -296,6 +338,7 @@ func (m *Mp1Service) serviceDelete(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesWrite),
 		&plans.DecodeRestReq{},
 		&plans.DeleteService{})
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
@@ -307,6 +350,7 @@ func (m *Mp1Service) getDnsRules(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeDnsRulesRead),
 		&plans.DecodeDnsRestReq{},
 		&plans.DNSRulesGet{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -318,6 +362,7 @@ func (m *Mp1Service) getDnsRule(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeDnsRulesRead),
 		&plans.DecodeDnsRestReq{},
 		&plans.DNSRuleGet{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -328,6 +373,7 @@ func (m *Mp1Service) getDnsRule(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) dnsRuleUpdate(w http.ResponseWriter, r *http.Request) {
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeDnsRulesWrite),
 		(&plans.DecodeDnsRestReq{}).WithBody(&dataplane.DNSRule{}),
 		(&plans.DNSRuleUpdate{}).WithDNSAgent(m.dnsAgent).WithDataPlane(m.dataPlane))
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -338,6 +384,7 @@ func (m *Mp1Service) dnsRuleUpdate(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) getHeartbeat(w http.ResponseWriter, r *http.Request) {
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesRead),
 		&plans.GetOneDecodeHeartbeat{},
 		&plans.GetOneInstanceHeartbeat{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -348,6 +395,7 @@ func (m *Mp1Service) getHeartbeat(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) heartbeatService(w http.ResponseWriter, r *http.Request) {
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeServicesWrite),
 		(&plans.DecodeHeartbeatRestReq{}).WithBodies(&models.ServiceLivenessUpdate{}),
 		&plans.UpdateHeartbeat{})
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
@@ -359,6 +407,7 @@ func (m *Mp1Service) getTrafficRules(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeTrafficRulesRead),
 		&plans.DecodeTrafficRestReq{},
 		&plans.TrafficRulesGet{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -370,6 +419,7 @@ func (m *Mp1Service) getTrafficRule(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeTrafficRulesRead),
 		&plans.DecodeTrafficRestReq{},
 		&plans.TrafficRuleGet{})
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -380,6 +430,7 @@ func (m *Mp1Service) getTrafficRule(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) trafficRuleUpdate(w http.ResponseWriter, r *http.Request) {
 	workPlan := NewWorkSpace(w, r)
 	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeTrafficRulesWrite),
 		(&plans.DecodeTrafficRestReq{}).WithBody(&dataplane.TrafficRule{}),
 		(&plans.TrafficRuleUpdate{}).WithDataPlane(m.dataPlane))
 	workPlan.Finally(&common.SendHttpRsp{})
@@ -390,7 +441,9 @@ func (m *Mp1Service) trafficRuleUpdate(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) getCurrentTime(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try(&plans.CurrentTimeGet{})
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeTimingRead),
+		&plans.CurrentTimeGet{})
 	workPlan.Finally(&common.SendHttpRsp{})
 
 	workspace.WkRun(workPlan)
@@ -399,7 +452,9 @@ func (m *Mp1Service) getCurrentTime(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) getTimingCaps(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try(&plans.TimingCaps{})
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeTimingRead),
+		&plans.TimingCaps{})
 	workPlan.Finally(&common.SendHttpRsp{})
 
 	workspace.WkRun(workPlan)
@@ -408,7 +463,9 @@ func (m *Mp1Service) getTimingCaps(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) getTransports(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try(&plans.Transports{})
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeTransportsRead),
+		&plans.Transports{})
 	workPlan.Finally(&common.SendHttpRsp{})
 
 	workspace.WkRun(workPlan)
@@ -417,7 +474,9 @@ func (m *Mp1Service) getTransports(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) confirmReady(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try((&plans.DecodeConfirmReadyReq{}).WithBody(&models.ConfirmReady{}),
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeAppLifecycleWrite),
+		(&plans.DecodeConfirmReadyReq{}).WithBody(&models.ConfirmReady{}),
 		&plans.ConfirmReady{})
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
 
@@ -427,7 +486,9 @@ func (m *Mp1Service) confirmReady(w http.ResponseWriter, r *http.Request) {
 func (m *Mp1Service) confirmTermination(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try((&plans.DecodeConfirmTerminateReq{}).WithBody(&models.ConfirmTermination{}),
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeAppLifecycleWrite),
+		(&plans.DecodeConfirmTerminateReq{}).WithBody(&models.ConfirmTermination{}),
 		&plans.ConfirmTermination{})
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
 
@@ -437,7 +498,9 @@ func (m *Mp1Service) confirmTermination(w http.ResponseWriter, r *http.Request)
 func (m *Mp1Service) callbackApp(w http.ResponseWriter, r *http.Request) {
 
 	workPlan := NewWorkSpace(w, r)
-	workPlan.Try(&plans.Callback{})
+	workPlan.Try(
+		(&plans.ValidateScope{}).WithScope(meputil.ScopeAppLifecycleWrite),
+		&plans.Callback{})
 	workPlan.Finally(&common.SendHttpRsp{StatusCode: http.StatusNoContent})
 
 	workspace.WkRun(workPlan)
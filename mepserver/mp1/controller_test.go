@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/beevik/ntp"
+	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/ghodss/yaml"
 	"io"
 	"io/ioutil"
@@ -38,6 +39,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -47,11 +49,9 @@ import (
 	_ "github.com/apache/servicecomb-service-center/server"
 	_ "github.com/apache/servicecomb-service-center/server/bootstrap"
 	pb "github.com/apache/servicecomb-service-center/server/core/proto"
-	scerr "github.com/apache/servicecomb-service-center/server/error"
 	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry/buildin"
 	srv "github.com/apache/servicecomb-service-center/server/service"
-	svcutil "github.com/apache/servicecomb-service-center/server/service/util"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -78,11 +78,18 @@ const getDnsRulesUrlFormat = "/mep/mec_app_support/v1/applications/%s/dns_rules"
 const getDnsRuleUrlFormat = "/mep/mec_app_support/v1/applications/%s/dns_rules/%s"
 const appInstanceQueryFormat = ":appInstanceId=%s&;"
 const appIdAndDnsRuleIdQueryFormat = ":appInstanceId=%s&;:dnsRuleId=%s&;"
+const appIdAndDnsRuleIdQuery = ":appInstanceId=%s&:dnsRuleId=%s"
 const appIdAndTrafficRuleIdQueryFormat = ":appInstanceId=%s&;:trafficRuleId=%s&;"
 const appInstanceIdHeader = "X-AppinstanceID"
 const responseStatusHeader = "X-Response-Status"
+
+// allScopes grants every mp1 operation to the requests of the tests
+var allScopes = strings.Join([]string{util.ScopeServicesRead, util.ScopeServicesWrite, util.ScopeSubscriptionsRead,
+	util.ScopeSubscriptionsWrite, util.ScopeDnsRulesRead, util.ScopeDnsRulesWrite, util.ScopeTrafficRulesRead,
+	util.ScopeTrafficRulesWrite, util.ScopeTimingRead, util.ScopeTransportsRead, util.ScopeAppLifecycleWrite}, " ")
 const responseCheckFor200 = "Response status code must be 200"
 const responseCheckFor400 = "Response status code must be 404"
+const responseCheckFor412 = "Response status code must be 412"
 const errorWriteRespErr = "Write Response Error"
 const exampleDomainName = "www.example.com"
 const defaultTTL = 30
@@ -257,6 +264,7 @@ func TestGetsTrafficRules(t *testing.T) {
 	defer patches.Reset()
 
 	// 21 is the order of the traffic get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[21].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -304,6 +312,7 @@ func TestGetTrafficRules(t *testing.T) {
 	defer patches.Reset()
 
 	// 22 is the order of the traffic get one handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[22].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -349,18 +358,22 @@ func TestPutTrafficRule(t *testing.T) {
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	patches := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		TrafficRule := dataplane.TrafficRule{TrafficRuleID: trafficRuleId, FilterType: "FLOW", Priority: 5,
 			Action: "DROP", State: util.InactiveState}
 		var TrafficRules []dataplane.TrafficRule
 		TrafficRules = append(TrafficRules, TrafficRule)
 		entry := models.AppDConfig{AppTrafficRule: TrafficRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patches.Reset()
 
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -407,6 +420,7 @@ func TestGetDnsRules(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[13].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -446,6 +460,7 @@ func TestGetEmptyDnsRules(t *testing.T) {
 	})
 	defer patches.Reset()
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[13].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -482,6 +497,7 @@ func TestGetEmptyDnsRulesAppInstanceIdUnMatched(t *testing.T) {
 	mockWriter.On("WriteHeader", 401)
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[13].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "401", responseHeader.Get(responseStatusHeader),
@@ -519,6 +535,7 @@ func TestGetEmptyDnsRulesAppInstanceIdInvalid(t *testing.T) {
 	mockWriter.On("WriteHeader", 400)
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[13].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -565,6 +582,7 @@ func TestGetSingleDnsRule(t *testing.T) {
 	defer patches.Reset()
 
 	// 14 is the order of the DNS get one handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[14].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -601,6 +619,7 @@ func TestGetSingleDnsRuleNotFound(t *testing.T) {
 	mockWriter.On("WriteHeader", 404)
 
 	// 14 is the order of the DNS get one handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[14].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "404", responseHeader.Get(responseStatusHeader),
@@ -636,6 +655,7 @@ func TestGetSingleDnsRuleNoId(t *testing.T) {
 	mockWriter.On("WriteHeader", 401)
 
 	// 14 is the order of the DNS get one handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[14].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "401", responseHeader.Get(responseStatusHeader),
@@ -680,18 +700,22 @@ func TestPutSingleDnsRule(t *testing.T) {
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	patches := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4", IPAddress: exampleIPAddress,
 			TTL: 30, State: util.InactiveState}
 		var dnsRules []dataplane.DNSRule
 		dnsRules = append(dnsRules, dnsRule)
 		entry := models.AppDConfig{AppDNSRule: dnsRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patches.Reset()
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -781,18 +805,22 @@ dataplane:
 
 	mockWriter.On("WriteHeader", 200)
 
-	patch1 := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patch1 := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4", IPAddress: exampleIPAddress,
 			TTL: 30, State: util.InactiveState}
 		var dnsRules []dataplane.DNSRule
 		dnsRules = append(dnsRules, dnsRule)
 		entry := models.AppDConfig{AppDNSRule: dnsRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patch1.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patch1.Reset()
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -845,14 +873,17 @@ func TestPutSingleDnsRuleReActive(t *testing.T) {
 		}
 	}))
 	defer ts.Close()
-	patch1 := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patch1 := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4", IPAddress: exampleIPAddress,
 			TTL: 30, State: util.ActiveState}
 		var dnsRules []dataplane.DNSRule
 		dnsRules = append(dnsRules, dnsRule)
 		entry := models.AppDConfig{AppDNSRule: dnsRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patch1.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	patch2 := gomonkey.ApplyFunc(dns.NewRestDNSAgent, func(config *config.MepServerConfig) *dns.RestDNSAgent {
 		parse, _ := url.Parse(ts.URL)
@@ -863,6 +894,7 @@ func TestPutSingleDnsRuleReActive(t *testing.T) {
 	defer patch2.Reset()
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -951,18 +983,22 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	patch1 := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patch1 := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4", IPAddress: exampleIPAddress,
 			TTL: 30, State: util.ActiveState}
 		var dnsRules []dataplane.DNSRule
 		dnsRules = append(dnsRules, dnsRule)
 		entry := models.AppDConfig{AppDNSRule: dnsRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patch1.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patch1.Reset()
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -1036,18 +1072,22 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 503)
 
-	patch1 := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patch1 := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4", IPAddress: exampleIPAddress,
 			TTL: 30, State: util.InactiveState}
 		var dnsRules []dataplane.DNSRule
 		dnsRules = append(dnsRules, dnsRule)
 		entry := models.AppDConfig{AppDNSRule: dnsRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patch1.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patch1.Reset()
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "503", responseHeader.Get(responseStatusHeader),
@@ -1136,19 +1176,23 @@ dataplane:
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 503)
 
-	patch1 := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patch1 := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4", IPAddress: exampleIPAddress,
 			TTL: 30, State: util.InactiveState}
 		var dnsRules []dataplane.DNSRule
 		dnsRules = append(dnsRules, dnsRule)
 		entry := models.AppDConfig{AppDNSRule: dnsRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patch1.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 
 	defer patch1.Reset()
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "503", responseHeader.Get(responseStatusHeader),
@@ -1184,6 +1228,7 @@ func TestPutSingleDnsRuleNotFound(t *testing.T) {
 	mockWriter.On("WriteHeader", 404)
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "404", responseHeader.Get(responseStatusHeader),
@@ -1219,6 +1264,7 @@ func TestPutSingleDnsRuleBodyParseError(t *testing.T) {
 	mockWriter.On("WriteHeader", 400)
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -1259,6 +1305,7 @@ func TestPutSingleDnsRuleOverLengthBody(t *testing.T) {
 	mockWriter.On("WriteHeader", 400)
 
 	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[15].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -1267,6 +1314,120 @@ func TestPutSingleDnsRuleOverLengthBody(t *testing.T) {
 	mockWriter.AssertExpectations(t)
 }
 
+// Update a dns rule with a stale e-tag
+func TestPutSingleDnsRuleETagMissMatch(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+
+	updateRule := dataplane.DNSRule{
+		DNSRuleID:     dnsRuleId,
+		DomainName:    exampleDomainName,
+		IPAddressType: util.IPv4Type,
+		IPAddress:     exampleIPAddress,
+		TTL:           defaultTTL,
+		State:         util.ActiveState,
+	}
+	updateRuleBytes, _ := json.Marshal(updateRule)
+
+	// Create http get request
+	getRequest, _ := http.NewRequest("PUT",
+		fmt.Sprintf(getDnsRuleUrlFormat, defaultAppInstanceId, dnsRuleId),
+		bytes.NewReader(updateRuleBytes))
+	getRequest.URL.RawQuery = fmt.Sprintf(appIdAndDnsRuleIdQuery, defaultAppInstanceId, dnsRuleId)
+	getRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+	getRequest.Header.Set(util.IfMatchHeader, "\"stale\"")
+
+	// Mock the response writer
+	mockWriter := &mockHttpWriter{}
+	responseHeader := http.Header{} // Create http response header
+	mockWriter.On("Header").Return(responseHeader)
+	mockWriter.On("Write",
+		[]byte("{\"title\":\"Precondition failed\",\"status\":10,\"detail\":\"e-tag miss-match\"}\n")).
+		Return(0, nil)
+	mockWriter.On("WriteHeader", 412)
+
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
+		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4",
+			IPAddress: exampleIPAddress, TTL: defaultTTL, State: util.InactiveState}
+		entry := models.AppDConfig{AppDNSRule: []dataplane.DNSRule{dnsRule}}
+		outBytes, _ := json.Marshal(&entry)
+		return outBytes, 1, 0
+	})
+	defer patches.Reset()
+
+	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
+	service.URLPatterns()[15].Func(mockWriter, getRequest)
+
+	assert.Equal(t, "412", responseHeader.Get(responseStatusHeader),
+		responseCheckFor412)
+
+	mockWriter.AssertExpectations(t)
+}
+
+// Update a dns rule modified by another request after it was read
+func TestPutSingleDnsRuleConcurrentUpdate(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+
+	updateRule := dataplane.DNSRule{
+		DNSRuleID:     dnsRuleId,
+		DomainName:    exampleDomainName,
+		IPAddressType: util.IPv4Type,
+		IPAddress:     exampleIPAddress,
+		TTL:           defaultTTL,
+		State:         util.ActiveState,
+	}
+	updateRuleBytes, _ := json.Marshal(updateRule)
+
+	// Create http get request
+	getRequest, _ := http.NewRequest("PUT",
+		fmt.Sprintf(getDnsRuleUrlFormat, defaultAppInstanceId, dnsRuleId),
+		bytes.NewReader(updateRuleBytes))
+	getRequest.URL.RawQuery = fmt.Sprintf(appIdAndDnsRuleIdQuery, defaultAppInstanceId, dnsRuleId)
+	getRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+
+	// Mock the response writer
+	mockWriter := &mockHttpWriter{}
+	responseHeader := http.Header{} // Create http response header
+	mockWriter.On("Header").Return(responseHeader)
+	mockWriter.On("Write",
+		[]byte("{\"title\":\"Precondition failed\",\"status\":10,\"detail\":\"dns rule modified concurrently\"}\n")).
+		Return(0, nil)
+	mockWriter.On("WriteHeader", 412)
+
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
+		dnsRule := dataplane.DNSRule{DNSRuleID: dnsRuleId, DomainName: exampleDomainName, IPAddressType: "IP_V4",
+			IPAddress: exampleIPAddress, TTL: defaultTTL, State: util.InactiveState}
+		entry := models.AppDConfig{AppDNSRule: []dataplane.DNSRule{dnsRule}}
+		outBytes, _ := json.Marshal(&entry)
+		return outBytes, 1, 0
+	})
+	defer patches.Reset()
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return util.EtagMissMatchErr
+	})
+
+	// 15 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
+	service.URLPatterns()[15].Func(mockWriter, getRequest)
+
+	assert.Equal(t, "412", responseHeader.Get(responseStatusHeader),
+		responseCheckFor412)
+
+	mockWriter.AssertExpectations(t)
+}
+
 //============================APP SERVICE AVAILABILITY SUBSCRIPTION=========================================
 // Post App service availability Notification
 func TestAppSubscribePost(t *testing.T) {
@@ -1324,6 +1485,7 @@ func TestAppSubscribePost(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 201)
 
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	assert.Equal(t, "201", responseHeader.Get(responseStatusHeader),
@@ -1364,6 +1526,7 @@ func TestAppSubscribePostWrongJsonBody(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -1441,6 +1604,7 @@ func TestAppSubscribePostJsonMarshallFail(t *testing.T) {
 	mockWriter.On("Header").Return(responseHeader)
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	respError := models.ProblemDetails{}
@@ -1509,6 +1673,9 @@ func TestAppSubscribePostDbFail(t *testing.T) {
 	patch1.ApplyMethod(reflect.TypeOf(ec), "TxnWithCmp", func(t *buildin.BuildinRegistry, ctx context.Context, success []registry.PluginOp, cmp []registry.CompareOp, fail []registry.PluginOp) (*registry.PluginResponse, error) {
 		return nil, fmt.Errorf("db error")
 	})
+	patch1.ApplyMethod(reflect.TypeOf(ec), "Do", func(t *buildin.BuildinRegistry, ctx context.Context, opts ...registry.PluginOpOption) (*registry.PluginResponse, error) {
+		return nil, fmt.Errorf("db error")
+	})
 	// Create http get request
 	postRequest, _ := http.NewRequest("POST",
 		fmt.Sprintf(postSubscribeUrl, defaultAppInstanceId),
@@ -1522,6 +1689,7 @@ func TestAppSubscribePostDbFail(t *testing.T) {
 	mockWriter.On("Header").Return(responseHeader)
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	respError := models.ProblemDetails{}
@@ -1595,6 +1763,13 @@ func TestAppSubscribePostRspCountExceeds(t *testing.T) {
 			Count:     51,
 		}, nil
 	})
+	patch1.ApplyMethod(reflect.TypeOf(ec), "Do", func(t *buildin.BuildinRegistry, ctx context.Context, opts ...registry.PluginOpOption) (*registry.PluginResponse, error) {
+		return &registry.PluginResponse{
+			Revision: 1,
+			Kvs:      nil,
+			Count:    51,
+		}, nil
+	})
 	// Create http get request
 	postRequest, _ := http.NewRequest("POST",
 		fmt.Sprintf(postSubscribeUrl, defaultAppInstanceId),
@@ -1608,6 +1783,7 @@ func TestAppSubscribePostRspCountExceeds(t *testing.T) {
 	mockWriter.On("Header").Return(responseHeader)
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	respError := models.ProblemDetails{}
@@ -1640,6 +1816,7 @@ func TestAppSubscribeGetAll(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[1].Func(mockWriterGet, getRequest)
 }
 
@@ -1666,6 +1843,7 @@ func TestGetOneAppSubscribe(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[2].Func(mockWriterGet, getRequest)
 }
 
@@ -1692,6 +1870,7 @@ func TestDelOneAppSubscribe(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[3].Func(mockWriterGet, getRequest)
 }
 
@@ -1734,6 +1913,7 @@ func TestAppTerminationSubscribePost(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 201)
 
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[9].Func(mockWriter, postRequest)
 
 	assert.Equal(t, "201", responseHeader.Get(responseStatusHeader),
@@ -1744,6 +1924,152 @@ func TestAppTerminationSubscribePost(t *testing.T) {
 	mockWriter.AssertExpectations(t)
 }
 
+var websocketSubscriptionRecord []byte
+
+// Post App termination Notification subscription requesting the websocket
+func TestAppTerminationSubscribePostWebsocket(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+	createSubscription := models.AppTerminationNotificationSubscription{
+		SubscriptionType:   "AppTerminationNotificationSubscription",
+		WebsockNotifConfig: &models.WebsockNotifConfig{RequestWebsocketUri: true},
+		AppInstanceId:      "6abe4782-2c70-4e47-9a4e-0ee3a1a0fd1e",
+	}
+	createSubscriptionBytes, _ := json.Marshal(createSubscription)
+	postRequest, _ := http.NewRequest("POST",
+		fmt.Sprintf(postAppTerminologiesUrl, defaultAppInstanceId),
+		bytes.NewReader(createSubscriptionBytes))
+	postRequest.URL.RawQuery = fmt.Sprintf(appInstanceQueryFormat, defaultAppInstanceId)
+	postRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+	postRequest.Header.Set("X-Forwarded-Proto", "https")
+	postRequest.Host = "mep-api-gw.mep:8443"
+
+	mockWriter := &mockHttpWriterWithoutWrite{}
+	responseHeader := http.Header{}
+	mockWriter.On("Header").Return(responseHeader)
+	mockWriter.On("Write").Return(0, nil)
+	mockWriter.On("WriteHeader", 201)
+
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
+	service.URLPatterns()[9].Func(mockWriter, postRequest)
+
+	assert.Equal(t, "201", responseHeader.Get(responseStatusHeader), responseCheckFor201)
+	subscription := models.AppTerminationNotificationSubscription{}
+	_ = json.Unmarshal(mockWriter.response, &subscription)
+	assert.Empty(t, subscription.CallbackReference)
+	assert.Equal(t, "wss://mep-api-gw.mep:8443/mep"+subscription.Links.Self.Href+"/websocket",
+		subscription.WebsockNotifConfig.WebsocketUri)
+	mockWriter.AssertExpectations(t)
+
+	// Connect without websocket upgrade
+	websocketSubscriptionRecord, _ = json.Marshal(subscription)
+	ec := &buildin.BuildinRegistry{}
+	patch1 := gomonkey.ApplyMethod(reflect.TypeOf(ec), "TxnWithCmp", func(*buildin.BuildinRegistry, context.Context,
+		[]registry.PluginOp, []registry.CompareOp, []registry.PluginOp) (*registry.PluginResponse, error) {
+		return &registry.PluginResponse{Kvs: []*mvccpb.KeyValue{{Value: websocketSubscriptionRecord}}}, nil
+	})
+	defer patch1.Reset()
+	getRequest, _ := http.NewRequest("GET", subscription.WebsockNotifConfig.WebsocketUri, nil)
+	getRequest.URL.RawQuery = fmt.Sprintf(appInstanceQueryFormat, defaultAppInstanceId) +
+		"&:subscriptionId=" + subscription.SubscriptionId
+	getRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+	mockWriterGet := &mockHttpWriterWithoutWrite{}
+	mockWriterGet.On("Header").Return(http.Header{})
+	mockWriterGet.On("Write").Return(0, nil)
+	mockWriterGet.On("WriteHeader", 400)
+
+	// 31 is the order of the app termination websocket handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
+	service.URLPatterns()[31].Func(mockWriterGet, getRequest)
+	assert.Contains(t, string(mockWriterGet.response), "websocket upgrade required")
+	mockWriterGet.AssertExpectations(t)
+}
+
+// Post App service availability Notification with both callback and websocket
+func TestAppSubscribePostWebsocketWithCallback(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+	for _, createSubscription := range []models.SerAvailabilityNotificationSubscription{
+		{
+			SubscriptionType:   "SerAvailabilityNotificationSubscription",
+			CallbackReference:  callBackRef,
+			WebsockNotifConfig: &models.WebsockNotifConfig{RequestWebsocketUri: true},
+		},
+		{
+			SubscriptionType:   "SerAvailabilityNotificationSubscription",
+			WebsockNotifConfig: &models.WebsockNotifConfig{},
+		},
+		{
+			SubscriptionType: "SerAvailabilityNotificationSubscription",
+		},
+	} {
+		createSubscriptionBytes, _ := json.Marshal(createSubscription)
+		postRequest, _ := http.NewRequest("POST",
+			fmt.Sprintf(postSubscribeUrl, defaultAppInstanceId),
+			bytes.NewReader(createSubscriptionBytes))
+		postRequest.URL.RawQuery = fmt.Sprintf(appInstanceQueryFormat, defaultAppInstanceId)
+		postRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+
+		mockWriter := &mockHttpWriterWithoutWrite{}
+		responseHeader := http.Header{}
+		mockWriter.On("Header").Return(responseHeader)
+		mockWriter.On("Write").Return(0, nil)
+		mockWriter.On("WriteHeader", 400)
+
+		postRequest.Header.Set(util.TokenScopeHeader, allScopes)
+		service.URLPatterns()[0].Func(mockWriter, postRequest)
+
+		assert.Equal(t, "400", responseHeader.Get(responseStatusHeader), responseCheckFor400)
+		mockWriter.AssertExpectations(t)
+	}
+}
+
+// Post App service availability Notification with expiry deadline
+func TestAppSubscribePostExpiryDeadline(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+	for expiry, statusCode := range map[int64]int{-10: 400, 3600: 201} {
+		createSubscription := models.SerAvailabilityNotificationSubscription{
+			SubscriptionType:  "SerAvailabilityNotificationSubscription",
+			CallbackReference: callBackRef,
+			ExpiryDeadline:    &models.TimeStamp{Seconds: uint32(time.Now().Unix() + expiry)},
+		}
+		createSubscriptionBytes, _ := json.Marshal(createSubscription)
+		postRequest, _ := http.NewRequest("POST",
+			fmt.Sprintf(postSubscribeUrl, defaultAppInstanceId),
+			bytes.NewReader(createSubscriptionBytes))
+		postRequest.URL.RawQuery = fmt.Sprintf(appInstanceQueryFormat, defaultAppInstanceId)
+		postRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+
+		mockWriter := &mockHttpWriterWithoutWrite{}
+		responseHeader := http.Header{}
+		mockWriter.On("Header").Return(responseHeader)
+		mockWriter.On("Write").Return(0, nil)
+		mockWriter.On("WriteHeader", statusCode)
+
+		postRequest.Header.Set(util.TokenScopeHeader, allScopes)
+		service.URLPatterns()[0].Func(mockWriter, postRequest)
+
+		assert.Equal(t, strconv.Itoa(statusCode), responseHeader.Get(responseStatusHeader))
+		mockWriter.AssertExpectations(t)
+	}
+}
+
 // Get all App termination Notification subscription
 func TestAppTerminationSubscribeGet(t *testing.T) {
 	defer func() {
@@ -1766,6 +2092,7 @@ func TestAppTerminationSubscribeGet(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[10].Func(mockWriterGet, getRequest)
 }
 
@@ -1792,6 +2119,7 @@ func TestGetOneAppTerminationSubscribe(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[11].Func(mockWriterGet, getRequest)
 }
 
@@ -1818,6 +2146,7 @@ func TestDelOneAppTerminationSubscribe(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[12].Func(mockWriterGet, getRequest)
 }
 
@@ -1938,6 +2267,7 @@ func TestPostServiceRegister(t *testing.T) {
 	mockWriter.On("WriteHeader", 201)
 
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[4].Func(mockWriter, getRequest)
 }
 
@@ -2042,6 +2372,7 @@ func TestPostServiceRegisterJsonMarshalFail(t *testing.T) {
 	mockWriter.On("WriteHeader", 400)
 
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[4].Func(mockWriter, getRequest)
 }
 
@@ -2138,6 +2469,7 @@ func TestPostServiceRegisterFindInstanceByKeyFailed(t *testing.T) {
 	mockWriter.On("WriteHeader", 400)
 
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[4].Func(mockWriter, getRequest)
 }
 
@@ -2165,6 +2497,7 @@ func TestServiceDiscoverServiceNameNotFound(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[5].Func(mockWriter, getRequest)
 
 }
@@ -2207,10 +2540,93 @@ func TestServiceDiscoverServiceFound(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[5].Func(mockWriter, getRequest)
 
 }
 
+// Discover services with the MEC 011 filters, the attributes are ANDed and the list values are ORed
+func TestServiceDiscoverFilters(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+
+	newInstance := func(instanceId string, serName string, catId string, isLocal string) *pb.MicroServiceInstance {
+		return &pb.MicroServiceInstance{
+			InstanceId: instanceId,
+			ServiceId:  sampleServiceId,
+			Properties: map[string]string{
+				"appInstanceId":   defaultAppInstanceId,
+				"serName":         serName,
+				svcCatId:          catId,
+				"IsLocal":         isLocal,
+				"ScopeOfLocality": "MEC_HOST",
+			},
+		}
+	}
+	patch1 := gomonkey.ApplyFunc(util.FindInstanceByKey, func(url.Values) (*pb.FindInstancesResponse, error) {
+		return &pb.FindInstancesResponse{
+			Response: &pb.Response{Code: pb.Response_SUCCESS},
+			Instances: []*pb.MicroServiceInstance{
+				newInstance("00000001", "ser1", "cat1", "true"),
+				newInstance("00000002", "ser2", "cat2", "true"),
+				newInstance("00000003", "ser3", "cat2", "false"),
+				newInstance("00000004", "ser4", "cat3", "true"),
+			},
+		}, nil
+	})
+	defer patch1.Reset()
+
+	discover := func(rawQuery string, statusCode int) []models.ServiceInfo {
+		getRequest, _ := http.NewRequest("GET",
+			fmt.Sprintf(serviceDiscoverUrlFormat, defaultAppInstanceId),
+			bytes.NewReader([]byte("")))
+		getRequest.URL.RawQuery = ":appInstanceId=" + defaultAppInstanceId + "&" + rawQuery
+		getRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+
+		mockWriter := &mockHttpWriterWithoutWrite{}
+		responseHeader := http.Header{}
+		mockWriter.On("Header").Return(responseHeader)
+		mockWriter.On("Write").Return(0, nil)
+		mockWriter.On("WriteHeader", statusCode)
+
+		getRequest.Header.Set(util.TokenScopeHeader, allScopes)
+		service.URLPatterns()[5].Func(mockWriter, getRequest)
+		mockWriter.AssertExpectations(t)
+
+		var services []models.ServiceInfo
+		if statusCode == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(mockWriter.response, &services))
+		}
+		return services
+	}
+	serNames := func(services []models.ServiceInfo) []string {
+		names := make([]string, 0, len(services))
+		for _, serviceInfo := range services {
+			names = append(names, serviceInfo.SerName)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"ser1", "ser2", "ser3", "ser4"}, serNames(discover("", http.StatusOK)))
+	assert.Equal(t, []string{"ser1", "ser2"},
+		serNames(discover("ser_category_id=cat1,cat2&is_local=true", http.StatusOK)))
+	assert.Equal(t, []string{"ser2", "ser3"},
+		serNames(discover("ser_instance_id="+sampleServiceId+"00000002&ser_instance_id="+sampleServiceId+
+			"00000003", http.StatusOK)))
+	assert.Equal(t, []string{"ser3"}, serNames(discover("is_local=false&scope_of_locality=MEC_HOST", http.StatusOK)))
+	assert.Equal(t, []string{}, serNames(discover("consumed_local_only=true", http.StatusOK)))
+
+	// Conflicting and invalid filters
+	discover("ser_category_id=cat1&ser_instance_id="+sampleServiceId+"00000001", http.StatusBadRequest)
+	discover("is_local=yes", http.StatusBadRequest)
+	discover("scope_of_locality=PLANET", http.StatusBadRequest)
+}
+
 // Update a service parameter
 func TestPutServiceUpdate(t *testing.T) {
 	defer func() {
@@ -2275,13 +2691,15 @@ func TestPutServiceUpdate(t *testing.T) {
 		InstanceId: sampleInstanceId,
 		ServiceId:  sampleServiceId,
 	}
-	patch1 := gomonkey.ApplyFunc(util.GetServiceInstance, func(ctx context.Context, serviceId string) (*pb.MicroServiceInstance, error) {
-		return findInstResp, nil
+	patch1 := gomonkey.ApplyFunc(util.GetServiceInstanceWithRevision, func(ctx context.Context,
+		serviceId string) (*pb.MicroServiceInstance, int64, error) {
+		return findInstResp, 1, nil
 	})
 	defer patch1.Reset()
 
-	patch2 := gomonkey.ApplyFunc(svcutil.UpdateInstance, func(context.Context, string, *pb.MicroServiceInstance) *scerr.Error {
-		return nil
+	patch2 := gomonkey.ApplyFunc(util.UpdateInstanceIfRevision, func(context.Context, *pb.MicroServiceInstance,
+		int64) int {
+		return 0
 	})
 	defer patch2.Reset()
 
@@ -2293,6 +2711,7 @@ func TestPutServiceUpdate(t *testing.T) {
 	mockWriter.On("WriteHeader", 200)
 
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[6].Func(mockWriter, getRequest)
 }
 
@@ -2364,6 +2783,7 @@ func TestPutServiceUpdateFindInstanceFail(t *testing.T) {
 	mockWriter.On("WriteHeader", 404)
 
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[6].Func(mockWriter, getRequest)
 }
 
@@ -2390,6 +2810,7 @@ func TestGetOneServiceWithInvalidId(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 400)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[7].Func(mockWriterGet, getRequest)
 }
 
@@ -2438,6 +2859,7 @@ func TestGetOneServiceWithValidId(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 200)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[7].Func(mockWriterGet, getRequest)
 }
 
@@ -2464,9 +2886,46 @@ func TestDelOneServiceWithValidId(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 404)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[8].Func(mockWriterGet, getRequest)
 }
 
+// Delete a service modified concurrently after the e-tag check
+func TestDelOneServiceModifiedConcurrently(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+	delRequest, _ := http.NewRequest("DELETE",
+		fmt.Sprintf(getOrDelOneSubscribeOrSveUrl, defaultAppInstanceId, sampleServiceId),
+		nil)
+	delRequest.URL.RawQuery = fmt.Sprintf(":appInstanceId=%s&:serviceId=%s", defaultAppInstanceId, sampleServiceId)
+	delRequest.Header.Set(appInstanceIdHeader, defaultAppInstanceId)
+
+	patch1 := gomonkey.ApplyFunc(util.GetServiceInstanceWithRevision, func(ctx context.Context,
+		serviceId string) (*pb.MicroServiceInstance, int64, error) {
+		return &pb.MicroServiceInstance{InstanceId: sampleInstanceId, ServiceId: sampleServiceId}, 5, nil
+	})
+	defer patch1.Reset()
+	patch2 := gomonkey.ApplyFunc(util.DeleteInstanceIfRevision, func(ctx context.Context, serviceId string,
+		instanceId string, revision int64) int {
+		return util.EtagMissMatchErr
+	})
+	defer patch2.Reset()
+
+	mockWriter := &mockHttpWriterWithoutWrite{}
+	mockWriter.On("Header").Return(http.Header{})
+	mockWriter.On("Write").Return(0, nil)
+	mockWriter.On("WriteHeader", 412)
+
+	delRequest.Header.Set(util.TokenScopeHeader, allScopes)
+	service.URLPatterns()[8].Func(mockWriter, delRequest)
+	mockWriter.AssertExpectations(t)
+}
+
 // Delete a service with invalid service id
 func TestDelOneServiceWithInValidId(t *testing.T) {
 	defer func() {
@@ -2490,6 +2949,7 @@ func TestDelOneServiceWithInValidId(t *testing.T) {
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 400)
 
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[8].Func(mockWriterGet, getRequest)
 }
 
@@ -2531,6 +2991,7 @@ func TestGetHeartbeat(t *testing.T) {
 	mockWriterGet.On("Header").Return(responseGetHeader)
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 200)
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[16].Func(mockWriterGet, getRequest)
 	assert.Equal(t, "200", responseGetHeader.Get(responseStatusHeader),
 		responseCheckFor200)
@@ -2575,6 +3036,7 @@ func TestGetHeartbeatForInvalidServiceId(t *testing.T) {
 	mockWriterGet.On("Header").Return(responseGetHeader)
 	mockWriterGet.On("Write").Return(0, nil)
 	mockWriterGet.On("WriteHeader", 400)
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[16].Func(mockWriterGet, getRequest)
 	assert.Equal(t, "400", responseGetHeader.Get(responseStatusHeader),
 		responseCheckFor400)
@@ -2631,6 +3093,7 @@ func TestHeartbeatService(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 204)
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[17].Func(mockWriter, getRequest)
 	assert.Equal(t, "204", responseHeader.Get(responseStatusHeader),
 		responseCheckFor204)
@@ -2686,6 +3149,7 @@ func TestHeartbeatServiceInvalidServiceId(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 	// 3 is the order of the DNS put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[17].Func(mockWriter, getRequest)
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
 		responseCheckFor400)
@@ -2726,6 +3190,7 @@ func TestGetCurrentTime(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[24].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -2766,6 +3231,7 @@ func TestGetCurrentTimeFailed(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[24].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -2808,6 +3274,7 @@ func TestGetCurrentTimeNonSyncTime(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[24].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -2850,6 +3317,7 @@ func TestGetCurrentTimeNtpConnFailed(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[24].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -2892,6 +3360,7 @@ func TestGetTimeCaps(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[25].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -2930,6 +3399,7 @@ func TestGetTimeCapsNtpFailed(t *testing.T) {
 	defer patches.Reset()
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[25].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader), responseCheckFor200)
@@ -2972,6 +3442,7 @@ func TestGetTransportInfo(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[26].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -3014,6 +3485,7 @@ func TestGetTransportInfoDecodeFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[26].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3056,6 +3528,7 @@ func TestGetTransportInfoList(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[26].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -3101,6 +3574,7 @@ func TestGetTransportInfoPutRecordFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[26].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3147,18 +3621,22 @@ func TestPutTrafficRuleStateAddRule(t *testing.T) {
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	patches := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		TrafficRule := dataplane.TrafficRule{TrafficRuleID: trafficRuleId, FilterType: "FLOW", Priority: 5,
 			Action: "DROP", State: util.InactiveState}
 		var TrafficRules []dataplane.TrafficRule
 		TrafficRules = append(TrafficRules, TrafficRule)
 		entry := models.AppDConfig{AppTrafficRule: TrafficRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patches.Reset()
 
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -3205,14 +3683,17 @@ func TestPutTrafficRuleStateDeleteRule(t *testing.T) {
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	patches := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		TrafficRule := dataplane.TrafficRule{TrafficRuleID: trafficRuleId, FilterType: "FLOW", Priority: 5,
 			Action: "DROP", State: util.ActiveState}
 		var TrafficRules []dataplane.TrafficRule
 		TrafficRules = append(TrafficRules, TrafficRule)
 		entry := models.AppDConfig{AppTrafficRule: TrafficRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patches.Reset()
 	patches.ApplyFunc(service.dataPlane.AddTrafficRule, func(appInfo dataplane.ApplicationInfo, trafficRuleId, filterType, action string, priority int,
@@ -3221,6 +3702,7 @@ func TestPutTrafficRuleStateDeleteRule(t *testing.T) {
 	})
 
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -3267,14 +3749,17 @@ func TestPutTrafficRuleStateSetRule(t *testing.T) {
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 200)
 
-	patches := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		TrafficRule := dataplane.TrafficRule{TrafficRuleID: trafficRuleId, FilterType: "FLOW", Priority: 5,
 			Action: "DROP", State: util.ActiveState}
 		var TrafficRules []dataplane.TrafficRule
 		TrafficRules = append(TrafficRules, TrafficRule)
 		entry := models.AppDConfig{AppTrafficRule: TrafficRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
+	})
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
+		return 0
 	})
 	defer patches.Reset()
 	patches.ApplyFunc(service.dataPlane.AddTrafficRule, func(appInfo dataplane.ApplicationInfo, trafficRuleId, filterType, action string, priority int,
@@ -3283,6 +3768,7 @@ func TestPutTrafficRuleStateSetRule(t *testing.T) {
 	})
 
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -3329,21 +3815,22 @@ func TestPutTrafficRuleStatePutRecordFailed(t *testing.T) {
 		Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
-	patches := gomonkey.ApplyFunc(backend.GetRecord, func(path string) ([]byte, int) {
+	patches := gomonkey.ApplyFunc(backend.GetRecordWithRevision, func(path string) ([]byte, int64, int) {
 		TrafficRule := dataplane.TrafficRule{TrafficRuleID: trafficRuleId, FilterType: "FLOW", Priority: 5,
 			Action: "DROP", State: util.ActiveState}
 		var TrafficRules []dataplane.TrafficRule
 		TrafficRules = append(TrafficRules, TrafficRule)
 		entry := models.AppDConfig{AppTrafficRule: TrafficRules}
 		outBytes, _ := json.Marshal(&entry)
-		return outBytes, 0
+		return outBytes, 1, 0
 	})
 	defer patches.Reset()
-	patches.ApplyFunc(backend.PutRecord, func(path string, value []byte) int {
+	patches.ApplyFunc(backend.PutRecordIfRevision, func(path string, value []byte, cmpPath string, revision int64) int {
 		return 1
 	})
 
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3444,6 +3931,7 @@ func TestGetTransportInfoGetRecordFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[26].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3489,6 +3977,7 @@ func TestGetTransportInfoMarshalFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[26].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3521,6 +4010,7 @@ func TestPutTrafficRuleInvalidRestBody(t *testing.T) {
 	mockWriter.On("WriteHeader", 400)
 
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3568,6 +4058,7 @@ func TestPutTrafficRuleReadAllFailed(t *testing.T) {
 	})
 	defer patches.Reset()
 	// 23 is the order of the Traffic Rule put handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[23].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "404", responseHeader.Get(responseStatusHeader),
@@ -3613,6 +4104,7 @@ func TestGetsTrafficRulesInvalidAppInstace(t *testing.T) {
 	defer patches.Reset()
 
 	// 21 is the order of the traffic get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[21].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "401", responseHeader.Get(responseStatusHeader),
@@ -3660,6 +4152,7 @@ func TestConfirmReady(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "204", responseHeader.Get(responseStatusHeader),
@@ -3706,6 +4199,7 @@ func TestConfirmReadyInvalidBody(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3752,6 +4246,7 @@ func TestConfirmReadyOngoingExist(t *testing.T) {
 		return resultList, 0
 	})
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "409", responseHeader.Get(responseStatusHeader),
@@ -3798,6 +4293,7 @@ func TestConfirmIndiactionWrong(t *testing.T) {
 		return resultList, 0
 	})
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3850,6 +4346,7 @@ func TestConfirmReadBodyFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3908,6 +4405,7 @@ func TestConfirmReadUnMarshalErr(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -3971,6 +4469,7 @@ func TestConfirmReadyRestBodyNil(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4026,6 +4525,7 @@ func TestConfirmReadBodyLenExceed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4072,6 +4572,7 @@ func TestConfirmReadyInvalidAppInstaces(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[27].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "401", responseHeader.Get(responseStatusHeader),
@@ -4120,6 +4621,7 @@ func TestConfirmTermination(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "204", responseHeader.Get(responseStatusHeader),
@@ -4168,6 +4670,7 @@ func TestConfirmTerminationParamErr(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "401", responseHeader.Get(responseStatusHeader),
@@ -4221,6 +4724,7 @@ func TestConfirmTerminationParseErr(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4277,6 +4781,7 @@ func TestConfirmTerminationParseInvalidLen(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4325,6 +4830,7 @@ func TestConfirmTerminationValidateFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4370,6 +4876,7 @@ func TestConfirmTerminationValidateUnMarshalFailed(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "204", responseHeader.Get(responseStatusHeader),
@@ -4418,6 +4925,7 @@ func TestConfirmTerminationIsNotInProgressErr(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "409", responseHeader.Get(responseStatusHeader),
@@ -4462,6 +4970,7 @@ func TestConfirmTerminationIsNotInProgressReErr(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4523,6 +5032,7 @@ func TestConfirmTerminationRestBodyNil(t *testing.T) {
 		return nil
 	})
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4577,6 +5087,7 @@ func TestConfirmTerminationGetRecordErr(t *testing.T) {
 	})
 
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "409", responseHeader.Get(responseStatusHeader),
@@ -4638,6 +5149,7 @@ func TestConfirmTerminationRecordUnMarshalErr(t *testing.T) {
 		return nil
 	})
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "417", responseHeader.Get(responseStatusHeader),
@@ -4686,6 +5198,7 @@ func TestConfirmTerminationPutRecERr(t *testing.T) {
 		return 1
 	})
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4743,6 +5256,7 @@ func TestConfirmTerminationMarshalErr(t *testing.T) {
 		return []byte(""), fmt.Errorf("invalid")
 	})
 	// 13 is the order of the DNS get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[28].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "417", responseHeader.Get(responseStatusHeader),
@@ -4786,6 +5300,7 @@ func TestGetsTrafficRulesAppInstIdNil(t *testing.T) {
 	defer patches.Reset()
 
 	// 21 is the order of the traffic get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[21].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "200", responseHeader.Get(responseStatusHeader),
@@ -4831,6 +5346,7 @@ func TestGetsTrafficRulesAppInstIdErr(t *testing.T) {
 	defer patches.Reset()
 
 	// 21 is the order of the traffic get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[21].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4870,6 +5386,7 @@ func TestGetsTrafficRulesTrafficRuleDbNil(t *testing.T) {
 	defer patches.Reset()
 
 	// 21 is the order of the traffic get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[21].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "404", responseHeader.Get(responseStatusHeader),
@@ -4919,6 +5436,7 @@ func TestGetsTrafficRulesUnmarshalErr(t *testing.T) {
 	})
 
 	// 21 is the order of the traffic get all handler in the URLPattern
+	getRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[21].Func(mockWriter, getRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -4976,6 +5494,7 @@ func TestAppSubscribeInsertDbError(t *testing.T) {
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
 
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	assert.Equal(t, "400", responseHeader.Get(responseStatusHeader),
@@ -5062,6 +5581,7 @@ func TestAppSubscribePostJsonMarshallFailDbErr(t *testing.T) {
 	mockWriter.On("Header").Return(responseHeader)
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	respError := models.ProblemDetails{}
@@ -5147,6 +5667,7 @@ func TestAppSubscribePostJsonMarshallFailValidationFail(t *testing.T) {
 	mockWriter.On("Header").Return(responseHeader)
 	mockWriter.On("Write").Return(0, nil)
 	mockWriter.On("WriteHeader", 400)
+	postRequest.Header.Set(util.TokenScopeHeader, allScopes)
 	service.URLPatterns()[0].Func(mockWriter, postRequest)
 
 	respError := models.ProblemDetails{}
@@ -5155,3 +5676,64 @@ func TestAppSubscribePostJsonMarshallFailValidationFail(t *testing.T) {
 	log.Info(respError.String())
 	assert.Equal(t, "", respError.Title, "Expected error not returned")
 }
+
+// Query transport info with a token missing the transports scope
+func TestGetTransportInfoInsufficientScope(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+
+	// Create http get request with a token granting the services scope only
+	getRequest, _ := http.NewRequest("GET",
+		fmt.Sprintf(getTiming, getTransport),
+		bytes.NewReader([]byte("")))
+	getRequest.Header.Set(util.TokenScopeHeader, util.ScopeServicesRead)
+
+	// Mock the response writer
+	mockWriter := &mockHttpWriterWithoutWrite{}
+	responseHeader := http.Header{} // Create http response header
+	mockWriter.On("Header").Return(responseHeader)
+	mockWriter.On("Write").Return(0, nil)
+	mockWriter.On("WriteHeader", 403)
+
+	service.URLPatterns()[26].Func(mockWriter, getRequest)
+
+	assert.Equal(t, "403", responseHeader.Get(responseStatusHeader), "Expected forbidden response")
+	respError := models.ProblemDetails{}
+	_ = json.Unmarshal(mockWriter.response, &respError)
+	assert.Contains(t, respError.Detail, util.ScopeTransportsRead, "Expected missing scope in response")
+}
+
+// Query transport info without the token scope set by the api gateway
+func TestGetTransportInfoWithoutScope(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf(panicFormatString, r)
+		}
+	}()
+
+	service := Mp1Service{}
+
+	// Create http get request not routed through the api gateway
+	getRequest, _ := http.NewRequest("GET",
+		fmt.Sprintf(getTiming, getTransport),
+		bytes.NewReader([]byte("")))
+
+	// Mock the response writer
+	mockWriter := &mockHttpWriterWithoutWrite{}
+	responseHeader := http.Header{} // Create http response header
+	mockWriter.On("Header").Return(responseHeader)
+	mockWriter.On("Write").Return(0, nil)
+	mockWriter.On("WriteHeader", 403)
+
+	service.URLPatterns()[26].Func(mockWriter, getRequest)
+
+	assert.Equal(t, "403", responseHeader.Get(responseStatusHeader), "Expected forbidden response")
+	respError := models.ProblemDetails{}
+	_ = json.Unmarshal(mockWriter.response, &respError)
+	assert.Contains(t, respError.Detail, util.ScopeTransportsRead, "Expected missing scope in response")
+}
@@ -23,8 +23,10 @@ import (
 	"errors"
 	"fmt"
 	"mepserver/common/models"
+	"mepserver/common/notification"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
 	"github.com/apache/servicecomb-service-center/pkg/util"
@@ -33,17 +35,23 @@ import (
 	"github.com/apache/servicecomb-service-center/server/core/proto"
 	"github.com/apache/servicecomb-service-center/server/notify"
 	"github.com/apache/servicecomb-service-center/server/plugin/pkg/discovery"
-	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 	"github.com/apache/servicecomb-service-center/server/service/metrics"
 	svcutil "github.com/apache/servicecomb-service-center/server/service/util"
 	"golang.org/x/net/context"
 
+	mepbackend "mepserver/common/extif/backend"
 	util2 "mepserver/common/util"
 )
 
 //ConsumeIDLength Consumer Id Length
 const ConsumeIDLength = 16
 
+var (
+	// instanceStates last known mecState per service instance, the kv events do not carry the previous value
+	instanceStates      = make(map[string]string)
+	instanceStatesMutex sync.Mutex
+)
+
 //InstanceEtsiEventHandler notification handler
 type InstanceEtsiEventHandler struct {
 	tlsCfg *tls.Config
@@ -76,6 +84,7 @@ func (h *InstanceEtsiEventHandler) OnEvent(evt discovery.KvEvent) {
 		return
 	}
 	domainName := domainProject[:idx]
+	prevState := updateInstanceState(action, instance)
 	switch action {
 	case proto.EVT_INIT:
 		metrics.ReportInstances(domainName, 1)
@@ -113,11 +122,35 @@ func (h *InstanceEtsiEventHandler) OnEvent(evt discovery.KvEvent) {
 		action, providerID, ms.Environment, ms.AppId, ms.ServiceName, ms.Version, providerInstanceID,
 		instance.Endpoints, domainProject)
 
-	h.sendRestMessageToApp(instance, string(action))
+	h.sendRestMessageToApp(instance, string(action), prevState)
+}
+
+// updateInstanceState records the current mecState of the instance and returns the previous one
+func updateInstanceState(action proto.EventType, instance *proto.MicroServiceInstance) string {
+	instanceID := instance.ServiceId + instance.InstanceId
+	instanceStatesMutex.Lock()
+	defer instanceStatesMutex.Unlock()
+	prevState := instanceStates[instanceID]
+	if action == proto.EVT_DELETE {
+		delete(instanceStates, instanceID)
+	} else {
+		instanceStates[instanceID] = instance.Properties["mecState"]
+	}
+	return prevState
+}
+
+// isStateChanged checks whether the update moved the instance between the mec service states
+func isStateChanged(action string, prevState string, state string) bool {
+	if action != "UPDATE" || prevState == state {
+		return false
+	}
+	mecStates := []string{util2.ActiveState, util2.InactiveState, util2.SuspendedState}
+	return util2.StringContains(mecStates, prevState) != -1 && util2.StringContains(mecStates, state) != -1
 }
 
 // sendRestMessageToApp send messages to application
-func (h *InstanceEtsiEventHandler) sendRestMessageToApp(instance *proto.MicroServiceInstance, action string) {
+func (h *InstanceEtsiEventHandler) sendRestMessageToApp(instance *proto.MicroServiceInstance, action string,
+	prevState string) {
 	instanceID := instance.ServiceId + instance.InstanceId
 	serName := instance.Properties["serName"]
 	isLocal := instance.Properties["isLocal"]
@@ -128,31 +161,40 @@ func (h *InstanceEtsiEventHandler) sendRestMessageToApp(instance *proto.MicroSer
 		Name:    instance.Properties["serCategory/name"],
 		Version: instance.Properties["serCategory/version"],
 	}
-	callBackUris := getCallBackUris(instanceID, serName, isLocal, state, serCategory)
+	states := []string{state}
+	stateChanged := isStateChanged(action, prevState, state)
+	if stateChanged {
+		// Subscribers filtering on either the old or the new state are informed of the transition
+		states = append(states, prevState)
+	}
+	callBackUris := getCallBackUris(instanceID, serName, isLocal, states, serCategory)
 	if len(callBackUris) == 0 {
 		log.Infof("Callback uris is empty for service subscription(id: %s, name: %s), hence ignored.", instanceID,
 			serName)
 		return
 	}
 
-	h.doSend(action, instance, callBackUris)
+	h.doSend(action, stateChanged, instance, callBackUris)
 }
 
-func (h *InstanceEtsiEventHandler) doSend(action string, instance *proto.MicroServiceInstance, callbackUris map[string]string) {
+func (h *InstanceEtsiEventHandler) doSend(action string, stateChanged bool, instance *proto.MicroServiceInstance,
+	callbackUris map[string]string) {
 	var notificationInfo models.ServiceAvailabilityNotification
 	notificationInfo.ServiceReferences = make([]models.ServiceReferences, 1, 1)
-	notificationInfo.NotificationType = "SerAvailabilityNotification"
+	notificationInfo.NotificationType = util2.SerAvailabilityNotification
 	notificationInfo.ServiceReferences[0].SerName = instance.Properties["serName"]
 	notificationInfo.ServiceReferences[0].SerInstanceID = instance.ServiceId + instance.InstanceId
 	notificationInfo.ServiceReferences[0].State = instance.Properties["mecState"]
 	href := "/mec_service_mgmt/v1/services/" + instance.ServiceId + instance.InstanceId
 
-	//Currently we cant identify only state changed. So Only attributes change will be supported
 	if action == "CREATE" {
 		notificationInfo.ServiceReferences[0].ChangeType = "ADDED"
 		notificationInfo.ServiceReferences[0].Link.Href = href
 	} else if action == "DELETE" {
 		notificationInfo.ServiceReferences[0].ChangeType = "REMOVED"
+	} else if action == "UPDATE" && stateChanged {
+		notificationInfo.ServiceReferences[0].ChangeType = "STATE_CHANGED"
+		notificationInfo.ServiceReferences[0].Link.Href = href
 	} else if action == "UPDATE" {
 		notificationInfo.ServiceReferences[0].ChangeType = "ATTRIBUTES_CHANGED"
 		notificationInfo.ServiceReferences[0].Link.Href = href
@@ -162,7 +204,7 @@ func (h *InstanceEtsiEventHandler) doSend(action string, instance *proto.MicroSe
 	}
 }
 
-// sendMsg send message
+// sendMsg queue the message for delivery, failed deliveries are retried by the notification queue
 func (h *InstanceEtsiEventHandler) sendMsg(notificationInfo models.ServiceAvailabilityNotification,
 	callBackURI string, subscription string) {
 	log.Infof("Send subscription notify(key: %s, uri: %s).", subscription, callBackURI)
@@ -177,27 +219,36 @@ func (h *InstanceEtsiEventHandler) sendMsg(notificationInfo models.ServiceAvaila
 		return
 	}
 
-	_, err = util2.SendPostRequest(callBackURI, notificationInfoJSON, h.tlsCfg)
+	err = notification.Enqueue(util2.SerAvailabilityNotification, appInstID, subscriptionID, callBackURI,
+		notificationInfoJSON)
 	if err != nil {
-		log.Error("Failed to send notification.", nil)
+		log.Error("Failed to queue notification.", err)
 	}
 }
 
-func getCallBackUris(instanceID string, serName string, isLocal string, state string, serCategory models.CategoryRef) map[string]string {
+// postNotification delivers a queued service availability notification
+func (h *InstanceEtsiEventHandler) postNotification(delivery *models.NotificationDelivery) error {
+	_, err := util2.SendPostRequest(delivery.CallbackReference, delivery.Payload, h.tlsCfg)
+	return err
+}
+
+func getCallBackUris(instanceID string, serName string, isLocal string, states []string,
+	serCategory models.CategoryRef) map[string]string {
 	notifyInfos := GetAllSubscriberInfoFromDB()
 	callBackUris := make(map[string]string, len(notifyInfos))
 
 	for subKey, notifyInfo := range notifyInfos {
 		callBackURI := notifyInfo.CallbackReference
 		filter := notifyInfo.FilteringCriteria
-		if isInFilter(filter, instanceID, serName, isLocal, state, serCategory) {
+		if isInFilter(filter, instanceID, serName, isLocal, states, serCategory) {
 			callBackUris[subKey] = callBackURI
 		}
 	}
 
 	return callBackUris
 }
-func isInFilter(filter models.FilteringCriteria, instanceID string, serName string, isLocal string, state string, serCategory models.CategoryRef) bool {
+func isInFilter(filter models.FilteringCriteria, instanceID string, serName string, isLocal string, states []string,
+	serCategory models.CategoryRef) bool {
 	localFilter := false
 	stateFilter := false
 	if strconv.FormatBool(filter.IsLocal) == isLocal {
@@ -205,8 +256,12 @@ func isInFilter(filter models.FilteringCriteria, instanceID string, serName stri
 	}
 	if filter.States == nil || len(filter.States) == 0 {
 		stateFilter = true
-	} else if util2.StringContains(filter.States, state) != -1 {
-		stateFilter = true
+	} else {
+		for _, state := range states {
+			if util2.StringContains(filter.States, state) != -1 {
+				stateFilter = true
+			}
+		}
 	}
 
 	localFilter = true
@@ -220,7 +275,8 @@ func isInFilter(filter models.FilteringCriteria, instanceID string, serName stri
 }
 
 func isAllFilterEmpty(filter models.FilteringCriteria) bool {
-	if len(filter.SerNames) == 0 && len(filter.SerInstanceIds) == 0 && len(filter.SerCategories) == 0 && len(filter.States) == 0 && !filter.IsLocal {
+	// States are already matched by the caller
+	if len(filter.SerNames) == 0 && len(filter.SerInstanceIds) == 0 && len(filter.SerCategories) == 0 && !filter.IsLocal {
 		return true
 	}
 	return false
@@ -250,10 +306,7 @@ func isServiceCategoryMatched(serCategories []models.CategoryRef, serCategory mo
 func GetAllSubscriberInfoFromDB() map[string]*models.SerAvailabilityNotificationSubscription {
 	subscribeKeyPath := util2.GetSubscribeKeyPath(util2.SerAvailabilityNotificationSubscription)
 	notifyInfos := make(map[string]*models.SerAvailabilityNotificationSubscription, 1000)
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(subscribeKeyPath), registry.WithPrefix()),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	resp, err := mepbackend.DB().List(context.Background(), subscribeKeyPath, mepbackend.ListOptions{})
 	if err != nil {
 		log.Errorf(nil, "Get subscription from etcd failed.")
 		return nil
@@ -263,7 +316,7 @@ func GetAllSubscriberInfoFromDB() map[string]*models.SerAvailabilityNotification
 		if err := json.Unmarshal(kvs.Value, notifyInfo); err != nil {
 			continue
 		}
-		notifyInfos[string(kvs.Key)] = notifyInfo
+		notifyInfos[kvs.Key] = notifyInfo
 	}
 	return notifyInfos
 }
@@ -274,5 +327,8 @@ func NewInstanceEtsiEventHandler() *InstanceEtsiEventHandler {
 	if err != nil {
 		return nil
 	}
-	return &InstanceEtsiEventHandler{config}
+	handler := &InstanceEtsiEventHandler{config}
+	notification.RegisterSender(util2.SerAvailabilityNotification, handler.postNotification)
+	notification.RegisterSender(util2.ExpiryNotification, handler.postNotification)
+	return handler
 }
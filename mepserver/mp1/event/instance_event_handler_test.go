@@ -17,7 +17,9 @@ package event
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"mepserver/common/models"
+	"mepserver/common/notification"
 	"mepserver/common/util"
 	"testing"
 
@@ -27,6 +29,7 @@ import (
 	"github.com/apache/servicecomb-service-center/server/notify"
 	"github.com/apache/servicecomb-service-center/server/plugin/pkg/discovery"
 	svcutil "github.com/apache/servicecomb-service-center/server/service/util"
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/context"
 )
 
@@ -161,6 +164,11 @@ func TestNewInstanceEtsiEventHandler(t *testing.T) {
 	})
 	defer patch3.Reset()
 
+	patch4 := gomonkey.ApplyFunc(notification.Enqueue, func(string, string, string, string, []byte) error {
+		return nil
+	})
+	defer patch4.Reset()
+
 	h := NewInstanceEtsiEventHandler()
 
 	for _, v := range cases {
@@ -170,3 +178,73 @@ func TestNewInstanceEtsiEventHandler(t *testing.T) {
 		notify.NotifyCenter().Stop()
 	}
 }
+
+var stateNotifications []models.ServiceAvailabilityNotification
+
+func newStateEvent(action proto.EventType, state string) discovery.KvEvent {
+	return discovery.KvEvent{
+		Type: action,
+		KV: &discovery.KeyValue{
+			Key: []byte(core.GenerateInstanceKey("default", "c936bdb887337c16", "a8612ca7603ad980")),
+			Value: &proto.MicroServiceInstance{
+				ServiceId:  "c936bdb887337c16",
+				InstanceId: "a8612ca7603ad980",
+				Properties: map[string]string{
+					"serName":  "faceapp03",
+					"mecState": state,
+				},
+				Version: "1.0",
+			},
+		},
+	}
+}
+
+func TestInstanceStateChanged(t *testing.T) {
+	patches := gomonkey.ApplyFunc(svcutil.GetService, func(context.Context, string, string) (*proto.MicroService, error) {
+		return &proto.MicroService{ServiceId: "1", AppId: "2", ServiceName: "abcd"}, nil
+	})
+	defer patches.Reset()
+	patches.ApplyFunc(GetAllSubscriberInfoFromDB, func() map[string]*models.SerAvailabilityNotificationSubscription {
+		return map[string]*models.SerAvailabilityNotificationSubscription{
+			"/cse-sr/etsi/subscribe/5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f/83b35ec2-0afe-4563-ab25-d36f3709221e": {
+				CallbackReference: "http://hello:80/state/notify",
+				FilteringCriteria: models.FilteringCriteria{
+					States: []string{"ACTIVE"},
+				},
+			},
+		}
+	})
+	patches.ApplyFunc(util.TLSConfig, func(crtName string, skipInsecureVerify bool) (*tls.Config, error) {
+		return &tls.Config{}, nil
+	})
+	patches.ApplyFunc(notification.Enqueue, func(notificationType, appInstanceId, subscriptionId,
+		callbackReference string, payload []byte) error {
+		notificationInfo := models.ServiceAvailabilityNotification{}
+		_ = json.Unmarshal(payload, &notificationInfo)
+		stateNotifications = append(stateNotifications, notificationInfo)
+		return nil
+	})
+
+	h := NewInstanceEtsiEventHandler()
+	notify.NotifyCenter().Start()
+	defer notify.NotifyCenter().Stop()
+	stateNotifications = nil
+
+	h.OnEvent(newStateEvent(proto.EVT_CREATE, "ACTIVE"))
+	h.OnEvent(newStateEvent(proto.EVT_UPDATE, "ACTIVE"))
+	// Leaving the filtered state is notified as well
+	h.OnEvent(newStateEvent(proto.EVT_UPDATE, "SUSPENDED"))
+	// Neither the old nor the new state matches the filter
+	h.OnEvent(newStateEvent(proto.EVT_UPDATE, "INACTIVE"))
+	h.OnEvent(newStateEvent(proto.EVT_UPDATE, "ACTIVE"))
+	h.OnEvent(newStateEvent(proto.EVT_DELETE, "ACTIVE"))
+
+	changeTypes := make([]string, 0, len(stateNotifications))
+	for _, notificationInfo := range stateNotifications {
+		changeTypes = append(changeTypes, notificationInfo.ServiceReferences[0].ChangeType)
+	}
+	assert.Equal(t, []string{"ADDED", "ATTRIBUTES_CHANGED", "STATE_CHANGED", "STATE_CHANGED", "REMOVED"},
+		changeTypes, "Error in state change notification")
+	assert.Equal(t, "SUSPENDED", stateNotifications[2].ServiceReferences[0].State,
+		"Error in state change notification")
+}
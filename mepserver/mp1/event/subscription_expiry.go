@@ -0,0 +1,161 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package event handling function
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	"mepserver/common/notification"
+	meputil "mepserver/common/util"
+)
+
+// subscriptionExpiry the subscription attributes used by the expiry handling
+type subscriptionExpiry struct {
+	CallbackReference string            `json:"callbackReference"`
+	ExpiryDeadline    *models.TimeStamp `json:"expiryDeadline"`
+}
+
+// SubscriptionExpiryProcess periodically removes the expired subscriptions
+func SubscriptionExpiryProcess() {
+	ticker := time.NewTicker(meputil.SubscriptionSweepInterval)
+	for range ticker.C {
+		SweepExpiredSubscriptions(time.Now())
+	}
+}
+
+// SweepExpiredSubscriptions sends the expiry notification to the subscriptions reaching their deadline within the
+// notice period and deletes the subscriptions past the deadline. Every replica sweeps, the notified deadline is
+// recorded in the data-store so that a deadline is notified once across the replicas and their restarts
+func SweepExpiredSubscriptions(now time.Time) {
+	for _, subscribeType := range []string{meputil.SerAvailabilityNotificationSubscription,
+		meputil.AppTerminationNotificationSubscription} {
+		subscribeKeyPath := meputil.GetSubscribeKeyPath(subscribeType)
+		records, err := backend.DB().List(context.Background(), subscribeKeyPath, backend.ListOptions{})
+		if err != nil {
+			log.Errorf(nil, "Get subscriptions from etcd failed.")
+			continue
+		}
+		for _, record := range records.Kvs {
+			sub := &subscriptionExpiry{}
+			if err = json.Unmarshal(record.Value, sub); err != nil || sub.ExpiryDeadline == nil {
+				continue
+			}
+			ids := strings.Split(strings.TrimPrefix(record.Key, subscribeKeyPath), "/")
+			if len(ids) != 2 {
+				continue
+			}
+			appInstanceId, subscriptionId := ids[0], ids[1]
+			deadline := sub.ExpiryDeadline.Time()
+			if !now.Before(deadline) {
+				removeExpiredSubscription(record, appInstanceId, subscriptionId)
+				continue
+			}
+			if deadline.After(now.Add(meputil.SubscriptionExpiryNoticePeriod)) {
+				continue
+			}
+			href := meputil.GetSubscriptionLocation(subscribeType, appInstanceId, subscriptionId)
+			notifyExpiry(record, sub, appInstanceId, subscriptionId, href, now)
+		}
+	}
+	purgeExpiryNotified(now)
+}
+
+// notifyExpiry queues the expiry notification unless the deadline was notified already. The notified deadline is
+// written along with the notification, conditional on the subscription and the previous notified deadline so that
+// only one of the concurrently sweeping replicas queues it
+func notifyExpiry(record *backend.KeyValue, sub *subscriptionExpiry, appInstanceId, subscriptionId, href string,
+	now time.Time) {
+	notifiedKey := meputil.ExpiryNotifiedPath + appInstanceId + "/" + subscriptionId
+	deadline := strconv.FormatUint(uint64(sub.ExpiryDeadline.Seconds), 10)
+	notified, revision, errCode := backend.GetRecordWithRevision(notifiedKey)
+	if errCode == 0 && string(notified) == deadline {
+		return
+	}
+	if errCode != 0 && errCode != meputil.SubscriptionNotFound {
+		log.Errorf(nil, "Read expiry notified deadline of subscription %s failed.", subscriptionId)
+		return
+	}
+	errCode = sendExpiryNotification(sub, appInstanceId, subscriptionId, href, now,
+		[]backend.Compare{backend.RevisionCmp(record.Key, record.Revision), backend.RevisionCmp(notifiedKey, revision)},
+		[]backend.Op{backend.PutOp(notifiedKey, []byte(deadline))})
+	if errCode == meputil.EtagMissMatchErr {
+		log.Debugf("Expiry of subscription %s notified by another replica or modified meanwhile.", subscriptionId)
+		return
+	}
+	if errCode != 0 {
+		log.Errorf(nil, "Failed to queue expiry notification of subscription %s.", subscriptionId)
+	}
+}
+
+// purgeExpiryNotified deletes the notified deadlines which passed, the subscriptions are removed by then
+func purgeExpiryNotified(now time.Time) {
+	records, err := backend.DB().List(context.Background(), meputil.ExpiryNotifiedPath, backend.ListOptions{})
+	if err != nil {
+		log.Errorf(nil, "Get expiry notified deadlines from etcd failed.")
+		return
+	}
+	for _, record := range records.Kvs {
+		deadline, err := strconv.ParseInt(string(record.Value), 10, 64)
+		if err == nil && deadline > now.Unix() {
+			continue
+		}
+		_ = backend.ApplyTxn([]backend.Compare{backend.RevisionCmp(record.Key, record.Revision)},
+			[]backend.Op{backend.DeleteOp(record.Key, false)})
+	}
+}
+
+// removeExpiredSubscription deletes the subscription unless it was modified since read, a renewed deadline is
+// checked again on the next sweep
+func removeExpiredSubscription(record *backend.KeyValue, appInstanceId, subscriptionId string) {
+	errCode := backend.ApplyTxn([]backend.Compare{backend.RevisionCmp(record.Key, record.Revision)},
+		[]backend.Op{backend.DeleteOp(record.Key, false),
+			backend.DeleteOp(meputil.ExpiryNotifiedPath+appInstanceId+"/"+subscriptionId, false)})
+	if errCode != 0 {
+		log.Errorf(nil, "Delete expired subscription %s from etcd failed.", subscriptionId)
+		return
+	}
+	notification.CloseWebsocket(appInstanceId, subscriptionId)
+	if errCode = notification.PurgeSubscription(appInstanceId, subscriptionId); errCode != 0 {
+		log.Errorf(nil, "Purge notifications of expired subscription %s failed.", subscriptionId)
+	}
+	log.Infof("Subscription %s of app %s expired, removed.", subscriptionId, appInstanceId)
+}
+
+func sendExpiryNotification(sub *subscriptionExpiry, appInstanceId, subscriptionId, href string, now time.Time,
+	cmps []backend.Compare, ops []backend.Op) int {
+	body := models.ExpiryNotification{
+		NotificationType: meputil.ExpiryNotification,
+		TimeStamp:        models.TimeStamp{Seconds: uint32(now.Unix()), Nanoseconds: uint32(now.Nanosecond())},
+		ExpiryDeadline:   *sub.ExpiryDeadline,
+		Links:            models.SerSubscription{Subscription: models.SerLinkType{Href: href}},
+	}
+	bodyJSON, err := json.Marshal(&body)
+	if err != nil {
+		return meputil.ParseInfoErr
+	}
+	return notification.EnqueueIf(cmps, ops, meputil.ExpiryNotification, appInstanceId, subscriptionId,
+		sub.CallbackReference, bodyJSON)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package event
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	"mepserver/common/util"
+)
+
+const (
+	expiryAppInstanceId = "5abe4782-2c70-4e47-9a4e-0ee3a1a0fd1f"
+	expirySubscription  = "83b35ec2-0afe-4563-ab25-d36f3709221b"
+	errorInExpiry       = "Error in subscription expiry"
+)
+
+// expiryQueued returns the queued expiry notifications
+func expiryQueued(t *testing.T) []*models.NotificationDelivery {
+	records, errCode := backend.GetRecordsWithCompleteKeyPath(util.NotificationQueuePath)
+	assert.Equal(t, 0, errCode, errorInExpiry)
+	var queued []*models.NotificationDelivery
+	for _, record := range records {
+		delivery := &models.NotificationDelivery{}
+		assert.NoError(t, json.Unmarshal(record, delivery), errorInExpiry)
+		if delivery.NotificationType == util.ExpiryNotification {
+			queued = append(queued, delivery)
+		}
+	}
+	return queued
+}
+
+func TestSweepExpiredSubscriptions(t *testing.T) {
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+
+	now := time.Now()
+	key := util.AvailAppSubKeyPath + expiryAppInstanceId + "/" + expirySubscription
+	permanentKey := util.EndAppSubKeyPath + expiryAppInstanceId + "/" + expirySubscription
+	backend.PutRecord(key, []byte(`{"callbackReference":"http://127.0.0.1:8080/notify","expiryDeadline":{"seconds":`+
+		strconv.FormatInt(now.Unix()+30, 10)+`}}`))
+	backend.PutRecord(permanentKey, []byte(`{"callbackReference":"http://127.0.0.1:8080/notify"}`))
+
+	// Deadline beyond the notice period
+	SweepExpiredSubscriptions(now.Add(-util.SubscriptionExpiryNoticePeriod))
+	assert.Empty(t, expiryQueued(t), errorInExpiry)
+
+	// Notified once within the notice period
+	SweepExpiredSubscriptions(now)
+	SweepExpiredSubscriptions(now.Add(time.Second))
+	queued := expiryQueued(t)
+	assert.Equal(t, 1, len(queued), errorInExpiry)
+	assert.Equal(t, util.ExpiryNotification, queued[0].NotificationType, errorInExpiry)
+	assert.Equal(t, expirySubscription, queued[0].SubscriptionId, errorInExpiry)
+	assert.Contains(t, string(queued[0].Payload), "/mec_service_mgmt/v1/applications/"+
+		expiryAppInstanceId+"/subscriptions/"+expirySubscription, errorInExpiry)
+
+	// Removed after the deadline along with its pending notifications
+	queueKey := util.NotificationQueuePath + expiryAppInstanceId + "/" + expirySubscription + "/00000000000000000001"
+	backend.PutRecord(queueKey, []byte(`{"deliveryId":"d1"}`))
+	backend.PutRecord(util.NotificationDeadLetterPath+"d2", []byte(`{"deliveryId":"d2","appInstanceId":"`+
+		expiryAppInstanceId+`","subscriptionId":"`+expirySubscription+`"}`))
+	SweepExpiredSubscriptions(now.Add(time.Minute))
+	_, _, errCode := backend.GetRecordWithRevision(key)
+	assert.Equal(t, util.SubscriptionNotFound, errCode, errorInExpiry)
+	_, _, errCode = backend.GetRecordWithRevision(queueKey)
+	assert.Equal(t, util.SubscriptionNotFound, errCode, errorInExpiry)
+	_, _, errCode = backend.GetRecordWithRevision(util.NotificationDeadLetterPath + "d2")
+	assert.Equal(t, util.SubscriptionNotFound, errCode, errorInExpiry)
+	_, _, errCode = backend.GetRecordWithRevision(permanentKey)
+	assert.Equal(t, 0, errCode, errorInExpiry)
+	_, _, errCode = backend.GetRecordWithRevision(util.ExpiryNotifiedPath + expiryAppInstanceId + "/" +
+		expirySubscription)
+	assert.Equal(t, util.SubscriptionNotFound, errCode, errorInExpiry)
+}
+
+func TestSweepExpiryNotifiedByOtherReplica(t *testing.T) {
+	previousDB := backend.SetDB(backend.NewMemoryDatastore())
+	defer backend.SetDB(previousDB)
+
+	now := time.Now()
+	deadline := strconv.FormatInt(now.Unix()+30, 10)
+	key := util.AvailAppSubKeyPath + expiryAppInstanceId + "/" + expirySubscription
+	notifiedKey := util.ExpiryNotifiedPath + expiryAppInstanceId + "/" + expirySubscription
+	backend.PutRecord(key, []byte(`{"callbackReference":"http://127.0.0.1:8080/notify","expiryDeadline":{"seconds":`+
+		deadline+`}}`))
+
+	// Deadline already notified by another replica, or before a restart
+	backend.PutRecord(notifiedKey, []byte(deadline))
+	SweepExpiredSubscriptions(now)
+	assert.Empty(t, expiryQueued(t), errorInExpiry)
+
+	// Notified again for a renewed deadline
+	renewed := strconv.FormatInt(now.Unix()+40, 10)
+	backend.PutRecord(key, []byte(`{"callbackReference":"http://127.0.0.1:8080/notify","expiryDeadline":{"seconds":`+
+		renewed+`}}`))
+	SweepExpiredSubscriptions(now)
+	assert.Equal(t, 1, len(expiryQueued(t)), errorInExpiry)
+	notified, _, errCode := backend.GetRecordWithRevision(notifiedKey)
+	assert.Equal(t, 0, errCode, errorInExpiry)
+	assert.Equal(t, renewed, string(notified), errorInExpiry)
+
+	// Passed notified deadlines are purged
+	SweepExpiredSubscriptions(now.Add(time.Minute))
+	assert.Equal(t, 0, len(expiryQueued(t)), errorInExpiry)
+	_, _, errCode = backend.GetRecordWithRevision(notifiedKey)
+	assert.Equal(t, util.SubscriptionNotFound, errCode, errorInExpiry)
+}
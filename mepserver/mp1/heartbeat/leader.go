@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+	"github.com/apache/servicecomb-service-center/pkg/util"
+	"github.com/apache/servicecomb-service-center/server/core/backend"
+	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
+
+	meputil "mepserver/common/util"
+)
+
+// Elector campaigns for the heartbeat leader key, only the leader suspends the services
+type Elector struct {
+	id      string
+	leaseID int64
+	leader  int32
+}
+
+// NewElector creates an elector identified by the host and process
+func NewElector() *Elector {
+	return &Elector{id: fmt.Sprintf("%s-%d", util.HostName(), os.Getpid())}
+}
+
+// IsLeader whether this replica holds the leader key
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run campaigns and keeps the leader lease alive, it never returns
+func (e *Elector) Run() {
+	ticker := time.NewTicker(meputil.HeartbeatLeaderRenewInterval)
+	for {
+		e.Campaign()
+		<-ticker.C
+	}
+}
+
+// Campaign renews the lease when leading, otherwise tries to take the leader key
+func (e *Elector) Campaign() {
+	ctx := context.Background()
+	if e.IsLeader() {
+		ttl, err := backend.Registry().LeaseRenew(ctx, e.leaseID)
+		if err == nil && ttl > 0 {
+			return
+		}
+		log.Warnf("Heartbeat leader lease lost, id %s.", e.id)
+		e.setLeader(false)
+	}
+
+	leaseID, err := backend.Registry().LeaseGrant(ctx, meputil.HeartbeatLeaderTTL)
+	if err != nil {
+		log.Errorf(err, "Heartbeat leader lease grant failed.")
+		return
+	}
+	success, err := backend.Registry().PutNoOverride(ctx, registry.WithStrKey(meputil.HeartbeatLeaderPath),
+		registry.WithStrValue(e.id), registry.WithLease(leaseID))
+	if err != nil || !success {
+		_ = backend.Registry().LeaseRevoke(ctx, leaseID)
+		return
+	}
+	e.leaseID = leaseID
+	e.setLeader(true)
+	log.Infof("Became the heartbeat leader, id %s.", e.id)
+}
+
+func (e *Elector) setLeader(leader bool) {
+	var value int32
+	if leader {
+		value = 1
+	}
+	atomic.StoreInt32(&e.leader, value)
+}
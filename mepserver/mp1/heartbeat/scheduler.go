@@ -0,0 +1,174 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package heartbeat supervises the liveness of the registered service instances
+package heartbeat
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+type deadlineItem struct {
+	key      string
+	deadline time.Time
+	index    int
+}
+
+// deadlineHeap min heap of the deadlines, implements heap.Interface
+type deadlineHeap []*deadlineItem
+
+func (h deadlineHeap) Len() int {
+	return len(h)
+}
+
+func (h deadlineHeap) Less(i, j int) bool {
+	return h[i].deadline.Before(h[j].deadline)
+}
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	item := x.(*deadlineItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// Scheduler keeps one deadline per key and reports the keys whose deadline passed
+type Scheduler struct {
+	mutex sync.Mutex
+	items deadlineHeap
+	index map[string]*deadlineItem
+	wake  chan struct{}
+}
+
+// NewScheduler creates an empty deadline scheduler
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		index: make(map[string]*deadlineItem),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// Schedule sets or moves the deadline of the key
+func (s *Scheduler) Schedule(key string, deadline time.Time) {
+	s.mutex.Lock()
+	if item, ok := s.index[key]; ok {
+		item.deadline = deadline
+		heap.Fix(&s.items, item.index)
+	} else {
+		item = &deadlineItem{key: key, deadline: deadline}
+		heap.Push(&s.items, item)
+		s.index[key] = item
+	}
+	s.mutex.Unlock()
+	s.notify()
+}
+
+// Cancel removes the deadline of the key
+func (s *Scheduler) Cancel(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	item, ok := s.index[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.items, item.index)
+	delete(s.index, key)
+}
+
+// Deadline returns the deadline scheduled for the key
+func (s *Scheduler) Deadline(key string) (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	item, ok := s.index[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return item.deadline, true
+}
+
+// Len number of the scheduled keys
+func (s *Scheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.items)
+}
+
+// PopExpired removes and returns the keys whose deadline is not after now, earliest first
+func (s *Scheduler) PopExpired(now time.Time) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var keys []string
+	for len(s.items) != 0 && !s.items[0].deadline.After(now) {
+		item := heap.Pop(&s.items).(*deadlineItem)
+		delete(s.index, item.key)
+		keys = append(keys, item.key)
+	}
+	return keys
+}
+
+// Run waits for the earliest deadline and calls onExpired for each expired key, it never returns
+func (s *Scheduler) Run(onExpired func(key string)) {
+	timer := time.NewTimer(0)
+	for {
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		for _, key := range s.PopExpired(time.Now()) {
+			onExpired(key)
+		}
+		timer.Reset(s.untilNext())
+	}
+}
+
+func (s *Scheduler) untilNext() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.items) == 0 {
+		// Woken up by the next Schedule
+		return time.Hour
+	}
+	return time.Until(s.items[0].deadline)
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package heartbeat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const errorInScheduler = "Error in heartbeat scheduler"
+
+var schedulerExpired = make(chan string, 10)
+
+func TestSchedulerPopExpired(t *testing.T) {
+	s := NewScheduler()
+	now := time.Now()
+	s.Schedule("c", now.Add(3*time.Second))
+	s.Schedule("a", now.Add(time.Second))
+	s.Schedule("b", now.Add(2*time.Second))
+	s.Schedule("d", now.Add(4*time.Second))
+
+	// Moved and cancelled deadlines
+	s.Schedule("a", now.Add(5*time.Second))
+	s.Cancel("d")
+	s.Cancel("unknown")
+	assert.Equal(t, 3, s.Len(), errorInScheduler)
+
+	assert.Empty(t, s.PopExpired(now), errorInScheduler)
+	assert.Equal(t, []string{"b", "c"}, s.PopExpired(now.Add(3*time.Second)), errorInScheduler)
+	deadline, ok := s.Deadline("a")
+	assert.True(t, ok, errorInScheduler)
+	assert.Equal(t, now.Add(5*time.Second), deadline, errorInScheduler)
+	assert.Equal(t, []string{"a"}, s.PopExpired(now.Add(time.Minute)), errorInScheduler)
+	assert.Equal(t, 0, s.Len(), errorInScheduler)
+}
+
+func TestSchedulerRun(t *testing.T) {
+	s := NewScheduler()
+	go s.Run(func(key string) {
+		schedulerExpired <- key
+	})
+
+	s.Schedule("later", time.Now().Add(time.Hour))
+	s.Schedule("soon", time.Now().Add(50*time.Millisecond))
+	select {
+	case key := <-schedulerExpired:
+		assert.Equal(t, "soon", key, errorInScheduler)
+	case <-time.After(5 * time.Second):
+		t.Error("Deadline not reported")
+	}
+	assert.Equal(t, 1, s.Len(), errorInScheduler)
+}
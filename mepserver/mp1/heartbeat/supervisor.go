@@ -0,0 +1,228 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+	"github.com/apache/servicecomb-service-center/server/core"
+	"github.com/apache/servicecomb-service-center/server/core/backend"
+	"github.com/apache/servicecomb-service-center/server/core/proto"
+	scerr "github.com/apache/servicecomb-service-center/server/error"
+	"github.com/apache/servicecomb-service-center/server/plugin/pkg/discovery"
+	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
+
+	meputil "mepserver/common/util"
+)
+
+var (
+	scheduler            = NewScheduler()
+	elector              = NewElector()
+	suspendedGracePeriod = meputil.DefaultSuspendedGracePeriod
+)
+
+func init() {
+	discovery.AddEventHandler(&EventHandler{})
+}
+
+// Start runs the leader election and the liveness deadline supervision
+func Start() {
+	loadGracePeriod()
+	go elector.Run()
+	go scheduler.Run(onDeadline)
+}
+
+func loadGracePeriod() {
+	value := meputil.GetAppConfigByKey(meputil.SuspendedGracePeriodKey)
+	if len(value) == 0 {
+		return
+	}
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil || gracePeriod < 0 {
+		log.Warnf("Invalid suspended grace period %s, default is used.", value)
+		return
+	}
+	suspendedGracePeriod = gracePeriod
+}
+
+// EventHandler keeps the liveness deadlines of the instances up to date from the registry events, the registration
+// and every liveness update store a new timestamp on the instance
+type EventHandler struct {
+}
+
+// Type event handler type
+func (h *EventHandler) Type() discovery.Type {
+	return backend.INSTANCE
+}
+
+// OnEvent schedules the liveness deadline of the active instances and the deregistration of the suspended ones
+func (h *EventHandler) OnEvent(evt discovery.KvEvent) {
+	instance, ok := evt.KV.Value.(*proto.MicroServiceInstance)
+	if !ok {
+		return
+	}
+	key := string(evt.KV.Key)
+	if evt.Type == proto.EVT_DELETE {
+		scheduler.Cancel(key)
+		return
+	}
+	deadline, ok := supervisionDeadline(instance)
+	if !ok {
+		scheduler.Cancel(key)
+		return
+	}
+	scheduler.Schedule(key, deadline)
+}
+
+// supervisionDeadline time by which the next liveness update of an active instance is expected, or after which a
+// suspended instance is deregistered
+func supervisionDeadline(instance *proto.MicroServiceInstance) (time.Time, bool) {
+	state := instance.Properties["mecState"]
+	if state != meputil.ActiveState && (state != meputil.SuspendedState || suspendedGracePeriod <= 0) {
+		return time.Time{}, false
+	}
+	interval, err := strconv.Atoi(instance.Properties["livenessInterval"])
+	if err != nil || interval <= 0 {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(instance.Properties["timestamp/seconds"], meputil.FormatIntBase, 64)
+	if err != nil {
+		log.Warnf("Timestamp parse failed for service(%s) in heartbeat process.", instance.ServiceId)
+		return time.Time{}, false
+	}
+	buffered := time.Duration(meputil.BufferHeartbeatInterval(interval)) * time.Second
+	deadline := time.Unix(seconds, 0).Add(buffered)
+	if state == meputil.SuspendedState {
+		deadline = deadline.Add(suspendedGracePeriod)
+	}
+	return deadline, true
+}
+
+// onDeadline suspends the instance which missed its liveness update and deregisters the one which stayed suspended,
+// the stored instance is checked again as the deadline may have moved on another replica
+func onDeadline(key string) {
+	if !elector.IsLeader() {
+		// Kept until the leader suspends the service or this replica takes over
+		scheduler.Schedule(key, time.Now().Add(meputil.HeartbeatLeaderRenewInterval))
+		return
+	}
+	instance, err := getInstance(key)
+	if err != nil {
+		log.Errorf(nil, "Get instance for heartbeat failed: %s.", err.Error())
+		scheduler.Schedule(key, time.Now().Add(meputil.HeartbeatLeaderRenewInterval))
+		return
+	}
+	if instance == nil {
+		return
+	}
+	deadline, ok := supervisionDeadline(instance)
+	if !ok {
+		return
+	}
+	if deadline.After(time.Now()) {
+		scheduler.Schedule(key, deadline)
+		return
+	}
+
+	if instance.Properties["mecState"] == meputil.SuspendedState {
+		if err = deregisterInstance(instance); err != nil {
+			log.Errorf(nil, "Deregister suspended service(%s) failed: %s.", instance.ServiceId, err.Error())
+			scheduler.Schedule(key, time.Now().Add(meputil.HeartbeatLeaderRenewInterval))
+			return
+		}
+		log.Infof("Service(%s) stayed suspended beyond the grace period, deregistered.", instance.ServiceId)
+		return
+	}
+	if err = suspendInstance(instance); err != nil {
+		log.Error("Updating service properties for heartbeat failed.", nil)
+		scheduler.Schedule(key, time.Now().Add(meputil.HeartbeatLeaderRenewInterval))
+		return
+	}
+	log.Infof("Service(%s) send to suspended state.", instance.ServiceId)
+}
+
+// suspendInstance persists the SUSPENDED state of the instance
+func suspendInstance(instance *proto.MicroServiceInstance) error {
+	instance.Properties["mecState"] = meputil.SuspendedState
+	req := &proto.UpdateInstancePropsRequest{
+		ServiceId:  instance.ServiceId,
+		InstanceId: instance.InstanceId,
+		Properties: instance.Properties,
+	}
+	_, err := core.InstanceAPI.UpdateInstanceProperties(context.Background(), req)
+	return err
+}
+
+// deregisterInstance removes the instance and its api gateway entries, the subscribers are notified of the removal
+// by the instance delete event
+func deregisterInstance(instance *proto.MicroServiceInstance) error {
+	req := &proto.UnregisterInstanceRequest{
+		ServiceId:  instance.ServiceId,
+		InstanceId: instance.InstanceId,
+	}
+	resp, err := core.InstanceAPI.Unregister(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.Response != nil && resp.Response.Code != proto.Response_SUCCESS &&
+		resp.Response.Code != scerr.ErrInstanceNotExists {
+		return fmt.Errorf("unregister instance failed: %s", resp.Response.Message)
+	}
+	for k, v := range instance.Properties {
+		if strings.HasPrefix(k, meputil.EndPointPropPrefix) {
+			meputil.ApiGWInterface.CleanUpApiGwEntry(v)
+		}
+	}
+	return nil
+}
+
+// getInstance reads the instance stored on the key, nil if it no longer exists
+func getInstance(key string) (*proto.MicroServiceInstance, error) {
+	opts := []registry.PluginOp{
+		registry.OpGet(registry.WithStrKey(key)),
+	}
+	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("query from etcd error")
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	var instance map[string]interface{}
+	if err = json.Unmarshal(resp.Kvs[0].Value, &instance); err != nil {
+		return nil, fmt.Errorf("string convert to instance get failed in heartbeat process")
+	}
+	instance[meputil.ServiceInfoDataCenter] = &proto.DataCenterInfo{Name: "", Region: "", AvailableZone: ""}
+	message, err := json.Marshal(&instance)
+	if err != nil {
+		return nil, fmt.Errorf("instance convert to string failed in heartbeat process")
+	}
+	var ins *proto.MicroServiceInstance
+	if err = json.Unmarshal(message, &ins); err != nil {
+		return nil, fmt.Errorf("string convert to micro service instance failed in heartbeat process")
+	}
+	if ins.Properties == nil {
+		ins.Properties = make(map[string]string)
+	}
+	return ins, nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package heartbeat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey"
+	"github.com/apache/servicecomb-service-center/server/core"
+	"github.com/apache/servicecomb-service-center/server/core/proto"
+	"github.com/apache/servicecomb-service-center/server/plugin/pkg/discovery"
+	"github.com/stretchr/testify/assert"
+
+	meputil "mepserver/common/util"
+)
+
+const (
+	heartbeatServiceId  = "c936bdb887337c15"
+	heartbeatInstanceId = "a8612ca7603ad979"
+	errorInHeartbeat    = "Error in heartbeat supervision"
+)
+
+var (
+	heartbeatInstance     *proto.MicroServiceInstance
+	suspendedInstances    []string
+	deregisteredInstances []string
+)
+
+func newHeartbeatInstance(state string, timestamp time.Time) *proto.MicroServiceInstance {
+	return &proto.MicroServiceInstance{
+		ServiceId:  heartbeatServiceId,
+		InstanceId: heartbeatInstanceId,
+		Properties: map[string]string{
+			"mecState":          state,
+			"livenessInterval":  "10",
+			"timestamp/seconds": strconv.FormatInt(timestamp.Unix(), meputil.FormatIntBase),
+		},
+	}
+}
+
+func newHeartbeatEvent(action proto.EventType, instance *proto.MicroServiceInstance) discovery.KvEvent {
+	return discovery.KvEvent{
+		Type: action,
+		KV: &discovery.KeyValue{
+			Key:   []byte(core.GenerateInstanceKey("default/default", heartbeatServiceId, heartbeatInstanceId)),
+			Value: instance,
+		},
+	}
+}
+
+func patchHeartbeat() *gomonkey.Patches {
+	suspendedInstances = nil
+	deregisteredInstances = nil
+	patches := gomonkey.ApplyFunc(getInstance, func(string) (*proto.MicroServiceInstance, error) {
+		return heartbeatInstance, nil
+	})
+	patches.ApplyFunc(suspendInstance, func(instance *proto.MicroServiceInstance) error {
+		suspendedInstances = append(suspendedInstances, instance.ServiceId+instance.InstanceId)
+		return nil
+	})
+	patches.ApplyFunc(deregisterInstance, func(instance *proto.MicroServiceInstance) error {
+		deregisteredInstances = append(deregisteredInstances, instance.ServiceId+instance.InstanceId)
+		return nil
+	})
+	return patches
+}
+
+func TestHeartbeatEventScheduling(t *testing.T) {
+	key := string(core.GenerateInstanceKey("default/default", heartbeatServiceId, heartbeatInstanceId))
+	handler := &EventHandler{}
+	now := time.Now()
+
+	handler.OnEvent(newHeartbeatEvent(proto.EVT_CREATE, newHeartbeatInstance(meputil.ActiveState, now)))
+	deadline, ok := scheduler.Deadline(key)
+	assert.True(t, ok, errorInHeartbeat)
+	assert.Equal(t, now.Unix()+11, deadline.Unix(), errorInHeartbeat)
+
+	// Liveness update moves the deadline
+	handler.OnEvent(newHeartbeatEvent(proto.EVT_UPDATE, newHeartbeatInstance(meputil.ActiveState,
+		now.Add(10*time.Second))))
+	deadline, _ = scheduler.Deadline(key)
+	assert.Equal(t, now.Unix()+21, deadline.Unix(), errorInHeartbeat)
+
+	// Suspended services are deregistered after the grace period
+	handler.OnEvent(newHeartbeatEvent(proto.EVT_UPDATE, newHeartbeatInstance(meputil.SuspendedState, now)))
+	deadline, _ = scheduler.Deadline(key)
+	assert.Equal(t, now.Add(meputil.DefaultSuspendedGracePeriod).Unix()+11, deadline.Unix(), errorInHeartbeat)
+
+	handler.OnEvent(newHeartbeatEvent(proto.EVT_UPDATE, newHeartbeatInstance(meputil.InactiveState, now)))
+	_, ok = scheduler.Deadline(key)
+	assert.False(t, ok, errorInHeartbeat)
+
+	handler.OnEvent(newHeartbeatEvent(proto.EVT_INIT, newHeartbeatInstance(meputil.ActiveState, now)))
+	handler.OnEvent(newHeartbeatEvent(proto.EVT_DELETE, newHeartbeatInstance(meputil.ActiveState, now)))
+	_, ok = scheduler.Deadline(key)
+	assert.False(t, ok, errorInHeartbeat)
+}
+
+func TestHeartbeatDeadline(t *testing.T) {
+	patches := patchHeartbeat()
+	defer patches.Reset()
+	key := string(core.GenerateInstanceKey("default/default", heartbeatServiceId, heartbeatInstanceId))
+	defer scheduler.Cancel(key)
+
+	// Only the leader suspends the services
+	elector.setLeader(false)
+	heartbeatInstance = newHeartbeatInstance(meputil.ActiveState, time.Now().Add(-time.Minute))
+	onDeadline(key)
+	assert.Empty(t, suspendedInstances, errorInHeartbeat)
+	_, ok := scheduler.Deadline(key)
+	assert.True(t, ok, errorInHeartbeat)
+
+	// Liveness updated meanwhile
+	elector.setLeader(true)
+	defer elector.setLeader(false)
+	heartbeatInstance = newHeartbeatInstance(meputil.ActiveState, time.Now())
+	onDeadline(key)
+	assert.Empty(t, suspendedInstances, errorInHeartbeat)
+	deadline, _ := scheduler.Deadline(key)
+	assert.True(t, deadline.After(time.Now()), errorInHeartbeat)
+
+	heartbeatInstance = newHeartbeatInstance(meputil.ActiveState, time.Now().Add(-time.Minute))
+	onDeadline(key)
+	assert.Equal(t, []string{heartbeatServiceId + heartbeatInstanceId}, suspendedInstances, errorInHeartbeat)
+}
+
+func TestHeartbeatSuspendedGracePeriod(t *testing.T) {
+	patches := patchHeartbeat()
+	defer patches.Reset()
+	key := string(core.GenerateInstanceKey("default/default", heartbeatServiceId, heartbeatInstanceId))
+	defer scheduler.Cancel(key)
+	elector.setLeader(true)
+	defer elector.setLeader(false)
+
+	// Within the grace period
+	heartbeatInstance = newHeartbeatInstance(meputil.SuspendedState, time.Now().Add(-time.Minute))
+	onDeadline(key)
+	assert.Empty(t, deregisteredInstances, errorInHeartbeat)
+	_, ok := scheduler.Deadline(key)
+	assert.True(t, ok, errorInHeartbeat)
+
+	// Reactivated by a liveness update before the deadline
+	heartbeatInstance = newHeartbeatInstance(meputil.ActiveState, time.Now())
+	onDeadline(key)
+	assert.Empty(t, deregisteredInstances, errorInHeartbeat)
+	assert.Empty(t, suspendedInstances, errorInHeartbeat)
+
+	heartbeatInstance = newHeartbeatInstance(meputil.SuspendedState,
+		time.Now().Add(-meputil.DefaultSuspendedGracePeriod-time.Minute))
+	onDeadline(key)
+	assert.Equal(t, []string{heartbeatServiceId + heartbeatInstanceId}, deregisteredInstances, errorInHeartbeat)
+	assert.Empty(t, suspendedInstances, errorInHeartbeat)
+}
@@ -42,8 +42,10 @@ type MepSpace struct {
 	DNSRuleId     string          `json:"dnsRuleId"`
 	TrafficRuleId string          `json:"trafficRuleId"`
 	Flag          bool            `json:"flag"`
+	Hijacked      bool            `json:"hijacked"`
 
-	QueryParam url.Values `json:"queryParam"`
+	QueryParam url.Values       `json:"queryParam"`
+	Filter     *discoveryFilter `json:"filter"`
 
 	CoreRequest interface{}     `json:"coreRequest"`
 	CoreRsp     interface{}     `json:"coreRsp"`
@@ -20,9 +20,11 @@ package mp1
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"mepserver/common/models"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/apache/servicecomb-service-center/pkg/util"
@@ -35,14 +37,37 @@ import (
 	meputil "mepserver/common/util"
 )
 
+// Service discovery query parameters as per ETSI GS MEC 011
+const (
+	serInstanceIdParam     = "ser_instance_id"
+	serNameParam           = "ser_name"
+	serCategoryIdParam     = "ser_category_id"
+	consumedLocalOnlyParam = "consumed_local_only"
+	isLocalParam           = "is_local"
+	scopeOfLocalityParam   = "scope_of_locality"
+)
+
+var scopeOfLocalityValues = []string{"MEC_SYSTEM", "MEC_HOST", "NFVI_POP", "ZONE", "ZONE_GROUP", "NFVI_NODE"}
+
+// discoveryFilter service discovery filters, the attributes are ANDed and the values within a list are ORed
+type discoveryFilter struct {
+	serInstanceIds    []string
+	serNames          []string
+	serCategoryIds    []string
+	consumedLocalOnly *bool
+	isLocal           *bool
+	scopeOfLocality   string
+}
+
 // DiscoverDecode step to handle the service discovery request
 type DiscoverDecode struct {
 	workspace.TaskBase
-	R             *http.Request   `json:"r,in"`
-	Ctx           context.Context `json:"ctx,out"`
-	QueryParam    url.Values      `json:"queryParam,out"`
-	CoreRequest   interface{}     `json:"coreRequest,out"`
-	AppInstanceId string          `json:"appInstanceId,out"`
+	R             *http.Request    `json:"r,in"`
+	Ctx           context.Context  `json:"ctx,out"`
+	QueryParam    url.Values       `json:"queryParam,out"`
+	CoreRequest   interface{}      `json:"coreRequest,out"`
+	AppInstanceId string           `json:"appInstanceId,out"`
+	Filter        *discoveryFilter `json:"filter,out"`
 }
 
 // OnRequest discover decode request
@@ -65,10 +90,16 @@ func (t *DiscoverDecode) GetFindParam(r *http.Request) error {
 		return err
 	}
 
+	filter, err := newDiscoveryFilter(query)
+	if err != nil {
+		t.SetFirstErrorCode(meputil.RequestParamErr, err.Error())
+		return err
+	}
+
 	req := &proto.FindInstancesRequest{
 		ConsumerServiceId: r.Header.Get("X-ConsumerId"),
 		AppId:             query.Get("instance_id"),
-		ServiceName:       query.Get("ser_name"),
+		ServiceName:       strings.Join(filter.serNames, ","),
 		VersionRule:       query.Get("version"),
 		Environment:       query.Get("env"),
 		Tags:              ids,
@@ -84,18 +115,128 @@ func (t *DiscoverDecode) GetFindParam(r *http.Request) error {
 	t.CoreRequest = req
 	t.QueryParam = query
 	t.AppInstanceId = r.Header.Get("X-AppInstanceId")
+	t.Filter = filter
 	return nil
 }
 
+// newDiscoveryFilter validates the discovery query parameters. List parameters can be comma separated or repeated.
+func newDiscoveryFilter(query url.Values) (*discoveryFilter, error) {
+	filter := &discoveryFilter{
+		serInstanceIds:  getQueryList(query, serInstanceIdParam),
+		serNames:        getQueryList(query, serNameParam),
+		serCategoryIds:  getQueryList(query, serCategoryIdParam),
+		scopeOfLocality: query.Get(scopeOfLocalityParam),
+	}
+
+	// Only one of the service identification filters is allowed
+	count := 0
+	for _, list := range [][]string{filter.serInstanceIds, filter.serNames, filter.serCategoryIds} {
+		if len(list) != 0 {
+			count++
+		}
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("%s, %s and %s are mutually exclusive", serInstanceIdParam, serNameParam,
+			serCategoryIdParam)
+	}
+
+	var err error
+	if filter.consumedLocalOnly, err = getQueryBool(query, consumedLocalOnlyParam); err != nil {
+		return nil, err
+	}
+	if filter.isLocal, err = getQueryBool(query, isLocalParam); err != nil {
+		return nil, err
+	}
+	if filter.scopeOfLocality != "" && !meputil.InArray(filter.scopeOfLocality, scopeOfLocalityValues) {
+		return nil, fmt.Errorf("invalid %s", scopeOfLocalityParam)
+	}
+	return filter, nil
+}
+
+func getQueryList(query url.Values, key string) []string {
+	var list []string
+	for _, value := range query[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+func getQueryBool(query url.Values, key string) (*bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, should be true or false", key)
+	}
+	return &flag, nil
+}
+
+// match checks whether the service instance satisfies all the filters
+func (f *discoveryFilter) match(instance *proto.MicroServiceInstance) bool {
+	properties := instance.Properties
+	if properties == nil {
+		properties = map[string]string{}
+	}
+	if len(f.serInstanceIds) != 0 && !meputil.InArray(instance.ServiceId+instance.InstanceId, f.serInstanceIds) {
+		return false
+	}
+	if len(f.serNames) != 0 && !meputil.InArray(properties["serName"], f.serNames) {
+		return false
+	}
+	if len(f.serCategoryIds) != 0 && !meputil.InArray(properties["serCategory/id"], f.serCategoryIds) {
+		return false
+	}
+	if f.consumedLocalOnly != nil && !matchBoolProperty(properties["ConsumedLocalOnly"], *f.consumedLocalOnly) {
+		return false
+	}
+	if f.isLocal != nil && !matchBoolProperty(properties["IsLocal"], *f.isLocal) {
+		return false
+	}
+	if f.scopeOfLocality != "" && !strings.EqualFold(properties["ScopeOfLocality"], f.scopeOfLocality) {
+		return false
+	}
+	return true
+}
+
+// matchBoolProperty missing or invalid property is considered as false
+func matchBoolProperty(property string, expected bool) bool {
+	value, err := strconv.ParseBool(property)
+	if err != nil {
+		value = false
+	}
+	return value == expected
+}
+
+// apply removes the service instances not satisfying the filters
+func (f *discoveryFilter) apply(instances []*proto.MicroServiceInstance) []*proto.MicroServiceInstance {
+	if f == nil {
+		return instances
+	}
+	result := make([]*proto.MicroServiceInstance, 0, len(instances))
+	for _, instance := range instances {
+		if f.match(instance) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
 type DiscoverService struct {
 	workspace.TaskBase
-	Ctx           context.Context `json:"ctx,in"`
-	QueryParam    url.Values      `json:"queryParam,in"`
-	CoreRequest   interface{}     `json:"coreRequest,in"`
-	AppInstanceId string          `json:"appInstanceId,in"`
-	Flag          bool            `json:"flag,out"`
-	InstanceId    string          `json:"instanceId,out"`
-	CoreRsp       interface{}     `json:"coreRsp,out"`
+	Ctx           context.Context  `json:"ctx,in"`
+	QueryParam    url.Values       `json:"queryParam,in"`
+	CoreRequest   interface{}      `json:"coreRequest,in"`
+	AppInstanceId string           `json:"appInstanceId,in"`
+	Filter        *discoveryFilter `json:"filter,in"`
+	Flag          bool             `json:"flag,out"`
+	InstanceId    string           `json:"instanceId,out"`
+	CoreRsp       interface{}      `json:"coreRsp,out"`
 }
 
 func (t *DiscoverService) checkInstanceId(req *proto.FindInstancesRequest) bool {
@@ -155,9 +296,10 @@ func (t *DiscoverService) OnRequest(data string) workspace.TaskCode {
 	if t.QueryParam.Get(meputil.AppInstanceIdStr) == "" {
 		t.Flag = true
 	}
-	if req.ServiceName == "" {
+	// Single service name is looked up with the version rule, all the other filters are applied on all the services
+	if t.Filter == nil || len(t.Filter.serNames) != 1 {
 		var errFindByKey error
-		t.CoreRsp, errFindByKey = meputil.FindInstanceByKey(t.QueryParam)
+		t.CoreRsp, errFindByKey = meputil.FindInstanceByKey(url.Values{})
 		if errFindByKey != nil {
 			log.Error("Failed to find instance.", nil)
 			t.SetFirstErrorCode(meputil.SerErrServiceNotFound, "failed to find the instance")
@@ -173,6 +315,7 @@ func (t *DiscoverService) OnRequest(data string) workspace.TaskCode {
 			t.SetFirstErrorCode(meputil.SerErrServiceNotFound, "instance id not found")
 		}
 		t.filterAppInstanceId()
+		t.applyFilter()
 		return workspace.TaskFinish
 	}
 
@@ -185,9 +328,18 @@ func (t *DiscoverService) OnRequest(data string) workspace.TaskCode {
 	log.Infof("findInstance: %s", findInstance)
 	t.CoreRsp = findInstance
 	t.filterAppInstanceId()
+	t.applyFilter()
 	return workspace.TaskFinish
 }
 
+func (t *DiscoverService) applyFilter() {
+	value, ok := t.CoreRsp.(*proto.FindInstancesResponse)
+	if !ok || value == nil {
+		return
+	}
+	value.Instances = t.Filter.apply(value.Instances)
+}
+
 type ToStrDiscover struct {
 	workspace.TaskBase
 	CoreRsp    interface{}     `json:"coreRsp,in"`
@@ -25,17 +25,18 @@ import (
 	"mepserver/common/models"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
 	scutil "github.com/apache/servicecomb-service-center/pkg/util"
 	"github.com/apache/servicecomb-service-center/server/core"
-	"github.com/apache/servicecomb-service-center/server/core/backend"
 	"github.com/apache/servicecomb-service-center/server/core/proto"
 	scerr "github.com/apache/servicecomb-service-center/server/error"
-	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 	uuid "github.com/satori/go.uuid"
 
 	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
 	"mepserver/common/util"
 )
 
@@ -65,6 +66,10 @@ func (t *SubscribeIst) OnRequest(data string) workspace.TaskCode {
 	if mp1SubscribeInfo == nil {
 		return workspace.TaskFinish
 	}
+	t.SubscribeId = uuid.NewV4().String()
+	if !t.setWebsocketUri(mp1SubscribeInfo) || !t.validateExpiryDeadline(mp1SubscribeInfo) {
+		return workspace.TaskFinish
+	}
 
 	subscribeJSON, err := json.Marshal(mp1SubscribeInfo)
 	if err != nil {
@@ -80,7 +85,6 @@ func (t *SubscribeIst) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 	log.Debugf("Request received for app subscription with appId %s.", t.AppInstanceId)
-	t.SubscribeId = uuid.NewV4().String()
 	err = t.insertOrUpdateData(subscribeJSON)
 	if err != nil {
 		return workspace.TaskFinish
@@ -128,6 +132,74 @@ func (t *SubscribeIst) ValidateCallbackUri(subscribeJSON []byte) bool {
 	}
 	return false
 }
+
+// setWebsocketUri selects the websocket uri for the subscription requesting the notifications over websocket
+func (t *SubscribeIst) setWebsocketUri(sub interface{}) bool {
+	var callback string
+	var config *models.WebsockNotifConfig
+	var location string
+	switch sub := sub.(type) {
+	case *models.SerAvailabilityNotificationSubscription:
+		callback, config = sub.CallbackReference, sub.WebsockNotifConfig
+		location = t.subscriptionLocation()
+	case *models.AppTerminationNotificationSubscription:
+		callback, config = sub.CallbackReference, sub.WebsockNotifConfig
+		location = t.subscriptionLocation()
+	default:
+		return true
+	}
+	if config == nil {
+		return true
+	}
+	if !config.RequestWebsocketUri {
+		log.Error("Websocket config without websocket uri request.", nil)
+		t.SetFirstErrorCode(util.RequestParamErr, "requestWebsocketUri must be true in websockNotifConfig")
+		return false
+	}
+	if len(callback) != 0 {
+		log.Error("Both callback reference and websocket requested.", nil)
+		t.SetFirstErrorCode(util.RequestParamErr, "callbackReference and websockNotifConfig are mutually exclusive")
+		return false
+	}
+	config.WebsocketUri = t.websocketUri(location)
+	return true
+}
+
+// websocketUri absolute uri of the subscription websocket as reached by the app, the scheme and host forwarded by the
+// api gateway take precedence over the ones of the request
+func (t *SubscribeIst) websocketUri(location string) string {
+	scheme := util.WebsocketScheme
+	if t.R.TLS != nil || strings.EqualFold(t.R.Header.Get(util.ForwardedProtoHeader), util.HttpsProtocol) {
+		scheme = util.WebsocketSecureScheme
+	}
+	host := t.R.Header.Get(util.ForwardedHostHeader)
+	if len(host) == 0 {
+		host = t.R.Host
+	}
+	return fmt.Sprintf("%s://%s%s%s%s", scheme, host, util.RootPath, location, util.WebsocketPath)
+}
+
+// validateExpiryDeadline checks the requested expiry deadline is in the future
+func (t *SubscribeIst) validateExpiryDeadline(sub interface{}) bool {
+	var expiryDeadline *models.TimeStamp
+	switch sub := sub.(type) {
+	case *models.SerAvailabilityNotificationSubscription:
+		expiryDeadline = sub.ExpiryDeadline
+	case *models.AppTerminationNotificationSubscription:
+		expiryDeadline = sub.ExpiryDeadline
+	}
+	if expiryDeadline != nil && !expiryDeadline.Time().After(time.Now()) {
+		log.Error("Subscription expiry deadline already passed.", nil)
+		t.SetFirstErrorCode(util.RequestParamErr, "expiryDeadline must be in the future")
+		return false
+	}
+	return true
+}
+
+func (t *SubscribeIst) subscriptionLocation() string {
+	return util.GetSubscriptionLocation(t.SubscribeType, t.AppInstanceId, t.SubscribeId)
+}
+
 func isValidCallbackURI(reference string) bool {
 	_, err := url.ParseRequestURI(reference)
 	if err != nil {
@@ -139,10 +211,8 @@ func isValidCallbackURI(reference string) bool {
 
 func (t *SubscribeIst) marshalError(appInstanceId string) workspace.TaskCode {
 	subKeyPath := util.GetSubscribeKeyPath(t.SubscribeType)
-	opts := []registry.PluginOp{
-		registry.OpDel(registry.WithStrKey(subKeyPath + appInstanceId + "/" + t.SubscribeId)),
-	}
-	_, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	_, err := backend.DB().Txn(context.Background(), nil,
+		[]backend.Op{backend.DeleteOp(subKeyPath+appInstanceId+"/"+t.SubscribeId, false)})
 	if err != nil {
 		log.Errorf(errors.New("delete operation failed"), "Deleting app subscription from etcd failed on error. "+
 			"This might lead to data inconsistency.")
@@ -158,15 +228,13 @@ func (t *SubscribeIst) buildResponse(sub interface{}) {
 
 	switch sub := sub.(type) {
 	case *models.SerAvailabilityNotificationSubscription:
-		location := fmt.Sprintf("%s/applications/%s/subscriptions/%s", util.MecServicePath, t.AppInstanceId,
-			t.SubscribeId)
+		location := t.subscriptionLocation()
 		sub.Links = models.Links{Self: models.Self{Href: location}}
 		sub.SubscriptionId = t.SubscribeId
 		t.W.Header().Set("Location", location)
 		t.HttpRsp = sub
 	case *models.AppTerminationNotificationSubscription:
-		location := fmt.Sprintf("%s/applications/%s/subscriptions/%s", util.MecAppSupportPath, t.AppInstanceId,
-			t.SubscribeId)
+		location := t.subscriptionLocation()
 		sub.Links = models.Links{Self: models.Self{Href: location}}
 		sub.SubscriptionId = t.SubscribeId
 		t.W.Header().Set("Location", location)
@@ -243,10 +311,7 @@ func (t *AppSubscribeLimit) OnRequest(data string) workspace.TaskCode {
 	subscribeKeyPath := util.GetSubscribeKeyPath(t.SubscribeType)
 	appInstanceId := t.AppInstanceId
 
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(subscribeKeyPath+appInstanceId), registry.WithPrefix()),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	resp, err := backend.DB().List(context.Background(), subscribeKeyPath+appInstanceId, backend.ListOptions{})
 	if err != nil {
 		log.Errorf(nil, "Get subscription from etcd failed.")
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "get subscription from etcd failed")
@@ -276,12 +341,8 @@ func (t *SubscribeIst) getMp1SubscribeInfo() interface{} {
 }
 
 func (t *SubscribeIst) insertOrUpdateData(subscribeJSON []byte) error {
-	opts := []registry.PluginOp{
-		registry.OpPut(registry.WithStrKey(util.GetSubscribeKeyPath(t.SubscribeType)+t.AppInstanceId+"/"+
-			t.SubscribeId),
-			registry.WithValue(subscribeJSON)),
-	}
-	_, resultErr := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	key := util.GetSubscribeKeyPath(t.SubscribeType) + t.AppInstanceId + "/" + t.SubscribeId
+	_, resultErr := backend.DB().Txn(context.Background(), nil, []backend.Op{backend.PutOp(key, subscribeJSON)})
 	if resultErr != nil {
 		log.Errorf(nil, "Subscription to etcd failed.")
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "put subscription to etcd failed")
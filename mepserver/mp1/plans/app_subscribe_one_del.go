@@ -22,11 +22,11 @@ import (
 	"net/http"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
-	"github.com/apache/servicecomb-service-center/server/core/backend"
 	"github.com/apache/servicecomb-service-center/server/core/proto"
-	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 
 	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
+	"mepserver/common/notification"
 	"mepserver/common/util"
 )
 
@@ -57,32 +57,31 @@ func (t *DelOneSubscribe) OnRequest(data string) workspace.TaskCode {
 	log.Debugf("Delete request arrived with app subscription with appId %s and subscriptionId %s.",
 		appInstanceId, subscribeId)
 	appSubKeyPath := util.GetSubscribeKeyPath(t.SubscribeType) + appInstanceId + "/" + subscribeId
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(appSubKeyPath)),
-	}
-	resp, errGet := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	record, errGet := backend.DB().Get(context.Background(), appSubKeyPath)
 	if errGet != nil {
 		log.Errorf(nil, "Get subscription from etcd failed.")
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "get subscription from etch failed")
 		return workspace.TaskFinish
 	}
 
-	if len(resp.Kvs) == 0 {
+	if record == nil {
 		log.Errorf(nil, "Subscription does not exist.")
 		t.SetFirstErrorCode(util.SubscriptionNotFound, "subscription not exist")
 		return workspace.TaskFinish
 	}
 
-	opts = []registry.PluginOp{
-		registry.OpDel(registry.WithStrKey(appSubKeyPath)),
-	}
-	_, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	_, err := backend.DB().Txn(context.Background(), nil, []backend.Op{backend.DeleteOp(appSubKeyPath, false)})
 	if err != nil {
 		log.Errorf(nil, "Delete subscription from etcd failed.")
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "delete subscription from etch failed")
 		return workspace.TaskFinish
 	}
 
+	notification.CloseWebsocket(appInstanceId, subscribeId)
+	if errCode := notification.PurgeSubscription(appInstanceId, subscribeId); errCode != 0 {
+		log.Errorf(nil, "Purge notifications of deleted subscription %s failed.", subscribeId)
+	}
+
 	t.HttpRsp = ""
 	log.Debugf("App subscription with appId %s and subscriptionId %s is deleted successfully.",
 		appInstanceId, subscribeId)
@@ -24,11 +24,10 @@ import (
 	"net/http"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
-	"github.com/apache/servicecomb-service-center/server/core/backend"
 	"github.com/apache/servicecomb-service-center/server/core/proto"
-	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 
 	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
 	"mepserver/common/util"
 )
 
@@ -59,18 +58,15 @@ func (t *GetOneSubscribe) OnRequest(data string) workspace.TaskCode {
 	log.Debugf("Query request arrived to fetch the subscription information with  "+
 		"appId %s and subscriptionId %s.", appInstanceId, subscribeId)
 
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(util.GetSubscribeKeyPath(t.SubscribeType) +
-			appInstanceId + "/" + subscribeId)),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	record, err := backend.DB().Get(context.Background(),
+		util.GetSubscribeKeyPath(t.SubscribeType)+appInstanceId+"/"+subscribeId)
 	if err != nil {
 		log.Errorf(nil, "Get subscription from etcd failed.")
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "get subscription from etch failed")
 		return workspace.TaskFinish
 	}
 
-	if len(resp.Kvs) == 0 {
+	if record == nil {
 		log.Errorf(nil, "Subscription doesn't exist.")
 		t.SetFirstErrorCode(util.SubscriptionNotFound, "subscription not exist")
 		return workspace.TaskFinish
@@ -80,12 +76,12 @@ func (t *GetOneSubscribe) OnRequest(data string) workspace.TaskCode {
 	selfPath := t.R.URL.Path[len(util.RootPath):]
 	if t.SubscribeType == util.SerAvailabilityNotificationSubscription {
 		sub := &models.SerAvailabilityNotificationSubscription{}
-		jsonErr = json.Unmarshal(resp.Kvs[0].Value, sub)
+		jsonErr = json.Unmarshal(record.Value, sub)
 		sub.Links.Self.Href = selfPath
 		t.HttpRsp = sub
 	} else {
 		sub := &models.AppTerminationNotificationSubscription{}
-		jsonErr = json.Unmarshal(resp.Kvs[0].Value, sub)
+		jsonErr = json.Unmarshal(record.Value, sub)
 		sub.Links.Self.Href = selfPath
 		t.HttpRsp = sub
 	}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plans implements mep server api plans
+package plans
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+	"github.com/gorilla/websocket"
+
+	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
+	"mepserver/common/models"
+	"mepserver/common/notification"
+	"mepserver/common/util"
+)
+
+var websocketUpgrader = websocket.Upgrader{}
+
+// SubscribeWebsocket steps to connect the websocket requested by a subscription for its notifications
+type SubscribeWebsocket struct {
+	workspace.TaskBase
+	R             *http.Request       `json:"r,in"`
+	W             http.ResponseWriter `json:"w,in"`
+	AppInstanceId string              `json:"appInstanceId,in"`
+	SubscribeId   string              `json:"subscribeId,in"`
+	SubscribeType string              `json:"subscribeType,out"`
+	Hijacked      bool                `json:"hijacked,out"`
+}
+
+// WithType set type and return SubscribeWebsocket
+func (t *SubscribeWebsocket) WithType(subType string) *SubscribeWebsocket {
+	t.SubscribeType = subType
+	return t
+}
+
+// OnRequest handles the websocket connect request
+func (t *SubscribeWebsocket) OnRequest(data string) workspace.TaskCode {
+	appSubKeyPath := util.GetSubscribeKeyPath(t.SubscribeType) + t.AppInstanceId + "/" + t.SubscribeId
+	record, err := backend.DB().Get(context.Background(), appSubKeyPath)
+	if err != nil {
+		log.Errorf(nil, "Get subscription from etcd failed.")
+		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "get subscription from etcd failed")
+		return workspace.TaskFinish
+	}
+	if record == nil {
+		log.Errorf(nil, "Subscription does not exist.")
+		t.SetFirstErrorCode(util.SubscriptionNotFound, "subscription not exist")
+		return workspace.TaskFinish
+	}
+
+	var sub struct {
+		Links              models.Links               `json:"_links"`
+		WebsockNotifConfig *models.WebsockNotifConfig `json:"websockNotifConfig"`
+	}
+	if err = json.Unmarshal(record.Value, &sub); err != nil {
+		log.Errorf(nil, "Subscription parse failed.")
+		t.SetFirstErrorCode(util.ParseInfoErr, "parse subscription failed")
+		return workspace.TaskFinish
+	}
+	if sub.WebsockNotifConfig == nil || len(sub.WebsockNotifConfig.WebsocketUri) == 0 {
+		log.Errorf(nil, "Websocket not requested by the subscription.")
+		t.SetFirstErrorCode(util.RequestParamErr, "websocket not requested by the subscription")
+		return workspace.TaskFinish
+	}
+	if !websocket.IsWebSocketUpgrade(t.R) {
+		log.Errorf(nil, "Not a websocket upgrade request.")
+		t.SetFirstErrorCode(util.RequestParamErr, "websocket upgrade required")
+		return workspace.TaskFinish
+	}
+
+	// The upgrader responds to the request on failure as well
+	t.Hijacked = true
+	conn, err := websocketUpgrader.Upgrade(t.W, t.R, nil)
+	if err != nil {
+		log.Errorf(nil, "Websocket upgrade failed.")
+		return workspace.TaskFinish
+	}
+	if err = notification.AttachWebsocket(t.AppInstanceId, t.SubscribeId, sub.Links.Self.Href, conn); err != nil {
+		log.Errorf(nil, "Websocket handshake failed for subscription %s: %s.", t.SubscribeId, err.Error())
+		return workspace.TaskFinish
+	}
+	log.Debugf("Websocket connected for subscription with appId %s and subscriptionId %s.",
+		t.AppInstanceId, t.SubscribeId)
+	return workspace.TaskFinish
+}
@@ -26,11 +26,10 @@ import (
 	"path"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
-	"github.com/apache/servicecomb-service-center/server/core/backend"
 	"github.com/apache/servicecomb-service-center/server/core/proto"
-	"github.com/apache/servicecomb-service-center/server/plugin/pkg/registry"
 
 	"mepserver/common/arch/workspace"
+	"mepserver/common/extif/backend"
 	"mepserver/common/util"
 )
 
@@ -60,10 +59,7 @@ func (t *GetSubscribes) OnRequest(data string) workspace.TaskCode {
 	appInstanceId := t.AppInstanceId
 	log.Debugf("Query request arrived to fetch all the %s information for appId %s.", t.SubscribeType, appInstanceId)
 
-	opts := []registry.PluginOp{
-		registry.OpGet(registry.WithStrKey(subscribeKeyPath+appInstanceId), registry.WithPrefix()),
-	}
-	resp, err := backend.Registry().TxnWithCmp(context.Background(), opts, nil, nil)
+	resp, err := backend.DB().List(context.Background(), subscribeKeyPath+appInstanceId, backend.ListOptions{})
 	if err != nil {
 		log.Errorf(nil, "Get subscription from etcd failed.")
 		t.SetFirstErrorCode(util.OperateDataWithEtcdErr, "get subscription from etcd failed")
@@ -73,7 +69,7 @@ func (t *GetSubscribes) OnRequest(data string) workspace.TaskCode {
 	var subs []models.Subscription
 	selfPath := t.R.URL.Path[len(util.RootPath):]
 	for _, value := range resp.Kvs {
-		u, err := url.Parse(string(value.Key))
+		u, err := url.Parse(value.Key)
 		if err != nil {
 			log.Error("Parse URL value failed.", nil)
 			t.SetFirstErrorCode(util.ParseInfoErr, "parse value failed")
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"mepserver/common/extif/dataplane"
 	"mepserver/common/models"
+	"net/http"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
 
@@ -32,9 +33,10 @@ import (
 // DNSRuleGet step to read a single dns rule
 type DNSRuleGet struct {
 	workspace.TaskBase
-	AppInstanceId string      `json:"appInstanceId,in"`
-	DNSRuleId     string      `json:"dnsRuleId,in"`
-	HttpRsp       interface{} `json:"httpRsp,out"`
+	W             http.ResponseWriter `json:"w,in"`
+	AppInstanceId string              `json:"appInstanceId,in"`
+	DNSRuleId     string              `json:"dnsRuleId,in"`
+	HttpRsp       interface{}         `json:"httpRsp,out"`
 }
 
 // OnRequest handles dns rule query
@@ -76,6 +78,9 @@ func (t *DNSRuleGet) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 
+	if dnsOnStoreBytes, err := json.Marshal(dnsOnStore); err == nil {
+		t.W.Header().Set(util.ETagHeader, util.GenerateStrongETag(dnsOnStoreBytes))
+	}
 	t.HttpRsp = dnsOnStore
 	return workspace.TaskFinish
 }
@@ -164,6 +164,7 @@ type DNSRuleUpdate struct {
 	dnsAgent      dns.DNSAgent
 	dataPlane     dataplane.DataPlane
 	AppName       string
+	revision      int64
 }
 
 // WithDNSAgent inputs dns agent
@@ -184,7 +185,7 @@ func (t *DNSRuleUpdate) OnRequest(data string) workspace.TaskCode {
 	log.Debugf("update request arrived for dns rule %s and appId %s.", t.DNSRuleId, t.AppInstanceId)
 
 	// Read dns entry from data-store
-	appDConfigEntry, errCode := backend.GetRecord(meputil.AppDConfigKeyPath + t.AppInstanceId)
+	appDConfigEntry, revision, errCode := backend.GetRecordWithRevision(meputil.AppDConfigKeyPath + t.AppInstanceId)
 	if errCode != 0 {
 		log.Errorf(errors.New("get operation failed"),
 			"Dns rule retrieval from data-store failed on update request.")
@@ -218,6 +219,7 @@ func (t *DNSRuleUpdate) OnRequest(data string) workspace.TaskCode {
 	}
 
 	t.AppName = appDInStore.AppName
+	t.revision = revision
 
 	dataOnStoreBytes, err := json.Marshal(dnsOnStore)
 	if err != nil {
@@ -227,8 +229,8 @@ func (t *DNSRuleUpdate) OnRequest(data string) workspace.TaskCode {
 	}
 
 	// Check for E-Tags precondition. More details could be found here: https://tools.ietf.org/html/rfc7232#section-2.3
-	ifMatchTag := t.R.Header.Get("If-Match")
-	if len(ifMatchTag) != 0 && ifMatchTag != meputil.GenerateStrongETag(dataOnStoreBytes) {
+	if !meputil.CheckETagPreconditions(t.R, meputil.GenerateStrongETag(dataOnStoreBytes)) {
+		log.Warn("E-Tag miss-match.")
 		t.SetFirstErrorCode(meputil.EtagMissMatchErr, "e-tag miss-match")
 		return workspace.TaskFinish
 	}
@@ -282,7 +284,7 @@ func (t *DNSRuleUpdate) updateDnsRecordToRemoteServer(appDConfig models.AppDConf
 	}
 
 	if dnsOnStore.State == dnsConfigInput.State {
-		t.W.Header().Set("ETag", meputil.GenerateStrongETag(dataOnStoreBytes))
+		t.W.Header().Set(meputil.ETagHeader, meputil.GenerateStrongETag(dataOnStoreBytes))
 		t.HttpRsp = dnsOnStore
 		return -1, ""
 	}
@@ -293,7 +295,7 @@ func (t *DNSRuleUpdate) updateDnsRecordToRemoteServer(appDConfig models.AppDConf
 
 	dnsOnStore.State = dnsConfigInput.State
 	appDConfig.AppDNSRule[ruleIndex].State = dnsConfigInput.State
-	errCode, errString := t.updateDnsRecordOnDataStore(appDConfig)
+	errCode, errString := t.updateDnsRecordOnDataStoreIfUnchanged(appDConfig)
 	if errCode != 0 {
 		return errCode, errString
 	}
@@ -344,7 +346,7 @@ func (t *DNSRuleUpdate) updateDnsRecordToRemoteServer(appDConfig models.AppDConf
 	// State updated on dnsOnStore, so regenerate the byte array
 	dataOnStoreBytes, err = json.Marshal(dnsOnStore)
 	if err == nil {
-		t.W.Header().Set("ETag", meputil.GenerateStrongETag(dataOnStoreBytes))
+		t.W.Header().Set(meputil.ETagHeader, meputil.GenerateStrongETag(dataOnStoreBytes))
 	}
 
 	t.HttpRsp = dnsOnStore
@@ -388,6 +390,24 @@ func (t *DNSRuleUpdate) updateDnsRecordOnDataStore(appDConfig models.AppDConfig)
 	return 0, ""
 }
 
+// Update the dns record to the data-store only if it was not modified since it was read
+func (t *DNSRuleUpdate) updateDnsRecordOnDataStoreIfUnchanged(appDConfig models.AppDConfig) (int, string) {
+	updateJSON, err := json.Marshal(appDConfig)
+	if err != nil {
+		return meputil.ParseInfoErr, "output rule parse failed"
+	}
+	key := meputil.AppDConfigKeyPath + t.AppInstanceId
+	errCode := backend.PutRecordIfRevision(key, updateJSON, key, t.revision)
+	if errCode == meputil.EtagMissMatchErr {
+		return errCode, "dns rule modified concurrently"
+	}
+	if errCode != 0 {
+		return errCode, "rule insertion failed"
+	}
+
+	return 0, ""
+}
+
 func (t *DNSRuleUpdate) updateDNSToDataPlane(dnsConfigInput *dataplane.DNSRule, dnsOnStore *dataplane.DNSRule,
 	appInfo dataplane.ApplicationInfo, rrType string) error {
 	var err error
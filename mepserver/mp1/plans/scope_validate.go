@@ -0,0 +1,51 @@
+/*
+ * Copyright 2021 Huawei Technologies Co., Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plans implements mep server api plans
+package plans
+
+import (
+	"net/http"
+
+	"github.com/apache/servicecomb-service-center/pkg/log"
+
+	"mepserver/common/arch/workspace"
+	meputil "mepserver/common/util"
+)
+
+// ValidateScope step to validate the operation scope granted by the access token of the app
+type ValidateScope struct {
+	workspace.TaskBase
+	R     *http.Request `json:"r,in"`
+	scope string
+}
+
+// WithScope sets the scope required by the operation
+func (t *ValidateScope) WithScope(scope string) *ValidateScope {
+	t.scope = scope
+	return t
+}
+
+// OnRequest validates the scope of the access token
+func (t *ValidateScope) OnRequest(data string) workspace.TaskCode {
+	err := meputil.ValidateTokenScope(t.scope, t.R)
+	if err != nil {
+		log.Errorf(nil, "Scope validation failed from ClientIP [%s] Operation [%s] Resource [%s]: %s.",
+			meputil.GetClientIp(t.R), meputil.GetMethodFromReq(t.R), meputil.GetHttpResourceInfo(t.R), err.Error())
+		t.SetFirstErrorCode(meputil.ForbiddenOperation, err.Error())
+	}
+	return workspace.TaskFinish
+}
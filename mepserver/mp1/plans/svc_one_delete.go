@@ -19,12 +19,11 @@ package plans
 
 import (
 	"context"
+	"net/http"
 	"strings"
 
 	"github.com/apache/servicecomb-service-center/pkg/log"
-	"github.com/apache/servicecomb-service-center/server/core"
 	"github.com/apache/servicecomb-service-center/server/core/proto"
-	scerr "github.com/apache/servicecomb-service-center/server/error"
 
 	"mepserver/common/arch/workspace"
 	"mepserver/common/util"
@@ -34,6 +33,7 @@ import (
 type DeleteService struct {
 	HttpErrInf *proto.Response `json:"httpErrInf,out"`
 	workspace.TaskBase
+	R         *http.Request   `json:"r,in"`
 	Ctx       context.Context `json:"ctx,in"`
 	ServiceId string          `json:"serviceId,in"`
 	HttpRsp   interface{}     `json:"httpRsp,out"`
@@ -46,39 +46,43 @@ func (t *DeleteService) OnRequest(data string) workspace.TaskCode {
 		t.SetFirstErrorCode(util.SerErrServiceDelFailed, "param is empty")
 		return workspace.TaskFinish
 	}
-	instance, err := util.GetServiceInstance(t.Ctx, t.ServiceId)
+	instance, revision, err := util.GetServiceInstanceWithRevision(t.Ctx, t.ServiceId)
 	if err != nil {
-		log.Error("Find service on update failed.", nil)
+		log.Error("Find service on delete failed.", nil)
 		t.SetFirstErrorCode(util.SerInstanceNotFound, "find service failed")
 		return workspace.TaskFinish
 	}
-	for k, v := range instance.Properties {
-		if !strings.HasPrefix(k, util.EndPointPropPrefix) {
-			continue
-		}
-		delete(instance.Properties, k)
-		util.ApiGWInterface.CleanUpApiGwEntry(v)
+	if !util.CheckETagPreconditions(t.R, serviceInfoETag(instance)) {
+		log.Warn("E-Tag miss-match.")
+		t.SetFirstErrorCode(util.EtagMissMatchErr, "e-tag miss-match")
+		return workspace.TaskFinish
 	}
 
 	serviceID := t.ServiceId[:len(t.ServiceId)/2]
 	log.Debugf("Delete request arrived for service with serviceId %s.", serviceID)
 	instanceID := t.ServiceId[len(t.ServiceId)/2:]
-	req := &proto.UnregisterInstanceRequest{
-		ServiceId:  serviceID,
-		InstanceId: instanceID,
-	}
-	resp, err := core.InstanceAPI.Unregister(t.Ctx, req)
-	if err != nil {
-		log.Errorf(nil, "Service(id: %s) delete failed.", req.ServiceId)
-		t.SetFirstErrorCode(util.SerErrServiceInstanceFailed, "service delete failed")
+	// Deleted with the revision the e-tag was checked against, a concurrent update fails the delete
+	errCode := util.DeleteInstanceIfRevision(t.Ctx, serviceID, instanceID, revision)
+	switch errCode {
+	case 0:
+	case util.EtagMissMatchErr:
+		log.Warn("Service modified concurrently on delete.")
+		t.SetFirstErrorCode(util.EtagMissMatchErr, "service modified concurrently")
 		return workspace.TaskFinish
-	}
-	if resp != nil && resp.Response.Code == scerr.ErrInstanceNotExists {
+	case util.SerInstanceNotFound:
 		log.Error("Instance not found on service delete request.", nil)
 		t.SetFirstErrorCode(util.SerInstanceNotFound, "instance not found")
 		return workspace.TaskFinish
+	default:
+		log.Errorf(nil, "Service(id: %s) delete failed.", serviceID)
+		t.SetFirstErrorCode(util.SerErrServiceInstanceFailed, "service delete failed")
+		return workspace.TaskFinish
+	}
+	for k, v := range instance.Properties {
+		if strings.HasPrefix(k, util.EndPointPropPrefix) {
+			util.ApiGWInterface.CleanUpApiGwEntry(v)
+		}
 	}
-	t.HttpErrInf = resp.Response
 	t.HttpRsp = ""
 	log.Debugf("Service with serviceId %s is deleted successfully.", serviceID)
 	return workspace.TaskFinish
@@ -98,11 +98,12 @@ func (t *GetOneDecode) getFindParam(r *http.Request) (context.Context, *proto.Ge
 // GetOneInstance step to retrieve service entry
 type GetOneInstance struct {
 	workspace.TaskBase
-	HttpErrInf    *proto.Response `json:"httpErrInf,out"`
-	Ctx           context.Context `json:"ctx,in"`
-	CoreRequest   interface{}     `json:"coreRequest,in"`
-	HttpRsp       interface{}     `json:"httpRsp,out"`
-	AppInstanceId string          `json:"appInstanceId,in"`
+	HttpErrInf    *proto.Response     `json:"httpErrInf,out"`
+	W             http.ResponseWriter `json:"w,in"`
+	Ctx           context.Context     `json:"ctx,in"`
+	CoreRequest   interface{}         `json:"coreRequest,in"`
+	HttpRsp       interface{}         `json:"httpRsp,out"`
+	AppInstanceId string              `json:"appInstanceId,in"`
 }
 
 // OnRequest handle the service query
@@ -133,12 +134,13 @@ func (t *GetOneInstance) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 	t.HttpRsp = mp1Rsp
-	_, err := json.Marshal(mp1Rsp)
+	mp1RspBytes, err := json.Marshal(mp1Rsp)
 	if err != nil {
 		log.Error("Service info marshalling failed.", nil)
 		t.SetFirstErrorCode(meputil.ParseInfoErr, "marshal service info failed")
 		return workspace.TaskFinish
 	}
+	t.W.Header().Set(meputil.ETagHeader, meputil.GenerateStrongETag(mp1RspBytes))
 	log.Debugf("Response for service information with subscriptionId %s.", req.ProviderServiceId)
 	return workspace.TaskFinish
 }
@@ -19,26 +19,29 @@ package plans
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+
 	"github.com/apache/servicecomb-service-center/pkg/log"
-	"github.com/apache/servicecomb-service-center/pkg/util"
 	"github.com/apache/servicecomb-service-center/server/core/proto"
-	svcutil "github.com/apache/servicecomb-service-center/server/service/util"
-	"mepserver/common/models"
 
 	"mepserver/common/arch/workspace"
+	"mepserver/common/models"
 	meputil "mepserver/common/util"
 )
 
 // UpdateInstance step to handle update request
 type UpdateInstance struct {
 	workspace.TaskBase
-	HttpErrInf    *proto.Response `json:"httpErrInf,out"`
-	Ctx           context.Context `json:"ctx,in"`
-	ServiceId     string          `json:"serviceId,in"`
-	RestBody      interface{}     `json:"restBody,in"`
-	HttpRsp       interface{}     `json:"httpRsp,out"`
-	AppInstanceId string          `json:"appInstanceId,in"`
+	HttpErrInf    *proto.Response     `json:"httpErrInf,out"`
+	R             *http.Request       `json:"r,in"`
+	W             http.ResponseWriter `json:"w,in"`
+	Ctx           context.Context     `json:"ctx,in"`
+	ServiceId     string              `json:"serviceId,in"`
+	RestBody      interface{}         `json:"restBody,in"`
+	HttpRsp       interface{}         `json:"httpRsp,out"`
+	AppInstanceId string              `json:"appInstanceId,in"`
 }
 
 // OnRequest handles service update request
@@ -54,12 +57,17 @@ func (t *UpdateInstance) OnRequest(data string) workspace.TaskCode {
 		t.SetFirstErrorCode(meputil.RequestParamErr, "request body invalid")
 		return workspace.TaskFinish
 	}
-	instance, err := meputil.GetServiceInstance(t.Ctx, t.ServiceId)
+	instance, revision, err := meputil.GetServiceInstanceWithRevision(t.Ctx, t.ServiceId)
 	if err != nil {
 		log.Error("Find service on update failed.", nil)
 		t.SetFirstErrorCode(meputil.SerInstanceNotFound, "find service failed")
 		return workspace.TaskFinish
 	}
+	if !meputil.CheckETagPreconditions(t.R, serviceInfoETag(instance)) {
+		log.Warn("E-Tag miss-match.")
+		t.SetFirstErrorCode(meputil.EtagMissMatchErr, "e-tag miss-match")
+		return workspace.TaskFinish
+	}
 
 	copyInstanceRef := *instance
 	req := proto.RegisterInstanceRequest{
@@ -73,9 +81,13 @@ func (t *UpdateInstance) OnRequest(data string) workspace.TaskCode {
 		req.Instance.Properties["liveness"] = fmt.Sprintf(meputil.LivenessPath, t.AppInstanceId,
 			instance.ServiceId+instance.InstanceId)
 	}
-	domainProject := util.ParseDomainProject(t.Ctx)
-	centerErr := svcutil.UpdateInstance(t.Ctx, domainProject, &copyInstanceRef)
-	if centerErr != nil {
+	errCode := meputil.UpdateInstanceIfRevision(t.Ctx, &copyInstanceRef, revision)
+	if errCode == meputil.EtagMissMatchErr {
+		log.Warn("Service modified concurrently on update.")
+		t.SetFirstErrorCode(meputil.EtagMissMatchErr, "service modified concurrently")
+		return workspace.TaskFinish
+	}
+	if errCode != 0 {
 		log.Error("Update service failed.", nil)
 		t.SetFirstErrorCode(meputil.SerErrServiceUpdFailed, "update service failed")
 		return workspace.TaskFinish
@@ -88,6 +100,18 @@ func (t *UpdateInstance) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 	mp1Ser.SerInstanceId = instance.ServiceId + instance.InstanceId
+	t.W.Header().Set(meputil.ETagHeader, serviceInfoETag(&copyInstanceRef))
 	t.HttpRsp = mp1Ser
 	return workspace.TaskFinish
 }
+
+// serviceInfoETag strong e-tag of the service information representation of the instance
+func serviceInfoETag(instance *proto.MicroServiceInstance) string {
+	serviceInfo := &models.ServiceInfo{}
+	serviceInfo.FromServiceInstance(instance)
+	serviceInfoBytes, err := json.Marshal(serviceInfo)
+	if err != nil {
+		return ""
+	}
+	return meputil.GenerateStrongETag(serviceInfoBytes)
+}
@@ -163,9 +163,10 @@ func (t *DecodeTrafficRestReq) getParam(r *http.Request) error {
 // TrafficRuleGet steps to query the traffic rules
 type TrafficRuleGet struct {
 	workspace.TaskBase
-	AppInstanceId string      `json:"appInstanceId,in"`
-	TrafficRuleId string      `json:"trafficRuleId,in"`
-	HttpRsp       interface{} `json:"httpRsp,out"`
+	W             http.ResponseWriter `json:"w,in"`
+	AppInstanceId string              `json:"appInstanceId,in"`
+	TrafficRuleId string              `json:"trafficRuleId,in"`
+	HttpRsp       interface{}         `json:"httpRsp,out"`
 }
 
 // OnRequest handles the traffic rule query
@@ -205,6 +206,9 @@ func (t *TrafficRuleGet) OnRequest(data string) workspace.TaskCode {
 		t.SetFirstErrorCode(meputil.SubscriptionNotFound, "traffic rule does not exist")
 		return workspace.TaskFinish
 	}
+	if trafficRuleBytes, err := json.Marshal(trafficRule); err == nil {
+		t.W.Header().Set(meputil.ETagHeader, meputil.GenerateStrongETag(trafficRuleBytes))
+	}
 	t.HttpRsp = trafficRule
 	return workspace.TaskFinish
 }
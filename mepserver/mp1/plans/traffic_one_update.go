@@ -43,6 +43,7 @@ type TrafficRuleUpdate struct {
 	TrafficRuleId string              `json:"trafficRuleId,in"`
 	HttpRsp       interface{}         `json:"httpRsp,out"`
 	dataPlane     dataplane.DataPlane
+	revision      int64
 }
 
 // WithDataPlane inputs the data plane instance
@@ -66,7 +67,7 @@ func (t *TrafficRuleUpdate) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 
-	appDConfigDB, errCode := backend.GetRecord(meputil.AppDConfigKeyPath + t.AppInstanceId)
+	appDConfigDB, revision, errCode := backend.GetRecordWithRevision(meputil.AppDConfigKeyPath + t.AppInstanceId)
 	if errCode != 0 {
 		log.Errorf(nil, "Update traffic rules failed.")
 		t.SetFirstErrorCode(workspace.ErrCode(errCode), "update rule retrieval failed")
@@ -97,11 +98,6 @@ func (t *TrafficRuleUpdate) OnRequest(data string) workspace.TaskCode {
 		return workspace.TaskFinish
 	}
 
-	if reflect.DeepEqual(trafficRule, trafficInPut) {
-		t.HttpRsp = trafficInPut
-		return workspace.TaskFinish
-	}
-
 	dataStoreEntryBytes, err := json.Marshal(trafficRule)
 	if err != nil {
 		log.Errorf(err, "Traffic rule parse failed.")
@@ -110,13 +106,19 @@ func (t *TrafficRuleUpdate) OnRequest(data string) workspace.TaskCode {
 	}
 
 	// Check for E-Tags precondition. More details could be found here: https://tools.ietf.org/html/rfc7232#section-2.3
-	ifMatchTag := t.R.Header.Get("If-Match")
-	if len(ifMatchTag) != 0 && ifMatchTag != meputil.GenerateStrongETag(dataStoreEntryBytes) {
+	if !meputil.CheckETagPreconditions(t.R, meputil.GenerateStrongETag(dataStoreEntryBytes)) {
 		log.Warn("E-Tag miss-match.")
 		t.SetFirstErrorCode(meputil.EtagMissMatchErr, "e-tag miss-match")
 		return workspace.TaskFinish
 	}
 
+	if reflect.DeepEqual(trafficRule, trafficInPut) {
+		t.W.Header().Set(meputil.ETagHeader, meputil.GenerateStrongETag(dataStoreEntryBytes))
+		t.HttpRsp = trafficInPut
+		return workspace.TaskFinish
+	}
+	t.revision = revision
+
 	if len(trafficInPut.TrafficRuleID) != 0 && trafficRule.TrafficRuleID != trafficInPut.TrafficRuleID {
 		log.Warn("Traffic identifier miss-match.")
 		t.SetFirstErrorCode(meputil.ParseInfoErr, "traffic identifier miss-match")
@@ -144,7 +146,11 @@ func (t *TrafficRuleUpdate) applyTrafficRule(trafficRule *dataplane.TrafficRule,
 		return meputil.ParseInfoErr, "can not marshal traffic info"
 	}
 
-	resultErr := backend.PutRecord(meputil.AppDConfigKeyPath+t.AppInstanceId, updateJSON)
+	key := meputil.AppDConfigKeyPath + t.AppInstanceId
+	resultErr := backend.PutRecordIfRevision(key, updateJSON, key, t.revision)
+	if resultErr == meputil.EtagMissMatchErr {
+		return resultErr, "traffic rule modified concurrently"
+	}
 	if resultErr != 0 {
 		log.Errorf(nil, "Traffic rule(appId: %s, ruleId: %s) update on etcd failed, "+
 			"this will lead to data inconsistency.", t.AppInstanceId,
@@ -182,7 +188,9 @@ func (t *TrafficRuleUpdate) applyTrafficRule(trafficRule *dataplane.TrafficRule,
 		return 0, ""
 	}
 
-	t.W.Header().Set("ETag", meputil.GenerateStrongETag(updateJSON))
+	if trafficRuleBytes, err := json.Marshal(trafficInPut); err == nil {
+		t.W.Header().Set(meputil.ETagHeader, meputil.GenerateStrongETag(trafficRuleBytes))
+	}
 	t.HttpRsp = trafficInPut
 	return 0, ""
 }